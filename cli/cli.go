@@ -11,6 +11,12 @@ Usage: esm.sh [command] [options]
 
 Commands:
   add [...imports]      Add imports to the "importmap" script in index.html
+  install               Resolve the "importmap" script with the versions locked in esm.lock
+  remove [...imports]   Remove imports from the "importmap" script in index.html
+  update [...packages]  Update imports of the "importmap" script in index.html
+  outdated              Check outdated imports of the "importmap" script in index.html
+  why <package>         Explain why the versions of a package are in the "importmap" script
+  vendor                Download the modules of the "importmap" script for offline use
   tidy                  Clean up and optimize the "importmap" script in index.html
 
 Options:
@@ -26,6 +32,18 @@ func Run() {
 	switch command := os.Args[1]; command {
 	case "add":
 		Add()
+	case "install", "i":
+		Install()
+	case "remove":
+		Remove()
+	case "update":
+		Update()
+	case "outdated":
+		Outdated()
+	case "why":
+		Why()
+	case "vendor":
+		Vendor()
 	case "tidy":
 		Tidy()
 	case "version":
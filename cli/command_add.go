@@ -1,21 +1,19 @@
 package cli
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/esm-dev/esm.sh/internal/importmap"
+	"github.com/esm-dev/esm.sh/importmap"
 	"github.com/ije/gox/set"
 	"github.com/ije/gox/term"
-	"golang.org/x/net/html"
 )
 
 const addHelpMessage = `Add imports to the "importmap" in index.html
@@ -28,6 +26,7 @@ Examples:
   esm.sh add react@19.0.0      ` + "\033[30m # use exact version \033[0m" + `
   esm.sh add react/jsx-runtime ` + "\033[30m # specifiy a sub-module \033[0m" + `
   esm.sh add --all react       ` + "\033[30m # include all sub-modules of the import\033[0m" + `
+  esm.sh add --file importmap.json react ` + "\033[30m # add to the importmap.json file\033[0m" + `
 
 Arguments:
   ...imports     Imports to add
@@ -36,6 +35,11 @@ Options:
 	--all, -a      Add all sub-modules of the import without prompt
 	--no-sri       No "integrity" attribute added
 	--no-prompt    Add imports without prompt
+	--preload      Add "modulepreload" hints of the static dependency graph to the HTML file
+	--preload-limit <n>
+	               The maximum number of "modulepreload" hints, default is 10
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html.
+	               Use it multiple times to sync the import map to other files.
   --help, -h     Show help message
 `
 
@@ -69,6 +73,9 @@ func Add() {
 	a := flag.Bool("a", false, "add all modules of the import")
 	noPrompt := flag.Bool("no-prompt", false, "add imports without prompt")
 	noSRI := flag.Bool("no-sri", false, "do not generate SRI for the import")
+	preload := flag.Bool("preload", false, "add modulepreload hints to the HTML file")
+	preloadLimit := flag.Int("preload-limit", defaultPreloadLimit, "the maximum number of modulepreload hints")
+	files := fileFlag()
 	specifiers, help := parseCommandFlags()
 
 	if help || len(specifiers) == 0 {
@@ -76,114 +83,32 @@ func Add() {
 		return
 	}
 
-	err := updateImportMap(set.New(specifiers...).Values(), *all || *a, *noPrompt, *noSRI)
+	err := updateImportMap(*files, set.New(specifiers...).Values(), *all || *a, *noPrompt, *noSRI, *preload, *preloadLimit)
 	if err != nil {
 		fmt.Println(term.Red("✖︎"), "Failed to add imports: "+err.Error())
 	}
 }
 
-func updateImportMap(specifiers []string, all bool, noPrompt bool, noSRI bool) (err error) {
-	indexHtml, exists, err := lookupClosestFile("index.html")
+func updateImportMap(filenames []string, specifiers []string, all bool, noPrompt bool, noSRI bool, preload bool, preloadLimit int) (err error) {
+	source, files, err := loadImportMapFiles(filenames)
 	if err != nil {
 		return
 	}
 
-	if exists {
-		var f *os.File
-		f, err = os.Open(indexHtml)
-		if err != nil {
+	created := false
+	if !source.exists && source.format == "html" {
+		source.data = fmt.Appendf(nil, htmlTemplate, "", specifiers[0])
+		if _, err = source.parseHtml(); err != nil {
 			return
 		}
-		tokenizer := html.NewTokenizer(f)
-		buf := bytes.NewBuffer(nil)
-		updated := false
-		for {
-			token := tokenizer.Next()
-			if token == html.ErrorToken && tokenizer.Err() == io.EOF {
-				break
-			}
-			if token == html.EndTagToken {
-				tagName, _ := tokenizer.TagName()
-				if string(tagName) == "head" && !updated {
-					buf.WriteString("  <script type=\"importmap\">\n")
-					var importMap importmap.ImportMap
-					if addImports(&importMap, specifiers, all, noPrompt, noSRI) {
-						buf.WriteString(importMap.FormatJSON(2))
-						buf.WriteString("\n  </script>\n")
-					}
-					buf.Write(tokenizer.Raw())
-					updated = true
-					continue
-				}
-			}
-			if token == html.StartTagToken {
-				tagName, moreAttr := tokenizer.TagName()
-				if string(tagName) == "script" && moreAttr {
-					var typeAttr string
-					for moreAttr {
-						var key, val []byte
-						key, val, moreAttr = tokenizer.TagAttr()
-						if string(key) == "type" {
-							typeAttr = string(val)
-							break
-						}
-					}
-					if typeAttr != "importmap" && !updated {
-						buf.WriteString("<script type=\"importmap\">\n")
-						importMap := importmap.Blank()
-						if addImports(importMap, specifiers, all, noPrompt, noSRI) {
-							buf.WriteString(importMap.FormatJSON(2))
-							buf.WriteString("\n  </script>\n  ")
-						}
-						buf.Write(tokenizer.Raw())
-						updated = true
-						continue
-					}
-					if typeAttr == "importmap" && !updated {
-						buf.Write(tokenizer.Raw())
-						token := tokenizer.Next()
-						importMap := importmap.Blank()
-						tagContent := tokenizer.Raw()
-						if token == html.TextToken {
-							importMapRaw := bytes.TrimSpace(tagContent)
-							if len(importMapRaw) > 0 {
-								importMap, err = importmap.Parse(nil, importMapRaw)
-								if err != nil {
-									err = fmt.Errorf("invalid importmap script: %w", err)
-									return
-								}
-							}
-						}
-						if addImports(importMap, specifiers, all, noPrompt, noSRI) {
-							buf.WriteString("\n")
-							buf.WriteString(importMap.FormatJSON(2))
-							buf.WriteString("\n  ")
-						} else {
-							buf.Write(tagContent)
-						}
-						if token == html.EndTagToken {
-							buf.Write(tokenizer.Raw())
-						}
-						updated = true
-						continue
-					}
-				}
-			}
-			buf.Write(tokenizer.Raw())
-		}
-		fi, erro := f.Stat()
-		f.Close()
-		if erro != nil {
-			return erro
-		}
-		err = os.WriteFile(indexHtml, buf.Bytes(), fi.Mode())
-	} else {
-		importMap := importmap.Blank()
-		if addImports(importMap, specifiers, all, noPrompt, noSRI) {
-			err = os.WriteFile(indexHtml, fmt.Appendf(nil, htmlTemplate, importMap.FormatJSON(2), specifiers[0]), 0644)
-			if err == nil {
-				fmt.Println(term.Dim("Created index.html with importmap script."))
-			}
+		source.exists = true
+		created = true
+	}
+
+	if addImports(source.ImportMap, specifiers, all, noPrompt, noSRI) && (noSRI || syncGraphIntegrity(source.ImportMap)) && updatePreloads(source.ImportMap, files, preload, preloadLimit) {
+		err = saveImportMapFiles(source, files)
+		if err == nil && created {
+			fmt.Println(term.Dim("Created " + filepath.Base(source.filename) + " with importmap script."))
 		}
 	}
 	return
@@ -263,13 +188,13 @@ func addImports(im *importmap.ImportMap, specifiers []string, all bool, noPrompt
 		}
 	}
 
+	// the shared peer dependencies of the imports are resolved together
+	warnings, errors = im.AddImports(resolvedImports, noSRI)
+	if len(errors) > 0 {
+		onErrors(errors)
+		return false
+	}
 	for _, imp := range resolvedImports {
-		warns, errors := im.AddImport(imp, noSRI)
-		if len(errors) > 0 {
-			onErrors(errors)
-			return false
-		}
-		warnings = append(warnings, warns...)
 		addedSpecifiers = append(addedSpecifiers, imp.Specifier(false))
 	}
 
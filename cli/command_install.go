@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/ije/gox/term"
+)
+
+const installHelpMessage = `Resolve the "importmap" in index.html with the versions locked in esm.lock
+
+Usage: esm.sh install [options]
+
+Options:
+	--frozen       Fail if the resolution drifts from esm.lock, nothing is written
+	--no-sri       No "integrity" attribute added
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html.
+	               Use it multiple times to sync the import map to other files.
+  --help, -h     Show help message
+`
+
+// Install resolves imports of "importmap" script with the lock file
+func Install() {
+	frozen := flag.Bool("frozen", false, "fail if the resolution drifts from esm.lock")
+	noSRI := flag.Bool("no-sri", false, "do not generate SRI for the import")
+	files := fileFlag()
+	_, help := parseCommandFlags()
+
+	if help {
+		fmt.Print(installHelpMessage)
+		return
+	}
+
+	err := install(*files, *frozen, *noSRI)
+	if err != nil {
+		fmt.Println(term.Red("✖︎"), "Failed to install: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func install(filenames []string, frozen bool, noSRI bool) (err error) {
+	source, files, err := loadImportMapFiles(filenames)
+	if err != nil {
+		return
+	}
+	if !source.exists {
+		return fmt.Errorf("%s not found", filepath.Base(source.filename))
+	}
+
+	lock, err := source.readLockFile()
+	if err != nil {
+		return
+	}
+
+	if frozen {
+		if lock == nil {
+			return fmt.Errorf("esm.lock not found")
+		}
+		if diff := lock.Diff(source.LockFile()); len(diff) > 0 {
+			printLockDiff(diff)
+			return fmt.Errorf("the import map does not match esm.lock")
+		}
+		// resolve with SRI only if the lock file records integrity
+		noSRI = true
+		for _, entry := range lock.Imports {
+			if entry.Integrity != "" {
+				noSRI = false
+				break
+			}
+		}
+	}
+
+	// resolve the top-level imports with the locked versions
+	cdnOrigin := source.CDNOrigin()
+	importMap := importmap.Blank()
+	importMap.SetConfig(source.Config())
+	specifiers := []string{}
+	aliases := map[string]string{}
+	source.Imports.Range(func(specifier string, url string) bool {
+		if strings.HasPrefix(url, cdnOrigin+"/") {
+			imp, err := importmap.ParseEsmPath(url)
+			if err == nil && imp.Version != "" {
+				if lock != nil {
+					if entry, ok := lock.Imports[specifier]; ok {
+						imp.Version = entry.Version
+					}
+				}
+				specifiers = append(specifiers, imp.Specifier(true))
+				if specifier != imp.Specifier(false) {
+					aliases[specifier] = imp.Specifier(false)
+				}
+				return true
+			}
+		}
+		importMap.Imports.Set(specifier, url)
+		return true
+	})
+	source.RangeScopes(func(scope string, imports *importmap.Imports) bool {
+		if !strings.HasPrefix(scope, cdnOrigin+"/") {
+			importMap.SetScopeImports(scope, imports)
+		}
+		return true
+	})
+	sort.Strings(specifiers)
+	if len(specifiers) > 0 && !addImports(importMap, specifiers, false, true, noSRI) {
+		return fmt.Errorf("could not resolve the imports")
+	}
+	for alias, specifier := range aliases {
+		if url, ok := importMap.Imports.Get(specifier); ok {
+			importMap.Imports.Set(alias, url)
+			if !source.Imports.Has(specifier) {
+				importMap.Imports.Delete(specifier)
+			}
+		}
+	}
+
+	if frozen {
+		if diff := lock.Diff(importMap.LockFile()); len(diff) > 0 {
+			printLockDiff(diff)
+			return fmt.Errorf("the resolution drifted from esm.lock")
+		}
+		fmt.Println(term.Green("✔"), "The import map matches esm.lock.")
+		return
+	}
+
+	if !noSRI && !syncGraphIntegrity(importMap) {
+		return fmt.Errorf("could not resolve the integrity of the import map")
+	}
+
+	source.ImportMap = importMap
+	err = saveImportMapFiles(source, files)
+	if err == nil && lock != nil {
+		printLockDiff(lock.Diff(importMap.LockFile()))
+	}
+	return
+}
+
+func printLockDiff(diff []string) {
+	for _, line := range diff {
+		fmt.Println(term.Yellow("~"), line)
+	}
+}
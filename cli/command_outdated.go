@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/gox/term"
+)
+
+const outdatedHelpMessage = `Check outdated imports of the "importmap" in index.html
+
+Usage: esm.sh outdated [options]
+
+Options:
+	--json         Print the report in JSON format
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html
+  --help, -h     Show help message
+
+The command exits with code 1 if there are outdated or deprecated imports.
+`
+
+// outdatedImport represents an outdated import of the import map
+type outdatedImport struct {
+	Name       string `json:"name"`
+	Current    string `json:"current"`
+	Wanted     string `json:"wanted,omitempty"`
+	Latest     string `json:"latest"`
+	Deprecated string `json:"deprecated,omitempty"`
+	Location   string `json:"location"` // "imports" or the scope
+	imp        importmap.Import
+}
+
+// Outdated checks outdated imports of "importmap" script
+func Outdated() {
+	jsonOutput := flag.Bool("json", false, "print the report in JSON format")
+	files := fileFlag()
+	_, help := parseCommandFlags()
+
+	if help {
+		fmt.Print(outdatedHelpMessage)
+		return
+	}
+
+	report, err := checkOutdatedImports(*files, !*jsonOutput)
+	if err != nil {
+		fmt.Println(term.Red("✖︎"), "Failed to check outdated imports: "+err.Error())
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if report == nil {
+			report = []outdatedImport{}
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		os.Stdout.Write(data)
+		os.Stdout.Write(EOL)
+	} else if len(report) == 0 {
+		fmt.Println(term.Green("✔"), "All imports are up to date.")
+	} else {
+		printOutdatedImports(report)
+	}
+	if len(report) > 0 {
+		os.Exit(1)
+	}
+}
+
+func checkOutdatedImports(filenames []string, showSpinner bool) (report []outdatedImport, err error) {
+	im, _, err := loadImportMapFiles(filenames)
+	if err != nil {
+		return
+	}
+	if !im.exists {
+		err = fmt.Errorf("%s not found", filepath.Base(im.filename))
+		return
+	}
+
+	// collect the imports of the CDN, both in `imports` and `scopes`
+	cdnOrigin := im.CDNOrigin()
+	seen := map[string]bool{}
+	collect := func(location string, imports *importmap.Imports) {
+		imports.Range(func(_ string, url string) bool {
+			if strings.HasPrefix(url, cdnOrigin+"/") {
+				imp, err := importmap.ParseEsmPath(url)
+				if err == nil && imp.Version != "" {
+					name := importmap.Import{Name: imp.Name, Github: imp.Github, Jsr: imp.Jsr}.Specifier(false)
+					key := location + " " + name + "@" + imp.Version
+					if !seen[key] {
+						seen[key] = true
+						report = append(report, outdatedImport{Name: name, Current: imp.Version, Location: location, imp: imp})
+					}
+				}
+			}
+			return true
+		})
+	}
+	collect("imports", im.Imports)
+	im.RangeScopes(func(scope string, imports *importmap.Imports) bool {
+		collect(scope, imports)
+		return true
+	})
+
+	if len(report) == 0 {
+		return
+	}
+
+	if showSpinner {
+		term.HideCursor()
+		defer term.ShowCursor()
+		spinner := term.NewSpinner(term.SpinnerConfig{})
+		spinner.Start()
+		defer spinner.Stop()
+	}
+
+	var lock sync.Mutex
+	var errors []error
+	var wg sync.WaitGroup
+	metas := map[string]importmap.ImportMeta{}
+	fetchMeta := func(imp importmap.Import) {
+		key := imp.Specifier(true)
+		lock.Lock()
+		_, ok := metas[key]
+		if !ok {
+			metas[key] = importmap.ImportMeta{}
+		}
+		lock.Unlock()
+		if ok {
+			return
+		}
+		wg.Go(func() {
+			meta, err := im.FetchImportMeta(imp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errors = append(errors, err)
+				return
+			}
+			metas[key] = meta
+		})
+	}
+	for _, entry := range report {
+		pkg := importmap.Import{Name: entry.imp.Name, Github: entry.imp.Github, Jsr: entry.imp.Jsr}
+		// the latest version
+		fetchMeta(pkg)
+		// the current version to check if it is deprecated
+		current := pkg
+		current.Version = entry.Current
+		fetchMeta(current)
+		// the latest version within the semver range of the current version
+		if !pkg.Github {
+			if versionRange, ok := wantedRange(entry.Current); ok {
+				wanted := pkg
+				wanted.Version = versionRange
+				fetchMeta(wanted)
+			}
+		}
+	}
+	wg.Wait()
+
+	if len(errors) > 0 {
+		return nil, errors[0]
+	}
+
+	outdated := make([]outdatedImport, 0, len(report))
+	for _, entry := range report {
+		pkg := importmap.Import{Name: entry.imp.Name, Github: entry.imp.Github, Jsr: entry.imp.Jsr}
+		entry.Latest = metas[pkg.Specifier(true)].Version
+		current := pkg
+		current.Version = entry.Current
+		entry.Deprecated = metas[current.Specifier(true)].Deprecated
+		if !pkg.Github {
+			if versionRange, ok := wantedRange(entry.Current); ok {
+				wanted := pkg
+				wanted.Version = versionRange
+				entry.Wanted = metas[wanted.Specifier(true)].Version
+			}
+		}
+		if entry.Latest != entry.Current || (entry.Wanted != "" && entry.Wanted != entry.Current) || entry.Deprecated != "" {
+			outdated = append(outdated, entry)
+		}
+	}
+	sort.Slice(outdated, func(i, j int) bool {
+		a, b := outdated[i], outdated[j]
+		if a.Location != b.Location {
+			// list the top-level imports first
+			return a.Location == "imports" || (b.Location != "imports" && a.Location < b.Location)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Current < b.Current
+	})
+	return outdated, nil
+}
+
+// wantedRange returns the semver range of the exact version,
+// pre-release versions and version ranges have no wanted range.
+func wantedRange(version string) (string, bool) {
+	if !npm.IsExactVersion(version) {
+		return "", false
+	}
+	return caretRange(version)
+}
+
+func printOutdatedImports(report []outdatedImport) {
+	header := []string{"Package", "Current", "Wanted", "Latest", "Location"}
+	rows := make([][]string, 0, len(report))
+	for _, entry := range report {
+		wanted := entry.Wanted
+		if wanted == "" {
+			wanted = "-"
+		}
+		location := entry.Location
+		if location != "imports" {
+			location = "scope " + location
+		}
+		rows = append(rows, []string{entry.Name, entry.Current, wanted, entry.Latest, location})
+	}
+	widths := make([]int, len(header))
+	for i, cell := range header {
+		widths[i] = len(cell)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	pad := func(s string, width int) string {
+		return s + strings.Repeat(" ", width-len(s)+2)
+	}
+	for i, cell := range header {
+		os.Stdout.WriteString(term.Dim(pad(cell, widths[i])))
+	}
+	os.Stdout.Write(EOL)
+	for i, row := range rows {
+		entry := report[i]
+		name := pad(row[0], widths[0])
+		if entry.Wanted != "" && entry.Wanted != entry.Current {
+			name = term.Red(name)
+		} else {
+			name = term.Yellow(name)
+		}
+		os.Stdout.WriteString(name)
+		os.Stdout.WriteString(pad(row[1], widths[1]))
+		os.Stdout.WriteString(term.Green(pad(row[2], widths[2])))
+		os.Stdout.WriteString(term.Cyan(pad(row[3], widths[3])))
+		os.Stdout.WriteString(term.Dim(row[4]))
+		os.Stdout.Write(EOL)
+	}
+	for _, entry := range report {
+		if entry.Deprecated != "" {
+			fmt.Println(term.Yellow("[deprecated]"), entry.Name+"@"+entry.Current+":", entry.Deprecated)
+		}
+	}
+}
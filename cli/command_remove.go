@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ije/gox/term"
+)
+
+const removeHelpMessage = `Remove imports from the "importmap" in index.html
+
+Usage: esm.sh remove [options] [...imports]
+
+Examples:
+  esm.sh remove react-dom/client ` + "\033[30m # remove a sub-module \033[0m" + `
+  esm.sh remove react-dom        ` + "\033[30m # remove the import and all its sub-modules \033[0m" + `
+
+Arguments:
+  ...imports     Imports to remove
+
+Options:
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html.
+	               Use it multiple times to sync the import map to other files.
+  --help, -h     Show help message
+`
+
+// Remove removes imports from "importmap" script
+func Remove() {
+	files := fileFlag()
+	specifiers, help := parseCommandFlags()
+
+	if help || len(specifiers) == 0 {
+		fmt.Print(removeHelpMessage)
+		return
+	}
+
+	err := removeImports(*files, specifiers)
+	if err != nil {
+		fmt.Println(term.Red("✖︎"), "Failed to remove imports: "+err.Error())
+	}
+}
+
+func removeImports(filenames []string, specifiers []string) (err error) {
+	im, files, err := loadImportMapFiles(filenames)
+	if err != nil {
+		return
+	}
+	if !im.exists {
+		return fmt.Errorf("%s not found", filepath.Base(im.filename))
+	}
+
+	// keep the integrity of the transitive modules in sync if the import map uses SRI
+	hasSRI := im.Integrity().Len() > 0
+
+	var removed []string
+	for _, specifier := range specifiers {
+		found := im.RemoveImport(specifier)
+		if found {
+			removed = append(removed, specifier)
+		}
+		// remove all sub-modules of the package
+		for _, key := range im.Imports.Keys() {
+			if strings.HasPrefix(key, specifier+"/") && im.RemoveImport(key) {
+				removed = append(removed, key)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("import %q not found", specifier)
+		}
+	}
+
+	term.HideCursor()
+	defer term.ShowCursor()
+
+	startTime := time.Now()
+	spinner := term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+	pruned, errors := im.Prune()
+	if len(errors) == 0 && hasSRI {
+		errors = im.SyncGraphIntegrity()
+	}
+	spinner.Stop()
+
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Println(term.Red("[error]"), err.Error())
+		}
+		return fmt.Errorf("could not resolve the dependencies of the import map")
+	}
+
+	err = saveImportMapFiles(im, files)
+	if err != nil {
+		return
+	}
+
+	sort.Strings(removed)
+	for _, specifier := range removed {
+		fmt.Println(term.Red("✖︎"), specifier)
+	}
+	if len(pruned) > 0 {
+		fmt.Println(term.Dim(fmt.Sprintf("Pruned %d unused dependencies: %s", len(pruned), strings.Join(pruned, ", "))))
+	}
+	fmt.Println(term.Green("✦"), "Done in", term.Dim(time.Since(startTime).String()))
+	return
+}
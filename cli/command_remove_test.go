@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemoveImports(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "importmap.json")
+	err := os.WriteFile(filename, []byte(`{
+		"imports": {
+			"react": "./vendor/react.mjs",
+			"react-dom": "./vendor/react-dom.mjs",
+			"react-dom/client": "./vendor/react-dom/client.mjs",
+			"react-dom/server": "./vendor/react-dom/server.mjs",
+			"react-dom-extra": "./vendor/react-dom-extra.mjs",
+			"vue/server": "./vendor/vue/server.mjs"
+		}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		specifiers []string
+		expected   []string
+	}{
+		// the sub-modules are removed with the package
+		{[]string{"react-dom"}, []string{"react", "react-dom-extra", "vue/server"}},
+		// the sub-modules are removed even if the package itself is not imported
+		{[]string{"vue"}, []string{"react", "react-dom-extra"}},
+	}
+	for _, tc := range testCases {
+		if err := removeImports([]string{filename}, tc.specifiers); err != nil {
+			t.Fatal(err)
+		}
+		f, err := loadImportMapFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := strings.Join(f.Imports.Keys(), ","); keys != strings.Join(tc.expected, ",") {
+			t.Fatalf("expected %v after removing %v, got %s", tc.expected, tc.specifiers, keys)
+		}
+	}
+
+	if err := removeImports([]string{filename}, []string{"vue"}); err == nil || !strings.Contains(err.Error(), `"vue" not found`) {
+		t.Fatalf("expected an error of the missing import, got %v", err)
+	}
+}
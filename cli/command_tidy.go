@@ -1,18 +1,15 @@
 package cli
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"io"
-	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
-	"github.com/esm-dev/esm.sh/internal/importmap"
+	"github.com/esm-dev/esm.sh/importmap"
 	"github.com/esm-dev/esm.sh/internal/npm"
 	"github.com/ije/gox/term"
-	"golang.org/x/net/html"
 )
 
 const tidyHelpMessage = `Clean up and optimize the "importmap" script in index.html
@@ -21,132 +18,111 @@ Usage: esm.sh tidy [options]
 
 Options:
 	--no-sri    No "integrity" attribute for the import map
+	--preload   Add "modulepreload" hints of the static dependency graph to the HTML file,
+	            the existing hints are always updated
+	--preload-limit <n>
+	            The maximum number of "modulepreload" hints, default is 10
+	--file      The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html.
+	            Use it multiple times to sync the import map to other files.
   --help, -h  Show help message
 `
 
 // Tidy tidies up "importmap" script
 func Tidy() {
 	noSRI := flag.Bool("no-sri", false, "do not generate SRI for the import")
+	preload := flag.Bool("preload", false, "add modulepreload hints to the HTML file")
+	preloadLimit := flag.Int("preload-limit", defaultPreloadLimit, "the maximum number of modulepreload hints")
+	files := fileFlag()
 	_, help := parseCommandFlags()
 	if help {
 		fmt.Print(tidyHelpMessage)
 		return
 	}
 
-	err := tidy(*noSRI)
+	err := tidy(*files, *noSRI, *preload, *preloadLimit)
 	if err != nil {
 		fmt.Println(term.Red("[error]"), "Failed to tidy up: "+err.Error())
 	}
 }
 
-func tidy(noSRI bool) (err error) {
-	indexHtml, exists, err := lookupClosestFile("index.html")
+func tidy(filenames []string, noSRI bool, preload bool, preloadLimit int) (err error) {
+	source, files, err := loadImportMapFiles(filenames)
 	if err != nil {
-		err = fmt.Errorf("Failed to lookup index.html: %w", err)
 		return
 	}
 
-	if !exists {
-		err = fmt.Errorf("index.html not found")
+	if !source.exists {
+		err = fmt.Errorf("%s not found", filepath.Base(source.filename))
 		return
 	}
 
-	f, err := os.Open(indexHtml)
-	if err != nil {
+	prevImportMap := source.ImportMap
+	if prevImportMap.Imports.Len() == 0 {
+		fmt.Println(term.Dim("No imports found."))
 		return
 	}
 
-	tokenizer := html.NewTokenizer(f)
-	buf := bytes.NewBuffer(nil)
-	for {
-		token := tokenizer.Next()
-		if token == html.ErrorToken && tokenizer.Err() == io.EOF {
-			break
-		}
-		if token == html.StartTagToken {
-			tagName, moreAttr := tokenizer.TagName()
-			if string(tagName) == "script" && moreAttr {
-				var typeAttr string
-				for moreAttr {
-					var key, val []byte
-					key, val, moreAttr = tokenizer.TagAttr()
-					if string(key) == "type" {
-						typeAttr = string(val)
-						break
-					}
-				}
-				if typeAttr == "importmap" {
-					buf.Write(tokenizer.Raw())
-					var prevImportMap *importmap.ImportMap
-					if tokenizer.Next() == html.TextToken {
-						importMapJson := bytes.TrimSpace(tokenizer.Text())
-						if len(importMapJson) > 0 {
-							prevImportMap, err = importmap.Parse(nil, importMapJson)
-							if err != nil {
-								err = fmt.Errorf("invalid importmap script: %w", err)
-								return
-							}
-						}
-					}
-					if prevImportMap == nil || prevImportMap.Imports.Len() == 0 {
-						fmt.Println(term.Dim("No imports found."))
-						return
-					}
-					buf.WriteString("\n")
-					importMap := importmap.Blank()
-					importMap.SetConfig(prevImportMap.Config())
-					importMap.SetIntegrity(prevImportMap.Integrity())
-					imports := make([]importmap.Import, 0, prevImportMap.Imports.Len())
-					prevImportMap.Imports.Range(func(specifier string, url string) bool {
-						if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
-							// todo: check hostname
-							imp, err := importmap.ParseEsmPath(url)
-							if err == nil {
-								if npm.IsExactVersion(imp.Version) {
-									imports = append(imports, imp)
-								}
-								return true // continue
-							}
-						}
-						importMap.Imports.Set(specifier, url)
-						return true
-					})
-					prevImportMap.RangeScopes(func(scope string, imports *importmap.Imports) bool {
-						if strings.HasPrefix(scope, "https://") || strings.HasPrefix(scope, "http://") {
-							// todo: check hostname
-							if strings.HasSuffix(scope, "/") {
-								return true // continue
-							}
-						}
-						importMap.SetScopeImports(scope, imports)
-						return true
-					})
-					if len(imports) == 0 {
-						fmt.Println(term.Dim("No imports found."))
-						return
-					}
-					specifiers := make([]string, 0, len(imports))
-					for _, imp := range imports {
-						specifiers = append(specifiers, imp.Specifier(true))
-					}
-					sort.Strings(specifiers)
-					addImports(importMap, specifiers, false, true, noSRI)
-					buf.WriteString(importMap.FormatJSON(2))
-					buf.WriteString("\n  ")
-					if token == html.EndTagToken {
-						buf.Write(tokenizer.Raw())
-					}
-					continue
+	importMap := importmap.Blank()
+	importMap.SetConfig(prevImportMap.Config())
+	if noSRI {
+		// drop the integrity of the CDN modules
+		cdnScopePrefix := prevImportMap.CDNOrigin() + "/"
+		integrity := importmap.NewImports(nil)
+		prevImportMap.Integrity().Range(func(url string, value string) bool {
+			if !strings.HasPrefix(url, cdnScopePrefix) {
+				integrity.Set(url, value)
+			}
+			return true
+		})
+		importMap.SetIntegrity(integrity)
+	} else {
+		importMap.SetIntegrity(prevImportMap.Integrity())
+	}
+	imports := make([]importmap.Import, 0, prevImportMap.Imports.Len())
+	prevImportMap.Imports.Range(func(specifier string, url string) bool {
+		if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+			// todo: check hostname
+			imp, err := importmap.ParseEsmPath(url)
+			if err == nil {
+				if npm.IsExactVersion(imp.Version) {
+					imports = append(imports, imp)
 				}
+				return true // continue
 			}
 		}
-		buf.Write(tokenizer.Raw())
-	}
-	fi, err := f.Stat()
-	f.Close()
-	if err != nil {
+		importMap.Imports.Set(specifier, url)
+		return true
+	})
+	prevImportMap.RangeScopes(func(scope string, imports *importmap.Imports) bool {
+		if strings.HasPrefix(scope, "https://") || strings.HasPrefix(scope, "http://") {
+			// todo: check hostname
+			if strings.HasSuffix(scope, "/") {
+				return true // continue
+			}
+		}
+		importMap.SetScopeImports(scope, imports)
+		return true
+	})
+	if len(imports) == 0 {
+		fmt.Println(term.Dim("No imports found."))
 		return
 	}
-	err = os.WriteFile(indexHtml, buf.Bytes(), fi.Mode())
-	return
+	specifiers := make([]string, 0, len(imports))
+	for _, imp := range imports {
+		specifiers = append(specifiers, imp.Specifier(true))
+	}
+	sort.Strings(specifiers)
+	if !addImports(importMap, specifiers, false, true, noSRI) {
+		return fmt.Errorf("could not resolve the imports")
+	}
+	// keep the integrity of the transitive modules in sync
+	if !noSRI && !syncGraphIntegrity(importMap) {
+		return fmt.Errorf("could not resolve the integrity of the import map")
+	}
+	// the "modulepreload" hints of the HTML files are updated if they exist
+	if !updatePreloads(importMap, files, preload, preloadLimit) {
+		return fmt.Errorf("could not resolve the static dependency graph")
+	}
+	source.ImportMap = importMap
+	return saveImportMapFiles(source, files)
 }
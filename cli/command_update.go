@@ -0,0 +1,331 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/gox/term"
+)
+
+const updateHelpMessage = `Update imports of the "importmap" in index.html
+
+Usage: esm.sh update [options] [...packages]
+
+Examples:
+  esm.sh update                ` + "\033[30m # update all imports within their semver ranges \033[0m" + `
+  esm.sh update react          ` + "\033[30m # update the react imports only \033[0m" + `
+  esm.sh update react@19       ` + "\033[30m # update react to the latest 19.x \033[0m" + `
+  esm.sh update --latest       ` + "\033[30m # update all imports to the latest version \033[0m" + `
+
+Arguments:
+  ...packages    Packages to update, default is all packages of the import map
+
+Options:
+	--latest       Update to the latest version ignoring the semver range
+	--dry-run      Show the changes without updating the import map
+	--no-sri       No "integrity" attribute added
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html.
+	               Use it multiple times to sync the import map to other files.
+  --help, -h     Show help message
+`
+
+// updateEntry represents a top-level import of the import map to update
+type updateEntry struct {
+	specifier string
+	imp       importmap.Import
+}
+
+// updatePackage represents a package of the import map to update
+type updatePackage struct {
+	imp          importmap.Import
+	versionRange string
+	entries      []updateEntry
+	resolved     []importmap.ImportMeta
+}
+
+// Update updates imports of "importmap" script
+func Update() {
+	latest := flag.Bool("latest", false, "update to the latest version")
+	dryRun := flag.Bool("dry-run", false, "show the changes without updating the import map")
+	noSRI := flag.Bool("no-sri", false, "do not generate SRI for the import")
+	files := fileFlag()
+	args, help := parseCommandFlags()
+
+	if help {
+		fmt.Print(updateHelpMessage)
+		return
+	}
+
+	err := updateImports(*files, args, *latest, *dryRun, *noSRI)
+	if err != nil {
+		fmt.Println(term.Red("✖︎"), "Failed to update imports: "+err.Error())
+	}
+}
+
+func updateImports(filenames []string, args []string, latest bool, dryRun bool, noSRI bool) (err error) {
+	im, files, err := loadImportMapFiles(filenames)
+	if err != nil {
+		return
+	}
+	if !im.exists {
+		return fmt.Errorf("%s not found", filepath.Base(im.filename))
+	}
+
+	// keep the integrity of the transitive modules in sync if the import map uses SRI
+	hasSRI := !noSRI && im.Integrity().Len() > 0
+
+	cdnOrigin := im.CDNOrigin()
+	packages := map[string]*updatePackage{}
+	im.Imports.Range(func(specifier string, url string) bool {
+		if strings.HasPrefix(url, cdnOrigin+"/") {
+			imp, err := importmap.ParseEsmPath(url)
+			if err == nil && imp.Version != "" {
+				pkgName := importmap.Import{Name: imp.Name, Github: imp.Github, Jsr: imp.Jsr}.Specifier(false)
+				pkg, ok := packages[pkgName]
+				if !ok {
+					pkg = &updatePackage{imp: imp}
+					pkg.imp.SubPath = ""
+					pkg.imp.Dev = false
+					packages[pkgName] = pkg
+				}
+				pkg.entries = append(pkg.entries, updateEntry{specifier: specifier, imp: imp})
+			}
+		}
+		return true
+	})
+
+	// filter packages by the arguments
+	if len(args) > 0 {
+		filtered := make(map[string]*updatePackage, len(args))
+		for _, arg := range args {
+			pkgName, versionRange := splitPackageVersion(arg)
+			pkg, ok := packages[pkgName]
+			if !ok {
+				return fmt.Errorf("package %q not found in the import map", pkgName)
+			}
+			pkg.versionRange = versionRange
+			filtered[pkgName] = pkg
+		}
+		packages = filtered
+	}
+
+	// select the version range to resolve for each package
+	for pkgName, pkg := range packages {
+		if pkg.versionRange != "" {
+			continue
+		}
+		if latest {
+			pkg.versionRange = "latest"
+		} else if pkg.imp.Github {
+			// git refs are not semver, update them with `--latest` or a specified ref only
+			delete(packages, pkgName)
+		} else if npm.IsExactVersion(pkg.imp.Version) {
+			versionRange, ok := caretRange(pkg.imp.Version)
+			if !ok {
+				// pre-release versions are updated with `--latest` or a specified version only
+				delete(packages, pkgName)
+				continue
+			}
+			pkg.versionRange = versionRange
+		} else {
+			pkg.versionRange = pkg.imp.Version
+		}
+	}
+
+	if len(packages) == 0 {
+		fmt.Println(term.Dim("No imports to update."))
+		return
+	}
+
+	term.HideCursor()
+	defer term.ShowCursor()
+
+	startTime := time.Now()
+	spinner := term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+
+	var lock sync.Mutex
+	var errors []error
+	var wg sync.WaitGroup
+	for _, pkg := range packages {
+		wg.Go(func() {
+			specifier := pkg.imp.Specifier(false)
+			if pkg.versionRange != "latest" {
+				specifier += "@" + pkg.versionRange
+			}
+			meta, err := im.ParseImport(specifier)
+			if err == nil && meta.Version == pkg.imp.Version {
+				// already up to date
+				return
+			}
+			resolved := make([]importmap.ImportMeta, 0, len(pkg.entries))
+			for _, entry := range pkg.entries {
+				if err != nil {
+					break
+				}
+				var m importmap.ImportMeta
+				if entry.imp.SubPath == "" {
+					m = meta
+				} else {
+					m, err = im.FetchImportMeta(importmap.Import{
+						Name:    meta.Name,
+						Version: meta.Version,
+						SubPath: entry.imp.SubPath,
+						Github:  meta.Github,
+						Jsr:     meta.Jsr,
+					})
+				}
+				m.Dev = entry.imp.Dev
+				resolved = append(resolved, m)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errors = append(errors, err)
+				return
+			}
+			pkg.resolved = resolved
+		})
+	}
+	wg.Wait()
+	spinner.Stop()
+
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Println(term.Red("[error]"), err.Error())
+		}
+		return fmt.Errorf("could not resolve the imports")
+	}
+
+	var changes []string
+	for pkgName, pkg := range packages {
+		if len(pkg.resolved) > 0 {
+			changes = append(changes, fmt.Sprintf("%s %s %s %s", pkgName, term.Dim(pkg.imp.Version), term.Dim("→"), term.Green(pkg.resolved[0].Version)))
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Println(term.Dim("All imports are up to date."))
+		return
+	}
+	sort.Strings(changes)
+
+	if dryRun {
+		for _, change := range changes {
+			fmt.Println(term.Dim("○"), change)
+		}
+		fmt.Println(term.Dim("Dry run, the import map is not updated."))
+		return
+	}
+
+	spinner = term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+
+	keys := make(map[string]bool, im.Imports.Len())
+	for _, key := range im.Imports.Keys() {
+		keys[key] = true
+	}
+	// add the updated imports in one batch to resolve the peer dependencies once
+	var batch []importmap.ImportMeta
+	var entries []updateEntry
+	for _, pkg := range packages {
+		if len(pkg.resolved) == 0 {
+			continue
+		}
+		for _, entry := range pkg.entries {
+			im.RemoveImport(entry.specifier)
+		}
+		batch = append(batch, pkg.resolved...)
+		entries = append(entries, pkg.entries...)
+	}
+	warnings, errors := im.AddImports(batch, !hasSRI)
+	for i, meta := range batch {
+		// keep the custom specifier of the import
+		if specifier := entries[i].specifier; specifier != meta.Specifier(false) {
+			if url, ok := im.Imports.Get(meta.Specifier(false)); ok {
+				if !keys[meta.Specifier(false)] {
+					im.RemoveImport(meta.Specifier(false))
+				}
+				im.Imports.Set(specifier, url)
+			}
+		}
+	}
+	var pruned []string
+	if len(errors) == 0 {
+		pruned, errors = im.Prune()
+	}
+	if len(errors) == 0 && hasSRI {
+		errors = im.SyncGraphIntegrity()
+	}
+	spinner.Stop()
+
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Println(term.Red("[error]"), err.Error())
+		}
+		return fmt.Errorf("could not update the import map")
+	}
+
+	err = saveImportMapFiles(im, files)
+	if err != nil {
+		return
+	}
+
+	for _, change := range changes {
+		fmt.Println(term.Green("✔"), change)
+	}
+	for _, warning := range warnings {
+		fmt.Println(term.Yellow("[warn]"), warning)
+	}
+	if len(pruned) > 0 {
+		fmt.Println(term.Dim(fmt.Sprintf("Pruned %d unused dependencies: %s", len(pruned), strings.Join(pruned, ", "))))
+	}
+	fmt.Println(term.Green("✦"), "Done in", term.Dim(time.Since(startTime).String()))
+	return
+}
+
+// caretRange returns the version range that is compatible with the given exact version,
+// it works like the caret range (^) of npm, e.g. "1.2.3" -> "1", "0.2.3" -> "0.2"
+func caretRange(version string) (string, bool) {
+	if strings.ContainsAny(version, "-+") {
+		return "", false
+	}
+	major, rest, _ := strings.Cut(version, ".")
+	if major != "0" {
+		return major, true
+	}
+	minor, _, _ := strings.Cut(rest, ".")
+	if minor != "0" {
+		return major + "." + minor, true
+	}
+	return version, true
+}
+
+// splitPackageVersion splits the package name and version range of the argument,
+// e.g. "@scope/name@^1.0.0" -> ("@scope/name", "^1.0.0")
+func splitPackageVersion(arg string) (pkgName string, versionRange string) {
+	var prefix string
+	if strings.HasPrefix(arg, "gh:") || strings.HasPrefix(arg, "jsr:") {
+		i := strings.IndexByte(arg, ':')
+		prefix, arg = arg[:i+1], arg[i+1:]
+	}
+	i := strings.IndexByte(arg, '@')
+	if i == 0 {
+		j := strings.IndexByte(arg[1:], '@')
+		if j == -1 {
+			i = -1
+		} else {
+			i = j + 1
+		}
+	}
+	if i > 0 {
+		return prefix + arg[:i], arg[i+1:]
+	}
+	return prefix + arg, ""
+}
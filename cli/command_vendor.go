@@ -0,0 +1,424 @@
+package cli
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/ije/gox/term"
+)
+
+const vendorHelpMessage = `Download the modules of the "importmap" in index.html for offline use
+
+Usage: esm.sh vendor [options]
+
+Options:
+	--out          The output directory, default is "vendor/"
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html.
+	               Use it multiple times to sync the import map to other files.
+  --help, -h     Show help message
+`
+
+var (
+	// matches the absolute import paths of esm.sh modules, e.g. `from"/react@19.0.0/es2022/react.mjs"`
+	regexpModuleImport = regexp.MustCompile(`(?:\bfrom|\bimport)\s*\(?\s*["']((?:https?://[^/"']+)?/[^"'\s]+)["']`)
+	// matches the source map url of a module
+	regexpSourceMapUrl = regexp.MustCompile(`//# sourceMappingURL=(\S+)\s*$`)
+)
+
+// vendorFile represents a downloaded file of the vendor directory
+type vendorFile struct {
+	url       string
+	localPath string // the slash-separated path relative to the output directory
+	kind      string // "js", "dts" or "map"
+	content   []byte
+	deps      map[string]string // import literal -> absolute url
+}
+
+// vendorTask is a file to download with its kind
+type vendorTask struct {
+	url  string
+	kind string
+}
+
+// vendorer downloads the module graph of an import map
+type vendorer struct {
+	im        *importmap.ImportMap
+	cdnOrigin string
+	client    *http.Client
+	lock      sync.Mutex
+	files     map[string]*vendorFile // requested url -> file
+	errors    []error
+}
+
+// Vendor downloads the modules of "importmap" script for offline use
+func Vendor() {
+	outDir := flag.String("out", "vendor", "the output directory")
+	files := fileFlag()
+	_, help := parseCommandFlags()
+
+	if help {
+		fmt.Print(vendorHelpMessage)
+		return
+	}
+
+	err := vendor(*files, *outDir)
+	if err != nil {
+		fmt.Println(term.Red("✖︎"), "Failed to vendor: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func vendor(filenames []string, outDir string) (err error) {
+	source, files, err := loadImportMapFiles(filenames)
+	if err != nil {
+		return
+	}
+	if !source.exists {
+		return fmt.Errorf("%s not found", filepath.Base(source.filename))
+	}
+
+	rootDir := filepath.Dir(source.filename)
+	if !filepath.IsAbs(outDir) {
+		outDir = filepath.Join(rootDir, outDir)
+	}
+	outPrefix, err := filepath.Rel(rootDir, outDir)
+	if err != nil {
+		return
+	}
+	outPrefix = filepath.ToSlash(outPrefix)
+	if !strings.HasPrefix(outPrefix, "../") {
+		outPrefix = "./" + outPrefix
+	}
+
+	v := &vendorer{
+		im:        source.ImportMap,
+		cdnOrigin: source.CDNOrigin(),
+		client:    &http.Client{Timeout: 60 * time.Second},
+		files:     map[string]*vendorFile{},
+	}
+
+	// collect the module urls of the import map
+	var queue []vendorTask
+	collect := func(imports *importmap.Imports) {
+		imports.Range(func(_ string, url string) bool {
+			if strings.HasPrefix(url, v.cdnOrigin+"/") {
+				queue = append(queue, vendorTask{url, "js"})
+			}
+			return true
+		})
+	}
+	collect(source.Imports)
+	source.RangeScopes(func(_ string, imports *importmap.Imports) bool {
+		collect(imports)
+		return true
+	})
+	if len(queue) == 0 {
+		fmt.Println(term.Dim("No imports to vendor."))
+		return
+	}
+
+	term.HideCursor()
+	defer term.ShowCursor()
+
+	startTime := time.Now()
+	spinner := term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+
+	// 1. download the module graph, the `seen` set is guarded by `v.lock`
+	seen := map[string]bool{}
+	for _, task := range queue {
+		seen[task.url] = true
+	}
+	for len(queue) > 0 {
+		var next []vendorTask
+		var wg sync.WaitGroup
+		for _, task := range queue {
+			wg.Go(func() {
+				f, err := v.download(task.url, task.kind)
+				var related map[string]string
+				if err == nil {
+					related = v.related(f)
+				}
+				v.lock.Lock()
+				defer v.lock.Unlock()
+				if err != nil {
+					v.errors = append(v.errors, err)
+					return
+				}
+				for _, depUrl := range f.deps {
+					if !seen[depUrl] {
+						seen[depUrl] = true
+						next = append(next, vendorTask{depUrl, f.kind})
+					}
+				}
+				for depUrl, kind := range related {
+					if !seen[depUrl] {
+						seen[depUrl] = true
+						next = append(next, vendorTask{depUrl, kind})
+					}
+				}
+			})
+		}
+		wg.Wait()
+		queue = next
+	}
+	spinner.Stop()
+
+	if len(v.errors) > 0 {
+		for _, err := range v.errors {
+			fmt.Println(term.Red("[error]"), err.Error())
+		}
+		return fmt.Errorf("could not download the modules")
+	}
+
+	// 2. rewrite the imports to relative paths and write the files
+	integrity := map[string]string{}
+	for _, f := range v.files {
+		content := f.content
+		for literal, depUrl := range f.deps {
+			dep, ok := v.files[depUrl]
+			if !ok {
+				continue
+			}
+			rel, err := filepath.Rel(path.Dir(f.localPath), dep.localPath)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if !strings.HasPrefix(rel, "../") {
+				rel = "./" + rel
+			}
+			content = replaceImportLiteral(content, literal, rel)
+		}
+		filename := filepath.Join(outDir, filepath.FromSlash(f.localPath))
+		if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return
+		}
+		if err = os.WriteFile(filename, content, 0644); err != nil {
+			return
+		}
+		if f.kind == "js" {
+			sum := sha512.Sum384(content)
+			integrity[f.url] = "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+		}
+	}
+
+	// 3. rewrite the import map to the local paths, scopes are preserved
+	importMap := importmap.Blank()
+	importMap.SetConfig(source.Config())
+	toLocalUrl := func(url string) string {
+		if f, ok := v.files[url]; ok {
+			return outPrefix + "/" + f.localPath
+		}
+		return url
+	}
+	localIntegrity := importMap.Integrity()
+	rewrite := func(imports *importmap.Imports, target *importmap.Imports) {
+		imports.Range(func(specifier string, url string) bool {
+			localUrl := toLocalUrl(url)
+			target.Set(specifier, localUrl)
+			if localUrl != url {
+				if _, ok := source.Integrity().Get(url); ok {
+					localIntegrity.Set(localUrl, integrity[url])
+				}
+			} else if sri, ok := source.Integrity().Get(url); ok {
+				localIntegrity.Set(url, sri)
+			}
+			return true
+		})
+	}
+	rewrite(source.Imports, importMap.Imports)
+	source.RangeScopes(func(scope string, imports *importmap.Imports) bool {
+		if strings.HasPrefix(scope, v.cdnOrigin+"/") {
+			scope = outPrefix + "/" + localPath(strings.TrimPrefix(scope, v.cdnOrigin+"/"))
+		}
+		scopeImports, ok := importMap.GetScopeImports(scope)
+		if !ok {
+			scopeImports = importmap.NewImports(nil)
+			importMap.SetScopeImports(scope, scopeImports)
+		}
+		rewrite(imports, scopeImports)
+		return true
+	})
+
+	source.ImportMap = importMap
+	for _, f := range files {
+		f.ImportMap = importMap
+		if err = f.save(); err != nil {
+			return
+		}
+	}
+
+	fmt.Println(term.Green("✔"), fmt.Sprintf("Vendored %d files to %s", len(v.files), outPrefix))
+	fmt.Println(term.Green("✦"), "Done in", term.Dim(time.Since(startTime).String()))
+	return
+}
+
+// download downloads the file of the url, the integrity is verified if it's in the import map
+func (v *vendorer) download(rawUrl string, kind string) (f *vendorFile, err error) {
+	resp, err := v.client.Get(rawUrl)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("could not download %s: %s", rawUrl, resp.Status)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if sri, ok := v.im.Integrity().Get(rawUrl); ok && sri != "" {
+		if err = verifyIntegrity(content, sri); err != nil {
+			return nil, fmt.Errorf("%s: %w", rawUrl, err)
+		}
+	}
+
+	// use the final url of redirects
+	finalUrl := resp.Request.URL
+	f = &vendorFile{
+		url:       rawUrl,
+		localPath: localPath(strings.TrimPrefix(finalUrl.Path, "/")),
+		kind:      kind,
+		content:   content,
+		deps:      map[string]string{},
+	}
+	if finalUrl.RawQuery != "" {
+		// e.g. `/scheduler@^0.27.0?target=es2022`
+		sum := sha1.Sum([]byte(finalUrl.RawQuery))
+		f.localPath += "~" + hex.EncodeToString(sum[:4])
+	}
+	if kind == "js" && path.Ext(f.localPath) != ".mjs" && path.Ext(f.localPath) != ".js" {
+		f.localPath += ".mjs"
+	}
+
+	if kind != "map" {
+		for _, m := range regexpModuleImport.FindAllSubmatch(content, -1) {
+			literal := string(m[1])
+			if depUrl, ok := v.resolveUrl(finalUrl, literal); ok {
+				f.deps[literal] = depUrl
+			}
+		}
+	}
+
+	if kind == "js" {
+		if dts := resp.Header.Get("X-TypeScript-Types"); dts != "" {
+			if dtsUrl, ok := v.resolveUrl(finalUrl, dts); ok {
+				f.deps["types:"+dtsUrl] = dtsUrl
+			}
+		}
+	}
+
+	v.lock.Lock()
+	v.files[rawUrl] = f
+	v.lock.Unlock()
+	return
+}
+
+// related returns the related files of the module that are not imported by the module,
+// e.g. the source map, the type definitions and the imports listed in the import meta.
+func (v *vendorer) related(f *vendorFile) map[string]string {
+	related := map[string]string{}
+	for literal, depUrl := range f.deps {
+		if strings.HasPrefix(literal, "types:") {
+			delete(f.deps, literal)
+			related[depUrl] = "dts"
+		}
+	}
+	if f.kind != "js" {
+		return related
+	}
+	if m := regexpSourceMapUrl.FindSubmatch(f.content); m != nil {
+		base, _ := url.Parse(f.url)
+		if mapUrl, ok := v.resolveUrl(base, string(m[1])); ok {
+			related[mapUrl] = "map"
+		}
+	}
+	if imp, err := importmap.ParseEsmPath(f.url); err == nil && imp.Version != "" {
+		if meta, err := v.im.FetchImportMeta(imp); err == nil {
+			for _, pathname := range meta.Imports {
+				if depUrl, ok := v.resolveUrl(nil, pathname); ok {
+					if _, ok := f.deps[pathname]; !ok {
+						related[depUrl] = "js"
+					}
+				}
+			}
+		}
+	}
+	return related
+}
+
+// resolveUrl resolves the import literal to an absolute url of the CDN
+func (v *vendorer) resolveUrl(base *url.URL, literal string) (string, bool) {
+	if strings.HasPrefix(literal, "/") && !strings.HasPrefix(literal, "//") {
+		return v.cdnOrigin + literal, true
+	}
+	if strings.HasPrefix(literal, v.cdnOrigin+"/") {
+		return literal, true
+	}
+	if base != nil && (strings.HasPrefix(literal, "./") || strings.HasPrefix(literal, "../") || !strings.Contains(literal, ":")) {
+		u, err := base.Parse(literal)
+		if err == nil && strings.HasPrefix(u.String(), v.cdnOrigin+"/") {
+			return u.String(), true
+		}
+	}
+	return "", false
+}
+
+// localPath converts the url path of the CDN to a local path,
+// the `*` prefix of esm.sh is replaced with `_` since it's invalid on Windows.
+func localPath(urlPath string) string {
+	return strings.ReplaceAll(urlPath, "*", "_")
+}
+
+// replaceImportLiteral replaces the quoted import literal in the content
+func replaceImportLiteral(content []byte, literal string, replacement string) []byte {
+	for _, quote := range []string{"\"", "'"} {
+		content = []byte(strings.ReplaceAll(string(content), quote+literal+quote, quote+replacement+quote))
+	}
+	return content
+}
+
+// verifyIntegrity verifies the content with the subresource integrity, e.g. "sha384-..."
+func verifyIntegrity(content []byte, integrity string) error {
+	algorithm, expected, ok := strings.Cut(integrity, "-")
+	if !ok {
+		return fmt.Errorf("invalid integrity %q", integrity)
+	}
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported integrity algorithm %q", algorithm)
+	}
+	h.Write(content)
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) != expected {
+		return fmt.Errorf("integrity mismatch")
+	}
+	return nil
+}
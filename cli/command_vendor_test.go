@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVendor(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	modules := map[string]string{
+		"/*app@1.0.0/es2022/app.mjs":   `import{dep}from"/dep@1.0.0/es2022/dep.mjs";import"/*app@1.0.0/es2022/chunk.mjs";export const app=dep;`,
+		"/*app@1.0.0/es2022/chunk.mjs": `import{dep}from"/dep@1.0.0/es2022/dep.mjs";export const chunk=dep;`,
+		"/dep@1.0.0/es2022/dep.mjs":    `export const dep=1;`,
+		"/lib@1.0.0/es2022/lib.mjs":    `import{dep}from"/dep@1.0.0/es2022/dep.mjs";export const lib=dep;`,
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, ok := modules[r.URL.Path]
+		if !ok || r.URL.RawQuery != "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte(code))
+	}))
+	defer cdn.Close()
+
+	sri := func(code string) string {
+		sum := sha512.Sum384([]byte(code))
+		return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "importmap.json")
+	err := os.WriteFile(filename, []byte(`{
+		"config": {"cdn": "`+cdn.URL+`"},
+		"imports": {
+			"app": "`+cdn.URL+`/*app@1.0.0/es2022/app.mjs",
+			"lib": "`+cdn.URL+`/lib@1.0.0/es2022/lib.mjs",
+			"local": "./local.js"
+		},
+		"scopes": {
+			"`+cdn.URL+`/": {
+				"dep": "`+cdn.URL+`/dep@1.0.0/es2022/dep.mjs"
+			}
+		},
+		"integrity": {
+			"`+cdn.URL+`/*app@1.0.0/es2022/app.mjs": "`+sri(modules["/*app@1.0.0/es2022/app.mjs"])+`",
+			"`+cdn.URL+`/dep@1.0.0/es2022/dep.mjs": "`+sri(modules["/dep@1.0.0/es2022/dep.mjs"])+`"
+		}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = vendor([]string{filename}, "vendor"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the absolute imports are rewritten to relative paths
+	app, err := os.ReadFile(filepath.Join(dir, "vendor", "_app@1.0.0", "es2022", "app.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(app), `from"../../dep@1.0.0/es2022/dep.mjs"`) || !strings.Contains(string(app), `import"./chunk.mjs"`) {
+		t.Fatalf("unexpected imports of app.mjs: %s", app)
+	}
+	lib, err := os.ReadFile(filepath.Join(dir, "vendor", "lib@1.0.0", "es2022", "lib.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(lib), `from"../../dep@1.0.0/es2022/dep.mjs"`) {
+		t.Fatalf("unexpected imports of lib.mjs: %s", lib)
+	}
+
+	f, err := loadImportMapFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for specifier, expected := range map[string]string{
+		"app":   "./vendor/_app@1.0.0/es2022/app.mjs",
+		"lib":   "./vendor/lib@1.0.0/es2022/lib.mjs",
+		"local": "./local.js",
+	} {
+		if url, _ := f.Imports.Get(specifier); url != expected {
+			t.Fatalf("expected %s to be %s, got %s", specifier, expected, url)
+		}
+	}
+
+	// the scopes of the CDN are rewritten to the output directory
+	scope, ok := f.GetScopeImports("./vendor/")
+	if !ok {
+		t.Fatalf("expected the scope of the output directory: %s", f.FormatJSON(2))
+	}
+	if url, _ := scope.Get("dep"); url != "./vendor/dep@1.0.0/es2022/dep.mjs" {
+		t.Fatalf("unexpected dep of the scope: %s", url)
+	}
+
+	// the integrity is recomputed for the rewritten modules
+	integrity := f.Integrity()
+	if integrity.Len() != 2 {
+		t.Fatalf("expected 2 integrity entries, got %v", integrity.Keys())
+	}
+	if v, _ := integrity.Get("./vendor/_app@1.0.0/es2022/app.mjs"); v != sri(string(app)) {
+		t.Fatalf("unexpected integrity of app.mjs: %s", v)
+	}
+	if v, _ := integrity.Get("./vendor/dep@1.0.0/es2022/dep.mjs"); v != sri(modules["/dep@1.0.0/es2022/dep.mjs"]) {
+		t.Fatalf("unexpected integrity of dep.mjs: %s", v)
+	}
+}
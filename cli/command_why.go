@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/ije/gox/term"
+)
+
+const whyHelpMessage = `Explain why the versions of a package are in the "importmap" of index.html
+
+Usage: esm.sh why [options] <package>
+
+Examples:
+  esm.sh why react
+  esm.sh why --file importmap.json react
+
+Arguments:
+  <package>      The package name, e.g. "react", "jsr:@std/encoding" or "gh:owner/repo"
+
+Options:
+	--file         The import map file (HTML, JSON, deno.json or deno.jsonc), default is index.html
+  --help, -h     Show help message
+`
+
+// Why explains why the versions of a package are in the import map
+func Why() {
+	files := fileFlag()
+	args, help := parseCommandFlags()
+
+	if help || len(args) == 0 {
+		fmt.Print(whyHelpMessage)
+		return
+	}
+
+	err := why(*files, args[0])
+	if err != nil {
+		fmt.Println(term.Red("✖︎"), "Failed to explain "+args[0]+": "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func why(filenames []string, name string) (err error) {
+	im, _, err := loadImportMapFiles(filenames)
+	if err != nil {
+		return
+	}
+	if !im.exists {
+		return fmt.Errorf("%s not found", filepath.Base(im.filename))
+	}
+
+	term.HideCursor()
+	spinner := term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+	entries, reason, errors := im.Why(name)
+	spinner.Stop()
+	term.ShowCursor()
+
+	if len(errors) > 0 {
+		return errors[0]
+	}
+	if len(entries) == 0 {
+		fmt.Println(term.Dim(name + " is not in the import map."))
+		return
+	}
+
+	for _, entry := range entries {
+		location := entry.Location
+		if location != "imports" {
+			location = "scope " + location
+		}
+		fmt.Println(term.Green(name+"@"+entry.Version), term.Dim(location))
+		if entry.TopLevel {
+			fmt.Println("  " + term.Dim("└") + " top-level import")
+		}
+		for _, dependent := range entry.Dependents {
+			fmt.Println("  "+term.Dim("└"), dependent.Importer, term.Dim(dependencyKind(dependent)+" "+dependencyRange(dependent)))
+		}
+		if !entry.TopLevel && len(entry.Dependents) == 0 {
+			fmt.Println("  " + term.Dim("└ no import depends on it, run `esm.sh tidy` to remove it"))
+		}
+	}
+	if reason != "" {
+		fmt.Println(term.Cyan("→"), reason)
+	}
+	return
+}
+
+func dependencyKind(dependent importmap.Dependent) string {
+	if dependent.Peer {
+		return "peer"
+	}
+	return "dependency"
+}
+
+func dependencyRange(dependent importmap.Dependent) string {
+	if dependent.Range == "" {
+		return "latest"
+	}
+	return dependent.Range
+}
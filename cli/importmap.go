@@ -0,0 +1,390 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/esm-dev/esm.sh/internal/jsonc"
+	"github.com/ije/gox/term"
+	"golang.org/x/net/html"
+)
+
+// importMapFile represents a file that contains an import map, it can be
+//   - a HTML file with a `<script type="importmap">` tag
+//   - a JSON file of the import map, e.g. importmap.json
+//   - a `deno.json` or `deno.jsonc` file with the `imports` and `scopes` fields
+type importMapFile struct {
+	*importmap.ImportMap
+	filename string
+	format   string // "html", "json" or "deno"
+	exists   bool
+	data     []byte
+	mode     os.FileMode
+	// the offsets of the content of the `<script type="importmap">` tag in a HTML file,
+	// or the insert point if the HTML file has no import map
+	start  int
+	end    int
+	insert string // "script" or "head"
+	// the `modulepreload` hints of a HTML file, nil means the hints are kept as they are
+	preloads []preloadLink
+}
+
+// loadImportMapFiles loads the import map files of the `--file` flags, the first file is the source
+// import map, the others are kept in sync with it. If no file is specified, the closest index.html
+// is used.
+func loadImportMapFiles(filenames []string) (source *importMapFile, files []*importMapFile, err error) {
+	if len(filenames) == 0 {
+		var indexHtml string
+		indexHtml, _, err = lookupClosestFile("index.html")
+		if err != nil {
+			err = fmt.Errorf("Failed to lookup index.html: %w", err)
+			return
+		}
+		filenames = []string{indexHtml}
+	}
+	for _, filename := range filenames {
+		var f *importMapFile
+		f, err = loadImportMapFile(filename)
+		if err != nil {
+			return
+		}
+		files = append(files, f)
+	}
+	source = files[0]
+	return
+}
+
+// saveImportMapFiles writes the source import map to all the files, and updates the `esm.lock` file
+func saveImportMapFiles(source *importMapFile, files []*importMapFile) error {
+	for _, f := range files {
+		f.ImportMap = source.ImportMap
+		if err := f.save(); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(source.lockFilename(), source.LockFile().Bytes(), 0644)
+}
+
+// syncGraphIntegrity computes the integrity of the transitive modules of the import map,
+// e.g. chunks and node runtime modules, it returns false if the graph could not be resolved.
+func syncGraphIntegrity(im *importmap.ImportMap) bool {
+	term.HideCursor()
+	defer term.ShowCursor()
+
+	spinner := term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+	errors := im.SyncGraphIntegrity()
+	spinner.Stop()
+
+	for _, err := range errors {
+		fmt.Println(term.Red("[error]"), err.Error())
+	}
+	return len(errors) == 0
+}
+
+// lockFilename returns the filename of the `esm.lock` file next to the import map file
+func (f *importMapFile) lockFilename() string {
+	return filepath.Join(filepath.Dir(f.filename), "esm.lock")
+}
+
+// readLockFile reads the `esm.lock` file next to the import map file,
+// it returns nil if the lock file does not exist.
+func (f *importMapFile) readLockFile() (*importmap.LockFile, error) {
+	data, err := os.ReadFile(f.lockFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lock, err := importmap.ParseLockFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid esm.lock: %w", err)
+	}
+	return lock, nil
+}
+
+// loadImportMapFile loads the import map of the given file, if the file is a HTML file with
+// an external import map (`<script type="importmap" src="importmap.json">`), the external
+// import map file is loaded instead.
+func loadImportMapFile(filename string) (f *importMapFile, err error) {
+	filename, err = filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	f = &importMapFile{
+		ImportMap: importmap.Blank(),
+		filename:  filename,
+		format:    importMapFileFormat(filename),
+		mode:      0644,
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if fi.IsDir() {
+		err = fmt.Errorf("%s is a directory", filename)
+		return
+	}
+	f.data, err = os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	f.exists = true
+	f.mode = fi.Mode()
+	switch f.format {
+	case "html":
+		var src string
+		src, err = f.parseHtml()
+		if err == nil && src != "" {
+			if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "//") {
+				err = fmt.Errorf("could not update the remote import map %s", src)
+				return
+			}
+			src = strings.TrimPrefix(src, "/")
+			return loadImportMapFile(filepath.Join(filepath.Dir(filename), filepath.FromSlash(src)))
+		}
+	case "deno":
+		err = f.parseDenoJson()
+	default:
+		if len(bytes.TrimSpace(f.data)) > 0 {
+			f.ImportMap, err = importmap.Parse(nil, f.data)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid import map in %s: %w", filepath.Base(filename), err)
+	}
+	return
+}
+
+// importMapFileFormat returns the format of the import map file by the filename
+func importMapFileFormat(filename string) string {
+	basename := filepath.Base(filename)
+	switch {
+	case basename == "deno.json" || basename == "deno.jsonc":
+		return "deno"
+	case strings.HasSuffix(basename, ".html") || strings.HasSuffix(basename, ".htm"):
+		return "html"
+	default:
+		return "json"
+	}
+}
+
+// parseHtml parses the `<script type="importmap">` tag of the HTML file,
+// it returns the `src` attribute if the import map is external.
+func (f *importMapFile) parseHtml() (src string, err error) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(f.data))
+	offset := 0
+	for {
+		token := tokenizer.Next()
+		if token == html.ErrorToken && tokenizer.Err() == io.EOF {
+			break
+		}
+		raw := tokenizer.Raw()
+		if token == html.EndTagToken && f.insert == "" {
+			tagName, _ := tokenizer.TagName()
+			if string(tagName) == "head" {
+				f.start, f.end, f.insert = offset, offset, "head"
+			}
+		}
+		if token == html.StartTagToken {
+			tagName, moreAttr := tokenizer.TagName()
+			if string(tagName) == "script" && moreAttr {
+				var typeAttr, srcAttr string
+				for moreAttr {
+					var key, val []byte
+					key, val, moreAttr = tokenizer.TagAttr()
+					switch string(key) {
+					case "type":
+						typeAttr = string(val)
+					case "src":
+						srcAttr = string(val)
+					}
+				}
+				if typeAttr == "importmap" {
+					if srcAttr != "" {
+						return srcAttr, nil
+					}
+					f.start = offset + len(raw)
+					f.end = f.start
+					f.insert = ""
+					if tokenizer.Next() == html.TextToken {
+						f.end += len(tokenizer.Raw())
+						importMapJson := bytes.TrimSpace(tokenizer.Text())
+						if len(importMapJson) > 0 {
+							f.ImportMap, err = importmap.Parse(nil, importMapJson)
+						}
+					}
+					return
+				}
+				if f.insert == "" {
+					f.start, f.end, f.insert = offset, offset, "script"
+				}
+			}
+		}
+		offset += len(raw)
+	}
+	if f.insert == "" {
+		err = fmt.Errorf("no <head> tag found")
+	}
+	return
+}
+
+// parseDenoJson parses the `imports` and `scopes` fields of the deno.json file, comments and trailing commas
+// are allowed.
+func (f *importMapFile) parseDenoJson() (err error) {
+	var denoJson struct {
+		Imports map[string]string            `json:"imports,omitempty"`
+		Scopes  map[string]map[string]string `json:"scopes,omitempty"`
+	}
+	err = json.Unmarshal(jsonc.StripJSONC(f.data), &denoJson)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(denoJson)
+	if err != nil {
+		return
+	}
+	f.ImportMap, err = importmap.Parse(nil, data)
+	return
+}
+
+// save writes the import map to the file
+func (f *importMapFile) save() (err error) {
+	buf := bytes.NewBuffer(nil)
+	switch f.format {
+	case "html":
+		if !f.exists {
+			return fmt.Errorf("%s not found", filepath.Base(f.filename))
+		}
+		buf.Write(f.data[:f.start])
+		switch f.insert {
+		case "script":
+			buf.WriteString("<script type=\"importmap\">\n")
+			buf.WriteString(f.FormatJSON(2))
+			buf.WriteString("\n  </script>\n  ")
+		case "head":
+			buf.WriteString("  <script type=\"importmap\">\n")
+			buf.WriteString(f.FormatJSON(2))
+			buf.WriteString("\n  </script>\n")
+		default:
+			buf.WriteString("\n")
+			buf.WriteString(f.FormatJSON(2))
+			buf.WriteString("\n  ")
+		}
+		buf.Write(f.data[f.end:])
+		if f.preloads != nil {
+			data := splicePreloadLinks(buf.Bytes(), f.CDNOrigin(), f.preloads)
+			return os.WriteFile(f.filename, data, f.mode)
+		}
+	case "deno":
+		var data []byte
+		data, err = f.spliceDenoJson()
+		if err != nil {
+			return
+		}
+		buf.Write(data)
+	default:
+		buf.WriteString(f.FormatJSON(0))
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(f.filename, buf.Bytes(), f.mode)
+}
+
+// spliceDenoJson replaces the `imports` and `scopes` fields of the deno.json file,
+// other fields and the comments are kept as they are.
+func (f *importMapFile) spliceDenoJson() ([]byte, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(f.FormatJSON(0)), &fields)
+	if err != nil {
+		return nil, err
+	}
+	if !f.exists || len(bytes.TrimSpace(f.data)) == 0 {
+		data := []byte("{\n  \"imports\": ")
+		data = append(data, fields["imports"]...)
+		if scopes, ok := fields["scopes"]; ok {
+			data = append(data, ",\n  \"scopes\": "...)
+			data = append(data, scopes...)
+		}
+		return append(data, "\n}\n"...), nil
+	}
+
+	// find the offsets of the `imports` and `scopes` fields, the stripped JSONC keeps the offsets of the source
+	stripped := jsonc.StripJSONC(f.data)
+	offsets := map[string][2]int{}
+	dec := json.NewDecoder(bytes.NewReader(stripped))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("invalid deno.json")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if key := t.(string); key == "imports" || key == "scopes" {
+			end := int(dec.InputOffset())
+			offsets[key] = [2]int{end - len(value), end}
+		}
+	}
+	type splice struct {
+		start int
+		end   int
+		data  []byte
+	}
+	var splices []splice
+	var missing []byte
+	for _, key := range []string{"imports", "scopes"} {
+		value, ok := fields[key]
+		if offset, exists := offsets[key]; exists {
+			if !ok {
+				value = []byte("{}")
+			}
+			splices = append(splices, splice{offset[0], offset[1], value})
+		} else if ok {
+			missing = append(missing, ",\n  \""+key+"\": "...)
+			missing = append(missing, value...)
+		}
+	}
+	if len(missing) > 0 {
+		// insert the missing fields after the last field
+		end := bytes.LastIndexByte(stripped, '}')
+		start := bytes.LastIndexFunc(stripped[:end], func(r rune) bool {
+			return r != ' ' && r != '\t' && r != '\n' && r != '\r'
+		}) + 1
+		if stripped[start-1] == '{' {
+			// empty object
+			missing = missing[1:]
+		}
+		if start == end || bytes.Equal(stripped[start:end], f.data[start:end]) {
+			splices = append(splices, splice{start, end, append(missing, '\n')})
+		} else {
+			// keep the comments after the last field
+			splices = append(splices, splice{start, start, missing})
+		}
+	}
+	sort.Slice(splices, func(i, j int) bool {
+		return splices[i].start < splices[j].start
+	})
+
+	// apply the splices from the end to the start
+	data := bytes.Clone(f.data)
+	for i := len(splices) - 1; i >= 0; i-- {
+		s := splices[i]
+		data = append(data[:s.start], append(bytes.Clone(s.data), data[s.end:]...)...)
+	}
+	return data, nil
+}
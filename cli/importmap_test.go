@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/jsonc"
+)
+
+func TestDenoJsonc(t *testing.T) {
+	if format := importMapFileFormat("/app/deno.jsonc"); format != "deno" {
+		t.Fatalf("expected deno format, got %s", format)
+	}
+
+	testCases := []struct {
+		data     string
+		expected []string
+	}{
+		{
+			data: strings.Join([]string{
+				`{`,
+				`  // the tasks`,
+				`  "tasks": { "dev": "deno run -A dev.ts" },`,
+				`  "imports": {`,
+				`    "react": "https://esm.sh/react@18.0.0",`,
+				`  },`,
+				`  /* trailing */`,
+				`}`,
+			}, "\n"),
+			expected: []string{"// the tasks", "/* trailing */", "https://esm.sh/react@19.0.0"},
+		},
+		{
+			data: strings.Join([]string{
+				`{`,
+				`  "tasks": { "dev": "deno run -A dev.ts" }, // the tasks`,
+				`}`,
+			}, "\n"),
+			expected: []string{"// the tasks", `"imports": {`, "https://esm.sh/react@19.0.0"},
+		},
+	}
+	for _, testCase := range testCases {
+		f := &importMapFile{filename: "deno.jsonc", format: "deno", exists: true, data: []byte(testCase.data)}
+		if err := f.parseDenoJson(); err != nil {
+			t.Fatal(err)
+		}
+		f.Imports.Set("react", "https://esm.sh/react@19.0.0")
+		data, err := f.spliceDenoJson()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range testCase.expected {
+			if !strings.Contains(string(data), s) {
+				t.Fatalf("missing %q in deno.jsonc: %s", s, data)
+			}
+		}
+		var denoJson struct {
+			Tasks   map[string]string `json:"tasks"`
+			Imports map[string]string `json:"imports"`
+		}
+		if err := json.Unmarshal(jsonc.StripJSONC(data), &denoJson); err != nil {
+			t.Fatalf("invalid deno.jsonc: %v\n%s", err, data)
+		}
+		if denoJson.Tasks["dev"] == "" || denoJson.Imports["react"] != "https://esm.sh/react@19.0.0" {
+			t.Fatalf("unexpected deno.jsonc: %s", data)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/importmap"
+	"github.com/ije/gox/set"
+	"github.com/ije/gox/term"
+	"golang.org/x/net/html"
+)
+
+// defaultPreloadLimit is the default maximum number of `modulepreload` hints of a HTML file
+const defaultPreloadLimit = 10
+
+var regexpStaticImport = regexp.MustCompile(`(?:^|[^\w$.])(?:import|export)\s*(?:[\w$*{}\s,]+?\s*from\s*)?["']([^"'\s]+)["']`)
+
+// preloadLink represents a `<link rel="modulepreload">` hint of a HTML file
+type preloadLink struct {
+	href      string
+	integrity string
+}
+
+// updatePreloads computes the `modulepreload` hints of the HTML files from the static dependency graph of
+// their entry scripts, the hints of a file are updated if `preload` is true or the file has the hints already.
+// It returns false if the graph could not be resolved.
+func updatePreloads(im *importmap.ImportMap, files []*importMapFile, preload bool, limit int) bool {
+	cdnOrigin := im.CDNOrigin()
+	var htmlFiles []*importMapFile
+	for _, f := range files {
+		if f.format == "html" && f.exists && (preload || hasPreloadLinks(f.data, cdnOrigin)) {
+			htmlFiles = append(htmlFiles, f)
+		}
+	}
+	if len(htmlFiles) == 0 {
+		return true
+	}
+
+	term.HideCursor()
+	defer term.ShowCursor()
+	spinner := term.NewSpinner(term.SpinnerConfig{})
+	spinner.Start()
+
+	for _, f := range htmlFiles {
+		var moduleUrls []string
+		for _, specifier := range f.entryImports() {
+			if url, ok := im.Resolve(specifier, nil); ok || strings.HasPrefix(specifier, cdnOrigin+"/") {
+				moduleUrls = append(moduleUrls, url)
+			}
+		}
+		urls, errors := im.StaticGraph(moduleUrls)
+		if len(errors) > 0 {
+			spinner.Stop()
+			for _, err := range errors {
+				fmt.Println(term.Red("[error]"), err.Error())
+			}
+			return false
+		}
+		if len(urls) > limit {
+			urls = urls[:max(limit, 0)]
+		}
+		f.preloads = make([]preloadLink, 0, len(urls))
+		for _, url := range urls {
+			integrity, _ := im.Integrity().Get(url)
+			f.preloads = append(f.preloads, preloadLink{href: url, integrity: integrity})
+		}
+	}
+	spinner.Stop()
+	return true
+}
+
+// entryImports returns the imports of the module scripts of the HTML file in order,
+// the local module scripts are scanned recursively.
+func (f *importMapFile) entryImports() (specifiers []string) {
+	seen := set.New[string]()
+	visited := set.New[string]()
+	var scan func(code []byte, dir string)
+	scan = func(code []byte, dir string) {
+		for _, m := range regexpStaticImport.FindAllSubmatch(code, -1) {
+			specifier := string(m[1])
+			if isLocalSpecifier(specifier) {
+				filename := localModuleFilename(dir, filepath.Dir(f.filename), specifier)
+				if !visited.Has(filename) {
+					visited.Add(filename)
+					if data, err := os.ReadFile(filename); err == nil {
+						scan(data, filepath.Dir(filename))
+					}
+				}
+			} else if !seen.Has(specifier) {
+				seen.Add(specifier)
+				specifiers = append(specifiers, specifier)
+			}
+		}
+	}
+
+	rootDir := filepath.Dir(f.filename)
+	tokenizer := html.NewTokenizer(bytes.NewReader(f.data))
+	for {
+		token := tokenizer.Next()
+		if token == html.ErrorToken && tokenizer.Err() == io.EOF {
+			break
+		}
+		if token != html.StartTagToken {
+			continue
+		}
+		tagName, moreAttr := tokenizer.TagName()
+		if string(tagName) != "script" {
+			continue
+		}
+		var typeAttr, srcAttr string
+		for moreAttr {
+			var key, val []byte
+			key, val, moreAttr = tokenizer.TagAttr()
+			switch string(key) {
+			case "type":
+				typeAttr = string(val)
+			case "src":
+				srcAttr = string(val)
+			}
+		}
+		if typeAttr != "module" {
+			continue
+		}
+		if srcAttr != "" {
+			// a module script of the CDN or a local module script
+			scan(fmt.Appendf(nil, "import %q", srcAttr), rootDir)
+		} else if tokenizer.Next() == html.TextToken {
+			scan(tokenizer.Raw(), rootDir)
+		}
+	}
+	return
+}
+
+// isLocalSpecifier returns true if the specifier is a path of a local module, e.g. "./app.js"
+func isLocalSpecifier(specifier string) bool {
+	return strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") || (strings.HasPrefix(specifier, "/") && !strings.HasPrefix(specifier, "//"))
+}
+
+// localModuleFilename returns the filename of the local module, the absolute paths are relative to the root directory
+func localModuleFilename(dir string, rootDir string, specifier string) string {
+	specifier, _, _ = strings.Cut(specifier, "?")
+	specifier, _, _ = strings.Cut(specifier, "#")
+	if strings.HasPrefix(specifier, "/") {
+		return filepath.Join(rootDir, filepath.FromSlash(specifier))
+	}
+	return filepath.Join(dir, filepath.FromSlash(specifier))
+}
+
+// isPreloadLink returns true if the tag is a `<link rel="modulepreload">` of the CDN
+func isPreloadLink(tokenizer *html.Tokenizer, cdnOrigin string) bool {
+	tagName, moreAttr := tokenizer.TagName()
+	if string(tagName) != "link" {
+		return false
+	}
+	var relAttr, hrefAttr string
+	for moreAttr {
+		var key, val []byte
+		key, val, moreAttr = tokenizer.TagAttr()
+		switch string(key) {
+		case "rel":
+			relAttr = string(val)
+		case "href":
+			hrefAttr = string(val)
+		}
+	}
+	return relAttr == "modulepreload" && strings.HasPrefix(hrefAttr, cdnOrigin+"/")
+}
+
+// hasPreloadLinks returns true if the HTML has `<link rel="modulepreload">` hints of the CDN
+func hasPreloadLinks(data []byte, cdnOrigin string) bool {
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		token := tokenizer.Next()
+		if token == html.ErrorToken && tokenizer.Err() == io.EOF {
+			return false
+		}
+		if (token == html.StartTagToken || token == html.SelfClosingTagToken) && isPreloadLink(tokenizer, cdnOrigin) {
+			return true
+		}
+	}
+}
+
+// splicePreloadLinks replaces the `<link rel="modulepreload">` hints of the CDN in the HTML,
+// the new hints are inserted after the `<script type="importmap">` tag.
+func splicePreloadLinks(data []byte, cdnOrigin string, links []preloadLink) []byte {
+	var removed [][2]int
+	insertAt := -1
+	indent := ""
+	inImportMap := false
+	offset := 0
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		token := tokenizer.Next()
+		if token == html.ErrorToken && tokenizer.Err() == io.EOF {
+			break
+		}
+		raw := tokenizer.Raw()
+		switch token {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if isPreloadLink(tokenizer, cdnOrigin) {
+				// remove the whole line of the tag
+				start := offset
+				for start > 0 && (data[start-1] == ' ' || data[start-1] == '\t') {
+					start--
+				}
+				if start > 0 && data[start-1] == '\n' {
+					start--
+				}
+				removed = append(removed, [2]int{start, offset + len(raw)})
+			} else if insertAt == -1 && bytes.HasPrefix(raw, []byte("<script")) && bytes.Contains(raw, []byte("importmap")) {
+				inImportMap = true
+				lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+				indent = string(data[lineStart:offset])
+				if strings.TrimLeft(indent, " \t") != "" {
+					indent = "  "
+				}
+			}
+		case html.EndTagToken:
+			if inImportMap {
+				inImportMap = false
+				insertAt = offset + len(raw)
+			}
+		}
+		offset += len(raw)
+	}
+	if insertAt == -1 {
+		return data
+	}
+
+	buf := bytes.NewBuffer(nil)
+	pos := 0
+	write := func(end int) {
+		for len(removed) > 0 && removed[0][0] < end {
+			buf.Write(data[pos:removed[0][0]])
+			pos = removed[0][1]
+			removed = removed[1:]
+		}
+		buf.Write(data[pos:end])
+		pos = end
+	}
+	write(insertAt)
+	for _, link := range links {
+		buf.WriteByte('\n')
+		buf.WriteString(indent)
+		buf.WriteString(`<link rel="modulepreload" href="`)
+		buf.WriteString(html.EscapeString(link.href))
+		buf.WriteByte('"')
+		if link.integrity != "" {
+			buf.WriteString(` integrity="`)
+			buf.WriteString(html.EscapeString(link.integrity))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte('>')
+	}
+	write(len(data))
+	return buf.Bytes()
+}
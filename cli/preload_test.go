@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplicePreloadLinks(t *testing.T) {
+	const cdnOrigin = "https://esm.sh"
+	links := []preloadLink{
+		{href: cdnOrigin + "/react@19.0.0/es2022/react.mjs", integrity: "sha384-react"},
+		{href: cdnOrigin + "/*app@1.0.0/es2022/app.mjs"},
+	}
+
+	testCases := []struct {
+		name     string
+		html     string
+		links    []preloadLink
+		expected string
+	}{
+		{
+			name: "insert after the import map",
+			html: strings.Join([]string{
+				`<html>`,
+				`<head>`,
+				`  <script type="importmap">{}</script>`,
+				`</head>`,
+				`</html>`,
+			}, "\n"),
+			links: links,
+			expected: strings.Join([]string{
+				`<html>`,
+				`<head>`,
+				`  <script type="importmap">{}</script>`,
+				`  <link rel="modulepreload" href="https://esm.sh/react@19.0.0/es2022/react.mjs" integrity="sha384-react">`,
+				`  <link rel="modulepreload" href="https://esm.sh/*app@1.0.0/es2022/app.mjs">`,
+				`</head>`,
+				`</html>`,
+			}, "\n"),
+		},
+		{
+			name: "replace the existing hints of the CDN",
+			html: strings.Join([]string{
+				`<head>`,
+				`  <link rel="modulepreload" href="https://esm.sh/react@18.3.1/es2022/react.mjs">`,
+				`  <script type="importmap">{}</script>`,
+				`  <link rel="modulepreload" href="https://esm.sh/*app@0.9.0/es2022/app.mjs" />`,
+				`  <link rel="modulepreload" href="/local.js">`,
+				`</head>`,
+			}, "\n"),
+			links: links,
+			expected: strings.Join([]string{
+				`<head>`,
+				`  <script type="importmap">{}</script>`,
+				`  <link rel="modulepreload" href="https://esm.sh/react@19.0.0/es2022/react.mjs" integrity="sha384-react">`,
+				`  <link rel="modulepreload" href="https://esm.sh/*app@1.0.0/es2022/app.mjs">`,
+				`  <link rel="modulepreload" href="/local.js">`,
+				`</head>`,
+			}, "\n"),
+		},
+		{
+			name: "remove all hints",
+			html: strings.Join([]string{
+				`<head>`,
+				`  <script type="importmap">{}</script>`,
+				`  <link rel="modulepreload" href="https://esm.sh/react@18.3.1/es2022/react.mjs">`,
+				`</head>`,
+			}, "\n"),
+			links: []preloadLink{},
+			expected: strings.Join([]string{
+				`<head>`,
+				`  <script type="importmap">{}</script>`,
+				`</head>`,
+			}, "\n"),
+		},
+		{
+			name: "keep the indentation of the import map",
+			html: strings.Join([]string{
+				`<html>`,
+				`	<head>`,
+				`		<script type="importmap">`,
+				`			{}`,
+				`		</script>`,
+				`	</head>`,
+				`</html>`,
+			}, "\n"),
+			links: links[:1],
+			expected: strings.Join([]string{
+				`<html>`,
+				`	<head>`,
+				`		<script type="importmap">`,
+				`			{}`,
+				`		</script>`,
+				`		<link rel="modulepreload" href="https://esm.sh/react@19.0.0/es2022/react.mjs" integrity="sha384-react">`,
+				`	</head>`,
+				`</html>`,
+			}, "\n"),
+		},
+		{
+			name:     "use the default indentation if the import map is not at the line start",
+			html:     `<head><meta charset="utf-8"><script type="importmap">{}</script></head>`,
+			links:    links[1:],
+			expected: `<head><meta charset="utf-8"><script type="importmap">{}</script>` + "\n" + `  <link rel="modulepreload" href="https://esm.sh/*app@1.0.0/es2022/app.mjs"></head>`,
+		},
+		{
+			name: "a page without <head>",
+			html: strings.Join([]string{
+				`<script type="importmap">{}</script>`,
+				`<script type="module" src="./app.js"></script>`,
+			}, "\n"),
+			links: links[:1],
+			expected: strings.Join([]string{
+				`<script type="importmap">{}</script>`,
+				`<link rel="modulepreload" href="https://esm.sh/react@19.0.0/es2022/react.mjs" integrity="sha384-react">`,
+				`<script type="module" src="./app.js"></script>`,
+			}, "\n"),
+		},
+		{
+			name:     "a page without import map is not changed",
+			html:     `<body><link rel="modulepreload" href="https://esm.sh/react@18.3.1/es2022/react.mjs"></body>`,
+			links:    links,
+			expected: `<body><link rel="modulepreload" href="https://esm.sh/react@18.3.1/es2022/react.mjs"></body>`,
+		},
+	}
+	for _, tc := range testCases {
+		data := splicePreloadLinks([]byte(tc.html), cdnOrigin, tc.links)
+		if string(data) != tc.expected {
+			t.Fatalf("%s: unexpected output:\n%s\nexpected:\n%s", tc.name, data, tc.expected)
+		}
+		// re-running must not duplicate the hints
+		if again := splicePreloadLinks(data, cdnOrigin, tc.links); string(again) != tc.expected {
+			t.Fatalf("%s: the hints are changed by re-running:\n%s", tc.name, again)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"golang.org/x/term"
 )
@@ -49,6 +50,25 @@ func (t *termRaw) isTTY() bool {
 	return term.IsTerminal(t.fd)
 }
 
+// stringsFlag is a flag that can be specified multiple times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// fileFlag defines the `--file` flag to specify the import map files
+func fileFlag() *stringsFlag {
+	files := &stringsFlag{}
+	flag.Var(files, "file", "the import map file")
+	return files
+}
+
 // parseCommandFlags parses the command flags
 func parseCommandFlags() (args []string, helpFlag bool) {
 	help := flag.Bool("help", false, "Print help message")
@@ -0,0 +1,28 @@
+package importmap_test
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/esm-dev/esm.sh/importmap"
+)
+
+func ExampleImportMap_Resolve() {
+	baseUrl, _ := url.Parse("https://example.com/index.html")
+	im, err := importmap.Parse(baseUrl, []byte(`{"imports": {"react": "https://esm.sh/react@19.2.4", "app/": "./src/"}}`))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(im.Resolve("react", nil))
+	fmt.Println(im.Resolve("app/main.js", nil))
+	fmt.Println(im.FormatJSON(0))
+	// Output:
+	// https://esm.sh/react@19.2.4 true
+	// https://example.com/src/main.js true
+	// {
+	//   "imports": {
+	//     "app/": "./src/",
+	//     "react": "https://esm.sh/react@19.2.4"
+	//   }
+	// }
+}
@@ -0,0 +1,152 @@
+package importmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/esm-dev/esm.sh/internal/app_dir"
+)
+
+// Cache caches the immutable responses of the CDN, e.g. the metadata of an exact version,
+// the keys are the request urls. The methods may be called from multiple goroutines.
+type Cache interface {
+	// Get returns the cached data of the key, ok is false if the key is not cached.
+	Get(key string) (data []byte, ok bool)
+	// Set stores the data of the key, errors are ignored since the cache is optional.
+	Set(key string, data []byte)
+}
+
+// MemoryCache is a Cache that stores the data in memory, the zero value is ready to use.
+type MemoryCache struct {
+	store sync.Map
+}
+
+// NewMemoryCache creates a new memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{}
+}
+
+// Get returns the data of the key.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	if v, ok := c.store.Load(key); ok {
+		return v.([]byte), true
+	}
+	return nil, false
+}
+
+// Set stores the data of the key.
+func (c *MemoryCache) Set(key string, data []byte) {
+	c.store.Store(key, data)
+}
+
+// FSCache is a Cache that stores the data in a directory, the data is cached in memory as well.
+// Each entry is stored in a file named by the SHA-256 hash of its key.
+type FSCache struct {
+	dir    string
+	memory MemoryCache
+}
+
+// NewFSCache creates a new cache that stores the data in the given directory.
+func NewFSCache(dir string) *FSCache {
+	return &FSCache{dir: dir}
+}
+
+// Get returns the data of the key.
+func (c *FSCache) Get(key string) ([]byte, bool) {
+	if data, ok := c.memory.Get(key); ok {
+		return data, true
+	}
+	data, err := os.ReadFile(c.filename(key))
+	if err != nil {
+		return nil, false
+	}
+	c.memory.Set(key, data)
+	return data, true
+}
+
+// Set stores the data of the key.
+func (c *FSCache) Set(key string, data []byte) {
+	c.memory.Set(key, data)
+	filename := c.filename(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err == nil {
+		os.WriteFile(filename, data, 0644)
+	}
+}
+
+func (c *FSCache) filename(key string) string {
+	sha := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sha[:]))
+}
+
+// DefaultCache returns the default cache of the import maps, which stores the data in the
+// `meta` directory of the esm.sh app directory, e.g. `~/.esm.sh/meta`. A memory cache is
+// returned if the app directory could not be resolved.
+func DefaultCache() Cache {
+	return defaultCache()
+}
+
+var defaultCache = sync.OnceValue(func() Cache {
+	appDir, err := app_dir.GetAppDir()
+	if err != nil {
+		return NewMemoryCache()
+	}
+	return NewFSCache(filepath.Join(appDir, "meta"))
+})
+
+// SetHTTPClient sets the http client to fetch the metadata from the CDN, default is `http.DefaultClient`.
+// A nil client restores the default.
+func (im *ImportMap) SetHTTPClient(client *http.Client) {
+	im.client = client
+}
+
+// SetCache sets the cache of the metadata fetched from the CDN, default is `DefaultCache()`.
+// A nil cache restores the default, use `NewMemoryCache()` to avoid writing to the disk.
+func (im *ImportMap) SetCache(cache Cache) {
+	im.cache = cache
+}
+
+func (im *ImportMap) httpClient() *http.Client {
+	if im.client != nil {
+		return im.client
+	}
+	return http.DefaultClient
+}
+
+func (im *ImportMap) fetchCache() Cache {
+	if im.cache != nil {
+		return im.cache
+	}
+	return DefaultCache()
+}
+
+// fetch fetches the url with the http client of the import map, it returns `errNotFound` if the status is 404.
+func (im *ImportMap) fetch(url string) (data []byte, err error) {
+	resp, err := im.httpClient().Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		err = errNotFound
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		msg, _ := io.ReadAll(resp.Body)
+		err = fmt.Errorf("unexpected http status %d: %s", resp.StatusCode, msg)
+		return
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("could not read %s: %s", url, err.Error())
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package importmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestFetchImportMeta(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/react@19", "/react@19.0.0":
+			json.NewEncoder(w).Encode(ImportMeta{Import: Import{Name: "react", Version: "19.0.0"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cdn.Close()
+
+	transport := &countingTransport{}
+	cache := NewFSCache(filepath.Join(t.TempDir(), "meta"))
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetHTTPClient(&http.Client{Transport: transport})
+	im.SetCache(cache)
+
+	meta, err := im.FetchImportMeta(Import{Name: "react", Version: "19"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != "19.0.0" {
+		t.Fatalf("Expected version 19.0.0, got %s", meta.Version)
+	}
+
+	// the metadata of the exact version is cached
+	meta, err = im.FetchImportMeta(Import{Name: "react", Version: "19.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != "19.0.0" || transport.requests.Load() != 1 {
+		t.Fatalf("Expected the cached metadata, got %s with %d requests", meta.Version, transport.requests.Load())
+	}
+	if _, ok := NewFSCache(cache.dir).Get(cdn.URL + "/react@19.0.0?meta"); !ok {
+		t.Fatal("Expected the metadata to be cached on disk")
+	}
+
+	// the semver range is not cached
+	if _, err = im.FetchImportMeta(Import{Name: "react", Version: "19"}); err != nil {
+		t.Fatal(err)
+	}
+	if transport.requests.Load() != 2 {
+		t.Fatalf("Expected 2 requests, got %d", transport.requests.Load())
+	}
+
+	_, err = im.FetchImportMeta(Import{Name: "vue", Version: "3.0.0"})
+	if err == nil || err.Error() != "package not found: vue@3.0.0" {
+		t.Fatalf("Expected package not found error, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package importmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ije/gox/set"
+)
+
+// moduleGraph represents the `?meta&graph` response of a module of the CDN.
+type moduleGraph struct {
+	Integrity string            `json:"integrity"`
+	Graph     map[string]string `json:"graph"`
+}
+
+// fetchModuleGraph fetches the integrity of the module and the modules in its static import graph,
+// an empty integrity means the module is not built yet.
+func (im *ImportMap) fetchModuleGraph(moduleUrl string) (graph moduleGraph, err error) {
+	url := moduleUrl + "?meta&graph"
+
+	// check the cache first
+	cache := im.fetchCache()
+	if data, ok := cache.Get(url); ok && json.Unmarshal(data, &graph) == nil {
+		return
+	}
+
+	data, err := im.fetch(url)
+	if err != nil {
+		if err == errNotFound {
+			err = fmt.Errorf("module not found: %s", moduleUrl)
+		}
+		return
+	}
+
+	err = json.Unmarshal(data, &graph)
+	if err != nil {
+		err = fmt.Errorf("could not decode %s: %s", url, err.Error())
+		return
+	}
+
+	// only the complete graph is cached
+	for _, integrity := range graph.Graph {
+		if integrity == "" {
+			return
+		}
+	}
+	cache.Set(url, data)
+	return
+}
+
+// SyncGraphIntegrity computes the integrity of every module in the static import graph of the CDN imports,
+// including the chunks and the node runtime modules, and removes the integrity of the CDN modules that
+// are no longer reachable. A module that could not be fetched or has no integrity is reported as an error,
+// and nothing is changed if the graph could not be resolved completely.
+func (im *ImportMap) SyncGraphIntegrity() (errors []error) {
+	cdnOrigin := im.CDNOrigin()
+	cdnScopePrefix := cdnOrigin + "/"
+
+	integrity := map[string]string{}
+	var queue []string
+	collect := func(imports *Imports) {
+		imports.Range(func(_ string, url string) bool {
+			if strings.HasPrefix(url, cdnScopePrefix) {
+				if isBuildUrl(url) {
+					queue = append(queue, url)
+				} else if v, ok := im.integrity.Get(url); ok && v != "" {
+					// keep the integrity of the modules that are not builds, e.g. `https://esm.sh/react@19`
+					integrity[url] = v
+				}
+			}
+			return true
+		})
+	}
+	collect(im.Imports)
+	im.RangeScopes(func(_ string, imports *Imports) bool {
+		collect(imports)
+		return true
+	})
+
+	var lock sync.Mutex
+	visited := set.New[string]()
+	for len(queue) > 0 {
+		var next []string
+		var wg sync.WaitGroup
+		for _, moduleUrl := range queue {
+			if visited.Has(moduleUrl) {
+				continue
+			}
+			visited.Add(moduleUrl)
+			wg.Go(func() {
+				graph, err := im.fetchModuleGraph(moduleUrl)
+				lock.Lock()
+				defer lock.Unlock()
+				if err != nil {
+					errors = append(errors, err)
+					return
+				}
+				if graph.Integrity == "" {
+					errors = append(errors, fmt.Errorf("could not compute the integrity of %s, the module is not built", moduleUrl))
+					return
+				}
+				integrity[moduleUrl] = graph.Integrity
+				for pathname, v := range graph.Graph {
+					if v != "" {
+						integrity[cdnOrigin+pathname] = v
+					} else {
+						// the module is not built yet, fetch its graph to build it
+						next = append(next, cdnOrigin+pathname)
+					}
+				}
+			})
+		}
+		wg.Wait()
+		queue = next
+	}
+	if len(errors) > 0 {
+		return
+	}
+
+	for _, url := range im.integrity.Keys() {
+		if _, ok := integrity[url]; !ok && strings.HasPrefix(url, cdnScopePrefix) {
+			im.integrity.Delete(url)
+		}
+	}
+	for url, v := range integrity {
+		im.integrity.Set(url, v)
+	}
+	return
+}
+
+// isBuildUrl returns true if the url is a build of the CDN, e.g. `https://esm.sh/react@19.0.0/es2022/react.mjs`.
+func isBuildUrl(url string) bool {
+	return !strings.ContainsAny(url, "?#") && strings.HasSuffix(url, ".mjs") && buildTarget(url) != ""
+}
+
+// StaticGraph returns the CDN modules in the static dependency graph of the given module urls in breadth-first
+// order, the given modules come first. The dependencies of a module are resolved by the import map with the
+// `imports` of its metadata, the node runtime modules are included as well.
+func (im *ImportMap) StaticGraph(moduleUrls []string) (urls []string, errors []error) {
+	cdnScopePrefix := im.CDNOrigin() + "/"
+	visited := set.New[string]()
+	queue := moduleUrls
+	for len(queue) > 0 {
+		var level []string
+		for _, moduleUrl := range queue {
+			if strings.HasPrefix(moduleUrl, cdnScopePrefix) && !visited.Has(moduleUrl) {
+				visited.Add(moduleUrl)
+				level = append(level, moduleUrl)
+			}
+		}
+		urls = append(urls, level...)
+
+		// the dependencies of each module are kept in order
+		deps := make([][]string, len(level))
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		for i, moduleUrl := range level {
+			if strings.HasPrefix(moduleUrl, cdnScopePrefix+"node/") {
+				continue
+			}
+			wg.Go(func() {
+				imp, err := ParseEsmPath(moduleUrl)
+				if err != nil {
+					return
+				}
+				meta, err := im.FetchImportMeta(imp)
+				if err != nil {
+					lock.Lock()
+					errors = append(errors, err)
+					lock.Unlock()
+					return
+				}
+				deps[i] = im.resolveDeps(meta, moduleUrl)
+			})
+		}
+		wg.Wait()
+		if len(errors) > 0 {
+			return
+		}
+		queue = nil
+		for _, d := range deps {
+			queue = append(queue, d...)
+		}
+	}
+	return
+}
+
+// resolveDeps resolves the urls of the dependencies of the module with the import map.
+func (im *ImportMap) resolveDeps(meta ImportMeta, moduleUrl string) (urls []string) {
+	cdnOrigin := im.CDNOrigin()
+	for _, pathname := range slices.Concat(meta.PeerImports, meta.Imports) {
+		if strings.HasPrefix(pathname, "/node/") {
+			urls = append(urls, cdnOrigin+pathname)
+			continue
+		}
+		depImport, err := ParseEsmPath(pathname)
+		if err != nil {
+			continue
+		}
+		if depImport.Name == meta.Name && depImport.Github == meta.Github && depImport.Jsr == meta.Jsr {
+			// a sub-module of the same package is imported by path, with the "external all" modifier
+			// of the importer
+			if strings.Contains(moduleUrl, "/*") {
+				pathname = "/*" + strings.TrimPrefix(strings.TrimPrefix(pathname, "/"), "*")
+			}
+			urls = append(urls, cdnOrigin+pathname)
+			continue
+		}
+		if _, url, ok := im.lookupImport(depImport.Specifier(false), moduleUrl); ok {
+			urls = append(urls, url)
+		}
+	}
+	return
+}
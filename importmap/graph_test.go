@@ -0,0 +1,145 @@
+package importmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSyncGraphIntegrity(t *testing.T) {
+	graphs := map[string]moduleGraph{
+		"/*app@1.0.0/es2022/app.mjs": {
+			Integrity: "sha384-app",
+			Graph: map[string]string{
+				"/*app@1.0.0/es2022/chunk.mjs": "",
+				"/node/process.mjs":            "sha384-process",
+			},
+		},
+		"/*app@1.0.0/es2022/chunk.mjs": {
+			Integrity: "sha384-chunk",
+			Graph: map[string]string{
+				"/node/buffer.mjs": "sha384-buffer",
+			},
+		},
+		"/dep@1.0.0/es2022/dep.mjs": {
+			Integrity: "sha384-dep",
+		},
+		"/unbuilt@1.0.0/es2022/unbuilt.mjs": {
+			Graph: map[string]string{
+				"/node/buffer.mjs": "sha384-buffer",
+			},
+		},
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		graph, ok := graphs[r.URL.Path]
+		if !ok || !r.URL.Query().Has("graph") {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(graph)
+	}))
+	defer cdn.Close()
+
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetCache(NewMemoryCache())
+	im.Imports.Set("app", cdn.URL+"/*app@1.0.0/es2022/app.mjs")
+	im.Imports.Set("react", cdn.URL+"/react@19")
+	im.SetScopeImports(cdn.URL+"/", NewImports(map[string]string{
+		"dep": cdn.URL + "/dep@1.0.0/es2022/dep.mjs",
+	}))
+	im.integrity.Set(cdn.URL+"/react@19", "sha384-react")
+	im.integrity.Set(cdn.URL+"/old@1.0.0/es2022/old.mjs", "sha384-old")
+	im.integrity.Set("https://example.com/app.js", "sha384-example")
+
+	errors := im.SyncGraphIntegrity()
+	if len(errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", errors)
+	}
+	expected := map[string]string{
+		cdn.URL + "/*app@1.0.0/es2022/app.mjs":   "sha384-app",
+		cdn.URL + "/*app@1.0.0/es2022/chunk.mjs": "sha384-chunk",
+		cdn.URL + "/node/process.mjs":            "sha384-process",
+		cdn.URL + "/node/buffer.mjs":             "sha384-buffer",
+		cdn.URL + "/dep@1.0.0/es2022/dep.mjs":    "sha384-dep",
+		cdn.URL + "/react@19":                    "sha384-react",
+		"https://example.com/app.js":             "sha384-example",
+	}
+	if im.integrity.Len() != len(expected) {
+		t.Fatalf("Expected %d integrity entries, got %v", len(expected), im.integrity.Keys())
+	}
+	for url, integrity := range expected {
+		if v, _ := im.integrity.Get(url); v != integrity {
+			t.Fatalf("Expected the integrity of %s to be %s, got %s", url, integrity, v)
+		}
+	}
+
+	// nothing is changed if the graph could not be resolved
+	im.Imports.Set("missing", cdn.URL+"/missing@1.0.0/es2022/missing.mjs")
+	errors = im.SyncGraphIntegrity()
+	if len(errors) != 1 {
+		t.Fatalf("Expected 1 error, got %v", errors)
+	}
+	if im.integrity.Len() != len(expected) {
+		t.Fatalf("Expected the integrity to be unchanged, got %v", im.integrity.Keys())
+	}
+
+	// a module without integrity is reported as an error
+	im.Imports.Delete("missing")
+	im.Imports.Set("unbuilt", cdn.URL+"/unbuilt@1.0.0/es2022/unbuilt.mjs")
+	errors = im.SyncGraphIntegrity()
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), "unbuilt@1.0.0") {
+		t.Fatalf("Expected 1 error of the unbuilt module, got %v", errors)
+	}
+	if im.integrity.Len() != len(expected) {
+		t.Fatalf("Expected the integrity to be unchanged, got %v", im.integrity.Keys())
+	}
+}
+
+func TestStaticGraph(t *testing.T) {
+	metas := map[string]ImportMeta{
+		"/app@1.0.0": {
+			Import:      Import{Name: "app", Version: "1.0.0"},
+			Imports:     []string{"/app@1.0.0/es2022/util.mjs", "/dep@1.0.0/es2022/dep.mjs", "/node/process.mjs"},
+			PeerImports: []string{"/peer@1.0.0/es2022/peer.mjs"},
+		},
+		"/app@1.0.0/util": {Import: Import{Name: "app", Version: "1.0.0"}, Imports: []string{"/dep@1.0.0/es2022/dep.mjs"}},
+		"/dep@1.0.0":      {Import: Import{Name: "dep", Version: "1.0.0"}},
+		"/peer@1.0.0":     {Import: Import{Name: "peer", Version: "1.0.0"}},
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta, ok := metas[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(meta)
+	}))
+	defer cdn.Close()
+
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetCache(NewMemoryCache())
+	im.Imports.Set("app", cdn.URL+"/*app@1.0.0/es2022/app.mjs")
+	im.Imports.Set("peer", cdn.URL+"/peer@1.0.0/es2022/peer.mjs")
+	im.SetScopeImports(cdn.URL+"/", NewImports(map[string]string{
+		"dep": cdn.URL + "/dep@1.0.0/es2022/dep.mjs",
+	}))
+
+	urls, errors := im.StaticGraph([]string{cdn.URL + "/*app@1.0.0/es2022/app.mjs", "https://example.com/app.js"})
+	if len(errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", errors)
+	}
+	expected := []string{
+		cdn.URL + "/*app@1.0.0/es2022/app.mjs",
+		cdn.URL + "/peer@1.0.0/es2022/peer.mjs",
+		cdn.URL + "/*app@1.0.0/es2022/util.mjs",
+		cdn.URL + "/dep@1.0.0/es2022/dep.mjs",
+		cdn.URL + "/node/process.mjs",
+	}
+	if strings.Join(urls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected %v, got %v", expected, urls)
+	}
+}
@@ -1,10 +1,13 @@
+// Package importmap manages import maps with the esm.sh CDN, see README.md for the usage.
 package importmap
 
 import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -22,10 +25,13 @@ type Config struct {
 	Target string `json:"target,omitempty"`
 }
 
-// Imports represents a map of imports.
+// Imports represents a map of imports, the insertion order of the keys is preserved.
+// An empty value represents a `null` entry that blocks the resolution of the specifier.
 type Imports struct {
 	lock    sync.RWMutex
+	keys    []string
 	imports map[string]string
+	version int // incremented on every change, used to invalidate the normalized import map
 }
 
 // Len returns the length of the imports map.
@@ -35,17 +41,11 @@ func (i *Imports) Len() int {
 	return len(i.imports)
 }
 
-// Keys returns the keys of the imports map.
+// Keys returns the keys of the imports map in insertion order.
 func (i *Imports) Keys() []string {
 	i.lock.RLock()
 	defer i.lock.RUnlock()
-	keys := make([]string, len(i.imports))
-	idx := 0
-	for key := range i.imports {
-		keys[idx] = key
-		idx++
-	}
-	return keys
+	return slices.Clone(i.keys)
 }
 
 // Has returns true if the key is in the imports map.
@@ -68,22 +68,37 @@ func (i *Imports) Get(specifier string) (string, bool) {
 func (i *Imports) Set(specifier string, url string) {
 	i.lock.Lock()
 	defer i.lock.Unlock()
+	if _, ok := i.imports[specifier]; !ok {
+		i.keys = append(i.keys, specifier)
+	}
 	i.imports[specifier] = url
+	i.version++
 }
 
 // Delete deletes the value of the key in the imports map.
 func (i *Imports) Delete(specifier string) {
 	i.lock.Lock()
 	defer i.lock.Unlock()
-	delete(i.imports, specifier)
+	if _, ok := i.imports[specifier]; ok {
+		delete(i.imports, specifier)
+		i.keys = slices.DeleteFunc(i.keys, func(key string) bool { return key == specifier })
+		i.version++
+	}
+}
+
+// rev returns the version of the imports map.
+func (i *Imports) rev() int {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return i.version
 }
 
-// Range ranges over the imports map.
+// Range ranges over the imports map in insertion order.
 func (i *Imports) Range(fn func(specifier string, url string) bool) {
 	i.lock.RLock()
 	defer i.lock.RUnlock()
-	for specifier, url := range i.imports {
-		if !fn(specifier, url) {
+	for _, specifier := range i.keys {
+		if !fn(specifier, i.imports[specifier]) {
 			break
 		}
 	}
@@ -105,36 +120,87 @@ type ImportMap struct {
 	scopes    map[string]*Imports
 	integrity *Imports
 	baseUrl   *url.URL
+	resolved  map[string]resolvedModule // the resolved module set of the spec, used to merge import maps
+	scopesRev int                       // incremented when a scope is set or deleted
+	cached    *cachedImportMap          // the cached normalized import map
+	client    *http.Client
+	cache     Cache
 	lock      sync.RWMutex
 }
 
 // Blank creates a new import map with empty imports and scopes.
 func Blank() *ImportMap {
 	return &ImportMap{
-		Imports:   newImports(nil),
+		Imports:   NewImports(nil),
 		scopes:    make(map[string]*Imports),
-		integrity: newImports(nil),
+		integrity: NewImports(nil),
 	}
 }
 
 // Parse parses an importmap from a JSON string.
+// The insertion order of the specifier keys is preserved, and non-string addresses are parsed as `null`.
 func Parse(baseUrl *url.URL, data []byte) (im *ImportMap, err error) {
-	var importMapRaw ImportMapJson
-	if err = json.Unmarshal(data, &importMapRaw); err != nil {
-		return
+	dec := json.NewDecoder(bytes.NewReader(data))
+	im = Blank()
+	im.baseUrl = baseUrl
+	err = decodeObject(dec, func(key string) error {
+		switch key {
+		case "config":
+			return dec.Decode(&im.config)
+		case "imports":
+			return decodeSpecifierMap(dec, im.Imports)
+		case "scopes":
+			return decodeObject(dec, func(scope string) error {
+				imports := NewImports(nil)
+				im.scopes[scope] = imports
+				return decodeSpecifierMap(dec, imports)
+			})
+		case "integrity":
+			return decodeSpecifierMap(dec, im.integrity)
+		default:
+			var v json.RawMessage
+			return dec.Decode(&v)
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
-	scopes := make(map[string]*Imports)
-	for scope, imports := range importMapRaw.Scopes {
-		scopes[scope] = newImports(imports)
+	return
+}
+
+// decodeObject decodes a JSON object and calls the fn for each key, the fn must decode the value.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
 	}
-	im = &ImportMap{
-		baseUrl:   baseUrl,
-		config:    importMapRaw.Config,
-		Imports:   newImports(importMapRaw.Imports),
-		scopes:    scopes,
-		integrity: newImports(importMapRaw.Integrity),
+	if t != json.Delim('{') {
+		return fmt.Errorf("expected a JSON object, got %v", t)
 	}
-	return
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err = fn(t.(string)); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeSpecifierMap decodes a specifier map, non-string values are parsed as `null`.
+func decodeSpecifierMap(dec *json.Decoder, imports *Imports) error {
+	return decodeObject(dec, func(key string) error {
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		s, _ := v.(string)
+		imports.Set(key, s)
+		return nil
+	})
 }
 
 // Config returns the config of the import map.
@@ -169,6 +235,7 @@ func (im *ImportMap) GetScopeImports(scope string) (*Imports, bool) {
 func (im *ImportMap) SetScopeImports(scope string, imports *Imports) {
 	im.lock.Lock()
 	im.scopes[scope] = imports
+	im.scopesRev++
 	im.lock.Unlock()
 }
 
@@ -183,76 +250,6 @@ func (im *ImportMap) RangeScopes(fn func(scope string, imports *Imports) bool) {
 	}
 }
 
-// Resolve resolves a specifier to a URL.
-// It returns the URL and a boolean indicating if the specifier was found.
-// This function follows the import maps specification:
-// https://developer.mozilla.org/en-US/docs/Web/HTML/Reference/Elements/script/type/importmap
-func (im *ImportMap) Resolve(specifier string, referrer *url.URL) (string, bool) {
-	if im.baseUrl == nil {
-		im.baseUrl, _ = url.Parse("file:///")
-	}
-
-	var hash string
-	specifier, hash = utils.SplitByFirstByte(specifier, '#')
-	if hash != "" {
-		hash = "#" + hash
-	}
-
-	var query string
-	specifier, query = utils.SplitByFirstByte(specifier, '?')
-	if query != "" {
-		query = "?" + query
-	}
-
-	if referrer != nil && len(im.scopes) > 0 {
-		scopeKeys := make(ScopeKeys, 0, len(im.scopes))
-		for prefix := range im.scopes {
-			scopeKeys = append(scopeKeys, prefix)
-		}
-		sort.Sort(scopeKeys)
-		for _, scopeKey := range scopeKeys {
-			if strings.HasPrefix(referrer.String(), scopeKey) {
-				imports, _ := im.GetScopeImports(scopeKey)
-				ret, ok := im.resolveWith(specifier, imports)
-				if ok {
-					return ret + query + hash, true
-				}
-			}
-		}
-	}
-
-	ret, ok := im.resolveWith(specifier, im.Imports)
-	if ok {
-		return ret + query + hash, true
-	}
-
-	return specifier + query + hash, false
-}
-
-func (im *ImportMap) resolveWith(specifier string, imports *Imports) (string, bool) {
-	if len(imports.imports) == 0 {
-		return "", false
-	}
-	if url, ok := imports.Get(specifier); ok {
-		return normalizeUrl(im.baseUrl, url), true
-	}
-	// try to match tailing slash specifier
-	if strings.ContainsRune(specifier, '/') {
-		var matchedUrl string
-		imports.Range(func(k string, v string) bool {
-			if strings.HasSuffix(k, "/") && strings.HasPrefix(specifier, k) {
-				matchedUrl = normalizeUrl(im.baseUrl, v+specifier[len(k):])
-				return false
-			}
-			return true
-		})
-		if matchedUrl != "" {
-			return matchedUrl, true
-		}
-	}
-	return "", false
-}
-
 // ParseImport gets the import metadata from a specifier.
 // Currently, it supports the following specifiers:
 // - npm:package[@semver][/subpath]
@@ -284,11 +281,12 @@ func (im *ImportMap) ParseImport(specifier string) (meta ImportMeta, err error)
 	if scopeName != "" {
 		imp.Name = scopeName + "/" + imp.Name
 	}
-	return fetchImportMeta(im.cdnOrigin(), imp, im.config.Target)
+	return im.fetchImportMeta(imp)
 }
 
+// FetchImportMeta fetches the metadata of the import from the CDN with the http client and the cache of the import map.
 func (im *ImportMap) FetchImportMeta(imp Import) (meta ImportMeta, err error) {
-	return fetchImportMeta(im.cdnOrigin(), imp, im.config.Target)
+	return im.fetchImportMeta(imp)
 }
 
 // AddImportFromSpecifier adds an import from a specifier to the import map.
@@ -301,23 +299,26 @@ func (im *ImportMap) AddImportFromSpecifier(specifier string, noSRI bool) (warni
 	return im.AddImport(imp, noSRI)
 }
 
-// AddImport adds an import to the import map.
+// AddImport adds an import to the import map. Unlike `AddImports`, the peer dependencies of the import
+// are added as they are without being resolved against the imports in the import map, which saves the
+// requests of `ResolvePeers`. Use `AddImports` to add multiple imports at once with the peer resolution.
 func (im *ImportMap) AddImport(imp ImportMeta, noSRI bool) (warnings []string, errors []error) {
-	return im.addImport(set.New[string](), imp, false, nil, noSRI)
+	return im.addImport(set.New[string](), set.New[string](), imp, false, nil, noSRI)
 }
 
-// addImport adds an import to the import map.
-func (im *ImportMap) addImport(mark *set.Set[string], imp ImportMeta, indirect bool, targetImports *Imports, noSRI bool) (warnings []string, errors []error) {
+// addImport adds an import to the import map, the peer dependencies in the `peers` set are resolved
+// by `ResolvePeers` and are skipped.
+func (im *ImportMap) addImport(mark *set.Set[string], peers *set.Set[string], imp ImportMeta, indirect bool, targetImports *Imports, noSRI bool) (warnings []string, errors []error) {
 	specifier := imp.Specifier(false)
 	if mark.Has(specifier) {
 		return
 	}
 	mark.Add(specifier)
 
-	cdnOrigin := im.cdnOrigin()
+	cdnOrigin := im.CDNOrigin()
 	cdnScopeImportsMap, cdnScoped := im.GetScopeImports(cdnOrigin + "/")
 	if !cdnScoped {
-		cdnScopeImportsMap = &Imports{imports: map[string]string{}}
+		cdnScopeImportsMap = NewImports(nil)
 		im.SetScopeImports(cdnOrigin+"/", cdnScopeImportsMap)
 	}
 
@@ -409,6 +410,10 @@ func (im *ImportMap) addImport(mark *set.Set[string], imp ImportMeta, indirect b
 					errors = append(errors, err)
 					return
 				}
+				if isPeer && peers.Has(Import{Name: depImport.Name, Github: depImport.Github, Jsr: depImport.Jsr}.Specifier(false)) {
+					// the peer dependency is resolved already
+					return
+				}
 				// if the dependency is the same as the current import, use the version of the current import
 				if depImport.Name == imp.Name {
 					depImport.Version = imp.Version
@@ -443,7 +448,7 @@ func (im *ImportMap) addImport(mark *set.Set[string], imp ImportMeta, indirect b
 							scope := cdnOrigin + "/" + imp.EsmSpecifier() + "/"
 							targetImports, ok = im.GetScopeImports(scope)
 							if !ok {
-								targetImports = newImports(nil)
+								targetImports = NewImports(nil)
 								im.SetScopeImports(scope, targetImports)
 							}
 						}
@@ -454,7 +459,7 @@ func (im *ImportMap) addImport(mark *set.Set[string], imp ImportMeta, indirect b
 					errors = append(errors, err)
 					return
 				}
-				warns, errs := im.addImport(mark, meta, !isPeer, targetImports, noSRI)
+				warns, errs := im.addImport(mark, peers, meta, !isPeer, targetImports, noSRI)
 				warnings = append(warnings, warns...)
 				errors = append(errors, errs...)
 			})
@@ -465,7 +470,8 @@ func (im *ImportMap) addImport(mark *set.Set[string], imp ImportMeta, indirect b
 	return
 }
 
-func (im *ImportMap) cdnOrigin() string {
+// CDNOrigin returns the origin of the CDN, default is "https://esm.sh".
+func (im *ImportMap) CDNOrigin() string {
 	cdn := im.config.CDN
 	if strings.HasPrefix(cdn, "https://") || strings.HasPrefix(cdn, "http://") {
 		return cdn
@@ -571,17 +577,18 @@ func formatImports(buf *strings.Builder, imports *Imports, indent int) {
 	sort.Strings(keys)
 	indentStr := bytes.Repeat([]byte{' ', ' '}, indent)
 	for i, key := range keys {
-		url, ok := imports.Get(key)
-		if !ok || url == "" {
-			// ignore empty values
-			continue
-		}
+		url, _ := imports.Get(key)
 		buf.Write(indentStr)
 		buf.WriteByte('"')
 		buf.WriteString(key)
-		buf.WriteString("\": \"")
-		buf.WriteString(url)
-		buf.WriteByte('"')
+		if url == "" {
+			// `null` entry that blocks the resolution
+			buf.WriteString("\": null")
+		} else {
+			buf.WriteString("\": \"")
+			buf.WriteString(url)
+			buf.WriteByte('"')
+		}
 		if i < len(keys)-1 {
 			buf.WriteByte(',')
 		}
@@ -612,16 +619,15 @@ func formatMap(buf *strings.Builder, m *Imports, indent int) {
 	}
 }
 
-func newImports(imports map[string]string) *Imports {
+// NewImports creates a new imports map, the keys are sorted.
+func NewImports(imports map[string]string) *Imports {
 	if imports == nil {
 		imports = map[string]string{}
 	}
-	return &Imports{imports: imports}
-}
-
-func normalizeUrl(baseUrl *url.URL, path string) string {
-	if baseUrl != nil && (strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")) {
-		return baseUrl.ResolveReference(&url.URL{Path: path}).String()
+	keys := make([]string, 0, len(imports))
+	for key := range imports {
+		keys = append(keys, key)
 	}
-	return path
+	sort.Strings(keys)
+	return &Imports{keys: keys, imports: imports}
 }
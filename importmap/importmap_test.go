@@ -81,9 +81,9 @@ func TestAddPackages(t *testing.T) {
 				CDN:    "https://cdn.esm.sh",
 				Target: "esnext",
 			},
-			Imports:   newImports(nil),
+			Imports:   NewImports(nil),
 			scopes:    make(map[string]*Imports),
-			integrity: newImports(nil),
+			integrity: NewImports(nil),
 		}
 		warnings, errors := im.AddImportFromSpecifier("react@19", false)
 		if len(errors) > 0 {
@@ -0,0 +1,150 @@
+package importmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LockFileVersion is the version of the `esm.lock` format.
+const LockFileVersion = 1
+
+// LockFile represents the `esm.lock` file that records the resolution of an import map.
+type LockFile struct {
+	Version int                             `json:"lockfileVersion"`
+	CDN     string                          `json:"cdn"`
+	Imports map[string]LockEntry            `json:"imports"`
+	Scopes  map[string]map[string]LockEntry `json:"scopes,omitempty"`
+}
+
+// LockEntry represents a resolved import of the lock file.
+type LockEntry struct {
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	Target    string `json:"target,omitempty"`
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// ParseLockFile parses the `esm.lock` file.
+func ParseLockFile(data []byte) (lock *LockFile, err error) {
+	lock = &LockFile{}
+	err = json.Unmarshal(data, lock)
+	if err != nil {
+		return nil, err
+	}
+	if lock.Version != LockFileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d", lock.Version)
+	}
+	if lock.Imports == nil {
+		lock.Imports = map[string]LockEntry{}
+	}
+	return
+}
+
+// LockFile returns the lock file of the import map, only the imports of the CDN are recorded.
+func (im *ImportMap) LockFile() *LockFile {
+	cdnOrigin := im.CDNOrigin()
+	lock := &LockFile{
+		Version: LockFileVersion,
+		CDN:     cdnOrigin,
+		Imports: im.lockEntries(cdnOrigin, im.Imports),
+	}
+	im.RangeScopes(func(scope string, imports *Imports) bool {
+		if entries := im.lockEntries(cdnOrigin, imports); len(entries) > 0 {
+			if lock.Scopes == nil {
+				lock.Scopes = map[string]map[string]LockEntry{}
+			}
+			lock.Scopes[scope] = entries
+		}
+		return true
+	})
+	return lock
+}
+
+func (im *ImportMap) lockEntries(cdnOrigin string, imports *Imports) map[string]LockEntry {
+	entries := map[string]LockEntry{}
+	imports.Range(func(specifier string, url string) bool {
+		if !strings.HasPrefix(url, cdnOrigin+"/") {
+			return true
+		}
+		imp, err := ParseEsmPath(url)
+		if err != nil || imp.Version == "" {
+			return true
+		}
+		integrity, _ := im.integrity.Get(url)
+		entries[specifier] = LockEntry{
+			Version:   imp.Version,
+			URL:       url,
+			Target:    buildTarget(url),
+			Integrity: integrity,
+		}
+		return true
+	})
+	return entries
+}
+
+// Bytes returns the JSON data of the lock file.
+func (lock *LockFile) Bytes() []byte {
+	data, _ := json.MarshalIndent(lock, "", "  ")
+	return append(data, '\n')
+}
+
+// Diff returns the differences between the lock file and the other one,
+// an empty slice is returned if the two lock files are equal.
+func (lock *LockFile) Diff(other *LockFile) (diff []string) {
+	if lock.CDN != other.CDN {
+		diff = append(diff, fmt.Sprintf("cdn: %s → %s", lock.CDN, other.CDN))
+	}
+	diff = append(diff, diffLockEntries("", lock.Imports, other.Imports)...)
+	scopes := map[string]bool{}
+	for scope := range lock.Scopes {
+		scopes[scope] = true
+	}
+	for scope := range other.Scopes {
+		scopes[scope] = true
+	}
+	for scope := range scopes {
+		diff = append(diff, diffLockEntries(scope, lock.Scopes[scope], other.Scopes[scope])...)
+	}
+	sort.Strings(diff)
+	return
+}
+
+func diffLockEntries(scope string, a map[string]LockEntry, b map[string]LockEntry) (diff []string) {
+	prefix := ""
+	if scope != "" {
+		prefix = "[" + scope + "] "
+	}
+	for specifier, entry := range a {
+		other, ok := b[specifier]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s%s: %s → (removed)", prefix, specifier, entry.Version))
+			continue
+		}
+		if entry.Version != other.Version {
+			diff = append(diff, fmt.Sprintf("%s%s: %s → %s", prefix, specifier, entry.Version, other.Version))
+		} else if entry.URL != other.URL {
+			diff = append(diff, fmt.Sprintf("%s%s: url %s → %s", prefix, specifier, entry.URL, other.URL))
+		} else if entry.Integrity != other.Integrity {
+			diff = append(diff, fmt.Sprintf("%s%s: integrity %s → %s", prefix, specifier, entry.Integrity, other.Integrity))
+		}
+	}
+	for specifier, entry := range b {
+		if _, ok := a[specifier]; !ok {
+			diff = append(diff, fmt.Sprintf("%s%s: (added) → %s", prefix, specifier, entry.Version))
+		}
+	}
+	return
+}
+
+// buildTarget returns the build target of the esm.sh module url, e.g. "es2022".
+func buildTarget(url string) string {
+	for _, seg := range strings.Split(url, "/") {
+		switch seg {
+		case "es2015", "es2016", "es2017", "es2018", "es2019", "es2020", "es2021", "es2022", "es2023", "es2024", "esnext", "denonext", "deno", "node":
+			return seg
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package importmap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	im := Blank()
+	im.Imports.Set("react", "https://esm.sh/react@19.0.0/es2022/react.mjs")
+	im.Imports.Set("app", "./app.js")
+	im.SetScopeImports("https://esm.sh/", NewImports(map[string]string{
+		"scheduler": "https://esm.sh/scheduler@0.25.0/es2022/scheduler.mjs",
+	}))
+	im.integrity.Set("https://esm.sh/react@19.0.0/es2022/react.mjs", "sha384-react")
+
+	lock := im.LockFile()
+	if lock.Version != LockFileVersion || lock.CDN != "https://esm.sh" {
+		t.Fatalf("unexpected lock file header: %d %s", lock.Version, lock.CDN)
+	}
+	if len(lock.Imports) != 1 {
+		t.Fatalf("Expected 1 locked import, got %d", len(lock.Imports))
+	}
+	entry := lock.Imports["react"]
+	if entry.Version != "19.0.0" || entry.Target != "es2022" || entry.Integrity != "sha384-react" {
+		t.Fatalf("unexpected lock entry: %+v", entry)
+	}
+	if lock.Scopes["https://esm.sh/"]["scheduler"].Version != "0.25.0" {
+		t.Fatalf("unexpected scoped lock entry: %+v", lock.Scopes)
+	}
+
+	parsed, err := ParseLockFile(lock.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := lock.Diff(parsed); len(diff) != 0 {
+		t.Fatalf("Expected no diff, got %v", diff)
+	}
+
+	im.Imports.Set("react", "https://esm.sh/react@19.0.1/es2022/react.mjs")
+	im.integrity.Delete("https://esm.sh/react@19.0.0/es2022/react.mjs")
+	im.Imports.Set("react-dom", "https://esm.sh/react-dom@19.0.0/es2022/react-dom.mjs")
+	imports, _ := im.GetScopeImports("https://esm.sh/")
+	imports.Delete("scheduler")
+	diff := parsed.Diff(im.LockFile())
+	expected := []string{
+		"[https://esm.sh/] scheduler: 0.25.0 → (removed)",
+		"react-dom: (added) → 19.0.0",
+		"react: 19.0.0 → 19.0.1",
+	}
+	if strings.Join(diff, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected diff: %q", diff)
+	}
+
+	_, err = ParseLockFile([]byte(`{"lockfileVersion": 2}`))
+	if err == nil {
+		t.Fatal("Expected an error for the unsupported lockfile version")
+	}
+}
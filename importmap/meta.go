@@ -1,26 +1,20 @@
 package importmap
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 
-	"github.com/esm-dev/esm.sh/internal/app_dir"
 	"github.com/esm-dev/esm.sh/internal/npm"
 	"github.com/ije/gox/sync"
 	"github.com/ije/gox/utils"
 )
 
 var (
-	keyedMutex sync.KeyedMutex
-	fetchCache sync.Map
+	keyedMutex  sync.KeyedMutex
+	errNotFound = errors.New("not found")
 )
 
 // Import represents an import from esm.sh CDN.
@@ -34,6 +28,8 @@ type Import struct {
 	Dev      bool   `json:"-"`
 }
 
+// Specifier returns the specifier of the import used as the key of the import map,
+// e.g. "react-dom/client", "gh:owner/repo" or "jsr:@std/path@1.0.0" with the version.
 func (im Import) Specifier(withVersion bool) string {
 	b := strings.Builder{}
 	if im.Github {
@@ -53,6 +49,8 @@ func (im Import) Specifier(withVersion bool) string {
 	return b.String()
 }
 
+// RegistryPrefix returns the path prefix of the registry of the import in the CDN URLs,
+// "gh/" for GitHub, "jsr/" for JSR, or an empty string for npm.
 func (im Import) RegistryPrefix() string {
 	if im.Github {
 		return "gh/"
@@ -71,6 +69,7 @@ type ImportMeta struct {
 	Exports     []string `json:"exports"`
 	Imports     []string `json:"imports"`
 	PeerImports []string `json:"peerImports"`
+	Deprecated  string   `json:"deprecated,omitempty"`
 }
 
 // HasExternalImports returns true if the import has external imports.
@@ -104,7 +103,9 @@ func (imp *ImportMeta) EsmSpecifier() string {
 }
 
 // fetchImportMeta fetches the import metadata from the esm.sh CDN.
-func fetchImportMeta(cdnOrigin string, imp Import, target string) (meta ImportMeta, err error) {
+func (im *ImportMap) fetchImportMeta(imp Import) (meta ImportMeta, err error) {
+	cdnOrigin := im.CDNOrigin()
+	target := im.config.Target
 	asteriskPrefix := ""
 	version := ""
 	subPath := ""
@@ -122,71 +123,28 @@ func fetchImportMeta(cdnOrigin string, imp Import, target string) (meta ImportMe
 		url += "&target=" + target
 	}
 
-	// check memory cache first
-	if v, ok := fetchCache.Load(url); ok {
-		meta, _ = v.(ImportMeta)
-		return
-	}
-
 	// only one fetch at a time for the same url
 	unlock := keyedMutex.Lock(url)
 	defer unlock()
 
-	// check memory cache again after acquiring the lock state
-	if v, ok := fetchCache.Load(url); ok {
-		meta, _ = v.(ImportMeta)
-		return
-	}
-
-	appDir, err := app_dir.GetAppDir()
-	if err != nil {
-		err = fmt.Errorf("could not get app directory: %s", err.Error())
-		return
-	}
-
-	sha := sha256.Sum256([]byte(url))
-	cachePath := filepath.Join(appDir, "meta", hex.EncodeToString(sha[:]))
-
-	// if the version is exact, check the cache on disk
+	// if the version is exact, check the cache first
+	cache := im.fetchCache()
 	if npm.IsExactVersion(imp.Version) {
-		f, err := os.Open(cachePath)
-		if err == nil {
-			defer f.Close()
-			err = json.NewDecoder(f).Decode(&meta)
-			if err == nil {
-				meta.SubPath = imp.SubPath
-				meta.Github = imp.Github
-				meta.Jsr = imp.Jsr
-				meta.External = imp.External
-				meta.Dev = imp.Dev
-				fetchCache.Store(url, meta)
-				return meta, nil
-			}
-			// if decode error, remove the cache file and try to fetch again
-			_ = os.Remove(cachePath)
+		if data, ok := cache.Get(url); ok && json.Unmarshal(data, &meta) == nil {
+			meta.SubPath = imp.SubPath
+			meta.Github = imp.Github
+			meta.Jsr = imp.Jsr
+			meta.External = imp.External
+			meta.Dev = imp.Dev
+			return meta, nil
 		}
 	}
 
-	resp, err := http.Get(url)
+	jsonData, err := im.fetch(url)
 	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 404 {
-		err = fmt.Errorf("package not found: %s", imp.Specifier(true))
-		return
-	}
-
-	if resp.StatusCode != 200 {
-		msg, _ := io.ReadAll(resp.Body)
-		err = fmt.Errorf("unexpected http status %d: %s", resp.StatusCode, msg)
-		return
-	}
-
-	jsonData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		err = fmt.Errorf("could not read %s: %s", url, err.Error())
+		if err == errNotFound {
+			err = fmt.Errorf("package not found: %s", imp.Specifier(true))
+		}
 		return
 	}
 
@@ -202,22 +160,13 @@ func fetchImportMeta(cdnOrigin string, imp Import, target string) (meta ImportMe
 	meta.External = imp.External
 	meta.Dev = imp.Dev
 
-	// cache the metadata on disk
-	dirname := filepath.Dir(cachePath)
-	if _, err := os.Lstat(dirname); err != nil && os.IsNotExist(err) {
-		os.MkdirAll(dirname, 0755)
-	}
-	os.WriteFile(cachePath, jsonData, 0644)
-
-	// cache the metadata in memory
-	fetchCache.Store(url, meta)
-	if meta.Version != imp.Version {
-		// cache the exact version as well
+	// cache the metadata of the exact version
+	if npm.IsExactVersion(meta.Version) {
 		cacheKey := fmt.Sprintf("%s/%s%s%s@%s%s?meta", cdnOrigin, asteriskPrefix, imp.RegistryPrefix(), imp.Name, meta.Version, subPath)
-		if target != "" {
+		if target != "" && target != "es2022" {
 			cacheKey += "&target=" + target
 		}
-		fetchCache.Store(cacheKey, meta)
+		cache.Set(cacheKey, jsonData)
 	}
 	return
 }
@@ -0,0 +1,311 @@
+package importmap
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/gox/set"
+	"github.com/ije/gox/term"
+)
+
+// PeerRequest is a semver range of a peer dependency requested by an import.
+type PeerRequest struct {
+	Importer string // the package of the import, e.g. "react-dom@19.2.3"
+	Range    string // the semver range of the peer dependency, e.g. "^19.0.0"
+	scope    string // the scope of the importer, e.g. "https://esm.sh/*react-dom@19.2.3/"
+}
+
+// PeerResolution is the resolved version of a peer dependency shared by the imports.
+type PeerResolution struct {
+	Name       string            // the package of the peer dependency, e.g. "react"
+	Version    string            // the chosen version
+	Reason     string            // why the version is chosen
+	Requests   []PeerRequest     // the requests of the peer dependency
+	Duplicates map[string]string // the versions of the unmet requests that are added to the scopes of the importers, keyed by importer
+	pkg        Import
+}
+
+// AddImports adds imports to the import map. The peer dependencies shared by the imports and the imports
+// in the import map are resolved by `ResolvePeers` first.
+func (im *ImportMap) AddImports(imports []ImportMeta, noSRI bool) (warnings []string, errors []error) {
+	resolutions, errors := im.ResolvePeers(imports)
+	if len(errors) > 0 {
+		return
+	}
+
+	mark := set.New[string]()
+	peers := set.New[string]()
+	for _, r := range resolutions {
+		peers.Add(r.Name)
+	}
+	for _, r := range resolutions {
+		warns, errs := im.addPeer(mark, peers, r.pkg, r.Version, nil, noSRI)
+		warnings = append(warnings, warns...)
+		errors = append(errors, errs...)
+		for _, req := range r.Requests {
+			version, ok := r.Duplicates[req.Importer]
+			if !ok {
+				continue
+			}
+			scopeImports, ok := im.GetScopeImports(req.scope)
+			if !ok {
+				scopeImports = NewImports(nil)
+				im.SetScopeImports(req.scope, scopeImports)
+			}
+			// the duplicate is marked separately since it is added to another scope
+			warns, errs := im.addPeer(set.New[string](), peers, r.pkg, version, scopeImports, noSRI)
+			warnings = append(warnings, warns...)
+			errors = append(errors, errs...)
+			warnings = append(warnings, "duplicate peer dependency "+r.Name+"@"+version+" in the scope of "+req.Importer+term.Dim("(unmet "+req.Range+" by "+r.Name+"@"+r.Version+")"))
+		}
+	}
+	if len(errors) > 0 {
+		return
+	}
+
+	for _, imp := range imports {
+		warns, errs := im.addImport(mark, peers, imp, false, nil, noSRI)
+		warnings = append(warnings, warns...)
+		errors = append(errors, errs...)
+	}
+	return
+}
+
+// addPeer adds the peer dependency with the resolved version to the import map,
+// or to the scope imports if it is a duplicate.
+func (im *ImportMap) addPeer(mark *set.Set[string], peers *set.Set[string], pkg Import, version string, scopeImports *Imports, noSRI bool) (warnings []string, errors []error) {
+	pkg.Version = version
+	meta, err := im.FetchImportMeta(pkg)
+	if err != nil {
+		errors = append(errors, err)
+		return
+	}
+	return im.addImport(mark, peers, meta, scopeImports != nil, scopeImports, noSRI)
+}
+
+// ResolvePeers computes a satisfying version set across the peer dependencies of the given imports,
+// the requests of the imports in the import map are taken into account as well. The version of a peer
+// dependency is chosen in the following order:
+//
+//  1. the version of the peer dependency if it is one of the given imports
+//  2. the current version in the import map if it satisfies all the requests
+//  3. the highest version that satisfies all the requests
+//  4. the version that satisfies the most requests, and the unmet requests get scoped duplicates
+func (im *ImportMap) ResolvePeers(imports []ImportMeta) (resolutions []PeerResolution, errors []error) {
+	cdnOrigin := im.CDNOrigin()
+	requests := map[string][]PeerRequest{}
+	pkgs := map[string]Import{}
+	pinned := map[string]string{}
+	var names []string
+
+	collect := func(imp ImportMeta, existing bool) {
+		importer := Import{Name: imp.Name, Version: imp.Version, Github: imp.Github, Jsr: imp.Jsr}.Specifier(true)
+		for _, pathname := range imp.PeerImports {
+			peer, err := ParseEsmPath(pathname)
+			if err != nil || peer.Name == imp.Name {
+				continue
+			}
+			pkg := Import{Name: peer.Name, Github: peer.Github, Jsr: peer.Jsr}
+			name := pkg.Specifier(false)
+			if _, ok := pkgs[name]; !ok {
+				if existing {
+					// only the peer dependencies of the given imports are resolved
+					continue
+				}
+				pkgs[name] = pkg
+				names = append(names, name)
+			}
+			req := PeerRequest{Importer: importer, Range: peer.Version, scope: cdnOrigin + "/" + imp.EsmSpecifier() + "/"}
+			if !slices.Contains(requests[name], req) {
+				requests[name] = append(requests[name], req)
+			}
+		}
+	}
+
+	added := set.New[string]()
+	for _, imp := range imports {
+		name := Import{Name: imp.Name, Github: imp.Github, Jsr: imp.Jsr}.Specifier(false)
+		added.Add(name)
+		pinned[name] = imp.Version
+		collect(imp, false)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	// collect the requests of the imports in the import map
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var existingImports []ImportMeta
+	seen := set.New[string]()
+	im.Imports.Range(func(_ string, url string) bool {
+		// only the builds with the "external all" modifier have peer dependencies
+		if !strings.HasPrefix(url, cdnOrigin+"/") || !strings.Contains(url, "/*") {
+			return true
+		}
+		imp, err := ParseEsmPath(url)
+		if err != nil || added.Has(Import{Name: imp.Name, Github: imp.Github, Jsr: imp.Jsr}.Specifier(false)) || seen.Has(imp.Specifier(true)) {
+			return true
+		}
+		seen.Add(imp.Specifier(true))
+		imp.External = true
+		wg.Go(func() {
+			meta, err := im.FetchImportMeta(imp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errors = append(errors, err)
+				return
+			}
+			existingImports = append(existingImports, meta)
+		})
+		return true
+	})
+	wg.Wait()
+	if len(errors) > 0 {
+		return
+	}
+	// sort the imports to keep the order of the requests stable
+	slices.SortFunc(existingImports, func(a, b ImportMeta) int {
+		return strings.Compare(a.Specifier(true), b.Specifier(true))
+	})
+	for _, imp := range existingImports {
+		collect(imp, true)
+	}
+
+	// resolve the version of every requested range
+	rangeVersions := map[string]string{}
+	ranges := map[string]Import{}
+	for _, name := range names {
+		for _, req := range requests[name] {
+			pkg := pkgs[name]
+			pkg.Version = req.Range
+			ranges[name+"@"+req.Range] = pkg
+		}
+	}
+	for key, pkg := range ranges {
+		wg.Go(func() {
+			meta, err := im.FetchImportMeta(pkg)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errors = append(errors, err)
+				return
+			}
+			rangeVersions[key] = meta.Version
+		})
+	}
+	wg.Wait()
+	if len(errors) > 0 {
+		return
+	}
+
+	cdnScopeImports, _ := im.GetScopeImports(cdnOrigin + "/")
+	for _, name := range names {
+		var current string
+		url, ok := im.Imports.Get(name)
+		if !ok && cdnScopeImports != nil {
+			url, ok = cdnScopeImports.Get(name)
+		}
+		if ok && strings.HasPrefix(url, cdnOrigin+"/") {
+			if imp, err := ParseEsmPath(url); err == nil && npm.IsExactVersion(imp.Version) {
+				current = imp.Version
+			}
+		}
+		var candidates []string
+		for _, req := range requests[name] {
+			candidates = append(candidates, rangeVersions[name+"@"+req.Range])
+		}
+		version, unmet, reason := choosePeerVersion(name, requests[name], pinned[name], current, candidates)
+		r := PeerResolution{
+			Name:     name,
+			Version:  version,
+			Reason:   reason,
+			Requests: requests[name],
+			pkg:      pkgs[name],
+		}
+		if len(unmet) > 0 {
+			r.Duplicates = make(map[string]string, len(unmet))
+			for _, req := range unmet {
+				r.Duplicates[req.Importer] = rangeVersions[name+"@"+req.Range]
+			}
+		}
+		resolutions = append(resolutions, r)
+	}
+	return
+}
+
+// choosePeerVersion chooses the version of a peer dependency from the pinned version, the current version
+// and the candidates, it returns the requests that are not satisfied by the chosen version.
+func choosePeerVersion(name string, requests []PeerRequest, pinned string, current string, candidates []string) (version string, unmet []PeerRequest, reason string) {
+	unmetBy := func(version string) (unmet []PeerRequest) {
+		for _, req := range requests {
+			if !satisfiesRange(version, req.Range) {
+				unmet = append(unmet, req)
+			}
+		}
+		return
+	}
+
+	if pinned != "" {
+		return pinned, unmetBy(pinned), name + "@" + pinned + " is added explicitly"
+	}
+	if current != "" && len(unmetBy(current)) == 0 {
+		return current, nil, name + "@" + current + " in the import map satisfies all the peer ranges"
+	}
+
+	// the highest version comes first, the current version is preferred over the others with the same score
+	candidates = slices.Clone(candidates)
+	if current != "" {
+		candidates = append(candidates, current)
+	}
+	slices.SortStableFunc(candidates, func(a, b string) int {
+		if a == current && b != current {
+			return -1
+		}
+		if b == current && a != current {
+			return 1
+		}
+		return compareVersions(b, a)
+	})
+	for _, v := range candidates {
+		if len(unmetBy(v)) == 0 {
+			return v, nil, name + "@" + v + " is the highest version that satisfies all the peer ranges"
+		}
+	}
+	for _, v := range candidates {
+		if u := unmetBy(v); version == "" || len(u) < len(unmet) {
+			version, unmet = v, u
+		}
+	}
+	return version, unmet, "no version satisfies all the peer ranges, " + name + "@" + version + " satisfies the most of them"
+}
+
+// satisfiesRange returns true if the version satisfies the semver range.
+func satisfiesRange(version string, versionRange string) bool {
+	if versionRange == "" || versionRange == "*" || versionRange == "latest" || versionRange == version {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	c, err := semver.NewConstraint(versionRange)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
+
+// compareVersions compares two versions, the invalid semver versions are compared as strings.
+func compareVersions(a string, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	return va.Compare(vb)
+}
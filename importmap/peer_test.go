@@ -0,0 +1,224 @@
+package importmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newPeerTestCDN() *httptest.Server {
+	metas := map[string]ImportMeta{
+		"/react@18.3.1":   {Import: Import{Name: "react", Version: "18.3.1"}},
+		"/react@19.1.0":   {Import: Import{Name: "react", Version: "19.1.0"}},
+		"/react@^18.0.0":  {Import: Import{Name: "react", Version: "18.3.1"}},
+		"/react@^19.0.0":  {Import: Import{Name: "react", Version: "19.1.0"}},
+		"/react@>=18.0.0": {Import: Import{Name: "react", Version: "19.1.0"}},
+		"/react@18.2.0":   {Import: Import{Name: "react", Version: "18.2.0"}},
+		"/lib-a@1.0.0":    {Import: Import{Name: "lib-a", Version: "1.0.0"}, PeerImports: []string{"/react@^19.0.0?target=es2022"}},
+		"/lib-b@1.0.0":    {Import: Import{Name: "lib-b", Version: "1.0.0"}, PeerImports: []string{"/react@>=18.0.0?target=es2022"}},
+		"/lib-c@1.0.0":    {Import: Import{Name: "lib-c", Version: "1.0.0"}, PeerImports: []string{"/react@^18.0.0?target=es2022"}},
+		"/lib-d@1.0.0":    {Import: Import{Name: "lib-d", Version: "1.0.0"}, PeerImports: []string{"/react@18.2.0?target=es2022"}},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta, ok := metas[strings.Replace(r.URL.Path, "/*", "/", 1)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(meta)
+	}))
+}
+
+func TestChoosePeerVersion(t *testing.T) {
+	requests := []PeerRequest{
+		{Importer: "lib-a@1.0.0", Range: "^19.0.0"},
+		{Importer: "lib-b@1.0.0", Range: ">=18.0.0"},
+	}
+	version, unmet, reason := choosePeerVersion("react", requests, "", "", []string{"19.1.0", "19.1.0"})
+	if version != "19.1.0" || len(unmet) != 0 || !strings.Contains(reason, "highest version") {
+		t.Fatalf("unexpected resolution: %s %v %s", version, unmet, reason)
+	}
+	version, unmet, reason = choosePeerVersion("react", requests, "", "19.0.0", []string{"19.1.0", "19.1.0"})
+	if version != "19.0.0" || len(unmet) != 0 || !strings.Contains(reason, "in the import map") {
+		t.Fatalf("unexpected resolution: %s %v %s", version, unmet, reason)
+	}
+	version, unmet, reason = choosePeerVersion("react", requests, "18.3.1", "", []string{"19.1.0", "19.1.0"})
+	if version != "18.3.1" || len(unmet) != 1 || unmet[0].Importer != "lib-a@1.0.0" || !strings.Contains(reason, "explicitly") {
+		t.Fatalf("unexpected resolution: %s %v %s", version, unmet, reason)
+	}
+
+	requests = append(requests, PeerRequest{Importer: "lib-c@1.0.0", Range: "^18.0.0"}, PeerRequest{Importer: "lib-d@1.0.0", Range: "18.2.0"})
+	version, unmet, reason = choosePeerVersion("react", requests, "", "", []string{"19.1.0", "19.1.0", "18.3.1", "18.2.0"})
+	if version != "18.2.0" || len(unmet) != 1 || unmet[0].Importer != "lib-a@1.0.0" || !strings.Contains(reason, "no version") {
+		t.Fatalf("unexpected resolution: %s %v %s", version, unmet, reason)
+	}
+}
+
+func TestAddImports(t *testing.T) {
+	cdn := newPeerTestCDN()
+	defer cdn.Close()
+
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetCache(NewMemoryCache())
+
+	fetch := func(name string) ImportMeta {
+		meta, err := im.FetchImportMeta(Import{Name: name, Version: "1.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta
+	}
+
+	// a version satisfying all the peer ranges is chosen
+	warnings, errors := im.AddImports([]ImportMeta{fetch("lib-a"), fetch("lib-b")}, true)
+	if len(errors) > 0 || len(warnings) > 0 {
+		t.Fatalf("Expected no errors and warnings, got %v %v", errors, warnings)
+	}
+	if url, _ := im.Imports.Get("react"); url != cdn.URL+"/react@19.1.0/es2022/react.mjs" {
+		t.Fatalf("Expected react@19.1.0, got %s", url)
+	}
+
+	// the unmet import gets a scoped duplicate
+	resolutions, errors := im.ResolvePeers([]ImportMeta{fetch("lib-c")})
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	if len(resolutions) != 1 || resolutions[0].Version != "19.1.0" || len(resolutions[0].Requests) != 3 || resolutions[0].Duplicates["lib-c@1.0.0"] != "18.3.1" {
+		t.Fatalf("unexpected resolutions: %+v", resolutions)
+	}
+	warnings, errors = im.AddImports([]ImportMeta{fetch("lib-c")}, true)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "duplicate peer dependency react@18.3.1") {
+		t.Fatalf("Expected a warning of the duplicate, got %v", warnings)
+	}
+	if url, _ := im.Imports.Get("react"); url != cdn.URL+"/react@19.1.0/es2022/react.mjs" {
+		t.Fatalf("Expected react@19.1.0, got %s", url)
+	}
+	scopeImports, ok := im.GetScopeImports(cdn.URL + "/*lib-c@1.0.0/")
+	if !ok {
+		t.Fatal("Expected the scope of lib-c")
+	}
+	if url, _ := scopeImports.Get("react"); url != cdn.URL+"/react@18.3.1/es2022/react.mjs" {
+		t.Fatalf("Expected react@18.3.1 in the scope of lib-c, got %s", url)
+	}
+
+	entries, reason, errors := im.Why("react")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 versions of react, got %+v", entries)
+	}
+	if entries[0].Version != "19.1.0" || entries[0].Location != "imports" || !entries[0].TopLevel || len(entries[0].Dependents) != 2 {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+	if entries[1].Version != "18.3.1" || entries[1].Location != cdn.URL+"/*lib-c@1.0.0/" || len(entries[1].Dependents) != 1 {
+		t.Fatalf("unexpected entry: %+v", entries[1])
+	}
+	if dependent := entries[1].Dependents[0]; dependent.Importer != "lib-c@1.0.0" || dependent.Range != "^18.0.0" || !dependent.Peer {
+		t.Fatalf("unexpected dependent: %+v", dependent)
+	}
+	if !strings.Contains(reason, "no version satisfies all the peer ranges") {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+}
+
+func TestWhy(t *testing.T) {
+	cdn := newPeerTestCDN()
+	defer cdn.Close()
+
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetCache(NewMemoryCache())
+
+	react, err := im.FetchImportMeta(Import{Name: "react", Version: "18.2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	libA, err := im.FetchImportMeta(Import{Name: "lib-a", Version: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the explicitly added version is kept even if it doesn't meet the peer ranges
+	warnings, errors := im.AddImports([]ImportMeta{react, libA}, true)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "duplicate peer dependency react@19.1.0") {
+		t.Fatalf("Expected a warning of the duplicate, got %v", warnings)
+	}
+
+	entries, reason, errors := im.Why("react")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	if len(entries) != 2 || entries[0].Version != "18.2.0" || !entries[0].TopLevel || entries[1].Version != "19.1.0" || entries[1].TopLevel {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if reason != "react@18.2.0 is added explicitly" {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+}
+
+// requestRecorder records the paths of the requests sent by an http client.
+type requestRecorder struct {
+	lock  sync.Mutex
+	paths []string
+}
+
+func (r *requestRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	r.paths = append(r.paths, req.URL.Path)
+	r.lock.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAddImport(t *testing.T) {
+	cdn := newPeerTestCDN()
+	defer cdn.Close()
+
+	recorder := &requestRecorder{}
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetCache(NewMemoryCache())
+	im.SetHTTPClient(&http.Client{Transport: recorder})
+
+	fetch := func(name string) ImportMeta {
+		meta, err := im.FetchImportMeta(Import{Name: name, Version: "1.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta
+	}
+
+	warnings, errors := im.AddImports([]ImportMeta{fetch("lib-a")}, true)
+	if len(errors) > 0 || len(warnings) > 0 {
+		t.Fatalf("Expected no errors and warnings, got %v %v", errors, warnings)
+	}
+	meta := fetch("lib-b")
+
+	// the peer dependencies of the imports in the import map are not resolved again
+	recorder.paths = nil
+	warnings, errors = im.AddImport(meta, true)
+	if len(errors) > 0 || len(warnings) > 0 {
+		t.Fatalf("Expected no errors and warnings, got %v %v", errors, warnings)
+	}
+	for _, path := range recorder.paths {
+		if strings.Contains(path, "lib-a") {
+			t.Fatalf("Expected no requests of lib-a, got %v", recorder.paths)
+		}
+	}
+	if url, _ := im.Imports.Get("lib-b"); url != cdn.URL+"/*lib-b@1.0.0/es2022/lib-b.mjs" {
+		t.Fatalf("Expected lib-b@1.0.0, got %s", url)
+	}
+	if url, _ := im.Imports.Get("react"); url != cdn.URL+"/react@19.1.0/es2022/react.mjs" {
+		t.Fatalf("Expected react@19.1.0, got %s", url)
+	}
+}
@@ -0,0 +1,154 @@
+package importmap
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ije/gox/set"
+)
+
+// RemoveImport removes an import from the `imports` of the import map.
+// Call `Prune` afterwards to remove the dependencies that are no longer used.
+func (im *ImportMap) RemoveImport(specifier string) bool {
+	if !im.Imports.Has(specifier) {
+		return false
+	}
+	im.Imports.Delete(specifier)
+	return true
+}
+
+// DeleteScope deletes the given scope from the import map.
+func (im *ImportMap) DeleteScope(scope string) {
+	im.lock.Lock()
+	delete(im.scopes, scope)
+	im.scopesRev++
+	im.lock.Unlock()
+}
+
+// Prune removes the imports of the CDN scopes that are created by `AddImport` but are no longer
+// used by the top-level imports, as well as the integrity of the CDN modules that are no longer
+// referenced by the import map. Use `SyncGraphIntegrity` to restore the integrity of the transitive modules.
+// Nothing is removed if the dependency graph could not be resolved completely.
+func (im *ImportMap) Prune() (removed []string, errors []error) {
+	cdnOrigin := im.CDNOrigin()
+	cdnScopePrefix := cdnOrigin + "/"
+
+	// the roots are the top-level imports and the imports of user-defined scopes
+	var queue []string
+	im.Imports.Range(func(_ string, url string) bool {
+		queue = append(queue, url)
+		return true
+	})
+	im.RangeScopes(func(scope string, imports *Imports) bool {
+		if !strings.HasPrefix(scope, cdnScopePrefix) {
+			imports.Range(func(_ string, url string) bool {
+				queue = append(queue, url)
+				return true
+			})
+		}
+		return true
+	})
+
+	var lock sync.Mutex
+	used := map[*Imports]*set.Set[string]{}
+	visited := set.New[string]()
+	for len(queue) > 0 {
+		var next []string
+		var wg sync.WaitGroup
+		for _, moduleUrl := range queue {
+			if visited.Has(moduleUrl) || !strings.HasPrefix(moduleUrl, cdnScopePrefix) {
+				continue
+			}
+			visited.Add(moduleUrl)
+			wg.Go(func() {
+				imp, err := ParseEsmPath(moduleUrl)
+				if err != nil {
+					return
+				}
+				meta, err := im.FetchImportMeta(imp)
+				lock.Lock()
+				defer lock.Unlock()
+				if err != nil {
+					errors = append(errors, err)
+					return
+				}
+				for _, pathname := range slices.Concat(meta.PeerImports, meta.Imports) {
+					if strings.HasPrefix(pathname, "/node/") {
+						continue
+					}
+					depImport, err := ParseEsmPath(pathname)
+					if err != nil {
+						continue
+					}
+					specifier := depImport.Specifier(false)
+					imports, depUrl, ok := im.lookupImport(specifier, moduleUrl)
+					if ok {
+						if used[imports] == nil {
+							used[imports] = set.New[string]()
+						}
+						used[imports].Add(specifier)
+						next = append(next, depUrl)
+					}
+				}
+			})
+		}
+		wg.Wait()
+		queue = next
+	}
+	if len(errors) > 0 {
+		return
+	}
+
+	referenced := set.New[string]()
+	im.Imports.Range(func(_ string, url string) bool {
+		referenced.Add(url)
+		return true
+	})
+	var emptyScopes []string
+	im.RangeScopes(func(scope string, imports *Imports) bool {
+		if strings.HasPrefix(scope, cdnScopePrefix) {
+			for _, specifier := range imports.Keys() {
+				if used[imports] == nil || !used[imports].Has(specifier) {
+					imports.Delete(specifier)
+					removed = append(removed, specifier)
+				}
+			}
+			if imports.Len() == 0 {
+				emptyScopes = append(emptyScopes, scope)
+			}
+		}
+		imports.Range(func(_ string, url string) bool {
+			referenced.Add(url)
+			return true
+		})
+		return true
+	})
+	for _, scope := range emptyScopes {
+		im.DeleteScope(scope)
+	}
+	for _, url := range im.integrity.Keys() {
+		if strings.HasPrefix(url, cdnScopePrefix) && !referenced.Has(url) {
+			im.integrity.Delete(url)
+		}
+	}
+	sort.Strings(removed)
+	return
+}
+
+// lookupImport finds the import of the specifier for the referrer like the browser does,
+// the scopes are matched by the rules of `ResolveSpecifier` from the most specific one to the
+// top-level imports.
+func (im *ImportMap) lookupImport(specifier string, referrer string) (imports *Imports, url string, ok bool) {
+	baseURLString := im.referrerURL(referrer).String()
+	for _, scope := range im.normalize().scopes {
+		if scope.matches(baseURLString) {
+			if url, ok = scope.source.Get(specifier); ok {
+				return scope.source, url, ok
+			}
+		}
+	}
+	url, ok = im.Imports.Get(specifier)
+	return im.Imports, url, ok
+}
@@ -0,0 +1,91 @@
+package importmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	metas := map[string]ImportMeta{
+		"/app@1.0.0":  {Import: Import{Name: "app", Version: "1.0.0"}, Imports: []string{"/dep@1.0.0/es2022/dep.mjs", "/node/process.mjs"}},
+		"/dep@1.0.0":  {Import: Import{Name: "dep", Version: "1.0.0"}},
+		"/dep@2.0.0":  {Import: Import{Name: "dep", Version: "2.0.0"}},
+		"/old@1.0.0":  {Import: Import{Name: "old", Version: "1.0.0"}, Imports: []string{"/dep@2.0.0/es2022/dep.mjs"}},
+		"/peer@1.0.0": {Import: Import{Name: "peer", Version: "1.0.0"}},
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta, ok := metas[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(meta)
+	}))
+	defer cdn.Close()
+
+	im := Blank()
+	im.SetConfig(Config{CDN: cdn.URL})
+	im.SetCache(NewMemoryCache())
+	im.Imports.Set("app", cdn.URL+"/*app@1.0.0/es2022/app.mjs")
+	im.Imports.Set("old", cdn.URL+"/*old@1.0.0/es2022/old.mjs")
+	im.SetScopeImports(cdn.URL+"/", NewImports(map[string]string{
+		"dep":  cdn.URL + "/dep@1.0.0/es2022/dep.mjs",
+		"peer": cdn.URL + "/peer@1.0.0/es2022/peer.mjs",
+	}))
+	im.SetScopeImports(cdn.URL+"/*old@1.0.0/", NewImports(map[string]string{
+		"dep": cdn.URL + "/dep@2.0.0/es2022/dep.mjs",
+	}))
+	im.integrity.Set(cdn.URL+"/dep@2.0.0/es2022/dep.mjs", "sha384-dep2")
+	im.integrity.Set(cdn.URL+"/peer@1.0.0/es2022/peer.mjs", "sha384-peer")
+	im.integrity.Set(cdn.URL+"/dep@1.0.0/es2022/dep.mjs", "sha384-dep1")
+
+	// 1. remove unused imports of the cdn scope
+	removed, errors := im.Prune()
+	if len(errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", errors)
+	}
+	if strings.Join(removed, ",") != "peer" {
+		t.Fatalf("Expected [peer] removed, got %v", removed)
+	}
+	if im.integrity.Has(cdn.URL + "/peer@1.0.0/es2022/peer.mjs") {
+		t.Fatal("Expected the integrity of peer to be removed")
+	}
+	if !im.integrity.Has(cdn.URL + "/dep@2.0.0/es2022/dep.mjs") {
+		t.Fatal("Expected the integrity of dep@2.0.0 to be kept")
+	}
+
+	// 2. remove an import and prune its dependencies
+	if !im.RemoveImport("old") {
+		t.Fatal("Expected old to be removed")
+	}
+	if im.RemoveImport("old") {
+		t.Fatal("Expected old to be removed already")
+	}
+	removed, errors = im.Prune()
+	if len(errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", errors)
+	}
+	if strings.Join(removed, ",") != "dep" {
+		t.Fatalf("Expected [dep] removed, got %v", removed)
+	}
+	if _, ok := im.GetScopeImports(cdn.URL + "/*old@1.0.0/"); ok {
+		t.Fatal("Expected the scope of old to be deleted")
+	}
+	if im.integrity.Has(cdn.URL + "/dep@2.0.0/es2022/dep.mjs") {
+		t.Fatal("Expected the integrity of dep@2.0.0 to be removed")
+	}
+	if !im.integrity.Has(cdn.URL + "/dep@1.0.0/es2022/dep.mjs") {
+		t.Fatal("Expected the integrity of dep@1.0.0 to be kept")
+	}
+
+	// 3. nothing is removed if a module can not be resolved
+	im.RemoveImport("app")
+	im.Imports.Set("missing", cdn.URL+"/missing@1.0.0/es2022/missing.mjs")
+	removed, errors = im.Prune()
+	if len(errors) != 1 || len(removed) != 0 {
+		t.Fatalf("Expected 1 error and nothing removed, got %v %v", errors, removed)
+	}
+}
@@ -0,0 +1,552 @@
+package importmap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// specialSchemes are the special schemes of the URL standard with their default ports.
+var specialSchemes = map[string]string{
+	"ftp":   "21",
+	"file":  "",
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// defaultBaseUrl is used when the import map has no base url.
+var defaultBaseUrl = &url.URL{Scheme: "file", Path: "/"}
+
+var errInvalidURL = errors.New("invalid URL")
+
+// specifierMapEntry is an entry of a normalized specifier map, a nil url represents a `null` entry.
+type specifierMapEntry struct {
+	key string
+	url *url.URL
+}
+
+// normalizedScope is a scope of a normalized import map.
+type normalizedScope struct {
+	prefix  string
+	imports []specifierMapEntry
+	source  *Imports // the imports of the scope in the import map
+}
+
+// normalizedImportMap is the import map after the "sort and normalize" steps of the spec,
+// the keys of the specifier maps and the scopes are sorted in descending order.
+type normalizedImportMap struct {
+	imports   []specifierMapEntry
+	scopes    []normalizedScope
+	integrity map[string]string
+}
+
+// matches returns true if the scope applies to the given base url.
+func (scope *normalizedScope) matches(baseURL string) bool {
+	return scope.prefix == baseURL || (strings.HasSuffix(scope.prefix, "/") && strings.HasPrefix(baseURL, scope.prefix))
+}
+
+// cachedImportMap is a normalized import map with the revision of the import map it was built from.
+type cachedImportMap struct {
+	rev normalizeRev
+	nm  *normalizedImportMap
+}
+
+// normalizeRev identifies the state of an import map, it changes whenever the import map is modified.
+type normalizeRev struct {
+	baseUrl      *url.URL
+	imports      *Imports
+	importsRev   int
+	integrity    *Imports
+	integrityRev int
+	scopesRev    int
+	scopeRevs    int // the sum of the revisions of the scopes, which only grow
+}
+
+// resolvedModule is a record of the resolved module set of the spec.
+type resolvedModule struct {
+	base      string
+	specifier string
+	asURL     *url.URL
+}
+
+// Resolve resolves a specifier to a URL.
+// It returns the URL and a boolean indicating if the specifier was mapped by the import map,
+// the specifier is returned as it is if it's not mapped or the resolution fails.
+// Bare specifiers with query or hash (e.g. `react?dev`) fall back to the mapping of the specifier
+// without the query or hash.
+// If the import map has no base url, the resolved `file:` URLs are returned as pathnames.
+func (im *ImportMap) Resolve(specifier string, referrer *url.URL) (string, bool) {
+	resolved, mapped, err := im.ResolveSpecifier(specifier, referrer)
+	if err != nil {
+		if i := strings.IndexAny(specifier, "?#"); i > 0 {
+			resolved, mapped, err = im.ResolveSpecifier(specifier[:i], referrer)
+			if err == nil && mapped {
+				return im.formatURL(resolved) + specifier[i:], true
+			}
+		}
+		return specifier, false
+	}
+	if !mapped {
+		return specifier, false
+	}
+	return im.formatURL(resolved), true
+}
+
+// ResolveSpecifier resolves a module specifier following the algorithm of the HTML spec:
+// https://html.spec.whatwg.org/multipage/webappapis.html#resolve-a-module-specifier
+// It returns the resolved URL and a boolean indicating if the specifier was mapped by the import map.
+// An error is returned if the resolution is blocked by a `null` entry, backtracks above its prefix,
+// or the specifier is a bare specifier that is not mapped.
+func (im *ImportMap) ResolveSpecifier(specifier string, referrer *url.URL) (resolved *url.URL, mapped bool, err error) {
+	baseURL := im.base()
+	if referrer != nil {
+		baseURL = im.referrerURL(referrer.String())
+	}
+	baseURLString := baseURL.String()
+	asURL := resolveURLLikeSpecifier(specifier, baseURL)
+	normalizedSpecifier := specifier
+	if asURL != nil {
+		normalizedSpecifier = asURL.String()
+	}
+
+	defer func() {
+		if err == nil {
+			im.addResolvedModule(resolvedModule{baseURLString, normalizedSpecifier, asURL})
+		}
+	}()
+
+	nm := im.normalize()
+	for _, scope := range nm.scopes {
+		if scope.matches(baseURLString) {
+			resolved, err = resolveImportsMatch(normalizedSpecifier, asURL, scope.imports)
+			if err != nil || resolved != nil {
+				return resolved, resolved != nil, err
+			}
+		}
+	}
+	resolved, err = resolveImportsMatch(normalizedSpecifier, asURL, nm.imports)
+	if err != nil || resolved != nil {
+		return resolved, resolved != nil, err
+	}
+	if asURL != nil {
+		return asURL, false, nil
+	}
+	return nil, false, fmt.Errorf("bare specifier %q was not remapped to anything by the import map", specifier)
+}
+
+// Merge merges a new import map into the import map following the algorithm of the HTML spec:
+// https://html.spec.whatwg.org/multipage/webappapis.html#merge-existing-and-new-import-maps
+// Entries of the new import map that are already defined, or would change the resolution of
+// already resolved modules, are ignored and reported as warnings.
+func (im *ImportMap) Merge(newImportMap *ImportMap) (warnings []string) {
+	newMap := newImportMap.normalize()
+	oldMap := im.normalize()
+
+	im.lock.RLock()
+	resolved := make([]resolvedModule, 0, len(im.resolved))
+	for _, record := range im.resolved {
+		resolved = append(resolved, record)
+	}
+	im.lock.RUnlock()
+
+	oldScopes := make(map[string]*Imports, len(oldMap.scopes))
+	oldScopeKeys := make(map[string]map[string]bool, len(oldMap.scopes))
+	for _, scope := range oldMap.scopes {
+		oldScopes[scope.prefix] = scope.source
+		oldScopeKeys[scope.prefix] = specifierMapKeys(scope.imports)
+	}
+
+	for _, scope := range newMap.scopes {
+		scopeImports := scope.imports
+		for _, record := range resolved {
+			if scope.matches(record.base) {
+				scopeImports = filterSpecifierMap(scopeImports, func(key string) bool {
+					if key == record.specifier || (strings.HasSuffix(key, "/") && strings.HasPrefix(record.specifier, key) && (record.asURL == nil || isSpecialURL(record.asURL))) {
+						warnings = append(warnings, fmt.Sprintf("ignored rule %q of scope %q since it was already resolved", key, scope.prefix))
+						return false
+					}
+					return true
+				})
+			}
+		}
+		if imports, ok := oldScopes[scope.prefix]; ok {
+			warnings = append(warnings, mergeSpecifierMap(imports, oldScopeKeys[scope.prefix], scopeImports)...)
+		} else {
+			imports := NewImports(nil)
+			mergeSpecifierMap(imports, nil, scopeImports)
+			im.SetScopeImports(scope.prefix, imports)
+		}
+	}
+
+	for url, integrity := range newMap.integrity {
+		if _, ok := oldMap.integrity[url]; ok {
+			warnings = append(warnings, fmt.Sprintf("ignored integrity of %q since it was already defined", url))
+			continue
+		}
+		im.integrity.Set(url, integrity)
+	}
+
+	newImports := newMap.imports
+	for _, record := range resolved {
+		newImports = filterSpecifierMap(newImports, func(key string) bool {
+			if strings.HasPrefix(key, record.specifier) {
+				warnings = append(warnings, fmt.Sprintf("ignored rule %q since it was already resolved", key))
+				return false
+			}
+			return true
+		})
+	}
+	warnings = append(warnings, mergeSpecifierMap(im.Imports, specifierMapKeys(oldMap.imports), newImports)...)
+	return
+}
+
+// mergeSpecifierMap merges the new specifier map into the old one, the existing keys are not overridden.
+func mergeSpecifierMap(imports *Imports, existingKeys map[string]bool, newMap []specifierMapEntry) (warnings []string) {
+	// keep the order of the new map
+	for i := len(newMap) - 1; i >= 0; i-- {
+		entry := newMap[i]
+		if existingKeys[entry.key] {
+			warnings = append(warnings, fmt.Sprintf("ignored rule %q since it was already defined", entry.key))
+			continue
+		}
+		var value string
+		if entry.url != nil {
+			value = entry.url.String()
+		}
+		imports.Set(entry.key, value)
+	}
+	return
+}
+
+func specifierMapKeys(specifierMap []specifierMapEntry) map[string]bool {
+	keys := make(map[string]bool, len(specifierMap))
+	for _, entry := range specifierMap {
+		keys[entry.key] = true
+	}
+	return keys
+}
+
+func filterSpecifierMap(specifierMap []specifierMapEntry, fn func(key string) bool) []specifierMapEntry {
+	filtered := make([]specifierMapEntry, 0, len(specifierMap))
+	for _, entry := range specifierMap {
+		if fn(entry.key) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// referrerURL returns the normalized url of the referrer, the base url of the import map is
+// returned if the referrer is invalid.
+func (im *ImportMap) referrerURL(referrer string) *url.URL {
+	baseURL := im.base()
+	if u, err := parseURL(referrer, baseURL); err == nil {
+		return u
+	}
+	return baseURL
+}
+
+func (im *ImportMap) base() *url.URL {
+	if im.baseUrl != nil {
+		return im.baseUrl
+	}
+	return defaultBaseUrl
+}
+
+func (im *ImportMap) formatURL(u *url.URL) string {
+	if im.baseUrl == nil && u.Scheme == "file" && u.Host == "" {
+		s := u.EscapedPath()
+		if u.RawQuery != "" || u.ForceQuery {
+			s += "?" + u.RawQuery
+		}
+		if u.Fragment != "" {
+			s += "#" + u.EscapedFragment()
+		}
+		return s
+	}
+	return u.String()
+}
+
+func (im *ImportMap) addResolvedModule(record resolvedModule) {
+	key := record.base + " " + record.specifier
+	im.lock.Lock()
+	defer im.lock.Unlock()
+	if im.resolved == nil {
+		im.resolved = map[string]resolvedModule{}
+	}
+	im.resolved[key] = record
+}
+
+// normalize returns the normalized import map with the base url of the import map,
+// the result is cached until the import map is modified.
+func (im *ImportMap) normalize() *normalizedImportMap {
+	rev := normalizeRev{
+		baseUrl:      im.baseUrl,
+		imports:      im.Imports,
+		importsRev:   im.Imports.rev(),
+		integrity:    im.integrity,
+		integrityRev: im.integrity.rev(),
+	}
+	im.lock.RLock()
+	rev.scopesRev = im.scopesRev
+	for _, imports := range im.scopes {
+		rev.scopeRevs += imports.rev()
+	}
+	cached := im.cached
+	im.lock.RUnlock()
+	if cached != nil && cached.rev == rev {
+		return cached.nm
+	}
+	nm := im.buildNormalized()
+	im.lock.Lock()
+	im.cached = &cachedImportMap{rev, nm}
+	im.lock.Unlock()
+	return nm
+}
+
+// buildNormalized implements the "sort and normalize" steps of the spec for the import map.
+func (im *ImportMap) buildNormalized() *normalizedImportMap {
+	baseURL := im.base()
+	nm := &normalizedImportMap{
+		imports:   sortAndNormalizeSpecifierMap(im.Imports, baseURL),
+		integrity: map[string]string{},
+	}
+
+	im.lock.RLock()
+	prefixes := make([]string, 0, len(im.scopes))
+	for prefix := range im.scopes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	scopes := make(map[string]normalizedScope, len(prefixes))
+	for _, prefix := range prefixes {
+		scopePrefixURL, err := parseURL(prefix, baseURL)
+		if err != nil {
+			// invalid scope prefix, ignore
+			continue
+		}
+		imports := im.scopes[prefix]
+		scopes[scopePrefixURL.String()] = normalizedScope{scopePrefixURL.String(), sortAndNormalizeSpecifierMap(imports, baseURL), imports}
+	}
+	im.lock.RUnlock()
+	for _, scope := range scopes {
+		nm.scopes = append(nm.scopes, scope)
+	}
+	sort.Slice(nm.scopes, func(i, j int) bool {
+		return nm.scopes[i].prefix > nm.scopes[j].prefix
+	})
+
+	im.integrity.Range(func(key string, integrity string) bool {
+		if u := resolveURLLikeSpecifier(key, baseURL); u != nil && integrity != "" {
+			nm.integrity[u.String()] = integrity
+		}
+		return true
+	})
+	return nm
+}
+
+// sortAndNormalizeSpecifierMap implements the "sort and normalize a specifier map" algorithm of the spec.
+func sortAndNormalizeSpecifierMap(imports *Imports, baseURL *url.URL) []specifierMapEntry {
+	normalized := map[string]*url.URL{}
+	imports.Range(func(specifierKey string, value string) bool {
+		normalizedSpecifierKey := normalizeSpecifierKey(specifierKey, baseURL)
+		if normalizedSpecifierKey == "" {
+			return true
+		}
+		addressURL := resolveURLLikeSpecifier(value, baseURL)
+		if value == "" || addressURL == nil || (strings.HasSuffix(specifierKey, "/") && !strings.HasSuffix(addressURL.String(), "/")) {
+			normalized[normalizedSpecifierKey] = nil
+		} else {
+			normalized[normalizedSpecifierKey] = addressURL
+		}
+		return true
+	})
+	entries := make([]specifierMapEntry, 0, len(normalized))
+	for key, url := range normalized {
+		entries = append(entries, specifierMapEntry{key, url})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key > entries[j].key
+	})
+	return entries
+}
+
+// normalizeSpecifierKey implements the "normalize a specifier key" algorithm of the spec,
+// an empty string is returned for invalid keys.
+func normalizeSpecifierKey(specifierKey string, baseURL *url.URL) string {
+	if specifierKey == "" {
+		return ""
+	}
+	if u := resolveURLLikeSpecifier(specifierKey, baseURL); u != nil {
+		return u.String()
+	}
+	return specifierKey
+}
+
+// resolveImportsMatch implements the "resolve an imports match" algorithm of the spec.
+func resolveImportsMatch(normalizedSpecifier string, asURL *url.URL, specifierMap []specifierMapEntry) (*url.URL, error) {
+	for _, entry := range specifierMap {
+		if entry.key == normalizedSpecifier {
+			if entry.url == nil {
+				return nil, fmt.Errorf("resolution of %q was blocked by a null entry", entry.key)
+			}
+			u := *entry.url
+			return &u, nil
+		}
+		if strings.HasSuffix(entry.key, "/") && strings.HasPrefix(normalizedSpecifier, entry.key) && (asURL == nil || isSpecialURL(asURL)) {
+			if entry.url == nil {
+				return nil, fmt.Errorf("resolution of %q was blocked by a null entry", entry.key)
+			}
+			afterPrefix := normalizedSpecifier[len(entry.key):]
+			u, err := parseURL(afterPrefix, entry.url)
+			if err != nil {
+				return nil, fmt.Errorf("resolution of %q was blocked since %q could not be parsed against %q", normalizedSpecifier, afterPrefix, entry.url)
+			}
+			if !strings.HasPrefix(u.String(), entry.url.String()) {
+				return nil, fmt.Errorf("resolution of %q was blocked due to it backtracking above its prefix %q", normalizedSpecifier, entry.key)
+			}
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveURLLikeSpecifier implements the "resolve a URL-like module specifier" algorithm of the spec,
+// nil is returned if the specifier is not URL-like.
+func resolveURLLikeSpecifier(specifier string, baseURL *url.URL) *url.URL {
+	if strings.HasPrefix(specifier, "/") || strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") {
+		u, err := parseURL(specifier, baseURL)
+		if err != nil {
+			return nil
+		}
+		return u
+	}
+	u, err := parseURL(specifier, nil)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func isSpecialURL(u *url.URL) bool {
+	_, ok := specialSchemes[u.Scheme]
+	return ok
+}
+
+// parseURL parses the input against the base url, it approximates the URL parser of the URL standard
+// (https://url.spec.whatwg.org/#concept-url-parser) for the cases that matter to import maps.
+func parseURL(input string, baseURL *url.URL) (u *url.URL, err error) {
+	input = strings.TrimFunc(input, func(r rune) bool { return r <= ' ' })
+	input = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, input)
+
+	if scheme, rest, ok := cutScheme(input); ok {
+		if _, special := specialSchemes[scheme]; special {
+			rest = strings.ReplaceAll(rest, "\\", "/")
+			if baseURL != nil && baseURL.Scheme == scheme && !strings.HasPrefix(rest, "/") {
+				// e.g. `https:foo` against a `https:` base url is a relative url
+				return parseURL(rest, baseURL)
+			}
+			if scheme == "file" {
+				if !strings.HasPrefix(rest, "//") {
+					rest = "///" + strings.TrimLeft(rest, "/")
+				}
+				input = "file:" + rest
+			} else {
+				rest = strings.TrimLeft(rest, "/")
+				// the host is percent-decoded, e.g. `fetch%2Dscheme.com` is `fetch-scheme.com`
+				authority, path := rest, ""
+				if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+					authority, path = rest[:i], rest[i:]
+				}
+				if strings.Contains(authority, "%") {
+					userinfo, host := "", authority
+					if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+						userinfo, host = authority[:i+1], authority[i+1:]
+					}
+					if host, err = url.PathUnescape(host); err != nil {
+						return nil, errInvalidURL
+					}
+					rest = userinfo + host + path
+				}
+				input = scheme + "://" + rest
+			}
+		}
+		u, err = url.Parse(input)
+		if err != nil {
+			return nil, errInvalidURL
+		}
+	} else {
+		if baseURL == nil || baseURL.Opaque != "" {
+			return nil, errInvalidURL
+		}
+		if isSpecialURL(baseURL) {
+			input = strings.ReplaceAll(input, "\\", "/")
+		}
+		var ref *url.URL
+		ref, err = url.Parse(input)
+		if err != nil && !strings.HasPrefix(input, "/") && !strings.HasPrefix(input, ".") {
+			// e.g. `a:b` (with an invalid scheme) is a path segment
+			ref, err = url.Parse("./" + input)
+		}
+		if err != nil {
+			return nil, errInvalidURL
+		}
+		u = baseURL.ResolveReference(ref)
+	}
+
+	if defaultPort, special := specialSchemes[u.Scheme]; special {
+		if u.Scheme != "file" {
+			hostname := u.Hostname()
+			if hostname == "" {
+				return nil, errInvalidURL
+			}
+			if strings.HasPrefix(u.Host, "[") {
+				if ip := net.ParseIP(hostname); ip == nil || ip.To4() != nil {
+					return nil, errInvalidURL
+				}
+			} else if strings.ContainsAny(hostname, " #/:<>?@[\\]^|") {
+				return nil, errInvalidURL
+			}
+			u.Host = strings.ToLower(u.Host)
+			if port := u.Port(); port == defaultPort || port == "" {
+				u.Host = strings.TrimSuffix(u.Host, ":"+port)
+			}
+		}
+		if u.Opaque != "" {
+			return nil, errInvalidURL
+		}
+		if u.Path == "" {
+			u.Path = "/"
+			u.RawPath = ""
+		}
+		// remove the dot segments of the path
+		u = u.ResolveReference(&url.URL{})
+	}
+	return u, nil
+}
+
+// cutScheme cuts the scheme of the url, the scheme is lowercased.
+func cutScheme(input string) (scheme string, rest string, ok bool) {
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		case i > 0 && c == ':':
+			return strings.ToLower(input[:i]), input[i+1:], true
+		default:
+			return "", input, false
+		}
+	}
+	return "", input, false
+}
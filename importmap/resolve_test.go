@@ -0,0 +1,150 @@
+package importmap
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestResolveWithoutBaseURL(t *testing.T) {
+	im, err := Parse(nil, []byte(`{
+		"imports": {
+			"react": "https://esm.sh/react@19.0.0/es2022/react.mjs",
+			"app/": "./src/",
+			"blocked": null
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for specifier, expected := range map[string]string{
+		"react":            "https://esm.sh/react@19.0.0/es2022/react.mjs",
+		"react?dev":        "https://esm.sh/react@19.0.0/es2022/react.mjs?dev",
+		"app/main.ts":      "/src/main.ts",
+		"app/main.ts?v=1":  "/src/main.ts?v=1",
+		"app/../../escape": "app/../../escape",
+		"blocked":          "blocked",
+		"./local.ts":       "./local.ts",
+		"vue":              "vue",
+	} {
+		resolved, _ := im.Resolve(specifier, nil)
+		if resolved != expected {
+			t.Fatalf("Expected %q to be resolved to %s, got %s", specifier, expected, resolved)
+		}
+	}
+	referrer, _ := url.Parse("/src/main.ts")
+	if resolved, ok := im.Resolve("app/utils.ts", referrer); !ok || resolved != "/src/utils.ts" {
+		t.Fatalf("Expected app/utils.ts to be resolved to /src/utils.ts, got %s", resolved)
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	im := Blank()
+	im.Imports.Set("react", "https://esm.sh/react@19.0.0")
+	if resolved, _ := im.Resolve("react", nil); resolved != "https://esm.sh/react@19.0.0" {
+		t.Fatalf("Expected react to be resolved to react@19.0.0, got %s", resolved)
+	}
+	nm := im.normalize()
+	if im.normalize() != nm {
+		t.Fatal("Expected the normalized import map to be cached")
+	}
+
+	im.Imports.Set("react", "https://esm.sh/react@19.1.0")
+	if resolved, _ := im.Resolve("react", nil); resolved != "https://esm.sh/react@19.1.0" {
+		t.Fatalf("Expected react to be resolved to react@19.1.0, got %s", resolved)
+	}
+	im.SetScopeImports("/app/", NewImports(map[string]string{"react": "https://esm.sh/react@18.3.1"}))
+	referrer, _ := url.Parse("/app/main.ts")
+	if resolved, _ := im.Resolve("react", referrer); resolved != "https://esm.sh/react@18.3.1" {
+		t.Fatalf("Expected react to be resolved to react@18.3.1, got %s", resolved)
+	}
+	scope, _ := im.GetScopeImports("/app/")
+	scope.Set("react", "https://esm.sh/react@18.2.0")
+	if resolved, _ := im.Resolve("react", referrer); resolved != "https://esm.sh/react@18.2.0" {
+		t.Fatalf("Expected react to be resolved to react@18.2.0, got %s", resolved)
+	}
+	im.DeleteScope("/app/")
+	if resolved, _ := im.Resolve("react", referrer); resolved != "https://esm.sh/react@19.1.0" {
+		t.Fatalf("Expected react to be resolved to react@19.1.0, got %s", resolved)
+	}
+}
+
+func TestLookupImport(t *testing.T) {
+	im := Blank()
+	im.Imports.Set("dep", "https://esm.sh/dep@1.0.0")
+	im.SetScopeImports("https://esm.sh/app@1.0.0", NewImports(map[string]string{"dep": "https://esm.sh/dep@2.0.0"}))
+	im.SetScopeImports("https://esm.sh/lib@1.0.0/", NewImports(map[string]string{"dep": "https://esm.sh/dep@3.0.0"}))
+	for referrer, expected := range map[string]string{
+		// a scope without a trailing slash matches the exact url only
+		"https://esm.sh/app@1.0.0":                "https://esm.sh/dep@2.0.0",
+		"https://esm.sh/app@1.0.0/es2022/app.mjs": "https://esm.sh/dep@1.0.0",
+		"https://esm.sh/lib@1.0.0/es2022/lib.mjs": "https://esm.sh/dep@3.0.0",
+		// the referrer is normalized like `ResolveSpecifier` does
+		"https://ESM.sh:443/lib@1.0.0/es2022/lib.mjs": "https://esm.sh/dep@3.0.0",
+	} {
+		_, url, ok := im.lookupImport("dep", referrer)
+		if !ok || url != expected {
+			t.Fatalf("Expected dep of %s to be %s, got %s", referrer, expected, url)
+		}
+		if resolved, _ := im.Resolve("dep", mustParseURL(referrer)); resolved != url {
+			t.Fatalf("Expected lookupImport and Resolve to agree on %s, got %s and %s", referrer, url, resolved)
+		}
+	}
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestMerge(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/app/index.html")
+	im, err := Parse(baseURL, []byte(`{"imports": {"a": "/a-1.mjs"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrer, _ := url.Parse("https://example.com/js/app.mjs")
+	if _, _, err = im.ResolveSpecifier("a", referrer); err != nil {
+		t.Fatal(err)
+	}
+
+	newBaseURL, _ := url.Parse("https://example.com/other/index.html")
+	newMap, err := Parse(newBaseURL, []byte(`{
+		"imports": {
+			"a": "/a-2.mjs",
+			"a/": "/a/",
+			"b": "./b.mjs"
+		},
+		"scopes": {
+			"/js/": {
+				"a": "/a-3.mjs",
+				"c": "/c.mjs"
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := im.Merge(newMap)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %v", warnings)
+	}
+	for specifier, expected := range map[string]string{
+		"a": "https://example.com/a-1.mjs",
+		"b": "https://example.com/other/b.mjs",
+		"c": "https://example.com/c.mjs",
+	} {
+		resolved, _, err := im.ResolveSpecifier(specifier, referrer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved.String() != expected {
+			t.Fatalf("Expected %q to be resolved to %s, got %s", specifier, expected, resolved)
+		}
+	}
+	if _, _, err = im.ResolveSpecifier("a/foo", referrer); err == nil {
+		t.Fatal("Expected a/foo to be unmapped")
+	}
+}
@@ -0,0 +1,165 @@
+package importmap
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ije/gox/set"
+)
+
+// Dependent is an import of the import map that depends on a package.
+type Dependent struct {
+	Importer string // the package of the import, e.g. "react-dom@19.2.3"
+	Range    string // the semver range of the dependency, e.g. "^19.0.0"
+	Peer     bool   // the dependency is a peer dependency
+}
+
+// WhyEntry is a version of a package in the import map with the imports that resolve to it.
+type WhyEntry struct {
+	Version    string      // the version of the package
+	Location   string      // "imports" or the scope of the import map
+	TopLevel   bool        // the package is in the top-level imports
+	Dependents []Dependent // the imports that resolve the package to the version
+}
+
+// Why explains why the versions of the package are in the import map: where they are, which imports
+// depend on them with which semver ranges. The reason of the version chosen for the peer dependents
+// is returned as well, see `ResolvePeers`.
+func (im *ImportMap) Why(name string) (entries []WhyEntry, reason string, errors []error) {
+	cdnOrigin := im.CDNOrigin()
+	cdnScopePrefix := cdnOrigin + "/"
+	isPackage := func(imp Import) bool {
+		return Import{Name: imp.Name, Github: imp.Github, Jsr: imp.Jsr}.Specifier(false) == name
+	}
+
+	// find the versions of the package and the importers
+	type importer struct {
+		imp Import
+		url string
+	}
+	var importers []importer
+	seen := set.New[string]()
+	findEntry := func(version string, location string) *WhyEntry {
+		for i := range entries {
+			if entries[i].Version == version && entries[i].Location == location {
+				return &entries[i]
+			}
+		}
+		entries = append(entries, WhyEntry{Version: version, Location: location})
+		return &entries[len(entries)-1]
+	}
+	collect := func(location string, imports *Imports) {
+		imports.Range(func(specifier string, url string) bool {
+			if !strings.HasPrefix(url, cdnScopePrefix) {
+				return true
+			}
+			imp, err := ParseEsmPath(url)
+			if err != nil {
+				return true
+			}
+			if isPackage(imp) {
+				entry := findEntry(imp.Version, location)
+				if location == "imports" && (specifier == name || strings.HasPrefix(specifier, name+"/")) {
+					entry.TopLevel = true
+				}
+			} else if !seen.Has(imp.Specifier(true)) {
+				seen.Add(imp.Specifier(true))
+				importers = append(importers, importer{imp: imp, url: url})
+			}
+			return true
+		})
+	}
+	collect("imports", im.Imports)
+	im.RangeScopes(func(scope string, imports *Imports) bool {
+		collect(scope, imports)
+		return true
+	})
+	if len(entries) == 0 {
+		return
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	metas := make([]ImportMeta, len(importers))
+	for i, importer := range importers {
+		imp := importer.imp
+		imp.External = strings.Contains(importer.url, "/*")
+		wg.Go(func() {
+			meta, err := im.FetchImportMeta(imp)
+			if err != nil {
+				lock.Lock()
+				errors = append(errors, err)
+				lock.Unlock()
+				return
+			}
+			metas[i] = meta
+		})
+	}
+	wg.Wait()
+	if len(errors) > 0 {
+		return
+	}
+
+	var requests []PeerRequest
+	for i, meta := range metas {
+		for j, pathname := range slices.Concat(meta.PeerImports, meta.Imports) {
+			dep, err := ParseEsmPath(pathname)
+			if err != nil || !isPackage(dep) {
+				continue
+			}
+			imports, url, ok := im.lookupImport(dep.Specifier(false), importers[i].url)
+			if !ok {
+				continue
+			}
+			resolved, err := ParseEsmPath(url)
+			if err != nil || !isPackage(resolved) {
+				continue
+			}
+			location := "imports"
+			if imports != im.Imports {
+				im.RangeScopes(func(scope string, scopeImports *Imports) bool {
+					if scopeImports == imports {
+						location = scope
+						return false
+					}
+					return true
+				})
+			}
+			dependent := Dependent{
+				Importer: Import{Name: meta.Name, Version: meta.Version, Github: meta.Github, Jsr: meta.Jsr}.Specifier(true),
+				Range:    dep.Version,
+				Peer:     j < len(meta.PeerImports),
+			}
+			entry := findEntry(resolved.Version, location)
+			if !slices.Contains(entry.Dependents, dependent) {
+				entry.Dependents = append(entry.Dependents, dependent)
+				if dependent.Peer {
+					requests = append(requests, PeerRequest{Importer: dependent.Importer, Range: dependent.Range})
+				}
+			}
+		}
+	}
+
+	// explain the version chosen for the peer dependents with the versions in the import map
+	if len(requests) > 0 {
+		var current, topLevel string
+		var candidates []string
+		for _, entry := range entries {
+			if entry.Location == "imports" || entry.Location == cdnScopePrefix {
+				current = entry.Version
+			}
+			if entry.TopLevel {
+				topLevel = entry.Version
+			}
+			candidates = append(candidates, entry.Version)
+		}
+		var version string
+		version, _, reason = choosePeerVersion(name, requests, "", current, candidates)
+		if topLevel != "" && topLevel != version {
+			// `ResolvePeers` only keeps another version in the top-level imports if it's added explicitly
+			_, _, reason = choosePeerVersion(name, requests, topLevel, current, candidates)
+		}
+	}
+	return
+}
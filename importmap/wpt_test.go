@@ -0,0 +1,148 @@
+package importmap
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wptTest is a test of the WPT import maps data-driven format, see testdata/wpt/README.md
+type wptTest struct {
+	ImportMap               json.RawMessage     `json:"importMap"`
+	ImportMapBaseURL        string              `json:"importMapBaseURL"`
+	BaseURL                 string              `json:"baseURL"`
+	ExpectedResults         map[string]*string  `json:"expectedResults"`
+	ExpectedParsedImportMap json.RawMessage     `json:"expectedParsedImportMap"`
+	Tests                   map[string]*wptTest `json:"tests"`
+}
+
+func TestWPT(t *testing.T) {
+	files, err := filepath.Glob("testdata/wpt/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no WPT test data found")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var test wptTest
+		if err = json.Unmarshal(data, &test); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			runWPTTest(t, &test)
+		})
+	}
+}
+
+func runWPTTest(t *testing.T, test *wptTest) {
+	for name, subtest := range test.Tests {
+		if subtest.ImportMap == nil {
+			subtest.ImportMap = test.ImportMap
+		}
+		if subtest.ImportMapBaseURL == "" {
+			subtest.ImportMapBaseURL = test.ImportMapBaseURL
+		}
+		if subtest.BaseURL == "" {
+			subtest.BaseURL = test.BaseURL
+		}
+		t.Run(name, func(t *testing.T) {
+			runWPTTest(t, subtest)
+		})
+	}
+	if test.ExpectedResults == nil && test.ExpectedParsedImportMap == nil {
+		return
+	}
+
+	importMapText := []byte(test.ImportMap)
+	var s string
+	if json.Unmarshal(test.ImportMap, &s) == nil {
+		importMapText = []byte(s)
+	}
+	importMapBaseURL, err := url.Parse(test.ImportMapBaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := Parse(importMapBaseURL, importMapText)
+
+	if test.ExpectedParsedImportMap != nil {
+		if string(test.ExpectedParsedImportMap) == "null" {
+			if err == nil {
+				t.Fatalf("Expected parsing %s to fail", importMapText)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected map[string]any
+		if err = json.Unmarshal(test.ExpectedParsedImportMap, &expected); err != nil {
+			t.Fatal(err)
+		}
+		parsed := normalizedJSON(im.normalize())
+		for key, value := range expected {
+			if !reflect.DeepEqual(parsed[key], value) {
+				t.Fatalf("Expected parsed %s to be %v, got %v", key, value, parsed[key])
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL, err := url.Parse(test.BaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for specifier, expected := range test.ExpectedResults {
+		resolved, _, err := im.ResolveSpecifier(specifier, baseURL)
+		if expected == nil {
+			if err == nil {
+				t.Fatalf("Expected resolving %q to fail, got %s", specifier, resolved)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected %q to be resolved to %s, got error: %v", specifier, *expected, err)
+		}
+		if resolved.String() != *expected {
+			t.Fatalf("Expected %q to be resolved to %s, got %s", specifier, *expected, resolved)
+		}
+	}
+}
+
+// normalizedJSON returns the normalized import map in the shape of the decoded JSON.
+func normalizedJSON(nm *normalizedImportMap) map[string]any {
+	specifierMap := func(entries []specifierMapEntry) map[string]any {
+		m := map[string]any{}
+		for _, entry := range entries {
+			if entry.url != nil {
+				m[entry.key] = entry.url.String()
+			} else {
+				m[entry.key] = nil
+			}
+		}
+		return m
+	}
+	scopes := map[string]any{}
+	for _, scope := range nm.scopes {
+		scopes[scope.prefix] = specifierMap(scope.imports)
+	}
+	integrity := map[string]any{}
+	for url, value := range nm.integrity {
+		integrity[url] = value
+	}
+	return map[string]any{
+		"imports":   specifierMap(nm.imports),
+		"scopes":    scopes,
+		"integrity": integrity,
+	}
+}
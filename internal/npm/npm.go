@@ -3,6 +3,7 @@ package npm
 import (
 	"errors"
 	"net/url"
+	"path"
 	"regexp"
 	"slices"
 	"sort"
@@ -35,33 +36,63 @@ func ValidatePackageName(pkgName string) bool {
 }
 
 type Package struct {
-	Name     string
-	Version  string
-	Url      string
-	Github   bool
-	PkgPrNew bool
+	Name    string
+	Version string
+	Url     string
+	// Github is true for the packages installed from a git repository
+	Github bool
+	// GitHost is the path prefix of the git host other than GitHub, e.g. "gitlab", "bitbucket", "git/gitea"
+	GitHost string
+	// Workspace is the directory of the workspace package in the git repository, e.g. "packages/foo"
+	Workspace string
+	PkgPrNew  bool
+	// Tarball is the url or the `file:` path of the tarball that the package is installed from
+	Tarball string
+	// Integrity is the subresource integrity of the tarball, e.g. "sha512-..."
+	Integrity string
 }
 
 func (p *Package) String() string {
 	s := p.Name + "@" + p.Version
+	if p.Workspace != "" {
+		s += "/" + p.Workspace
+	}
 	if p.Github {
+		if p.GitHost != "" {
+			return p.GitHost + "/" + s
+		}
 		return "gh/" + s
 	}
 	if p.PkgPrNew {
 		return "pr/" + s
 	}
+	if p.Tarball != "" {
+		return "tarball/" + s
+	}
 	return s
 }
 
 // ResolveDependencyVersion resolves the version of a dependency
 // e.g. "react": "npm:react@19.0.0"
 // e.g. "react": "github:facebook/react#semver:19.0.0"
+// e.g. "lib": "gitlab:owner/lib#v1.0.0"
+// e.g. "foo": "github:owner/monorepo#main&path:/packages/foo"
+// e.g. "bar": "github:owner/monorepo#path=packages/bar"
 // e.g. "flag": "jsr:@luca/flag@0.0.1"
+// e.g. "lib": "https://example.com/lib-1.0.0.tgz#sha512-..."
+// e.g. "lib": "file:../lib-1.0.0.tgz"
 // e.g. "tinybench": "https://pkg.pr.new/tinybench@a832a55"
 func ResolveDependencyVersion(v string) (Package, error) {
-	// ban file specifier
+	// only local tarballs are supported for the file specifier
 	if strings.HasPrefix(v, "file:") {
-		return Package{}, errors.New("unsupported file dependency")
+		filename, integrity := utils.SplitByLastByte(v, '#')
+		if !isTarballPath(filename) {
+			return Package{}, errors.New("unsupported file dependency")
+		}
+		return Package{
+			Tarball:   filename,
+			Integrity: integrity,
+		}, nil
 	}
 	if strings.HasPrefix(v, "npm:") {
 		pkgName, pkgVersion := splitPackageVersion(v[4:])
@@ -81,27 +112,61 @@ func ResolveDependencyVersion(v string) (Package, error) {
 			Version: pkgVersion,
 		}, nil
 	}
-	if after, ok := strings.CutPrefix(v, "github:"); ok {
+	for _, gitHost := range [][2]string{{"github:", ""}, {"gitlab:", "gitlab"}, {"bitbucket:", "bitbucket"}} {
+		if after, ok := strings.CutPrefix(v, gitHost[0]); ok {
+			repo, fragment := utils.SplitByLastByte(after, '#')
+			version, workspace := splitGitFragment(fragment)
+			return Package{
+				Github:    true,
+				GitHost:   gitHost[1],
+				Name:      repo,
+				Version:   version,
+				Workspace: workspace,
+			}, nil
+		}
+	}
+	// custom git hosts, e.g. "git/gitea:owner/repo#v1.0.0"
+	if strings.HasPrefix(v, "git/") && strings.ContainsRune(v, ':') {
+		gitHost, after := utils.SplitByFirstByte(v, ':')
+		if !Naming.Match(gitHost[4:]) {
+			return Package{}, errors.New("unsupported git dependency")
+		}
 		repo, fragment := utils.SplitByLastByte(after, '#')
+		version, workspace := splitGitFragment(fragment)
 		return Package{
-			Github:  true,
-			Name:    repo,
-			Version: strings.TrimPrefix(url.QueryEscape(fragment), "semver:"),
+			Github:    true,
+			GitHost:   gitHost,
+			Name:      repo,
+			Version:   version,
+			Workspace: workspace,
 		}, nil
 	}
 	if strings.HasPrefix(v, "git+ssh://") || strings.HasPrefix(v, "git+https://") || strings.HasPrefix(v, "git://") {
 		gitUrl, e := url.Parse(v)
-		if e != nil || gitUrl.Hostname() != "github.com" {
+		if e != nil {
+			return Package{}, errors.New("unsupported git dependency")
+		}
+		var gitHost string
+		switch gitUrl.Hostname() {
+		case "github.com":
+		case "gitlab.com":
+			gitHost = "gitlab"
+		case "bitbucket.org":
+			gitHost = "bitbucket"
+		default:
 			return Package{}, errors.New("unsupported git dependency")
 		}
 		repo := strings.TrimSuffix(gitUrl.Path[1:], ".git")
 		if gitUrl.Scheme == "git+ssh" {
 			repo = gitUrl.Port() + "/" + repo
 		}
+		version, workspace := splitGitFragment(gitUrl.Fragment)
 		return Package{
-			Github:  true,
-			Name:    repo,
-			Version: strings.TrimPrefix(url.QueryEscape(gitUrl.Fragment), "semver:"),
+			Github:    true,
+			GitHost:   gitHost,
+			Name:      repo,
+			Version:   version,
+			Workspace: workspace,
 		}, nil
 	}
 	if strings.HasPrefix(v, "https://") || strings.HasPrefix(v, "http://") {
@@ -124,20 +189,50 @@ func ResolveDependencyVersion(v string) (Package, error) {
 				Version:  version,
 			}, nil
 		}
+		if isTarballPath(u.Path) {
+			integrity := u.Fragment
+			u.Fragment = ""
+			return Package{
+				Tarball:   u.String(),
+				Integrity: integrity,
+			}, nil
+		}
 		return Package{Url: v}, nil
 	}
 	// see https://docs.npmjs.com/cli/v10/configuring-npm/package-json#git-urls-as-dependencies
 	if !strings.HasPrefix(v, "@") && strings.ContainsRune(v, '/') {
 		repo, fragment := utils.SplitByLastByte(v, '#')
+		version, workspace := splitGitFragment(fragment)
 		return Package{
-			Github:  true,
-			Name:    repo,
-			Version: strings.TrimPrefix(url.QueryEscape(fragment), "semver:"),
+			Github:    true,
+			Name:      repo,
+			Version:   version,
+			Workspace: workspace,
 		}, nil
 	}
 	return Package{}, nil
 }
 
+// splitGitFragment splits the fragment of a git dependency into the version and the workspace directory,
+// the directory is specified with the `path:` parameter like pnpm does, or the `path=` parameter,
+// e.g. "v1.0.0&path:/packages/foo"
+func splitGitFragment(fragment string) (version string, workspace string) {
+	for param := range strings.SplitSeq(fragment, "&") {
+		if strings.HasPrefix(param, "path:") || strings.HasPrefix(param, "path=") {
+			workspace = strings.Trim(path.Clean("/"+param[5:]), "/")
+		} else if version == "" {
+			version = param
+		}
+	}
+	version = url.QueryEscape(strings.TrimPrefix(version, "semver:"))
+	return
+}
+
+// isTarballPath returns true if the path is a gzipped tarball.
+func isTarballPath(path string) bool {
+	return strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz")
+}
+
 func splitPackageVersion(v string) (string, string) {
 	if strings.HasPrefix(v, "@") {
 		if i := strings.IndexByte(v[1:], '@'); i > 0 {
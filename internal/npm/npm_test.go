@@ -129,3 +129,50 @@ func TestResolveVersionByTime(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveGitWorkspaceDependency(t *testing.T) {
+	for v, expected := range map[string]Package{
+		"github:owner/repo#main&path:/packages/foo": {Github: true, Name: "owner/repo", Version: "main", Workspace: "packages/foo"},
+		"github:owner/repo#path=packages/bar":       {Github: true, Name: "owner/repo", Workspace: "packages/bar"},
+		"gitlab:owner/repo#v1.0.0&path:/../baz":     {Github: true, GitHost: "gitlab", Name: "owner/repo", Version: "v1.0.0", Workspace: "baz"},
+		"git/gitea:owner/repo#1a2b3c4&path:/pkg/":   {Github: true, GitHost: "git/gitea", Name: "owner/repo", Version: "1a2b3c4", Workspace: "pkg"},
+		"github:owner/repo#semver:^1.0.0":           {Github: true, Name: "owner/repo", Version: "%5E1.0.0"},
+	} {
+		pkg, err := ResolveDependencyVersion(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg != expected {
+			t.Fatalf("ResolveDependencyVersion(%q): expected %+v, got %+v", v, expected, pkg)
+		}
+	}
+	pkg := Package{Github: true, Name: "owner/repo", Version: "1a2b3c4", Workspace: "packages/foo"}
+	if pkg.String() != "gh/owner/repo@1a2b3c4/packages/foo" {
+		t.Fatalf("unexpected package string: %s", pkg.String())
+	}
+}
+
+func TestResolveTarballDependency(t *testing.T) {
+	for v, expected := range map[string]Package{
+		"https://example.com/lib-1.0.0.tgz#sha512-abc+/=": {Tarball: "https://example.com/lib-1.0.0.tgz", Integrity: "sha512-abc+/="},
+		"https://example.com/lib.tar.gz?token=1":          {Tarball: "https://example.com/lib.tar.gz?token=1"},
+		"file:../lib-1.0.0.tgz":                           {Tarball: "file:../lib-1.0.0.tgz"},
+		"file:./vendor/lib.tgz#sha256-abc":                {Tarball: "file:./vendor/lib.tgz", Integrity: "sha256-abc"},
+		"https://esm.sh/react@19.0.0":                     {Url: "https://esm.sh/react@19.0.0"},
+	} {
+		pkg, err := ResolveDependencyVersion(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg != expected {
+			t.Fatalf("ResolveDependencyVersion(%q): expected %+v, got %+v", v, expected, pkg)
+		}
+	}
+	if _, err := ResolveDependencyVersion("file:../lib"); err == nil {
+		t.Fatal("file dependency of a directory should be unsupported")
+	}
+	pkg := Package{Name: "lib", Version: "1a2b3c4d", Tarball: "file:/tmp/lib.tgz"}
+	if pkg.String() != "tarball/lib@1a2b3c4d" {
+		t.Fatalf("unexpected package string: %s", pkg.String())
+	}
+}
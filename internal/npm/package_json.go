@@ -34,11 +34,12 @@ type PackageJSONRaw struct {
 	Dependencies     any             `json:"dependencies"`
 	PeerDependencies any             `json:"peerDependencies"`
 	Imports          any             `json:"imports"`
-	TypesVersions    any             `json:"typesVersions"`
+	TypesVersions    json.RawMessage `json:"typesVersions"`
 	Exports          json.RawMessage `json:"exports"`
 	Esmsh            any             `json:"esm.sh"`
 	Dist             json.RawMessage `json:"dist"`
 	Deprecated       any             `json:"deprecated"`
+	Repository       any             `json:"repository"`
 }
 
 // NpmPackageDist defines the dist field of a NPM package
@@ -61,11 +62,13 @@ type PackageJSON struct {
 	Dependencies     map[string]string
 	PeerDependencies map[string]string
 	Imports          map[string]any
-	TypesVersions    map[string]any
+	TypesVersions    JSONObject
 	Exports          JSONObject
 	Esmsh            map[string]any
 	Dist             NpmPackageDist
 	Deprecated       string
+	// Repository is the url of the source repository, e.g. "git+https://github.com/owner/repo.git"
+	Repository string
 }
 
 // ToNpmPackage converts PackageJSONRaw to PackageJSON
@@ -152,6 +155,11 @@ func (a *PackageJSONRaw) ToNpmPackage() *PackageJSON {
 		}
 	}
 
+	typesVersions := JSONObject{}
+	if rawTypesVersions := a.TypesVersions; rawTypesVersions != nil {
+		typesVersions.UnmarshalJSON(rawTypesVersions)
+	}
+
 	depreacted := ""
 	if a.Deprecated != nil {
 		if s, ok := a.Deprecated.(string); ok {
@@ -159,6 +167,16 @@ func (a *PackageJSONRaw) ToNpmPackage() *PackageJSON {
 		}
 	}
 
+	// the `repository` field can be a string or an object with the `url` field
+	repository := ""
+	if s, ok := a.Repository.(string); ok {
+		repository = s
+	} else if m, ok := a.Repository.(map[string]any); ok {
+		if s, ok := m["url"].(string); ok {
+			repository = s
+		}
+	}
+
 	var dist NpmPackageDist
 	if a.Dist != nil {
 		json.Unmarshal(a.Dist, &dist)
@@ -177,11 +195,12 @@ func (a *PackageJSONRaw) ToNpmPackage() *PackageJSON {
 		Dependencies:     dependencies,
 		PeerDependencies: peerDependencies,
 		Imports:          asMap(a.Imports),
-		TypesVersions:    asMap(a.TypesVersions),
+		TypesVersions:    typesVersions,
 		Exports:          exports,
 		Esmsh:            asMap(a.Esmsh),
 		Deprecated:       depreacted,
 		Dist:             dist,
+		Repository:       repository,
 	}
 
 	if p.Types == "" {
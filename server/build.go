@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/sha512"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -137,6 +136,11 @@ func (ctx *BuildContext) Build(buildCtx context.Context) (meta *BuildMeta, err e
 		buildCtx = context.Background()
 	}
 	ctx.ctx = buildCtx
+	if ctx.esmPath.GhPrefix {
+		// the build of a private repository is only requested by the authorized clients, it may install
+		// the repository itself as a dependency, e.g. the workspace packages
+		ctx.ctx = withPrivateGhRepo(buildCtx, ctx.esmPath.PkgName)
+	}
 	if err = ctx.checkCanceled(); err != nil {
 		return
 	}
@@ -169,20 +173,29 @@ func (ctx *BuildContext) Build(buildCtx context.Context) (meta *BuildMeta, err e
 		return
 	}
 
-	// analyze splitting modules if bundling
-	if ctx.pkgJson.Exports.Len() > 1 && ctx.shouldBundle() {
-		ctx.status = "analyze"
-		err = ctx.analyzeSplitting()
+	if ctx.isCSSBuild() {
+		// build the package css file
+		ctx.status = "build"
+		meta, err = ctx.buildCSS()
 		if err != nil {
 			return
 		}
-	}
+	} else {
+		// analyze splitting modules if bundling
+		if ctx.pkgJson.Exports.Len() > 1 && ctx.shouldBundle() {
+			ctx.status = "analyze"
+			err = ctx.analyzeSplitting()
+			if err != nil {
+				return
+			}
+		}
 
-	// build the module
-	ctx.status = "build"
-	meta, _, err = ctx.buildModule(false)
-	if err != nil {
-		return
+		// build the module
+		ctx.status = "build"
+		meta, _, err = ctx.buildModule(false)
+		if err != nil {
+			return
+		}
 	}
 	if err = ctx.checkCanceled(); err != nil {
 		return
@@ -220,7 +233,7 @@ func (ctx *BuildContext) buildPath() {
 		return
 	}
 
-	name := strings.TrimSuffix(path.Base(esm.PkgName), ".js")
+	name := esm.moduleName()
 	if esm.SubPath != "" {
 		if esm.SubPath == name {
 			// if the sub-module name is same as the package name
@@ -234,6 +247,19 @@ func (ctx *BuildContext) buildPath() {
 		}
 	}
 
+	// the css build path keeps the original file name, e.g. "/pkg@1.0.0/es2022/style.css"
+	if ctx.isCSSBuild() {
+		ctx.path = fmt.Sprintf(
+			"/%s%s/%s%s/%s",
+			asteriskPrefix,
+			esm.PackageId(),
+			ctx.getBuildArgsPrefix(false),
+			ctx.target,
+			esm.SubPath,
+		)
+		return
+	}
+
 	if ctx.dev {
 		name += ".development"
 	}
@@ -373,7 +399,7 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 			err = errors.New("storage(put): " + err.Error())
 			return
 		}
-		meta.Dts, err = ctx.resolveDTS(entry)
+		meta.Dts, meta.DtsReason, err = ctx.resolveDTS(entry)
 		return
 	}
 
@@ -618,6 +644,10 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 					// bundles all dependencies in `bundle` mode, apart from peerDependencies and `?external` flag
 					if !isRelPathSpecifier(specifier) {
 						pkgName := toPackageName(specifier)
+						// bundles the dependencies installed from tarballs since they are not available in the registry
+						if isTarballDependency(pkgJson, pkgName) && !ctx.args.External.Has(pkgName) {
+							return esbuild.OnResolveResult{}, nil
+						}
 						if ctx.bundleMode == BundleDeps && !ctx.args.External.Has(pkgName) && !isPackageInExternalNamespace(pkgName, ctx.args.External) && !implicitExternal.Has(specifier) {
 							_, ok := pkgJson.PeerDependencies[pkgName]
 							if !ok {
@@ -725,7 +755,7 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 
 						if len(args.With) > 0 && args.With["type"] == "css" {
 							return esbuild.OnResolveResult{
-								Path:        "/" + ctx.esmPath.PackageId() + utils.NormalizePathname(modulePath) + "?module",
+								Path:        "/" + ctx.esmPath.PackageId() + "/" + ctx.getBuildArgsPrefix(false) + ctx.target + utils.NormalizePathname(modulePath) + "?module",
 								External:    true,
 								SideEffects: esbuild.SideEffectsFalse,
 							}, nil
@@ -839,6 +869,13 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 										Namespace: "wasm",
 									}, nil
 								}
+								// emit large binary assets (images, fonts, etc.) as separate files
+								if loaders[path.Ext(resolvedFilename)] == esbuild.LoaderDataURL && !ctx.shouldInlineAsset(resolvedFilename) {
+									return esbuild.OnResolveResult{
+										Path:      resolvedFilename,
+										Namespace: "asset",
+									}, nil
+								}
 								// transfrom svelte component
 								if strings.HasSuffix(resolvedFilename, ".svelte") {
 									return esbuild.OnResolveResult{
@@ -968,20 +1005,49 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 				},
 			)
 
-			// wasm module exclude loader
+			// wasm module loader
 			build.OnLoad(
 				esbuild.OnLoadOptions{Filter: ".*", Namespace: "wasm"},
 				func(args esbuild.OnLoadArgs) (ret esbuild.OnLoadResult, err error) {
-					wasm, err := os.ReadFile(args.Path)
+					code, err := ctx.getWasmModuleShim(args.Path, analyzeMode)
+					if err != nil {
+						return
+					}
+					return esbuild.OnLoadResult{Contents: &code, Loader: esbuild.LoaderJS, ResolveDir: path.Dir(args.Path)}, nil
+				},
+			)
+
+			// asset loader
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: ".*", Namespace: "asset"},
+				func(args esbuild.OnLoadArgs) (ret esbuild.OnLoadResult, err error) {
+					code, err := ctx.getAssetModule(args.Path, analyzeMode)
 					if err != nil {
 						return
 					}
-					wasm64 := base64.StdEncoding.EncodeToString(wasm)
-					code := fmt.Sprintf("export default Uint8Array.from(atob('%s'), c => c.charCodeAt(0))", wasm64)
 					return esbuild.OnLoadResult{Contents: &code, Loader: esbuild.LoaderJS}, nil
 				},
 			)
 
+			// rewrite `new URL("./foo.png", import.meta.url)` to the emitted asset URL, and
+			// `new Worker(new URL("./worker.js", import.meta.url))` to the built worker URL
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: `\.(m|c)?(j|t)sx?$`, Namespace: "file"},
+				func(args esbuild.OnLoadArgs) (ret esbuild.OnLoadResult, err error) {
+					data, err := os.ReadFile(args.Path)
+					if err != nil {
+						return
+					}
+					data, err = ctx.rewriteImportMetaURLs(args.Path, data, analyzeMode)
+					if err != nil || data == nil {
+						// let esbuild load the file
+						return
+					}
+					code := string(data)
+					return esbuild.OnLoadResult{Contents: &code, Loader: loaders[path.Ext(args.Path)]}, nil
+				},
+			)
+
 			// svelte SFC loader
 			build.OnLoad(
 				esbuild.OnLoadOptions{Filter: ".*", Namespace: "svelte"},
@@ -1166,7 +1232,9 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 	if ctx.target == "node" {
 		options.Platform = esbuild.PlatformNode
 	}
-	if config.SourceMap {
+	sourceMapMode := ctx.getSourceMapMode()
+	if sourceMapMode != "none" {
+		// always generate external source maps, the mappings need to be fixed before they are saved or inlined
 		options.Sourcemap = esbuild.SourceMapExternal
 	}
 	for _, pkgName := range []string{"preact", "react", "solid-js", "mono-jsx", "vue", "hono"} {
@@ -1249,12 +1317,22 @@ REBUILD:
 	}
 
 	imports := set.New[string]()
+	sourceMaps := map[string][]byte{}
+	for _, file := range res.OutputFiles {
+		if strings.HasSuffix(file.Path, ".map") {
+			sourceMaps[strings.TrimSuffix(file.Path, ".map")] = file.Contents
+		}
+	}
 
 	for _, file := range res.OutputFiles {
 		if strings.HasSuffix(file.Path, ".js") {
 			header := bytes.NewBufferString("/* esm.sh - ")
 			if ctx.esmPath.GhPrefix {
-				header.WriteString("github:")
+				if ctx.esmPath.GitHost != "" {
+					header.WriteString(strings.TrimPrefix(ctx.esmPath.GitHost, "git/") + ":")
+				} else {
+					header.WriteString("github:")
+				}
 			} else if ctx.esmPath.PrPrefix {
 				header.WriteString("pkg.pr.new/")
 			}
@@ -1478,10 +1556,17 @@ REBUILD:
 			}
 
 			// add sourcemap Url
-			if config.SourceMap && !dropSourceMap {
-				finalJS.WriteString("//# sourceMappingURL=")
-				finalJS.WriteString(path.Base(ctx.Path()))
-				finalJS.WriteString(".map")
+			var sourceMap []byte
+			if data, ok := sourceMaps[file.Path]; ok && !dropSourceMap {
+				sourceMap, err = fixSourceMap(data, ctx.smOffset)
+				if err != nil {
+					ctx.logger.Warnf("build(%s): invalid source map: %v", ctx.Path(), err)
+					sourceMap = nil
+					err = nil
+				}
+			}
+			if sourceMap != nil {
+				writeSourceMappingURL(finalJS, sourceMap, path.Base(ctx.Path()), sourceMapMode == "inline", false)
 			}
 
 			var stat storage.Stat
@@ -1503,6 +1588,14 @@ REBUILD:
 				return
 			}
 			meta.Integrity = "sha384-" + base64.StdEncoding.EncodeToString(sha.Sum(nil))
+			if sourceMap != nil && sourceMapMode == "external" {
+				err = ctx.storage.Put(ctx.getSavePath()+".map", bytes.NewReader(sourceMap))
+				if err != nil {
+					ctx.logger.Errorf("storage.put(%s): %v", ctx.getSavePath()+".map", err)
+					err = errors.New("storage(put): " + err.Error())
+					return
+				}
+			}
 		}
 	}
 
@@ -1510,34 +1603,34 @@ REBUILD:
 		if strings.HasSuffix(file.Path, ".css") {
 			savePath := ctx.getSavePath()
 			savePath = strings.TrimSuffix(savePath, path.Ext(savePath)) + ".css"
-			err = ctx.storage.Put(savePath, bytes.NewReader(file.Contents))
-			if err != nil {
-				ctx.logger.Errorf("storage.put(%s): %v", savePath, err)
-				err = errors.New("storage(put): " + err.Error())
-				return
-			}
-			meta.CSSInJS = true
-		} else if config.SourceMap && strings.HasSuffix(file.Path, ".js.map") {
-			var sourceMap map[string]any
-			if json.Unmarshal(file.Contents, &sourceMap) == nil {
-				if mapping, ok := sourceMap["mappings"].(string); ok {
-					fixedMapping := make([]byte, ctx.smOffset+len(mapping))
-					for i := 0; i < ctx.smOffset; i++ {
-						fixedMapping[i] = ';'
-					}
-					copy(fixedMapping[ctx.smOffset:], mapping)
-					sourceMap["mappings"] = string(fixedMapping)
+			css := bytes.NewBuffer(file.Contents)
+			var sourceMap []byte
+			if data, ok := sourceMaps[file.Path]; ok {
+				sourceMap, err = fixSourceMap(data, 0)
+				if err != nil {
+					ctx.logger.Warnf("build(%s): invalid css source map: %v", ctx.Path(), err)
+					sourceMap = nil
+					err = nil
 				}
-				buf := &bytes.Buffer{}
-				if json.NewEncoder(buf).Encode(sourceMap) == nil {
-					err = ctx.storage.Put(ctx.getSavePath()+".map", buf)
+			}
+			if sourceMap != nil {
+				writeSourceMappingURL(css, sourceMap, path.Base(savePath), sourceMapMode == "inline", true)
+				if sourceMapMode == "external" {
+					err = ctx.storage.Put(savePath+".map", bytes.NewReader(sourceMap))
 					if err != nil {
-						ctx.logger.Errorf("storage.put(%s): %v", ctx.getSavePath()+".map", err)
+						ctx.logger.Errorf("storage.put(%s): %v", savePath+".map", err)
 						err = errors.New("storage(put): " + err.Error())
 						return
 					}
 				}
 			}
+			err = ctx.storage.Put(savePath, css)
+			if err != nil {
+				ctx.logger.Errorf("storage.put(%s): %v", savePath, err)
+				err = errors.New("storage(put): " + err.Error())
+				return
+			}
+			meta.CSSInJS = true
 		}
 	}
 
@@ -1550,7 +1643,7 @@ REBUILD:
 	sort.Strings(meta.Imports)
 
 	// resolve types(dts)
-	meta.Dts, err = ctx.resolveDTS(entry)
+	meta.Dts, meta.DtsReason, err = ctx.resolveDTS(entry)
 	return
 }
 
@@ -1606,7 +1699,7 @@ func (ctx *BuildContext) install() (err error) {
 		}
 
 		// Check if the `SubPath` is the same as the `main` or `module` field of the package.json
-		if subPath := ctx.esmPath.SubPath; subPath != "" && ctx.target != "types" {
+		if subPath := ctx.esmPath.SubPath; subPath != "" && ctx.target != "types" && !ctx.isCSSBuild() {
 			isMainModule := false
 			check := func(s string) bool {
 				return isMainModule || (s != "" && subPath == utils.NormalizePathname(stripModuleExt(s))[1:])
@@ -1641,6 +1734,7 @@ func (ctx *BuildContext) install() (err error) {
 
 	// - install dependencies in `BundleDeps` mode
 	// - install '@babel/runtime' and '@swc/helpers' if they are present in the dependencies in `BundleDefault` mode
+	// - install the tarball dependencies that are always bundled in other modes
 	switch ctx.bundleMode {
 	case BundleDeps:
 		err = ctx.npmrc.installDependenciesContext(ctx.Context(), ctx.wd, ctx.pkgJson, false, nil)
@@ -1654,6 +1748,11 @@ func (ctx *BuildContext) install() (err error) {
 			}
 		}
 	}
+	if err == nil && ctx.bundleMode != BundleDeps {
+		if deps := getTarballDependencies(ctx.pkgJson); len(deps) > 0 {
+			err = ctx.npmrc.installDependenciesContext(ctx.Context(), ctx.wd, &npm.PackageJSON{Name: ctx.pkgJson.Name, Dependencies: deps}, false, nil)
+		}
+	}
 	if err != nil {
 		return
 	}
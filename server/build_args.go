@@ -21,6 +21,9 @@ type BuildArgs struct {
 	KeepNames         bool
 	IgnoreAnnotations bool
 	ExternalRequire   bool
+	InlineAssets      bool
+	DtsBundle         bool
+	SourceMap         string
 }
 
 func decodeBuildArgs(argsString string) (args BuildArgs, err error) {
@@ -49,6 +52,8 @@ func decodeBuildArgs(argsString string) (args BuildArgs, err error) {
 				args.External = *set.NewReadOnly(strings.Split(p[1:], ",")...)
 			} else if strings.HasPrefix(p, "c") {
 				args.Conditions = append(args.Conditions, strings.Split(p[1:], ",")...)
+			} else if strings.HasPrefix(p, "m") {
+				args.SourceMap = p[1:]
 			} else {
 				switch p {
 				case "r":
@@ -57,6 +62,10 @@ func decodeBuildArgs(argsString string) (args BuildArgs, err error) {
 					args.KeepNames = true
 				case "i":
 					args.IgnoreAnnotations = true
+				case "n":
+					args.InlineAssets = true
+				case "b":
+					args.DtsBundle = true
 
 				}
 			}
@@ -117,6 +126,14 @@ func encodeBuildArgs(args BuildArgs, isDts bool) string {
 		if args.IgnoreAnnotations {
 			lines = append(lines, "i")
 		}
+		if args.InlineAssets {
+			lines = append(lines, "n")
+		}
+		if args.SourceMap != "" {
+			lines = append(lines, "m"+args.SourceMap)
+		}
+	} else if args.DtsBundle {
+		lines = append(lines, "b")
 	}
 	if len(lines) > 0 {
 		return btoaUrl(strings.Join(lines, "\n"))
@@ -282,6 +299,10 @@ func walkDeps(npmrc *NpmRC, installDir string, pkg npm.Package, mark *set.Set[st
 	for name, version := range pkgDeps {
 		depPkg := npm.Package{Name: name, Version: version}
 		p, e := npm.ResolveDependencyVersion(version)
+		if e == nil && p.Tarball != "" {
+			// tarball dependencies are always bundled
+			continue
+		}
 		if e == nil && p.Name != "" {
 			depPkg = p
 		}
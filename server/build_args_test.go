@@ -21,6 +21,8 @@ func TestEncodeBuildArgs(t *testing.T) {
 			ExternalRequire:   true,
 			KeepNames:         true,
 			IgnoreAnnotations: true,
+			InlineAssets:      true,
+			SourceMap:         "inline",
 		},
 		false,
 	)
@@ -49,4 +51,10 @@ func TestEncodeBuildArgs(t *testing.T) {
 	if !args.IgnoreAnnotations {
 		t.Fatal("ignoreAnnotations should be true")
 	}
+	if !args.InlineAssets {
+		t.Fatal("inlineAssets should be true")
+	}
+	if args.SourceMap != "inline" {
+		t.Fatal("sourceMap should be inline")
+	}
 }
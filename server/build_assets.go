@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/internal/storage"
+	esbuild "github.com/ije/esbuild-internal/api"
+)
+
+var regexpImportMetaURLAsset = regexp.MustCompile(`new\s+URL\(\s*(["'])(\.\.?/[^"'\r\n]+\.[a-zA-Z0-9]+)["']\s*,\s*import\.meta\.url\s*\)`)
+
+// isBinaryAsset returns true if the file is a binary asset (wasm, image, font, etc.) that can be emitted as a build asset.
+func isBinaryAsset(filename string) bool {
+	ext := path.Ext(filename)
+	return ext == ".wasm" || loaders[ext] == esbuild.LoaderDataURL
+}
+
+// getAssetInlineLimit returns the size limit of the asset that can be inlined as a data URL.
+func getAssetInlineLimit(ext string) int64 {
+	if limit, ok := config.AssetInlineLimits[strings.TrimPrefix(ext, ".")]; ok {
+		return limit
+	}
+	if limit, ok := config.AssetInlineLimits["*"]; ok {
+		return limit
+	}
+	return 4 * 1024
+}
+
+// shouldInlineAsset returns true if the asset should be inlined as a data URL instead of being emitted as a file.
+func (ctx *BuildContext) shouldInlineAsset(filename string) bool {
+	if ctx.args.InlineAssets {
+		return true
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		// let the loader report the error
+		return true
+	}
+	return fi.Size() <= getAssetInlineLimit(path.Ext(filename))
+}
+
+// getAssetPath returns the URL path of the build asset, e.g. "/pkg@1.0.0/es2022/dist/foo.wasm".
+func (ctx *BuildContext) getAssetPath(filename string) string {
+	pkgId, subPath := ctx.splitPackageFile(filename)
+	return "/" + pkgId + "/" + ctx.target + "/" + subPath
+}
+
+// emitAsset saves the package file to the storage as a build asset, returns the URL path of the asset.
+func (ctx *BuildContext) emitAsset(filename string) (assetPath string, err error) {
+	assetPath = ctx.getAssetPath(filename)
+	savePath := normalizeSavePath(path.Join("modules", assetPath))
+	_, err = ctx.storage.Stat(savePath)
+	if err == nil {
+		return
+	}
+	if err != storage.ErrNotFound {
+		ctx.logger.Errorf("storage.stat(%s): %v", savePath, err)
+		err = errors.New("storage(stat): " + err.Error())
+		return
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	err = ctx.storage.Put(savePath, f)
+	if err != nil {
+		ctx.logger.Errorf("storage.put(%s): %v", savePath, err)
+		err = errors.New("storage(put): " + err.Error())
+	}
+	return
+}
+
+// getAssetModule returns a JS module that exports the URL of the emitted asset.
+func (ctx *BuildContext) getAssetModule(filename string, analyzeMode bool) (code string, err error) {
+	var assetPath string
+	if analyzeMode {
+		assetPath = ctx.getAssetPath(filename)
+	} else {
+		assetPath, err = ctx.emitAsset(filename)
+		if err != nil {
+			return
+		}
+	}
+	return fmt.Sprintf("export default new URL(%s, import.meta.url).href;\n", toJSString(assetPath)), nil
+}
+
+// rewriteImportMetaURLs rewrites `new URL("./foo.wasm", import.meta.url)` expressions that reference binary assets
+// or workers of the module to the URLs of the emitted assets, returns nil if nothing is changed.
+func (ctx *BuildContext) rewriteImportMetaURLs(filename string, code []byte, analyzeMode bool) ([]byte, error) {
+	if !bytes.Contains(code, []byte("import.meta.url")) {
+		return nil, nil
+	}
+	var err error
+	changed := false
+	if ret := ctx.rewriteWorkerURLs(filename, code); ret != nil {
+		code = ret
+		changed = true
+	}
+	ret := regexpImportMetaURLAsset.ReplaceAllFunc(code, func(m []byte) []byte {
+		if err != nil {
+			return m
+		}
+		specifier := string(regexpImportMetaURLAsset.FindSubmatch(m)[2])
+		if !isBinaryAsset(specifier) {
+			return m
+		}
+		assetFilename := path.Join(path.Dir(filename), specifier)
+		if !strings.HasPrefix(assetFilename, ctx.wd+"/") || !existsFile(assetFilename) {
+			return m
+		}
+		var assetPath string
+		if analyzeMode {
+			assetPath = ctx.getAssetPath(assetFilename)
+		} else {
+			assetPath, err = ctx.emitAsset(assetFilename)
+		}
+		changed = true
+		return fmt.Appendf(nil, "new URL(%s, import.meta.url)", toJSString(assetPath))
+	})
+	if err != nil || !changed {
+		return nil, err
+	}
+	return ret, nil
+}
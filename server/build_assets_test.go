@@ -0,0 +1,86 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/esm-dev/esm.sh/internal/storage"
+	"github.com/ije/gox/log"
+)
+
+func TestBuildAssets(t *testing.T) {
+	root := t.TempDir()
+	wd := filepath.Join(root, "wd")
+	pkgName := "assets-pkg"
+	pkgDir := filepath.Join(wd, "node_modules", pkgName)
+	if err := os.MkdirAll(filepath.Join(pkgDir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"assets/icon.svg": "<svg xmlns=\"http://www.w3.org/2000/svg\"/>",
+		"assets/logo.png": "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 8*1024),
+		"index.d.ts":      "export declare const icon: string, logo: string, logoUrl: URL;",
+		"index.js": strings.Join([]string{
+			`import icon from "./assets/icon.svg";`,
+			`import logo from "./assets/logo.png";`,
+			`export const logoUrl = new URL("./assets/logo.png", import.meta.url);`,
+			`export { icon, logo };`,
+		}, "\n"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pkgDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := storage.NewFSStorage(filepath.Join(root, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := func(args BuildArgs) string {
+		logger, _ := log.New("")
+		ctx := &BuildContext{
+			logger:  logger,
+			storage: fs,
+			wd:      wd,
+			args:    args,
+			esmPath: EsmPath{PkgName: pkgName, PkgVersion: "1.0.0"},
+			pkgJson: &npm.PackageJSON{Name: pkgName, Version: "1.0.0", Type: "module", Module: "./index.js", Types: "./index.d.ts"},
+			target:  "es2022",
+		}
+		if _, _, err := ctx.buildModule(false); err != nil {
+			t.Fatal(err)
+		}
+		f, _, err := fs.Get(ctx.getSavePath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	js := build(BuildArgs{})
+	assetUrl := "/assets-pkg@1.0.0/es2022/assets/logo.png"
+	if strings.Count(js, `"`+assetUrl+`"`) != 2 || strings.Contains(js, "data:image/png") {
+		t.Fatalf("large asset should be emitted: %s", js)
+	}
+	if !strings.Contains(js, "data:image/svg+xml") {
+		t.Fatalf("small asset should be inlined: %s", js)
+	}
+	if stat, err := fs.Stat(normalizeSavePath("modules" + assetUrl)); err != nil || stat.Size() != int64(len(files["assets/logo.png"])) {
+		t.Fatalf("asset should be emitted: %v", err)
+	}
+
+	js = build(BuildArgs{InlineAssets: true})
+	if !strings.Contains(js, "data:image/png") {
+		t.Fatalf("asset should be inlined with `?inline-assets`: %s", js)
+	}
+}
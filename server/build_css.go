@@ -0,0 +1,637 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/internal/mime"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	esbuild "github.com/ije/esbuild-internal/api"
+	"github.com/ije/gox/utils"
+)
+
+// cssEngines maps the build target to the minimum browser versions that support the ES version,
+// the browser versions are used to lower modern CSS features like nesting.
+var cssEngines = map[string][]esbuild.Engine{
+	"es2015": cssEngineVersions("51", "15", "54", "10"),
+	"es2016": cssEngineVersions("52", "15", "54", "10.1"),
+	"es2017": cssEngineVersions("58", "16", "54", "11"),
+	"es2018": cssEngineVersions("64", "79", "78", "12"),
+	"es2019": cssEngineVersions("73", "79", "78", "12.1"),
+	"es2020": cssEngineVersions("80", "80", "80", "14"),
+	"es2021": cssEngineVersions("85", "85", "80", "14.1"),
+	"es2022": cssEngineVersions("94", "94", "93", "16.4"),
+	"es2023": cssEngineVersions("110", "110", "115", "16.4"),
+	"es2024": cssEngineVersions("117", "117", "119", "17.4"),
+}
+
+// the virtual filename suffix of CSS modules, which makes the generated class names unique across packages
+var regexpCSSModuleSuffix = regexp.MustCompile(`\.module_[0-9a-f]{8}\.css`)
+
+func cssEngineVersions(chrome string, edge string, firefox string, safari string) []esbuild.Engine {
+	return []esbuild.Engine{
+		{Name: esbuild.EngineChrome, Version: chrome},
+		{Name: esbuild.EngineEdge, Version: edge},
+		{Name: esbuild.EngineFirefox, Version: firefox},
+		{Name: esbuild.EngineSafari, Version: safari},
+		{Name: esbuild.EngineIOS, Version: safari},
+	}
+}
+
+// isCSSBuild returns true if the build is a package CSS file.
+func (ctx *BuildContext) isCSSBuild() bool {
+	return ctx.target != "types" && strings.HasSuffix(ctx.esmPath.SubPath, ".css")
+}
+
+// buildCSS bundles the CSS file of the package:
+//   - `@import`s are bundled, package `@import`s are resolved by the same resolver as JS
+//   - modern CSS features like nesting and `color-mix()` are lowered for the build target
+//   - `url()` assets are inlined as data URLs or rewritten to CDN URLs
+//   - `*.module.css` files are built as CSS modules with a class name map
+//
+// A CSS module script(`{savePath}.mjs`) which exports the `CSSStyleSheet` object is saved
+// along with the CSS file, it's used by the `?module` query.
+func (ctx *BuildContext) buildCSS() (meta *BuildMeta, err error) {
+	entry := ctx.resolveEntry(ctx.esmPath)
+	if !strings.HasSuffix(entry.main, ".css") {
+		err = errors.New("could not resolve build entry")
+		return
+	}
+	pkgDir := path.Join(ctx.wd, "node_modules", ctx.esmPath.PkgName)
+	entryFilename := path.Join(pkgDir, entry.main)
+	if !strings.HasPrefix(entryFilename, pkgDir+"/") || !existsFile(entryFilename) {
+		err = errors.New("could not resolve build entry")
+		return
+	}
+
+	isCSSModule := strings.HasSuffix(entryFilename, ".module.css")
+	lowerColorMix := needsColorMixLowering(ctx.target)
+	cssPlugin := esbuild.Plugin{
+		Name: "esm-css",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(
+				esbuild.OnResolveOptions{Filter: ".*"},
+				func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+					switch args.Kind {
+					case esbuild.ResolveEntryPoint:
+						return esbuild.OnResolveResult{}, nil
+					case esbuild.ResolveCSSURLToken:
+						return ctx.resolveCSSAsset(args.Path, args.ResolveDir)
+					default:
+						return ctx.resolveCSSImport(args.Path, args.ResolveDir)
+					}
+				},
+			)
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: `\.css$`, Namespace: "file"},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					filename := regexpCSSModuleSuffix.ReplaceAllString(args.Path, ".module.css")
+					data, err := os.ReadFile(filename)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
+					code := string(data)
+					if lowerColorMix {
+						code = lowerCSSColorMix(code)
+					}
+					loader := esbuild.LoaderCSS
+					if strings.HasSuffix(filename, ".module.css") {
+						loader = esbuild.LoaderLocalCSS
+					}
+					return esbuild.OnLoadResult{Contents: &code, Loader: loader, ResolveDir: path.Dir(filename)}, nil
+				},
+			)
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: ".*", Namespace: "css-asset"},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					data, err := os.ReadFile(args.Path)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
+					contents := string(data)
+					return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderDataURL}, nil
+				},
+			)
+		},
+	}
+
+	options := esbuild.BuildOptions{
+		AbsWorkingDir:    ctx.wd,
+		PreserveSymlinks: true,
+		Format:           esbuild.FormatESModule,
+		Engines:          cssEngines[ctx.target],
+		Bundle:           true,
+		MinifyWhitespace: config.Minify,
+		MinifySyntax:     config.Minify,
+		// local class names must not be minified, otherwise the names will conflict across packages
+		MinifyIdentifiers: false,
+		Plugins:           []esbuild.Plugin{cssPlugin},
+		Outdir:            "/esbuild",
+		Write:             false,
+	}
+	if isCSSModule {
+		// import the CSS module from a JS entry to get the class name map
+		options.Stdin = &esbuild.StdinOptions{
+			Sourcefile: "class-names.js",
+			Contents:   fmt.Sprintf(`export { default } from "./%s";`, path.Base(entryFilename)),
+			ResolveDir: path.Dir(entryFilename),
+			Loader:     esbuild.LoaderJS,
+		}
+	} else {
+		options.EntryPoints = []string{entryFilename}
+	}
+	sourceMapMode := ctx.getSourceMapMode()
+	if sourceMapMode != "none" {
+		options.Sourcemap = esbuild.SourceMapExternal
+	}
+
+	ret := esbuild.Build(options)
+	if len(ret.Errors) > 0 {
+		msg := ret.Errors[0]
+		if msg.Location != nil {
+			err = fmt.Errorf("could not build %s: %s (%s:%d:%d)", ctx.esmPath.String(), msg.Text, msg.Location.File, msg.Location.Line, msg.Location.Column)
+		} else {
+			err = fmt.Errorf("could not build %s: %s", ctx.esmPath.String(), msg.Text)
+		}
+		return
+	}
+
+	var css, sourceMap, classNames []byte
+	for _, file := range ret.OutputFiles {
+		switch {
+		case strings.HasSuffix(file.Path, ".css"):
+			css = file.Contents
+		case strings.HasSuffix(file.Path, ".css.map"):
+			sourceMap = regexpCSSModuleSuffix.ReplaceAll(file.Contents, []byte(".module.css"))
+		case strings.HasSuffix(file.Path, ".js"):
+			classNames = file.Contents
+		}
+	}
+	if sourceMap != nil {
+		sourceMap, err = fixSourceMap(sourceMap, 0)
+		if err != nil {
+			ctx.logger.Warnf("build(%s): invalid css source map: %v", ctx.Path(), err)
+			sourceMap = nil
+			err = nil
+		}
+	}
+
+	savePath := ctx.getSavePath()
+	buf := bytes.NewBuffer(css)
+	if sourceMap != nil {
+		writeSourceMappingURL(buf, sourceMap, path.Base(savePath), sourceMapMode == "inline", true)
+		if sourceMapMode == "external" {
+			err = ctx.storage.Put(savePath+".map", bytes.NewReader(sourceMap))
+			if err != nil {
+				ctx.logger.Errorf("storage.put(%s): %v", savePath+".map", err)
+				err = errors.New("storage(put): " + err.Error())
+				return
+			}
+		}
+	}
+
+	// create the CSS module script
+	script := bytes.NewBufferString("/* esm.sh - ")
+	script.WriteString(ctx.esmPath.String())
+	script.WriteString(" */\n")
+	script.WriteString("const __stylesheet$ = new CSSStyleSheet({ baseURL: import.meta.url });\n")
+	script.WriteString("__stylesheet$.replaceSync(")
+	script.Write(bytes.TrimSpace(utils.MustEncodeJSON(strings.TrimSpace(string(css)))))
+	script.WriteString(");\n")
+	if isCSSModule && classNames != nil {
+		script.Write(stripSourceMappingURL(classNames))
+		script.WriteString("export { __stylesheet$ as stylesheet };\n")
+	} else {
+		script.WriteString("export { __stylesheet$ as default, __stylesheet$ as stylesheet };\n")
+	}
+	err = ctx.storage.Put(savePath+".mjs", script)
+	if err != nil {
+		ctx.logger.Errorf("storage.put(%s): %v", savePath+".mjs", err)
+		err = errors.New("storage(put): " + err.Error())
+		return
+	}
+
+	sha := sha512.New384()
+	sha.Write(buf.Bytes())
+	integrity := "sha384-" + base64.StdEncoding.EncodeToString(sha.Sum(nil))
+	err = ctx.storage.Put(savePath, buf)
+	if err != nil {
+		ctx.logger.Errorf("storage.put(%s): %v", savePath, err)
+		err = errors.New("storage(put): " + err.Error())
+		return
+	}
+
+	meta = &BuildMeta{Integrity: integrity}
+	return
+}
+
+// resolveCSSImport resolves the `@import` rule and the `composes` property of CSS.
+func (ctx *BuildContext) resolveCSSImport(specifier string, resolveDir string) (esbuild.OnResolveResult, error) {
+	if isHttpSpecifier(specifier) || strings.HasPrefix(specifier, "//") {
+		return esbuild.OnResolveResult{Path: specifier, External: true}, nil
+	}
+
+	// the import path is relative in CSS unless it starts with `~`(webpack style) or the file doesn't exist
+	if !strings.HasPrefix(specifier, "~") {
+		filename := path.Join(resolveDir, specifier)
+		if isRelPathSpecifier(specifier) || existsFile(filename) {
+			if !strings.HasPrefix(filename, ctx.wd+"/") {
+				return esbuild.OnResolveResult{}, fmt.Errorf("could not resolve \"%s\"", specifier)
+			}
+			return esbuild.OnResolveResult{Path: ctx.getCSSModuleVirtualPath(filename)}, nil
+		}
+	}
+
+	specifier = strings.TrimPrefix(specifier, "~")
+	pkgName, _, subPath := splitEsmPath(specifier)
+
+	// check `?alias` option
+	if name, ok := ctx.args.Alias[pkgName]; ok {
+		specifier = name
+		if subPath != "" {
+			specifier += "/" + subPath
+		}
+		pkgName, _, subPath = splitEsmPath(specifier)
+	}
+
+	// sub-module of current package
+	if pkgName == ctx.esmPath.PkgName || pkgName == ctx.pkgJson.Name {
+		sub := ctx.esmPath
+		sub.SubPath = subPath
+		entry := ctx.resolveEntry(sub)
+		if !strings.HasSuffix(entry.main, ".css") {
+			return esbuild.OnResolveResult{}, fmt.Errorf("could not resolve \"%s\"", specifier)
+		}
+		return esbuild.OnResolveResult{Path: ctx.getCSSModuleVirtualPath(ctx.getPkgFullPath(entry.main))}, nil
+	}
+
+	dep, _, err := ctx.resolveDependency(specifier, false)
+	if err != nil {
+		return esbuild.OnResolveResult{}, err
+	}
+
+	// install the dependency and bundle it, since a constructable stylesheet doesn't support `@import` rules
+	err = ctx.npmrc.installDependenciesContext(ctx.Context(), ctx.wd, &npm.PackageJSON{Dependencies: map[string]string{dep.PkgName: dep.PkgVersion}}, false, nil)
+	if err != nil {
+		return esbuild.OnResolveResult{}, err
+	}
+	var raw npm.PackageJSONRaw
+	err = utils.ParseJSONFile(path.Join(ctx.wd, "node_modules", dep.PkgName, "package.json"), &raw)
+	if err != nil {
+		return esbuild.OnResolveResult{}, err
+	}
+	b := &BuildContext{
+		npmrc:   ctx.npmrc,
+		logger:  ctx.logger,
+		esmPath: dep,
+		ctx:     ctx.ctx,
+		wd:      ctx.wd,
+		pkgJson: raw.ToNpmPackage(),
+	}
+	entry := b.resolveEntry(dep)
+	if !strings.HasSuffix(entry.main, ".css") {
+		return esbuild.OnResolveResult{}, fmt.Errorf("could not resolve \"%s\"", specifier)
+	}
+	return esbuild.OnResolveResult{Path: ctx.getCSSModuleVirtualPath(b.getPkgFullPath(entry.main))}, nil
+}
+
+// resolveCSSAsset resolves the `url()` asset of CSS, small assets are inlined as data URLs,
+// others are rewritten to the CDN URLs.
+func (ctx *BuildContext) resolveCSSAsset(specifier string, resolveDir string) (esbuild.OnResolveResult, error) {
+	if specifier == "" || strings.HasPrefix(specifier, "data:") || strings.HasPrefix(specifier, "#") || strings.HasPrefix(specifier, "/") || isHttpSpecifier(specifier) {
+		return esbuild.OnResolveResult{Path: specifier, External: true}, nil
+	}
+
+	// strip the query and hash, e.g. "font.woff?#iefix", "icons.svg#close"
+	pathname, suffix := specifier, ""
+	if i := strings.IndexAny(specifier, "?#"); i > 0 {
+		pathname, suffix = specifier[:i], specifier[i:]
+	}
+
+	var filename string
+	if !strings.HasPrefix(pathname, "~") {
+		filename = path.Join(resolveDir, pathname)
+	}
+	if filename == "" || (!isRelPathSpecifier(pathname) && !existsFile(filename)) {
+		pkgName, _, subPath := splitEsmPath(strings.TrimPrefix(pathname, "~"))
+		if pkgName == ctx.esmPath.PkgName || pkgName == ctx.pkgJson.Name {
+			filename = ctx.getPkgFullPath(subPath)
+		} else {
+			dep, _, err := ctx.resolveDependency(strings.TrimPrefix(pathname, "~"), false)
+			if err != nil {
+				return esbuild.OnResolveResult{}, err
+			}
+			return esbuild.OnResolveResult{Path: "/" + dep.String() + suffix, External: true}, nil
+		}
+	}
+	if !strings.HasPrefix(filename, ctx.wd+"/") {
+		return esbuild.OnResolveResult{}, fmt.Errorf("could not resolve \"%s\"", specifier)
+	}
+
+	if !existsFile(filename) {
+		// keep the url as it is
+		return esbuild.OnResolveResult{Path: specifier, External: true}, nil
+	}
+	if mime.GetContentType(filename) != "" && ctx.shouldInlineAsset(filename) {
+		return esbuild.OnResolveResult{Path: filename, Namespace: "css-asset"}, nil
+	}
+	assetPath, err := ctx.emitAsset(filename)
+	if err != nil {
+		return esbuild.OnResolveResult{}, err
+	}
+	return esbuild.OnResolveResult{Path: assetPath + suffix, External: true}, nil
+}
+
+// getCSSModuleVirtualPath returns a virtual path for the `*.module.css` file that includes a hash of the package,
+// since esbuild generates the local class names by the file name (e.g. `button_module_root`).
+func (ctx *BuildContext) getCSSModuleVirtualPath(filename string) string {
+	if !strings.HasSuffix(filename, ".module.css") {
+		return filename
+	}
+	sum := sha1.Sum([]byte(ctx.esmPath.PackageId() + "/" + strings.TrimPrefix(filename, ctx.wd)))
+	return strings.TrimSuffix(filename, ".css") + "_" + hex.EncodeToString(sum[:4]) + ".css"
+}
+
+// needsColorMixLowering returns true if the browsers of the target don't support the `color-mix()` function,
+// which is supported since Chrome 111, Firefox 113 and Safari 16.2.
+func needsColorMixLowering(target string) bool {
+	switch target {
+	case "es2015", "es2016", "es2017", "es2018", "es2019", "es2020", "es2021", "es2022", "es2023":
+		return true
+	}
+	return false
+}
+
+// lowerCSSColorMix replaces the `color-mix()` functions that mix two literal colors in the srgb color space
+// with the computed colors, other `color-mix()` functions are kept as they are. Strings, comments and `url()`
+// tokens are copied verbatim.
+func lowerCSSColorMix(css string) string {
+	const fn = "color-mix("
+	var buf strings.Builder
+	i := 0
+	for i < len(css) {
+		c := css[i]
+		switch {
+		case c == '"' || c == '\'':
+			j := skipCSSString(css, i)
+			buf.WriteString(css[i:j])
+			i = j
+		case c == '/' && strings.HasPrefix(css[i:], "/*"):
+			j := strings.Index(css[i+2:], "*/")
+			if j < 0 {
+				j = len(css)
+			} else {
+				j += i + 4
+			}
+			buf.WriteString(css[i:j])
+			i = j
+		case isCSSIdentStart(css, i) && hasPrefixFold(css[i:], "url("):
+			j := i + 4
+			for j < len(css) && css[j] != ')' {
+				if css[j] == '"' || css[j] == '\'' {
+					j = skipCSSString(css, j)
+				} else {
+					j++
+				}
+			}
+			j = min(j+1, len(css))
+			buf.WriteString(css[i:j])
+			i = j
+		case isCSSIdentStart(css, i) && hasPrefixFold(css[i:], fn):
+			start := i + len(fn)
+			end := -1
+			depth := 1
+			for j := start; j < len(css); j++ {
+				switch css[j] {
+				case '"', '\'':
+					j = skipCSSString(css, j) - 1
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				if depth == 0 {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				buf.WriteString(css[i:])
+				return buf.String()
+			}
+			if color, ok := mixCSSColors(css[start:end]); ok {
+				buf.WriteString(color)
+			} else {
+				buf.WriteString(css[i : end+1])
+			}
+			i = end + 1
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// skipCSSString returns the index after the quoted string that starts at `i`.
+func skipCSSString(css string, i int) int {
+	quote := css[i]
+	for j := i + 1; j < len(css); j++ {
+		switch css[j] {
+		case '\\':
+			j++
+		case quote, '\n':
+			return j + 1
+		}
+	}
+	return len(css)
+}
+
+// isCSSIdentStart returns true if the character at `i` is not preceded by an identifier character,
+// e.g. `color-mix(` in `--my-color-mix(` is not a function call.
+func isCSSIdentStart(css string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	c := css[i-1]
+	return !(c == '-' || c == '_' || c == '\\' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80)
+}
+
+func hasPrefixFold(s string, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// mixCSSColors computes the color of the `color-mix()` arguments, e.g. "in srgb, red 40%, #00f".
+func mixCSSColors(args string) (string, bool) {
+	parts := splitCSSValue(args, ',')
+	if len(parts) != 3 || strings.Join(strings.Fields(strings.ToLower(parts[0])), " ") != "in srgb" {
+		return "", false
+	}
+	var colors [2][4]float64
+	var percentages [2]float64
+	var hasPercentage [2]bool
+	for i, part := range parts[1:] {
+		fields := splitCSSValue(strings.Join(strings.Fields(part), " "), ' ')
+		if len(fields) == 0 || len(fields) > 2 {
+			return "", false
+		}
+		var colorOk bool
+		for _, field := range fields {
+			if p, ok := strings.CutSuffix(field, "%"); ok && !hasPercentage[i] {
+				v, err := strconv.ParseFloat(p, 64)
+				if err != nil || v < 0 || v > 100 {
+					return "", false
+				}
+				percentages[i] = v
+				hasPercentage[i] = true
+			} else if c, ok := parseCSSColor(field); ok && !colorOk {
+				colors[i] = c
+				colorOk = true
+			} else {
+				return "", false
+			}
+		}
+		if !colorOk {
+			return "", false
+		}
+	}
+
+	// normalize the percentages, see https://www.w3.org/TR/css-color-5/#color-mix-percent-norm
+	p1, p2 := percentages[0], percentages[1]
+	switch {
+	case !hasPercentage[0] && !hasPercentage[1]:
+		p1, p2 = 50, 50
+	case !hasPercentage[0]:
+		p1 = 100 - p2
+	case !hasPercentage[1]:
+		p2 = 100 - p1
+	}
+	sum := p1 + p2
+	if sum == 0 {
+		return "", false
+	}
+	alphaMultiplier := 1.0
+	if sum < 100 {
+		alphaMultiplier = sum / 100
+	}
+	p1, p2 = p1/sum, p2/sum
+
+	// interpolate with premultiplied alpha
+	c1, c2 := colors[0], colors[1]
+	alpha := c1[3]*p1 + c2[3]*p2
+	var rgb [3]float64
+	if alpha > 0 {
+		for i := range 3 {
+			rgb[i] = (c1[i]*c1[3]*p1 + c2[i]*c2[3]*p2) / alpha
+		}
+	}
+	alpha *= alphaMultiplier
+
+	r, g, b := math.Round(rgb[0]), math.Round(rgb[1]), math.Round(rgb[2])
+	if alpha >= 1 {
+		return fmt.Sprintf("#%02x%02x%02x", int(r), int(g), int(b)), true
+	}
+	return fmt.Sprintf("rgba(%d, %d, %d, %s)", int(r), int(g), int(b), strconv.FormatFloat(math.Round(alpha*1000)/1000, 'f', -1, 64)), true
+}
+
+// parseCSSColor parses the hex, `rgb()`/`rgba()` and a few named colors,
+// returns the red, green, blue channels in [0, 255] and the alpha channel in [0, 1].
+func parseCSSColor(s string) (color [4]float64, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "transparent":
+		return [4]float64{0, 0, 0, 0}, true
+	case "black":
+		return [4]float64{0, 0, 0, 1}, true
+	case "white":
+		return [4]float64{255, 255, 255, 1}, true
+	}
+	if hex, found := strings.CutPrefix(s, "#"); found {
+		switch len(hex) {
+		case 3, 4:
+			var expanded strings.Builder
+			for _, c := range hex {
+				expanded.WriteRune(c)
+				expanded.WriteRune(c)
+			}
+			hex = expanded.String()
+		case 6, 8:
+		default:
+			return color, false
+		}
+		if len(hex) == 6 {
+			hex += "ff"
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color, false
+		}
+		return [4]float64{float64(v >> 24 & 0xff), float64(v >> 16 & 0xff), float64(v >> 8 & 0xff), float64(v&0xff) / 255}, true
+	}
+	if (strings.HasPrefix(s, "rgb(") || strings.HasPrefix(s, "rgba(")) && strings.HasSuffix(s, ")") {
+		args := s[strings.IndexByte(s, '(')+1 : len(s)-1]
+		args = strings.NewReplacer(",", " ", "/", " ").Replace(args)
+		fields := strings.Fields(args)
+		if len(fields) != 3 && len(fields) != 4 {
+			return color, false
+		}
+		color[3] = 1
+		for i, field := range fields {
+			p, isPercentage := strings.CutSuffix(field, "%")
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return color, false
+			}
+			if i < 3 {
+				if isPercentage {
+					v = v * 255 / 100
+				}
+				color[i] = math.Max(0, math.Min(255, v))
+			} else {
+				if isPercentage {
+					v = v / 100
+				}
+				color[i] = math.Max(0, math.Min(1, v))
+			}
+		}
+		return color, true
+	}
+	return color, false
+}
+
+// splitCSSValue splits the CSS value by the separator that is not in parentheses.
+func splitCSSValue(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				if part := strings.TrimSpace(s[start:i]); part != "" || sep == ',' {
+					parts = append(parts, part)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" || sep == ',' {
+		parts = append(parts, part)
+	}
+	return parts
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/esm-dev/esm.sh/internal/storage"
+)
+
+func TestBuildCSS(t *testing.T) {
+	root := t.TempDir()
+	wd := filepath.Join(root, "wd")
+	pkgName := "css-pkg"
+	pkgDir := filepath.Join(wd, "node_modules", pkgName)
+	if err := os.MkdirAll(filepath.Join(pkgDir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"base.css":          ".base { color: color-mix(in srgb, #ff0000 50%, #0000ff); }",
+		"style.css":         "@import \"./base.css\";\n.card { .title { background: url(./assets/icon.svg); } }",
+		"button.module.css": ".root { color: red; }\n.primary { composes: root; }",
+		"assets/icon.svg":   "<svg xmlns=\"http://www.w3.org/2000/svg\"/>",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pkgDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := storage.NewFSStorage(filepath.Join(root, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFile := func(name string) string {
+		f, _, err := fs.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	ctx := &BuildContext{
+		storage: fs,
+		wd:      wd,
+		esmPath: EsmPath{PkgName: pkgName, PkgVersion: "1.0.0", SubPath: "style.css"},
+		pkgJson: &npm.PackageJSON{Name: pkgName, Version: "1.0.0"},
+		target:  "es2022",
+	}
+	if !ctx.isCSSBuild() || ctx.Path() != "/css-pkg@1.0.0/es2022/style.css" {
+		t.Fatalf("unexpected css build path: %s", ctx.Path())
+	}
+	if _, err := ctx.buildCSS(); err != nil {
+		t.Fatal(err)
+	}
+	css := readFile(ctx.getSavePath())
+	if !strings.Contains(css, "color:purple") || strings.Contains(css, "color-mix") {
+		t.Fatalf("color-mix() should be lowered: %s", css)
+	}
+	if !strings.Contains(css, ".card .title") {
+		t.Fatalf("nesting should be lowered: %s", css)
+	}
+	if !strings.Contains(css, "data:image/svg+xml") {
+		t.Fatalf("small asset should be inlined: %s", css)
+	}
+	if script := readFile(ctx.getSavePath() + ".mjs"); !strings.Contains(script, "new CSSStyleSheet(") || !strings.Contains(script, "__stylesheet$ as default") {
+		t.Fatalf("unexpected css module script: %s", script)
+	}
+
+	ctx = &BuildContext{
+		storage: fs,
+		wd:      wd,
+		esmPath: EsmPath{PkgName: pkgName, PkgVersion: "1.0.0", SubPath: "button.module.css"},
+		pkgJson: &npm.PackageJSON{Name: pkgName, Version: "1.0.0"},
+		target:  "esnext",
+	}
+	if _, err := ctx.buildCSS(); err != nil {
+		t.Fatal(err)
+	}
+	css = readFile(ctx.getSavePath())
+	if !strings.Contains(css, ".button_module_") || strings.Contains(css, ".root") {
+		t.Fatalf("class names should be scoped: %s", css)
+	}
+	if script := readFile(ctx.getSavePath() + ".mjs"); !strings.Contains(script, "primary:") || !strings.Contains(script, "as default") {
+		t.Fatalf("class name map should be exported: %s", script)
+	}
+}
+
+func TestLowerCSSColorMix(t *testing.T) {
+	testCases := map[string]string{
+		"a{color:color-mix(in srgb, red, blue)}":                           "a{color:color-mix(in srgb, red, blue)}",
+		"a{color:color-mix(in srgb, #fff 25%, #000)}":                      "a{color:#404040}",
+		"a{color:color-mix(in srgb, rgb(255 0 0) 20%, #0000ff 20%)}":       "a{color:rgba(128, 0, 128, 0.4)}",
+		"a{color:color-mix(in oklch, #fff, #000)}":                         "a{color:color-mix(in oklch, #fff, #000)}",
+		"a{color:color-mix(in srgb, var(--a), #000)}":                      "a{color:color-mix(in srgb, var(--a), #000)}",
+		"a{content:\"color-mix(in srgb, #fff 25%, #000)\"}":                "a{content:\"color-mix(in srgb, #fff 25%, #000)\"}",
+		"/* color-mix(in srgb, #fff 25%, #000) */a{color:red}":             "/* color-mix(in srgb, #fff 25%, #000) */a{color:red}",
+		"a{background:url(color-mix(in srgb, #fff 25%, #000).png)}":        "a{background:url(color-mix(in srgb, #fff 25%, #000).png)}",
+		"a{background:url(\"a).png\"),color-mix(in srgb, #fff 25%, #000)}": "a{background:url(\"a).png\"),#404040}",
+	}
+	for input, expected := range testCases {
+		if output := lowerCSSColorMix(input); output != expected {
+			t.Fatalf("lowerCSSColorMix(%q): expected %q, got %q", input, expected, output)
+		}
+	}
+}
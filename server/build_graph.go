@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ije/gox/set"
+)
+
+var regexpNodeRuntimeImport = regexp.MustCompile(`(?:from|import)\s*"((?:\.\.?|/node)/[^"]+\.mjs)"`)
+
+// getModuleGraphIntegrity walks the static import graph of the given module imports with the build metadata,
+// and returns the integrity of every reachable module, including the node runtime modules.
+// Imports with a query (e.g. `/scheduler@^0.27.0?target=es2022`) are not immutable and are skipped.
+// An empty integrity means the module is not built yet, the graph is complete only if all modules are built.
+func getModuleGraphIntegrity(metaDB *BuildMetaDB, imports []string) (graph map[string]string, complete bool) {
+	graph = map[string]string{}
+	complete = true
+	visited := set.New[string]()
+	queue := imports
+	for len(queue) > 0 {
+		var next []string
+		for _, pathname := range queue {
+			if visited.Has(pathname) || strings.ContainsRune(pathname, '?') {
+				continue
+			}
+			visited.Add(pathname)
+			if name, ok := strings.CutPrefix(pathname, "/node/"); ok {
+				js, ok := getNodeRuntimeModule(name)
+				if !ok {
+					continue
+				}
+				graph[pathname] = sha384Integrity(js)
+				for _, m := range regexpNodeRuntimeImport.FindAllSubmatch(js, -1) {
+					specifier := string(m[1])
+					if !strings.HasPrefix(specifier, "/") {
+						specifier = path.Join(path.Dir(pathname), specifier)
+					}
+					next = append(next, specifier)
+				}
+				continue
+			}
+			var meta *BuildMeta
+			data, err := metaDB.Get(pathname)
+			if err == nil {
+				meta, err = decodeBuildMeta(data)
+			}
+			if err != nil || meta.Integrity == "" {
+				graph[pathname] = ""
+				complete = false
+				continue
+			}
+			graph[pathname] = meta.Integrity
+			next = append(next, meta.Imports...)
+		}
+		queue = next
+	}
+	return
+}
+
+// sha384Integrity returns the subresource integrity of the data.
+func sha384Integrity(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/storage"
+)
+
+func TestGetModuleGraphIntegrity(t *testing.T) {
+	fs, err := storage.NewFSStorage(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaDB := NewBuildMetaDB(fs)
+	metaDB.Put("/pkg@1.0.0/es2022/sub.mjs", encodeBuildMeta(&BuildMeta{
+		Imports:   []string{"/pkg@1.0.0/es2022/chunk.mjs", "/node/process.mjs", "/node/crypto.mjs"},
+		Integrity: "sha384-sub",
+	}))
+	metaDB.Put("/pkg@1.0.0/es2022/chunk.mjs", encodeBuildMeta(&BuildMeta{
+		Imports:   []string{"/pkg@1.0.0/es2022/sub.mjs"},
+		Integrity: "sha384-chunk",
+	}))
+
+	graph, complete := getModuleGraphIntegrity(metaDB, []string{"/pkg@1.0.0/es2022/sub.mjs", "/dep@^1.0.0?target=es2022"})
+	if !complete {
+		t.Fatalf("Expected the graph to be complete, got %v", graph)
+	}
+	if graph["/pkg@1.0.0/es2022/sub.mjs"] != "sha384-sub" || graph["/pkg@1.0.0/es2022/chunk.mjs"] != "sha384-chunk" {
+		t.Fatalf("unexpected graph: %v", graph)
+	}
+	if _, ok := graph["/dep@^1.0.0?target=es2022"]; ok {
+		t.Fatal("Expected the import with query to be skipped")
+	}
+	js, _ := getNodeRuntimeModule("process.mjs")
+	if graph["/node/process.mjs"] != sha384Integrity(js) {
+		t.Fatalf("unexpected integrity of /node/process.mjs: %s", graph["/node/process.mjs"])
+	}
+	hasChunk := false
+	for pathname := range graph {
+		if strings.HasPrefix(pathname, "/node/chunk-") {
+			hasChunk = true
+		}
+	}
+	if !hasChunk {
+		t.Fatalf("Expected the chunks of the node runtime in the graph, got %v", graph)
+	}
+
+	graph, complete = getModuleGraphIntegrity(metaDB, []string{"/pkg@1.0.0/es2022/missing.mjs"})
+	if complete || graph["/pkg@1.0.0/es2022/missing.mjs"] != "" {
+		t.Fatalf("Expected the graph to be incomplete, got %v", graph)
+	}
+}
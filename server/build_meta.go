@@ -18,6 +18,7 @@ type BuildMeta struct {
 	ExportDefault bool
 	CSSEntry      string
 	Dts           string
+	DtsReason     string
 	Imports       []string
 	Integrity     string
 }
@@ -47,6 +48,11 @@ func encodeBuildMeta(meta *BuildMeta) []byte {
 		buf.WriteString(meta.Dts)
 		buf.WriteByte('\n')
 	}
+	if meta.DtsReason != "" {
+		buf.Write([]byte{'r', ':'})
+		buf.WriteString(meta.DtsReason)
+		buf.WriteByte('\n')
+	}
 	if len(meta.Imports) > 0 {
 		for _, path := range meta.Imports {
 			buf.Write([]byte{'i', ':'})
@@ -90,6 +96,8 @@ func decodeBuildMeta(data []byte) (*BuildMeta, error) {
 					meta.CSSEntry = value
 				case 'd':
 					meta.Dts = value
+				case 'r':
+					meta.DtsReason = value
 				case 'i':
 					meta.Imports = append(meta.Imports, value)
 				case 's':
@@ -150,5 +158,8 @@ func (storage *BuildMetaDB) Delete(key string) (err error) {
 
 func normalizeMetaStoreKey(key string) string {
 	data := sha256.Sum256([]byte(key))
+	if _, ok := getPrivateGhRepo(key); ok {
+		return "private/meta/" + hex.EncodeToString(data[:])
+	}
 	return "meta/" + hex.EncodeToString(data[:])
 }
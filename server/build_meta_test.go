@@ -13,6 +13,7 @@ func TestEncodeBuildMeta(t *testing.T) {
 		ExportDefault: true,
 		CSSEntry:      "./index.css",
 		Dts:           "./types/index.d.ts",
+		DtsReason:     "declared by react@19.2.4",
 		Imports:       []string{"/react@19.2.4?target=es2022", "/react-dom@19.2.4?target=es2022"},
 		Integrity:     "sha384-...",
 	}
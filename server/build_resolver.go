@@ -27,6 +27,8 @@ type BuildEntry struct {
 	main   string
 	module bool
 	types  string
+	// describes how the types are selected for the TypeScript version, e.g. the "typesVersions" range
+	typesSource string
 }
 
 func (entry *BuildEntry) isEmpty() bool {
@@ -58,8 +60,11 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 				case ".mts", ".ts", ".tsx", ".cts":
 					// todo: create dts from the ts file
 					entry.update(subPath, true)
-					// lookup jsr built dts
-					if strings.HasPrefix(esm.PkgName, "@jsr/") {
+					if ctx.npmrc.isNativeJsrPackage(esm.PkgName) {
+						// the declaration file is generated from the typescript source
+						entry.types = toDeclarationPath(normalizeEntryPath(subPath))
+					} else if strings.HasPrefix(esm.PkgName, "@jsr/") {
+						// lookup jsr built dts
 						for _, v := range pkgJson.Exports.Values() {
 							if obj, ok := v.(npm.JSONObject); ok {
 								if v, ok := obj.Get("default"); ok {
@@ -210,6 +215,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			}
 			if exportEntry.types != "" && ctx.existsPkgFile(exportEntry.types) {
 				entry.types = exportEntry.types
+				entry.typesSource = exportEntry.typesSource
 			}
 		}
 
@@ -360,6 +366,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			}
 			if exportEntry.types != "" && ctx.existsPkgFile(exportEntry.types) {
 				entry.types = exportEntry.types
+				entry.typesSource = exportEntry.typesSource
 			}
 		}
 
@@ -426,67 +433,56 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 
 	// resolve types from `typesVersions` field if it's defined
 	// see https://www.typescriptlang.org/docs/handbook/declaration-files/publishing.html#version-selection-with-typesversions
-	if typesVersions := pkgJson.TypesVersions; len(typesVersions) > 0 && entry.types != "" {
-		versions := make(sort.StringSlice, len(typesVersions))
-		i := 0
-		for c := range typesVersions {
-			if strings.HasPrefix(c, ">") {
-				versions[i] = c
-				i++
+	if typesVersions := pkgJson.TypesVersions; typesVersions.Len() > 0 && entry.types != "" {
+		if versionRange, mapping, ok := selectTypesVersions(typesVersions); ok {
+			var paths any
+			var matched bool
+			var exact bool
+			var suffix string
+			types := entry.types
+			paths, matched = mapping.Get(entry.types)
+			if !matched {
+				// try to match the dts wihout leading "./"
+				paths, matched = mapping.Get(strings.TrimPrefix(types, "./"))
 			}
-		}
-		versions = versions[:i]
-		if versions.Len() > 0 {
-			versions.Sort()
-			latestVersion := typesVersions[versions[versions.Len()-1]]
-			if mapping, ok := latestVersion.(map[string]any); ok {
-				var paths any
-				var matched bool
-				var exact bool
-				var suffix string
-				types := entry.types
-				paths, matched = mapping[entry.types]
-				if !matched {
-					// try to match the dts wihout leading "./"
-					paths, matched = mapping[strings.TrimPrefix(types, "./")]
-				}
-				if matched {
-					exact = true
-				}
-				if !matched {
-					for key, value := range mapping {
-						if strings.HasSuffix(key, "/*") {
-							key = normalizeEntryPath(key)
-							if strings.HasPrefix(types, strings.TrimSuffix(key, "/*")) {
-								paths = value
-								matched = true
-								suffix = strings.TrimPrefix(types, strings.TrimSuffix(key, "*"))
-								break
-							}
+			if matched {
+				exact = true
+			}
+			if !matched {
+				for _, key := range mapping.Keys() {
+					if strings.HasSuffix(key, "/*") {
+						value, _ := mapping.Get(key)
+						key = normalizeEntryPath(key)
+						if strings.HasPrefix(types, strings.TrimSuffix(key, "/*")) {
+							paths = value
+							matched = true
+							suffix = strings.TrimPrefix(types, strings.TrimSuffix(key, "*"))
+							break
 						}
 					}
 				}
-				if !matched {
-					paths, matched = mapping["*"]
-				}
-				if matched {
-					if a, ok := paths.([]any); ok && len(a) > 0 {
-						if path, ok := a[0].(string); ok {
-							path = normalizeEntryPath(path)
-							if exact {
-								entry.types = path
+			}
+			if !matched {
+				paths, matched = mapping.Get("*")
+			}
+			if matched {
+				if a, ok := paths.([]any); ok && len(a) > 0 {
+					if path, ok := a[0].(string); ok {
+						path = normalizeEntryPath(path)
+						if exact {
+							entry.types = path
+						} else {
+							prefix, _ := utils.SplitByLastByte(path, '*')
+							if suffix != "" {
+								entry.types = prefix + suffix
+							} else if after, ok0 := strings.CutPrefix(types, prefix); ok0 {
+								diff := after
+								entry.types = strings.ReplaceAll(path, "*", diff)
 							} else {
-								prefix, _ := utils.SplitByLastByte(path, '*')
-								if suffix != "" {
-									entry.types = prefix + suffix
-								} else if after, ok0 := strings.CutPrefix(types, prefix); ok0 {
-									diff := after
-									entry.types = strings.ReplaceAll(path, "*", diff)
-								} else {
-									entry.types = prefix + types[2:]
-								}
+								entry.types = prefix + types[2:]
 							}
 						}
+						entry.typesSource = fmt.Sprintf("the \"typesVersions\" range %q", versionRange)
 					}
 				}
 			}
@@ -569,7 +565,10 @@ func (ctx *BuildContext) finalizeBuildEntry(entry *BuildEntry) {
 			entry.types = ""
 		}
 	} else if ext := path.Ext(entry.main); ext == ".mts" || ext == ".ts" || ext == ".tsx" || ext == ".cts" {
-		// entry.types = strings.TrimSuffix(entry.main, ext) + ".d" + strings.TrimSuffix(ext,"x")
+		// the declaration file is generated from the typescript source of a JSR package
+		if ctx.npmrc.isNativeJsrPackage(ctx.esmPath.PkgName) {
+			entry.types = toDeclarationPath(entry.main)
+		}
 	}
 }
 
@@ -607,6 +606,8 @@ func (ctx *BuildContext) resolveConditionExportEntry(conditions npm.JSONObject,
 	}
 
 	var conditionFound bool
+	var typesConditionFound bool
+	var plainTypesFound bool
 
 	if ctx.isBrowserTarget() {
 		conditionName := "browser"
@@ -660,6 +661,11 @@ LOOP:
 			}
 			module = prefered == "module"
 		case "types", "typings":
+			if typesConditionFound {
+				// a `types@<range>` condition that matches the TypeScript version is already applied
+				continue LOOP
+			}
+			plainTypesFound = true
 			if s, ok := condition.(string); ok {
 				if entry.types == "" || (!strings.HasSuffix(entry.types, ".d.mts") && strings.HasSuffix(s, ".d.mts")) {
 					entry.types = s
@@ -669,11 +675,27 @@ LOOP:
 				if e.types != "" {
 					if entry.types == "" || (!strings.HasSuffix(entry.types, ".d.mts") && strings.HasSuffix(e.types, ".d.mts")) {
 						entry.types = e.types
+						entry.typesSource = e.typesSource
 					}
 				}
 			}
 			continue LOOP
 		default:
+			// apply the versioned types condition that matches the TypeScript version, e.g. "types@>=5.0"
+			// see https://www.typescriptlang.org/docs/handbook/modules/reference.html#versioned-exports-conditions
+			if versionRange, ok := strings.CutPrefix(conditionName, "types@"); ok && !typesConditionFound && !plainTypesFound && matchTypeScriptVersion(versionRange) {
+				types := ""
+				if s, ok := condition.(string); ok {
+					types = s
+				} else if obj, ok := condition.(npm.JSONObject); ok {
+					types = ctx.resolveConditionExportEntry(obj, "types").types
+				}
+				if types != "" {
+					entry.types = types
+					entry.typesSource = fmt.Sprintf("the %q export condition", conditionName)
+					typesConditionFound = true
+				}
+			}
 			// skip unknown condition
 			continue LOOP
 		}
@@ -685,8 +707,9 @@ LOOP:
 				if e.main != "" {
 					entry.update(e.main, e.module)
 				}
-				if e.types != "" {
+				if e.types != "" && !typesConditionFound {
 					entry.types = e.types
+					entry.typesSource = e.typesSource
 				}
 			}
 		}
@@ -777,6 +800,8 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind esbuild.Re
 	if isSelfRef {
 		esmPath := EsmPath{
 			GhPrefix:   ctx.esmPath.GhPrefix,
+			GitHost:    ctx.esmPath.GitHost,
+			Workspace:  ctx.esmPath.Workspace,
 			PrPrefix:   ctx.esmPath.PrPrefix,
 			PkgName:    pkgJson.Name,
 			PkgVersion: pkgJson.Version,
@@ -815,6 +840,8 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind esbuild.Re
 		if ok {
 			subModule := EsmPath{
 				GhPrefix:   ctx.esmPath.GhPrefix,
+				GitHost:    ctx.esmPath.GitHost,
+				Workspace:  ctx.esmPath.Workspace,
 				PrPrefix:   ctx.esmPath.PrPrefix,
 				PkgName:    ctx.esmPath.PkgName,
 				PkgVersion: ctx.esmPath.PkgVersion,
@@ -900,17 +927,35 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind esbuild.Re
 		resolvedPath = p.Url
 		return
 	}
+	if p.Tarball != "" {
+		// tarball dependencies are bundled, see `isTarballDependency`
+		resolvedPath = fmt.Sprintf("/error.js?type=unsupported-tarball-dependency&name=%s&importer=%s", pkgName, ctx.esmPath.String())
+		return
+	}
 	if p.Name != "" {
 		dep.GhPrefix = p.Github
+		dep.GitHost = p.GitHost
+		dep.Workspace = p.Workspace
 		dep.PrPrefix = p.PkgPrNew
 		dep.PkgName = p.Name
 		dep.PkgVersion = p.Version
 	}
 
+	// private repositories can't be dependencies, unless it's the repository being built
+	if isPrivateGhDependency(ctx.Context(), dep.Package()) {
+		resolvedPath = fmt.Sprintf("/error.js?type=private-repository-dependency&name=%s&importer=%s", pkgName, ctx.esmPath.String())
+		return
+	}
+
 	// fetch the latest tag as the version of the repository
 	if dep.GhPrefix && dep.PkgVersion == "" {
+		var host *GitHost
+		host, err = dep.gitHost()
+		if err != nil {
+			return
+		}
 		var refs []GitRef
-		refs, err = listGhRepoRefsContext(ctx.Context(), fmt.Sprintf("https://github.com/%s", dep.PkgName))
+		refs, err = host.ListRepoRefsContext(ctx.Context(), dep.PkgName)
 		if err != nil {
 			return
 		}
@@ -1027,70 +1072,70 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind esbuild.Re
 	return
 }
 
-func (ctx *BuildContext) resolveDTS(entry BuildEntry) (string, error) {
+// resolveDTS resolves the types(dts) path of the entry, returns the path and the reason why the types are chosen.
+func (ctx *BuildContext) resolveDTS(entry BuildEntry) (dts string, reason string, err error) {
 	if entry.types != "" {
-		return fmt.Sprintf(
+		reason = "declared by " + ctx.pkgJson.Name + "@" + ctx.pkgJson.Version
+		if entry.typesSource != "" {
+			reason += ", selected by " + entry.typesSource + " for TypeScript " + typescriptVersion
+		}
+		dts = fmt.Sprintf(
 			"/%s/%s%s",
 			ctx.esmPath.PackageId(),
 			ctx.getBuildArgsPrefix(true),
 			strings.TrimPrefix(entry.types, "./"),
-		), nil
+		)
+		return
 	}
 
 	if ctx.esmPath.SubPath != "" && ctx.pkgJson.Types != "" {
-		return "", nil
+		return
 	}
 
 	// lookup types in @types scope
 	if pkgJson := ctx.pkgJson; pkgJson.Types == "" && !strings.HasPrefix(pkgJson.Name, "@types/") && npm.IsExactVersion(pkgJson.Version) {
-		versionParts := strings.Split(pkgJson.Version, ".")
-		versions := []string{
-			versionParts[0] + "." + versionParts[1], // major.minor
-			versionParts[0],                         // major
-		}
 		typesPkgName := npm.ToTypesPackageName(pkgJson.Name)
-		pkgVersion, ok := ctx.args.Deps[typesPkgName]
-		if ok {
-			// use the version of the `?deps` query if it exists
-			versions = append([]string{pkgVersion}, versions...)
+		m, err := ctx.lookupTypesPackage()
+		if err != nil || m.Version == "" {
+			return "", "", nil
+		}
+		dtsModule := EsmPath{
+			PkgName:    typesPkgName,
+			PkgVersion: m.Version,
+			SubPath:    ctx.esmPath.SubPath,
+		}
+		b := &BuildContext{
+			npmrc:       ctx.npmrc,
+			logger:      ctx.logger,
+			esmPath:     dtsModule,
+			args:        ctx.args,
+			externalAll: ctx.externalAll,
+			target:      "types",
+			ctx:         ctx.ctx,
+		}
+		err = b.install()
+		if err != nil {
+			if strings.Contains(err.Error(), " not found") {
+				return "", "", nil
+			}
+			return "", "", err
 		}
-		for _, version := range versions {
-			p, err := ctx.npmrc.getPackageInfoContext(ctx.Context(), typesPkgName, version)
-			if err == nil {
-				dtsModule := EsmPath{
-					PkgName:    typesPkgName,
-					PkgVersion: p.Version,
-					SubPath:    ctx.esmPath.SubPath,
-				}
-				b := &BuildContext{
-					npmrc:       ctx.npmrc,
-					logger:      ctx.logger,
-					esmPath:     dtsModule,
-					args:        ctx.args,
-					externalAll: ctx.externalAll,
-					target:      "types",
-					ctx:         ctx.ctx,
-				}
-				err := b.install()
-				if err != nil {
-					if strings.Contains(err.Error(), " not found") {
-						return "", nil
-					}
-					return "", err
-				}
-				dts, err := b.resolveDTS(b.resolveEntry(dtsModule))
-				if err != nil {
-					return "", err
-				}
-				if dts != "" {
-					// use tilde semver range instead of the exact version
-					return strings.ReplaceAll(dts, fmt.Sprintf("%s@%s", typesPkgName, p.Version), fmt.Sprintf("%s@~%s", typesPkgName, p.Version)), nil
-				}
+		typesEntry := b.resolveEntry(dtsModule)
+		dts, _, err := b.resolveDTS(typesEntry)
+		if err != nil {
+			return "", "", err
+		}
+		if dts != "" {
+			reason = m.Reason
+			if typesEntry.typesSource != "" {
+				reason += ", selected by " + typesEntry.typesSource + " for TypeScript " + typescriptVersion
 			}
+			// use tilde semver range instead of the exact version
+			return strings.ReplaceAll(dts, fmt.Sprintf("%s@%s", typesPkgName, m.Version), fmt.Sprintf("%s@~%s", typesPkgName, m.Version)), reason, nil
 		}
 	}
 
-	return "", nil
+	return
 }
 
 func (ctx *BuildContext) getImportPath(esm EsmPath, buildArgsPrefix string, externalAll bool) string {
@@ -1101,7 +1146,7 @@ func (ctx *BuildContext) getImportPath(esm EsmPath, buildArgsPrefix string, exte
 	if externalAll {
 		asteriskPrefix = "*"
 	}
-	name := strings.TrimSuffix(path.Base(esm.PkgName), ".js")
+	name := esm.moduleName()
 	if subPath := esm.SubPath; subPath != "" {
 		if subPath == name {
 			// if the sub-module name is same as the package name
@@ -1166,6 +1211,20 @@ func (ctx *BuildContext) existsPkgFile(fp ...string) bool {
 	return existsFile(path.Join(args...))
 }
 
+// splitPackageFile splits the filename in the build directory into the package id and the sub path,
+// e.g. "/wd/node_modules/foo/dist/foo.wasm" -> ("foo@1.0.0", "dist/foo.wasm")
+func (ctx *BuildContext) splitPackageFile(filename string) (pkgId string, subPath string) {
+	pkgName, _, subPath := splitEsmPath(strings.TrimPrefix(filename, path.Join(ctx.wd, "node_modules")+"/"))
+	if pkgName == ctx.esmPath.PkgName {
+		return ctx.esmPath.PackageId(), subPath
+	}
+	var raw npm.PackageJSONRaw
+	if utils.ParseJSONFile(path.Join(ctx.wd, "node_modules", pkgName, "package.json"), &raw) == nil && raw.Version != "" {
+		return pkgName + "@" + raw.Version, subPath
+	}
+	return pkgName, subPath
+}
+
 func (ctx *BuildContext) resloveSubModule(subPath string) (string, bool) {
 	if subPath != "" {
 		if ctx.existsPkgFile(subPath) {
@@ -1388,6 +1447,12 @@ func normalizeSavePath(pathname string) string {
 			segments[i] = seg[1:] + "/ea"
 		}
 	}
+	// the files of private github repositories are stored separately
+	if _, rest := utils.SplitByFirstByte(pathname, '/'); rest != "" {
+		if _, ok := getPrivateGhRepo("/" + rest); ok {
+			return "private/" + strings.Join(segments, "/")
+		}
+	}
 	return strings.Join(segments, "/")
 }
 
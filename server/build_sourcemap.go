@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/internal/storage"
+)
+
+var (
+	jsSourceMappingURLPrefix  = []byte("//# sourceMappingURL=")
+	cssSourceMappingURLPrefix = []byte("/*# sourceMappingURL=")
+)
+
+// normalizeSourceMapMode normalizes the `?sourcemap` query value,
+// returns false if the value is not a valid source map mode.
+func normalizeSourceMapMode(v string) (string, bool) {
+	switch v {
+	case "", "true", "external":
+		return "external", true
+	case "inline":
+		return "inline", true
+	case "false", "none":
+		return "none", true
+	}
+	return "", false
+}
+
+// getSourceMapMode returns the source map mode of the build: "external", "inline" or "none".
+func (ctx *BuildContext) getSourceMapMode() string {
+	if ctx.args.SourceMap != "" {
+		return ctx.args.SourceMap
+	}
+	if config.SourceMap {
+		return "external"
+	}
+	return "none"
+}
+
+// fixSourceMap shifts the mappings of the source map by the given line offset,
+// and strips the `sourcesContent` field if the `sourcesContent` option is disabled.
+func fixSourceMap(data []byte, lineOffset int) ([]byte, error) {
+	var sourceMap map[string]any
+	if err := json.Unmarshal(data, &sourceMap); err != nil {
+		return nil, err
+	}
+	if mappings, ok := sourceMap["mappings"].(string); ok {
+		if lineOffset > 0 {
+			mappings = strings.Repeat(";", lineOffset) + mappings
+		} else {
+			for i := lineOffset; i < 0 && mappings != ""; i++ {
+				if j := strings.IndexByte(mappings, ';'); j >= 0 {
+					mappings = mappings[j+1:]
+				} else {
+					mappings = ""
+				}
+			}
+		}
+		sourceMap["mappings"] = mappings
+	}
+	if !config.SourcesContent {
+		delete(sourceMap, "sourcesContent")
+	}
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(sourceMap); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// writeSourceMappingURL writes the `sourceMappingURL` comment to the given buffer,
+// the source map is embedded as a data URL in inline mode.
+func writeSourceMappingURL(buf *bytes.Buffer, sourceMap []byte, filename string, inline bool, isCSS bool) {
+	if isCSS {
+		buf.Write(cssSourceMappingURLPrefix)
+	} else {
+		buf.Write(jsSourceMappingURLPrefix)
+	}
+	if inline {
+		buf.WriteString("data:application/json;base64,")
+		buf.WriteString(base64.StdEncoding.EncodeToString(sourceMap))
+	} else {
+		buf.WriteString(filename)
+		buf.WriteString(".map")
+	}
+	if isCSS {
+		buf.WriteString(" */")
+	}
+}
+
+// stripSourceMappingURL removes the trailing `sourceMappingURL` comment of the given js code.
+func stripSourceMappingURL(code []byte) []byte {
+	i := bytes.LastIndex(code, jsSourceMappingURLPrefix)
+	if i >= 0 && !bytes.ContainsRune(code[i:], '\n') {
+		return code[:i]
+	}
+	return code
+}
+
+// readBuildSourceMap reads the external source map of the built js code from the storage,
+// returns nil if the code doesn't link to an external source map.
+func readBuildSourceMap(esmStorage storage.Storage, savePath string, code []byte) ([]byte, error) {
+	i := bytes.LastIndex(code, jsSourceMappingURLPrefix)
+	if i < 0 || bytes.HasPrefix(code[i+len(jsSourceMappingURLPrefix):], []byte("data:")) {
+		return nil, nil
+	}
+	f, _, err := esmStorage.Get(savePath + ".map")
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	esbuild "github.com/ije/esbuild-internal/api"
+)
+
+func TestFixSourceMap(t *testing.T) {
+	data := []byte(`{"version":3,"sources":["a.js"],"sourcesContent":["foo"],"mappings":"AAAA;AACA"}`)
+
+	fixed, err := fixSourceMap(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sourceMap map[string]any
+	if err := json.Unmarshal(fixed, &sourceMap); err != nil {
+		t.Fatal(err)
+	}
+	if sourceMap["mappings"] != ";;AAAA;AACA" {
+		t.Fatalf("unexpected mappings: %v", sourceMap["mappings"])
+	}
+	if _, ok := sourceMap["sourcesContent"]; !ok {
+		t.Fatal("sourcesContent should be kept")
+	}
+
+	fixed, err = fixSourceMap(data, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(fixed, &sourceMap); err != nil {
+		t.Fatal(err)
+	}
+	if sourceMap["mappings"] != "AACA" {
+		t.Fatalf("unexpected mappings: %v", sourceMap["mappings"])
+	}
+
+	config.SourcesContent = false
+	defer func() { config.SourcesContent = true }()
+	fixed, err = fixSourceMap(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceMap = nil
+	if err := json.Unmarshal(fixed, &sourceMap); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sourceMap["sourcesContent"]; ok {
+		t.Fatal("sourcesContent should be stripped")
+	}
+}
+
+func TestSourceMappingURL(t *testing.T) {
+	buf := bytes.NewBufferString("console.log(1);\n")
+	writeSourceMappingURL(buf, []byte("{}"), "foo.mjs", false, false)
+	if buf.String() != "console.log(1);\n//# sourceMappingURL=foo.mjs.map" {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	if string(stripSourceMappingURL(buf.Bytes())) != "console.log(1);\n" {
+		t.Fatalf("unexpected output: %s", stripSourceMappingURL(buf.Bytes()))
+	}
+
+	buf = bytes.NewBufferString("a{color:red}\n")
+	writeSourceMappingURL(buf, []byte("{}"), "foo.css", true, true)
+	if buf.String() != "a{color:red}\n/*# sourceMappingURL=data:application/json;base64,e30= */" {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+
+	for _, v := range []string{"", "inline", "external", "none", "false"} {
+		if _, ok := normalizeSourceMapMode(v); !ok {
+			t.Fatalf("%q should be a valid source map mode", v)
+		}
+	}
+	if _, ok := normalizeSourceMapMode("hidden"); ok {
+		t.Fatal("\"hidden\" should not be a valid source map mode")
+	}
+}
+
+func TestTreeShakeInlineSourceMap(t *testing.T) {
+	ret := esbuild.Transform("export const a = 1;\nexport const b = 2;\n", esbuild.TransformOptions{
+		Format:     esbuild.FormatESModule,
+		Sourcemap:  esbuild.SourceMapInline,
+		Sourcefile: "src/index.js",
+	})
+	if len(ret.Errors) > 0 {
+		t.Fatal(ret.Errors[0].Text)
+	}
+
+	config.SourcesContent = false
+	defer func() { config.SourcesContent = true }()
+	out, outSourceMap, err := treeShake(nil, npm.Package{Name: "pkg", Version: "1.0.0"}, ret.Code, nil, []string{"a"}, esbuild.ES2022)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outSourceMap != nil {
+		t.Fatal("the source map should be inlined")
+	}
+	prefix := []byte("//# sourceMappingURL=data:application/json;base64,")
+	i := bytes.LastIndex(out, prefix)
+	if i < 0 {
+		t.Fatalf("missing inline source map: %s", out)
+	}
+	data, err := base64.StdEncoding.DecodeString(string(out[i+len(prefix):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sourceMap map[string]any
+	if err := json.Unmarshal(data, &sourceMap); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sourceMap["sourcesContent"]; ok {
+		t.Fatal("sourcesContent should be stripped")
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	esbuild "github.com/ije/esbuild-internal/api"
+	"github.com/ije/gox/utils"
+)
+
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// WasmModule represents the imports and exports of a WebAssembly module
+type WasmModule struct {
+	// the module names of the imports, e.g. "./foo_bg.js"
+	Imports []string
+	// the names of the exports
+	Exports []string
+}
+
+// parseWasmModule parses the import and export sections of the WebAssembly binary.
+func parseWasmModule(data []byte) (mod *WasmModule, err error) {
+	if len(data) < 8 || !bytes.Equal(data[:4], wasmMagic) {
+		return nil, errors.New("invalid wasm binary")
+	}
+	r := &wasmReader{data: data, offset: 8}
+	mod = &WasmModule{}
+	for r.offset < len(r.data) {
+		id := r.byte()
+		size := int(r.u32())
+		if r.err != nil || r.offset+size > len(r.data) {
+			return nil, errors.New("invalid wasm section")
+		}
+		section := &wasmReader{data: r.data[:r.offset+size], offset: r.offset}
+		r.offset += size
+		switch id {
+		case 2: // import section
+			count := section.u32()
+			for range count {
+				module := section.name()
+				section.name() // field
+				switch section.byte() {
+				case 0x00: // func
+					section.u32()
+				case 0x01: // table
+					section.byte()
+					section.limits()
+				case 0x02: // memory
+					section.limits()
+				case 0x03: // global
+					section.byte()
+					section.byte()
+				case 0x04: // tag
+					section.byte()
+					section.u32()
+				default:
+					return nil, errors.New("invalid wasm import")
+				}
+				if section.err != nil {
+					return nil, section.err
+				}
+				if !slices.Contains(mod.Imports, module) {
+					mod.Imports = append(mod.Imports, module)
+				}
+			}
+		case 7: // export section
+			count := section.u32()
+			for range count {
+				name := section.name()
+				section.byte() // kind
+				section.u32()  // index
+				if section.err != nil {
+					return nil, section.err
+				}
+				mod.Exports = append(mod.Exports, name)
+			}
+		}
+	}
+	return mod, nil
+}
+
+type wasmReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *wasmReader) byte() byte {
+	if r.offset >= len(r.data) {
+		r.err = errors.New("unexpected end of wasm binary")
+		return 0
+	}
+	b := r.data[r.offset]
+	r.offset++
+	return b
+}
+
+// u32 reads an unsigned LEB128 integer.
+func (r *wasmReader) u32() uint64 {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	r.err = errors.New("invalid LEB128 integer")
+	return 0
+}
+
+func (r *wasmReader) name() string {
+	n := int(r.u32())
+	if r.err != nil || r.offset+n > len(r.data) {
+		r.err = errors.New("unexpected end of wasm binary")
+		return ""
+	}
+	s := string(r.data[r.offset : r.offset+n])
+	r.offset += n
+	return s
+}
+
+func (r *wasmReader) limits() {
+	flags := r.byte()
+	r.u32()
+	if flags&0x01 != 0 {
+		r.u32()
+	}
+}
+
+// supportsTopLevelAwait returns true if the build target supports top-level await.
+func (ctx *BuildContext) supportsTopLevelAwait() bool {
+	t := targets[ctx.target]
+	return t == esbuild.ESNext || t >= esbuild.ES2022
+}
+
+// getWasmModuleShim returns the JS module of the `.wasm` import. The wasm file is emitted as a build asset,
+// and the module follows the WebAssembly ESM integration proposal: the exports of the wasm instance are exported,
+// and the imports of the wasm module are imported from the JS modules. The default export is the binary
+// of the wasm file for compatibility.
+//
+// For targets that don't support top-level await, the wasm binary is embedded in the JS module and the
+// wasm module is compiled and instantiated synchronously.
+func (ctx *BuildContext) getWasmModuleShim(filename string, analyzeMode bool) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	mod, err := parseWasmModule(data)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	// only instantiate the wasm module when all the imports are JS modules
+	instantiate := len(mod.Exports) > 0
+	for _, name := range mod.Imports {
+		if !isRelPathSpecifier(name) {
+			instantiate = false
+			break
+		}
+	}
+	if instantiate {
+		for i, name := range mod.Imports {
+			fmt.Fprintf(buf, "import * as __wasmImport%d$ from %s;\n", i, toJSString(name))
+		}
+	}
+
+	if ctx.supportsTopLevelAwait() {
+		var assetPath string
+		if analyzeMode {
+			assetPath = ctx.getAssetPath(filename)
+		} else {
+			assetPath, err = ctx.emitAsset(filename)
+			if err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(buf, "const __wasm$ = new Uint8Array(await fetch(new URL(%s, import.meta.url)).then(res => res.arrayBuffer()));\n", toJSString(assetPath))
+		if instantiate {
+			buf.WriteString("const { instance: __wasmInstance$ } = await WebAssembly.instantiate(__wasm$, ")
+		}
+	} else {
+		fmt.Fprintf(buf, "const __wasm$ = Uint8Array.from(atob('%s'), c => c.charCodeAt(0));\n", base64.StdEncoding.EncodeToString(data))
+		if instantiate {
+			buf.WriteString("const __wasmInstance$ = new WebAssembly.Instance(new WebAssembly.Module(__wasm$), ")
+		}
+	}
+	if instantiate {
+		buf.WriteString("{")
+		for i, name := range mod.Imports {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "%s: __wasmImport%d$", toJSString(name), i)
+		}
+		buf.WriteString("});\n")
+		var names []string
+		for _, name := range mod.Exports {
+			if isJsIdentifier(name) && !isJsReservedWord(name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(buf, "export const { %s } = __wasmInstance$.exports;\n", strings.Join(names, ", "))
+		}
+	}
+	buf.WriteString("export default __wasm$;\n")
+	return buf.String(), nil
+}
+
+// toJSString returns the JSON-encoded string that is a valid JS string literal.
+func toJSString(s string) string {
+	return strings.TrimSpace(string(utils.MustEncodeJSON(s)))
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/esm-dev/esm.sh/internal/storage"
+	"github.com/ije/gox/log"
+)
+
+// a wasm module that imports `log` from "./foo_bg.js" and exports the `add` function
+var testWasmModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// type section: () -> ()
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00,
+	// import section: "./foo_bg.js" "log" func 0
+	0x02, 0x13, 0x01, 0x0b, '.', '/', 'f', 'o', 'o', '_', 'b', 'g', '.', 'j', 's', 0x03, 'l', 'o', 'g', 0x00, 0x00,
+	// function section
+	0x03, 0x02, 0x01, 0x00,
+	// export section: "add" func 1
+	0x07, 0x07, 0x01, 0x03, 'a', 'd', 'd', 0x00, 0x01,
+	// code section
+	0x0a, 0x04, 0x01, 0x02, 0x00, 0x0b,
+}
+
+func TestParseWasmModule(t *testing.T) {
+	mod, err := parseWasmModule(testWasmModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mod.Imports) != 1 || mod.Imports[0] != "./foo_bg.js" {
+		t.Fatalf("unexpected imports: %v", mod.Imports)
+	}
+	if len(mod.Exports) != 1 || mod.Exports[0] != "add" {
+		t.Fatalf("unexpected exports: %v", mod.Exports)
+	}
+
+	if _, err := parseWasmModule([]byte("not a wasm")); err == nil {
+		t.Fatal("expected an error for invalid wasm binary")
+	}
+	if _, err := parseWasmModule(testWasmModule[:20]); err == nil {
+		t.Fatal("expected an error for truncated wasm binary")
+	}
+}
+
+func TestBuildWasmModule(t *testing.T) {
+	root := t.TempDir()
+	wd := filepath.Join(root, "wd")
+	pkgName := "wasm-pkg"
+	pkgDir := filepath.Join(wd, "node_modules", pkgName)
+	if err := os.MkdirAll(filepath.Join(pkgDir, "dist"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"dist/foo.wasm":   string(testWasmModule),
+		"dist/foo_bg.js":  "export function log() { console.log('hello') }",
+		"dist/index.d.ts": "export declare function add(): void;",
+		"dist/index.js": strings.Join([]string{
+			`import { add } from "./foo.wasm";`,
+			`export const wasmUrl = new URL("./foo.wasm", import.meta.url);`,
+			`export { add };`,
+		}, "\n"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pkgDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := storage.NewFSStorage(filepath.Join(root, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := log.New("")
+	ctx := &BuildContext{
+		logger:  logger,
+		storage: fs,
+		wd:      wd,
+		esmPath: EsmPath{PkgName: pkgName, PkgVersion: "1.0.0"},
+		pkgJson: &npm.PackageJSON{Name: pkgName, Version: "1.0.0", Type: "module", Module: "./dist/index.js", Types: "./dist/index.d.ts"},
+		target:  "es2022",
+	}
+	if _, _, err := ctx.buildModule(false); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := fs.Get(ctx.getSavePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := string(data)
+	assetUrl := "/wasm-pkg@1.0.0/es2022/dist/foo.wasm"
+	if !strings.Contains(js, `"`+assetUrl+`"`) || strings.Contains(js, `"./foo.wasm"`) {
+		t.Fatalf("wasm URL should be rewritten: %s", js)
+	}
+	if !strings.Contains(js, "WebAssembly.instantiate(") || !strings.Contains(js, "console.log(") {
+		t.Fatalf("wasm module should be instantiated with the JS imports: %s", js)
+	}
+	if strings.Contains(js, "atob(") {
+		t.Fatalf("wasm binary should not be embedded: %s", js)
+	}
+	if stat, err := fs.Stat(normalizeSavePath("modules" + assetUrl)); err != nil || stat.Size() != int64(len(testWasmModule)) {
+		t.Fatalf("wasm asset should be emitted: %v", err)
+	}
+
+	// embed the wasm binary and instantiate it synchronously for targets that don't support top-level await
+	ctx.target = "es2020"
+	ctx.path = ""
+	code, err := ctx.getWasmModuleShim(filepath.Join(pkgDir, "dist/foo.wasm"), false)
+	if err != nil || !strings.Contains(code, "atob(") {
+		t.Fatalf("wasm binary should be embedded: %v", err)
+	}
+	if !strings.Contains(code, "new WebAssembly.Instance(new WebAssembly.Module(__wasm$), {\"./foo_bg.js\": __wasmImport0$})") || !strings.Contains(code, "export const { add } = __wasmInstance$.exports;") || strings.Contains(code, "await ") {
+		t.Fatalf("wasm module should be instantiated synchronously: %s", code)
+	}
+	if _, _, err := ctx.buildModule(false); err != nil {
+		t.Fatal(err)
+	}
+}
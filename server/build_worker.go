@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ije/gox/utils"
+)
+
+var regexpWorkerURL = regexp.MustCompile(`new\s+(Shared)?Worker\(\s*new\s+URL\(\s*["'](\.\.?/[^"'\r\n]+)["']\s*,\s*import\.meta\.url\s*\)\s*([,)])`)
+
+// workerHelper creates the worker of the module with the `type: "module"` option merged into the options of the caller.
+// Browsers don't allow to create a worker from a cross-origin script, so the worker module is imported by a blob
+// script in that case. The blob shim is not used for shared workers, since every page would get a unique blob URL
+// and no longer share the worker.
+const workerHelper = "\nfunction __esmWorker$(shared, url, options) { const u = new URL(url, import.meta.url); const opts = typeof options === \"string\" ? { name: options, type: \"module\" } : { ...options, type: \"module\" }; if (shared) return new SharedWorker(u, opts); return new Worker(globalThis.location && u.origin === globalThis.location.origin ? u : URL.createObjectURL(new Blob([\"import \" + JSON.stringify(u.href) + \";\"], { type: \"application/javascript\" })), opts); }\n"
+
+// getWorkerPath returns the build path of the worker module that is a file of current package,
+// e.g. "/pkg@1.0.0/es2022/dist/worker.mjs".
+func (ctx *BuildContext) getWorkerPath(filename string) (string, bool) {
+	subPath, ok := strings.CutPrefix(filename, path.Join(ctx.wd, "node_modules", ctx.esmPath.PkgName)+"/")
+	if !ok || !slices.Contains(moduleExts, path.Ext(filename)) || !existsFile(filename) {
+		return "", false
+	}
+	workerModule := EsmPath{
+		GhPrefix:   ctx.esmPath.GhPrefix,
+		GitHost:    ctx.esmPath.GitHost,
+		Workspace:  ctx.esmPath.Workspace,
+		PrPrefix:   ctx.esmPath.PrPrefix,
+		PkgName:    ctx.esmPath.PkgName,
+		PkgVersion: ctx.esmPath.PkgVersion,
+		SubPath:    stripEntryModuleExt(subPath),
+	}
+	workerPath := ctx.getImportPath(workerModule, ctx.getBuildArgsPrefix(false), ctx.externalAll)
+	if ctx.bundleMode == BundleFalse {
+		n, e := utils.SplitByLastByte(workerPath, '.')
+		workerPath = n + ".nobundle." + e
+	}
+	return workerPath, true
+}
+
+// rewriteWorkerURLs rewrites `new Worker(new URL("./worker.js", import.meta.url))` expressions of the module to
+// create the worker of the module that is built as a separate entry with the same target and build args, returns
+// nil if nothing is changed.
+func (ctx *BuildContext) rewriteWorkerURLs(filename string, code []byte) []byte {
+	changed := false
+	ret := regexpWorkerURL.ReplaceAllFunc(code, func(m []byte) []byte {
+		submatch := regexpWorkerURL.FindSubmatch(m)
+		workerPath, ok := ctx.getWorkerPath(path.Join(path.Dir(filename), string(submatch[2])))
+		if !ok {
+			return m
+		}
+		changed = true
+		shared := len(submatch[1]) > 0
+		if string(submatch[3]) == ")" {
+			return fmt.Appendf(nil, "__esmWorker$(%t, %s)", shared, toJSString(workerPath))
+		}
+		return fmt.Appendf(nil, "__esmWorker$(%t, %s,", shared, toJSString(workerPath))
+	})
+	if !changed {
+		return nil
+	}
+	// append the helper function at the end to keep the line numbers of the source map
+	return append(ret, workerHelper...)
+}
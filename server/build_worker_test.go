@@ -0,0 +1,98 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/esm-dev/esm.sh/internal/storage"
+	"github.com/ije/gox/log"
+)
+
+func TestBuildWorker(t *testing.T) {
+	root := t.TempDir()
+	wd := filepath.Join(root, "wd")
+	pkgName := "worker-pkg"
+	pkgDir := filepath.Join(wd, "node_modules", pkgName)
+	if err := os.MkdirAll(filepath.Join(pkgDir, "dist"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"dist/index.d.ts": "export declare function spawn(): Worker;",
+		"dist/index.js": strings.Join([]string{
+			`export const spawn = () => new Worker(new URL("./worker.js", import.meta.url));`,
+			`export const spawnShared = () => new SharedWorker(new URL("./worker.js", import.meta.url), { name: "shared" });`,
+			`export const notWorker = new URL("./foo.js", import.meta.url);`,
+		}, "\n"),
+		"dist/worker.js": `import { add } from "./utils.js"; self.onmessage = (e) => self.postMessage(add(e.data, 1));`,
+		"dist/utils.js":  `export const add = (a, b) => a + b;`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pkgDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := storage.NewFSStorage(filepath.Join(root, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFile := func(name string) string {
+		f, _, err := fs.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	logger, _ := log.New("")
+	newBuildContext := func(subPath string) *BuildContext {
+		return &BuildContext{
+			logger:  logger,
+			storage: fs,
+			wd:      wd,
+			args:    BuildArgs{KeepNames: true},
+			esmPath: EsmPath{PkgName: pkgName, PkgVersion: "1.0.0", SubPath: subPath},
+			pkgJson: &npm.PackageJSON{Name: pkgName, Version: "1.0.0", Type: "module", Module: "./dist/index.js", Types: "./dist/index.d.ts"},
+			target:  "es2022",
+		}
+	}
+
+	ctx := newBuildContext("")
+	if _, _, err := ctx.buildModule(false); err != nil {
+		t.Fatal(err)
+	}
+	js := readFile(ctx.getSavePath())
+	workerPath := "/worker-pkg@1.0.0/" + ctx.getBuildArgsPrefix(false) + "es2022/dist/worker.mjs"
+	if strings.Count(js, `"`+workerPath+`"`) != 2 {
+		t.Fatalf("worker URL should be rewritten: %s", js)
+	}
+	if !strings.Contains(js, `(!1,"`+workerPath+`")`) || !strings.Contains(js, `(!0,"`+workerPath+`",{name:"shared"})`) {
+		t.Fatalf("worker should be created by the helper: %s", js)
+	}
+	if !strings.Contains(js, `,type:"module"}`) || !strings.Contains(js, "URL.createObjectURL(") || !strings.Contains(js, `"./foo.js"`) {
+		t.Fatalf("unexpected worker URL rewriting: %s", js)
+	}
+	if strings.Count(js, "new SharedWorker(") != 1 || strings.Contains(js, "new SharedWorker(URL.createObjectURL(") {
+		t.Fatalf("shared worker should not be loaded by a blob URL: %s", js)
+	}
+
+	ctx = newBuildContext("dist/worker")
+	if ctx.Path() != workerPath {
+		t.Fatalf("unexpected worker build path: %s", ctx.Path())
+	}
+	if _, _, err := ctx.buildModule(false); err != nil {
+		t.Fatal(err)
+	}
+	if js := readFile(ctx.getSavePath()); !strings.Contains(js, "postMessage(") || strings.Contains(js, "utils.js") {
+		t.Fatalf("worker should be built as a bundle: %s", js)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/esm-dev/esm.sh/internal/npm"
 	"github.com/esm-dev/esm.sh/internal/storage"
 	"github.com/ije/gox/term"
 	"github.com/ije/gox/utils"
@@ -46,11 +47,17 @@ type Config struct {
 	NpmPassword         string                       `json:"npmPassword"`
 	NpmScopedRegistries map[string]NpmRegistryConfig `json:"npmScopedRegistries"`
 	NpmQueryCacheTTL    uint32                       `json:"npmQueryCacheTTL"`
+	GitHosts            map[string]GitHostConfig     `json:"gitHosts"`
+	GithubTokens        map[string]GithubTokenConfig `json:"githubTokens"`
+	TarballHosts        []string                     `json:"tarballHosts"`
+	AssetInlineLimits   map[string]int64             `json:"assetInlineLimits"`
 	MinifyRaw           json.RawMessage              `json:"minify"`
 	SourceMapRaw        json.RawMessage              `json:"sourceMap"`
+	SourcesContentRaw   json.RawMessage              `json:"sourcesContent"`
 	CompressRaw         json.RawMessage              `json:"compress"`
 	Minify              bool                         `json:"-"`
 	SourceMap           bool                         `json:"-"`
+	SourcesContent      bool                         `json:"-"`
 	Compress            bool                         `json:"-"`
 }
 
@@ -62,6 +69,21 @@ type NpmRegistryConfig struct {
 	Password       string `json:"password"`
 }
 
+type GitHostConfig struct {
+	BaseURL string `json:"baseUrl"`
+	Type    string `json:"type"`
+	User    string `json:"user"`
+	Token   string `json:"token"`
+}
+
+type GithubTokenConfig struct {
+	// the token to access the private repositories of the owner
+	Token string `json:"token"`
+	// the tokens that clients use to access the modules built from the private repositories,
+	// sent with the `Authorization: Bearer <token>` header
+	ClientTokens []string `json:"clientTokens"`
+}
+
 type LandingPageOptions struct {
 	Origin string   `json:"origin"`
 	Assets []string `json:"assets"`
@@ -242,6 +264,47 @@ func normalizeConfig(config *Config) {
 		}
 		config.NpmScopedRegistries = regs
 	}
+	if len(config.GitHosts) > 0 {
+		hosts := make(map[string]GitHostConfig)
+		for name, c := range config.GitHosts {
+			if !npm.Naming.Match(name) || !isHttpSpecifier(c.BaseURL) {
+				fmt.Printf("[error] invalid git host %s: %s\n", name, c.BaseURL)
+				continue
+			}
+			switch c.Type {
+			case "", "github", "gitlab", "gitea", "bitbucket":
+				c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+				hosts[name] = c
+			default:
+				fmt.Printf("[error] invalid type of git host %s: %s\n", name, c.Type)
+			}
+		}
+		config.GitHosts = hosts
+	}
+	if len(config.GithubTokens) > 0 {
+		tokens := make(map[string]GithubTokenConfig)
+		for owner, c := range config.GithubTokens {
+			if c.Token == "" {
+				fmt.Printf("[error] missing github token for %s\n", owner)
+				continue
+			}
+			// github owner names are case-insensitive
+			tokens[strings.ToLower(owner)] = c
+		}
+		config.GithubTokens = tokens
+	}
+	if len(config.TarballHosts) > 0 {
+		hosts := make([]string, 0, len(config.TarballHosts))
+		for _, host := range config.TarballHosts {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host == "" || strings.ContainsRune(host, '/') {
+				fmt.Printf("[error] invalid tarball host: %s\n", host)
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+		config.TarballHosts = hosts
+	}
 	if config.NpmQueryCacheTTL == 0 {
 		v := os.Getenv("NPM_QUERY_CACHE_TTL")
 		if v != "" {
@@ -254,8 +317,21 @@ func normalizeConfig(config *Config) {
 		}
 		config.NpmQueryCacheTTL = 600
 	}
+	if config.AssetInlineLimits == nil {
+		config.AssetInlineLimits = map[string]int64{}
+	}
+	if _, ok := config.AssetInlineLimits["*"]; !ok {
+		config.AssetInlineLimits["*"] = 4 * 1024
+		if v := os.Getenv("ASSET_INLINE_LIMIT"); v != "" {
+			i, e := strconv.ParseInt(v, 10, 64)
+			if e == nil && i >= 0 {
+				config.AssetInlineLimits["*"] = i
+			}
+		}
+	}
 	config.Compress = !(bytes.Equal(config.CompressRaw, []byte("false")) || os.Getenv("COMPRESS") == "false")
 	config.SourceMap = !(bytes.Equal(config.SourceMapRaw, []byte("false")) || (os.Getenv("SOURCEMAP") == "false" || os.Getenv("SOURCE_MAP") == "false"))
+	config.SourcesContent = !(bytes.Equal(config.SourcesContentRaw, []byte("false")) || os.Getenv("SOURCES_CONTENT") == "false")
 	config.Minify = !(bytes.Equal(config.MinifyRaw, []byte("false")) || os.Getenv("MINIFY") == "false")
 }
 
@@ -0,0 +1,808 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/internal/storage"
+)
+
+var regexpDtsReferenceTag = regexp.MustCompile(`^///\s*<reference\s+(path|types|lib)\s*=\s*['"](.+?)['"]`)
+
+// the keywords that start a new statement in `.d.ts` files
+var dtsStmtKeywords = map[string]bool{
+	"export":    true,
+	"import":    true,
+	"declare":   true,
+	"interface": true,
+	"type":      true,
+	"function":  true,
+	"class":     true,
+	"abstract":  true,
+	"const":     true,
+	"let":       true,
+	"var":       true,
+	"namespace": true,
+	"module":    true,
+	"enum":      true,
+	"global":    true,
+	"async":     true,
+}
+
+// dtsStmt is a top-level statement of a `.d.ts` file
+type dtsStmt struct {
+	// the leading comments of the statement
+	lead string
+	// the statement without leading comments
+	body string
+	// the significant tokens (not spaces or comments) of the statement
+	tokens dtsTokens
+}
+
+// dtsBinding is an imported/exported binding of a relative `.d.ts` file
+type dtsBinding struct {
+	target string
+	name   string
+	as     string
+}
+
+// dtsBundleFile is a `.d.ts` file that is inlined into the bundle
+type dtsBundleFile struct {
+	stmts        []dtsStmt
+	localExports map[string]string
+	reExportAll  []string
+	reExports    []dtsBinding
+	imports      []dtsBinding
+	exports      map[string]string
+	resolving    bool
+}
+
+type dtsBundler struct {
+	ctx        *BuildContext
+	entry      string
+	files      map[string]*dtsBundleFile
+	order      []string
+	directives []string
+	imports    map[string]string
+	declared   map[string]string
+}
+
+// bundleDTS rolls up the `.d.ts` file and the relative declaration files it imports into a single file,
+// the imports of other packages are kept as CDN URLs. It returns an error if the declaration files can't
+// be merged safely (e.g. name conflicts, namespace imports, etc.), the caller should fall back to the
+// per-file mode in that case.
+func (ctx *BuildContext) bundleDTS(dts string) (n int, err error) {
+	dtsPath := path.Join("/"+ctx.esmPath.PackageId(), ctx.getBuildArgsPrefix(true), dts)
+	savePath := normalizeSavePath(path.Join("types", dtsPath))
+	_, err = ctx.storage.Stat(savePath)
+	if err == nil || err != storage.ErrNotFound {
+		return
+	}
+
+	b := &dtsBundler{
+		ctx:      ctx,
+		entry:    dts,
+		files:    map[string]*dtsBundleFile{},
+		imports:  map[string]string{},
+		declared: map[string]string{},
+	}
+	err = b.load(dts)
+	if err != nil {
+		return
+	}
+	buf, err := b.bundle()
+	if err != nil {
+		return
+	}
+	err = ctx.storage.Put(savePath, buf)
+	if err != nil {
+		return
+	}
+	return len(b.files), nil
+}
+
+// load parses the `.d.ts` file and the relative declaration files it imports
+func (b *dtsBundler) load(dts string) (err error) {
+	if _, ok := b.files[dts]; ok {
+		return
+	}
+	isEntry := dts == b.entry
+	file := &dtsBundleFile{localExports: map[string]string{}}
+	b.files[dts] = file
+
+	ctx := b.ctx
+	r, err := ctx.openDTS(dts)
+	if err != nil {
+		if os.IsNotExist(err) && isEntry {
+			err = errors.New("types not found")
+		}
+		return
+	}
+	defer r.Close()
+
+	buffer := &bytes.Buffer{}
+	err = parseDts(r, buffer, func(specifier string, kind TsImportKind, position int) (string, error) {
+		res, _, err := ctx.resolveDTSImport(dts, specifier, kind)
+		return res, err
+	})
+	if err != nil {
+		return
+	}
+
+	directives, stmts := splitDtsStmts(ctx.rewriteDTS(dts, buffer).String())
+	for _, directive := range directives {
+		if m := regexpDtsReferenceTag.FindStringSubmatch(directive); m != nil && m[1] == "path" && isRelPathSpecifier(m[2]) {
+			return fmt.Errorf("unsupported reference path %q in %s", m[2], dts)
+		}
+		if !slices.Contains(b.directives, directive) {
+			b.directives = append(b.directives, directive)
+		}
+	}
+
+	var deps []string
+	resolveRelPath := func(specifier string) string {
+		target := "./" + path.Join(path.Dir(dts), specifier)
+		if !slices.Contains(deps, target) {
+			deps = append(deps, target)
+		}
+		return target
+	}
+	unsupported := func(stmt string) error {
+		return fmt.Errorf("unsupported statement in %s: %s", dts, stmt)
+	}
+
+	for _, stmt := range stmts {
+		toks := stmt.tokens
+		if len(toks) == 0 {
+			file.stmts = append(file.stmts, stmt)
+			continue
+		}
+		if toks.hasRelImportCall() || (toks.at(0) == "declare" && toks.at(1) == "module" && strings.HasPrefix(toks.str(2), ".")) {
+			return unsupported(stmt.body)
+		}
+		if specifier := toks.str(1); toks[0] == "import" && specifier != "" {
+			// import "..."
+			if isRelPathSpecifier(specifier) {
+				resolveRelPath(specifier)
+				continue
+			}
+		} else if name, ok := toks.matchImportEquals(); ok {
+			// import A = require("...")
+			if err = b.declare(name, dts); err != nil {
+				return
+			}
+		} else if clause, specifier, ok := toks.matchImportFrom(); ok {
+			// import { A } from "..."
+			if isRelPathSpecifier(specifier) {
+				if clause.at(0) != "{" || clause.at(len(clause)-1) != "}" {
+					return unsupported(stmt.body)
+				}
+				target := resolveRelPath(specifier)
+				for _, binding := range parseDtsBindings(clause[1 : len(clause)-1]) {
+					binding.target = target
+					file.imports = append(file.imports, binding)
+				}
+				continue
+			}
+			if ok, err := b.addImport(clause, strings.Join(toks, " ")); err != nil {
+				return err
+			} else if !ok {
+				// an identical import statement exists
+				continue
+			}
+		} else if form, list, specifier, ok := toks.matchExport(); ok {
+			switch form {
+			case dtsExportAllFrom:
+				if isRelPathSpecifier(specifier) {
+					file.reExportAll = append(file.reExportAll, resolveRelPath(specifier))
+					continue
+				}
+				if !isEntry {
+					return unsupported(stmt.body)
+				}
+			case dtsExportNsFrom:
+				if !isEntry || isRelPathSpecifier(specifier) {
+					return unsupported(stmt.body)
+				}
+			case dtsExportListFrom:
+				if isRelPathSpecifier(specifier) {
+					target := resolveRelPath(specifier)
+					for _, binding := range parseDtsBindings(list) {
+						binding.target = target
+						file.reExports = append(file.reExports, binding)
+					}
+					continue
+				}
+				if !isEntry {
+					return unsupported(stmt.body)
+				}
+			case dtsExportList:
+				for _, binding := range parseDtsBindings(list) {
+					file.localExports[binding.as] = binding.name
+				}
+				if !isEntry {
+					continue
+				}
+			case dtsExportSpecial:
+				if !isEntry {
+					return unsupported(stmt.body)
+				}
+				if toks.at(1) == "default" {
+					file.localExports["default"] = "default"
+				}
+			}
+		} else if decl, ok := toks.matchDeclaration(); ok {
+			for _, name := range decl.names {
+				if err = b.declare(name, dts); err != nil {
+					return
+				}
+				if decl.exported {
+					file.localExports[name] = name
+				}
+			}
+			if decl.exported && !isEntry {
+				// strip the `export` modifier of the inlined declaration, top-level declarations in `.d.ts`
+				// files must start with the `declare` modifier except interfaces and type aliases.
+				body := strings.TrimLeft(stmt.body[len("export"):], " \t\r\n")
+				if !decl.declared && decl.keyword != "interface" && decl.keyword != "type" {
+					body = "declare " + body
+				}
+				stmt.body = body
+			}
+		}
+		file.stmts = append(file.stmts, stmt)
+	}
+
+	for _, dep := range deps {
+		if err = b.load(dep); err != nil {
+			return
+		}
+	}
+	b.order = append(b.order, dts)
+	return
+}
+
+// declare checks the name conflicts of the top-level declarations across the inlined files
+func (b *dtsBundler) declare(name string, dts string) error {
+	if _, ok := b.imports[name]; ok {
+		return fmt.Errorf("duplicate identifier %q in %s", name, dts)
+	}
+	if file, ok := b.declared[name]; ok && file != dts {
+		return fmt.Errorf("duplicate identifier %q in %s and %s", name, file, dts)
+	}
+	b.declared[name] = dts
+	return nil
+}
+
+// addImport adds an import statement of other packages, returns false if an identical import statement exists
+func (b *dtsBundler) addImport(clause dtsTokens, stmt string) (bool, error) {
+	var names []string
+	for _, part := range clause.split(",") {
+		switch {
+		case part.at(0) == "{" && part.at(len(part)-1) == "}":
+			for _, binding := range parseDtsBindings(part[1 : len(part)-1]) {
+				names = append(names, binding.as)
+			}
+		case part.at(0) == "*":
+			if part.at(1) == "as" && isDtsIdent(part.at(2)) {
+				names = append(names, part[2])
+			}
+		case isDtsIdent(part.at(0)):
+			names = append(names, part[0])
+		}
+	}
+	added := false
+	for _, name := range names {
+		if s, ok := b.imports[name]; ok {
+			if s != stmt {
+				return false, fmt.Errorf("duplicate identifier %q: %s", name, stmt)
+			}
+			continue
+		}
+		if _, ok := b.declared[name]; ok {
+			return false, fmt.Errorf("duplicate identifier %q: %s", name, stmt)
+		}
+		b.imports[name] = stmt
+		added = true
+	}
+	return added || len(names) == 0, nil
+}
+
+// resolveExports returns the exports(export name -> local name) of the inlined file
+func (b *dtsBundler) resolveExports(dts string) (map[string]string, error) {
+	file := b.files[dts]
+	if file.exports != nil {
+		return file.exports, nil
+	}
+	if file.resolving {
+		return nil, fmt.Errorf("circular re-exports in %s", dts)
+	}
+	file.resolving = true
+	defer func() { file.resolving = false }()
+
+	exports := map[string]string{}
+	for name, local := range file.localExports {
+		exports[name] = local
+	}
+	for _, target := range file.reExportAll {
+		targetExports, err := b.resolveExports(target)
+		if err != nil {
+			return nil, err
+		}
+		for name, local := range targetExports {
+			// `export *` doesn't re-export the default export, and the local exports take precedence
+			if _, ok := exports[name]; !ok && name != "default" {
+				exports[name] = local
+			}
+		}
+	}
+	for _, binding := range file.reExports {
+		targetExports, err := b.resolveExports(binding.target)
+		if err != nil {
+			return nil, err
+		}
+		local, ok := targetExports[binding.name]
+		if !ok || local == "default" {
+			return nil, fmt.Errorf("%q is not exported by %s", binding.name, binding.target)
+		}
+		exports[binding.as] = local
+	}
+	file.exports = exports
+	return exports, nil
+}
+
+// bundle validates the imports of the inlined files and generates the bundled `.d.ts` file
+func (b *dtsBundler) bundle() (*bytes.Buffer, error) {
+	for _, dts := range b.order {
+		for _, binding := range b.files[dts].imports {
+			targetExports, err := b.resolveExports(binding.target)
+			if err != nil {
+				return nil, err
+			}
+			local, ok := targetExports[binding.name]
+			if !ok || local == "default" {
+				return nil, fmt.Errorf("%q is not exported by %s", binding.name, binding.target)
+			}
+			// the inlined declarations can't be renamed
+			if local != binding.as {
+				return nil, fmt.Errorf("unsupported import alias %q of %s in %s", binding.as, binding.target, dts)
+			}
+		}
+	}
+
+	entryExports, err := b.resolveExports(b.entry)
+	if err != nil {
+		return nil, err
+	}
+	var specifiers []string
+	for _, name := range slices.Sorted(maps.Keys(entryExports)) {
+		if _, ok := b.files[b.entry].localExports[name]; ok {
+			continue
+		}
+		if local := entryExports[name]; local != name {
+			specifiers = append(specifiers, local+" as "+name)
+		} else {
+			specifiers = append(specifiers, name)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, directive := range b.directives {
+		buf.WriteString(directive)
+		buf.WriteByte('\n')
+	}
+	for _, dts := range b.order {
+		for _, stmt := range b.files[dts].stmts {
+			buf.WriteString(strings.TrimLeft(stmt.lead, "\r\n"))
+			if stmt.body != "" {
+				buf.WriteString(stmt.body)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	if len(specifiers) > 0 {
+		fmt.Fprintf(buf, "export { %s };\n", strings.Join(specifiers, ", "))
+	}
+	return buf, nil
+}
+
+// parseDtsBindings parses the tokens of the import/export specifiers, e.g. `a, type b, c as d`
+func parseDtsBindings(toks dtsTokens) (bindings []dtsBinding) {
+	for _, part := range toks.split(",") {
+		if len(part) > 1 && part[0] == "type" {
+			part = part[1:]
+		}
+		if len(part) == 0 {
+			continue
+		}
+		binding := dtsBinding{name: part[0], as: part[0]}
+		if len(part) == 3 && part[1] == "as" {
+			binding.as = part[2]
+		}
+		bindings = append(bindings, binding)
+	}
+	return
+}
+
+// splitDtsStmts splits the `.d.ts` code into the leading triple-slash directives and the top-level statements
+// by the tokens of the declaration scanner, so brackets and semicolons in comments, strings and template literal
+// types don't split the statements.
+func splitDtsStmts(code string) (directives []string, stmts []dtsStmt) {
+	tokens := scanDtsTokens([]byte(code))
+	n := len(tokens)
+	i := 0
+	// the triple-slash directives are only valid at the top of the file
+	for k, tok := range tokens {
+		if tok.kind == dtsTokenSpace {
+			continue
+		}
+		text := code[tok.start:tok.end]
+		if tok.kind != dtsTokenComment || !tok.lineStart || !strings.HasPrefix(text, "///") {
+			break
+		}
+		line := strings.TrimSpace(text)
+		if strings.HasPrefix(line, "/// <") || regexpDtsReferenceTag.MatchString(line) {
+			directives = append(directives, line)
+		}
+		i = k + 1
+	}
+
+	for i < n {
+		start := i
+		bodyStart, last := -1, -1
+		depth := 0
+	Loop:
+		for ; i < n; i++ {
+			tok := tokens[i]
+			switch tok.kind {
+			case dtsTokenSpace:
+				if depth == 0 && last >= 0 && strings.IndexByte(code[tok.start:tok.end], '\n') >= 0 && isDtsStmtBoundary(code, tokens, last, i) {
+					break Loop
+				}
+				continue
+			case dtsTokenComment:
+				continue
+			}
+			if bodyStart < 0 {
+				bodyStart = i
+			}
+			last = i
+			if tok.kind == dtsTokenPunct {
+				switch code[tok.start] {
+				case '{', '(', '[':
+					depth++
+				case '}', ')', ']':
+					depth--
+				case ';':
+					if depth == 0 {
+						i++
+						break Loop
+					}
+				}
+			}
+		}
+		end := len(code)
+		if i < n {
+			end = tokens[i].start
+		}
+		if bodyStart < 0 {
+			stmts = append(stmts, dtsStmt{lead: code[tokens[start].start:end]})
+			continue
+		}
+		var toks dtsTokens
+		for _, tok := range tokens[bodyStart:i] {
+			if tok.kind != dtsTokenSpace && tok.kind != dtsTokenComment {
+				toks = append(toks, code[tok.start:tok.end])
+			}
+		}
+		stmts = append(stmts, dtsStmt{
+			lead:   code[tokens[start].start:tokens[bodyStart].start],
+			body:   strings.TrimRight(code[tokens[bodyStart].start:end], " \t\r\n"),
+			tokens: toks,
+		})
+	}
+	return
+}
+
+// isDtsStmtBoundary checks if the line break token ends the statement by looking at the last token of the
+// statement and the next significant token.
+func isDtsStmtBoundary(code string, tokens []dtsToken, last int, i int) bool {
+	// the statement expects more tokens
+	if tok := tokens[last]; tok.kind == dtsTokenPunct && strings.IndexByte("=|&,:?<.", code[tok.start]) >= 0 {
+		return false
+	}
+	next := nextDtsToken(tokens, i)
+	if next < 0 {
+		return true
+	}
+	word := code[tokens[next].start:tokens[next].end]
+	if tokens[next].kind != dtsTokenIdent || !dtsStmtKeywords[word] {
+		return false
+	}
+	// `import("...")` type expression
+	if word == "import" {
+		if k := nextDtsToken(tokens, next+1); k >= 0 && code[tokens[k].start:tokens[k].end] == "(" {
+			return false
+		}
+	}
+	return true
+}
+
+// nextDtsToken returns the index of the next significant token (not spaces or comments) from `i`, or -1.
+func nextDtsToken(tokens []dtsToken, i int) int {
+	for ; i < len(tokens); i++ {
+		if kind := tokens[i].kind; kind != dtsTokenSpace && kind != dtsTokenComment {
+			return i
+		}
+	}
+	return -1
+}
+
+// dtsTokens is the significant tokens of a top-level statement of a `.d.ts` file
+type dtsTokens []string
+
+type dtsExportForm uint8
+
+const (
+	dtsExportAllFrom  dtsExportForm = iota // export * from "..."
+	dtsExportNsFrom                        // export * as ns from "..."
+	dtsExportListFrom                      // export { a, b as c } from "..."
+	dtsExportList                          // export { a, b as c }
+	dtsExportSpecial                       // export =, export default, export as namespace, export import
+)
+
+// dtsDecl is a top-level declaration, e.g. `export declare function foo(): void`
+type dtsDecl struct {
+	exported bool
+	declared bool
+	keyword  string
+	names    []string
+}
+
+// at returns the token at `i`, or an empty string if `i` is out of range.
+func (toks dtsTokens) at(i int) string {
+	if i < 0 || i >= len(toks) {
+		return ""
+	}
+	return toks[i]
+}
+
+// str returns the value of the string literal token at `i`, or an empty string if the token is not a string literal.
+func (toks dtsTokens) str(i int) string {
+	s := toks.at(i)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return ""
+}
+
+// split splits the tokens by the separator that is not in brackets, it stops at the `;` of the top level.
+func (toks dtsTokens) split(sep string) (parts []dtsTokens) {
+	depth := 0
+	start := 0
+	for i, tok := range toks {
+		switch tok {
+		case "{", "(", "[", "<":
+			depth++
+		case "}", ")", "]":
+			depth--
+		case ">":
+			// skip the arrow of function types
+			if toks.at(i-1) != "=" {
+				depth--
+			}
+		case ";":
+			if depth == 0 {
+				return append(parts, toks[start:i])
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, toks[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(toks) {
+		parts = append(parts, toks[start:])
+	}
+	return
+}
+
+// hasRelImportCall checks if the statement has an `import("./...")` type or a `require("./...")` call.
+func (toks dtsTokens) hasRelImportCall() bool {
+	for i, tok := range toks {
+		if (tok == "import" || tok == "require") && toks.at(i-1) != "." && toks.at(i+1) == "(" && isRelPathSpecifier(toks.str(i+2)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchImportEquals matches `import A = ...` and `import type A = ...`, returns the name of the import.
+func (toks dtsTokens) matchImportEquals() (name string, ok bool) {
+	if toks.at(0) != "import" {
+		return
+	}
+	k := 1
+	if toks.at(1) == "type" && toks.at(2) != "=" {
+		k = 2
+	}
+	if isDtsIdent(toks.at(k)) && toks.at(k+1) == "=" {
+		return toks[k], true
+	}
+	return
+}
+
+// matchImportFrom matches `import ... from "..."`, returns the import clause without the `type` modifier and
+// the module specifier.
+func (toks dtsTokens) matchImportFrom() (clause dtsTokens, specifier string, ok bool) {
+	if toks.at(0) != "import" {
+		return
+	}
+	depth := 0
+	for i := 1; i < len(toks); i++ {
+		switch toks[i] {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		case "from":
+			if depth == 0 && i > 1 {
+				if specifier = toks.str(i + 1); specifier != "" {
+					clause = toks[1:i]
+					// import type { A } from "..."
+					if len(clause) > 1 && clause[0] == "type" && clause[1] != "," {
+						clause = clause[1:]
+					}
+					return clause, specifier, true
+				}
+			}
+		}
+	}
+	return
+}
+
+// matchExport matches the export statements that are not declarations, returns the form, the export specifiers
+// and the module specifier of the statement.
+func (toks dtsTokens) matchExport() (form dtsExportForm, list dtsTokens, specifier string, ok bool) {
+	if toks.at(0) != "export" {
+		return
+	}
+	switch toks.at(1) {
+	case "=", "default", "import":
+		return dtsExportSpecial, nil, "", true
+	case "as":
+		if toks.at(2) == "namespace" {
+			return dtsExportSpecial, nil, "", true
+		}
+		return
+	}
+	k := 1
+	if toks.at(1) == "type" && (toks.at(2) == "*" || toks.at(2) == "{") {
+		k = 2
+	}
+	switch toks.at(k) {
+	case "*":
+		if toks.at(k+1) == "from" {
+			if specifier = toks.str(k + 2); specifier != "" {
+				return dtsExportAllFrom, nil, specifier, true
+			}
+		} else if toks.at(k+1) == "as" && toks.at(k+3) == "from" {
+			if specifier = toks.str(k + 4); specifier != "" {
+				return dtsExportNsFrom, nil, specifier, true
+			}
+		}
+	case "{":
+		end := slices.Index(toks[k:], "}")
+		if end < 0 {
+			return
+		}
+		end += k
+		list = toks[k+1 : end]
+		if toks.at(end+1) == "from" {
+			if specifier = toks.str(end + 2); specifier != "" {
+				return dtsExportListFrom, list, specifier, true
+			}
+		} else if end+1 == len(toks) || (toks[end+1] == ";" && end+2 == len(toks)) {
+			return dtsExportList, list, "", true
+		}
+	}
+	return
+}
+
+// matchDeclaration matches the top-level declarations, e.g. `export declare const a: string, b: number`.
+func (toks dtsTokens) matchDeclaration() (decl dtsDecl, ok bool) {
+	k := 0
+	if toks.at(k) == "export" {
+		decl.exported = true
+		k++
+	}
+	if toks.at(k) == "declare" {
+		decl.declared = true
+		k++
+	}
+	if toks.at(k) == "abstract" {
+		k++
+	}
+	if toks.at(k) == "async" {
+		k++
+	}
+	decl.keyword = toks.at(k)
+	switch decl.keyword {
+	case "function":
+		k++
+		if toks.at(k) == "*" {
+			k++
+		}
+	case "const":
+		k++
+		if toks.at(k) == "enum" {
+			decl.keyword = "const enum"
+			k++
+		} else {
+			for _, declarator := range toks[k:].split(",") {
+				if isDtsIdent(declarator.at(0)) {
+					decl.names = append(decl.names, declarator[0])
+				}
+			}
+			return decl, true
+		}
+	case "let", "var":
+		for _, declarator := range toks[k+1:].split(",") {
+			if isDtsIdent(declarator.at(0)) {
+				decl.names = append(decl.names, declarator[0])
+			}
+		}
+		return decl, true
+	case "class", "interface", "type", "enum", "namespace", "module":
+		k++
+	case "global":
+		return decl, true
+	default:
+		return decl, false
+	}
+	if isDtsIdent(toks.at(k)) {
+		decl.names = append(decl.names, toks[k])
+	}
+	return decl, true
+}
+
+// isDtsIdent checks if the token is an identifier
+func isDtsIdent(tok string) bool {
+	return tok != "" && isDtsIdentByte(tok[0]) && (tok[0] < '0' || tok[0] > '9')
+}
+
+// getDtsBundlePath returns the path of the bundled `.d.ts` file by adding the `DtsBundle` flag to
+// the build args of the given dts path, e.g. "/pkg@1.0.0/index.d.ts" -> "/pkg@1.0.0/X-Yg/index.d.ts".
+func getDtsBundlePath(dts string) string {
+	segments := strings.Split(strings.TrimPrefix(dts, "/"), "/")
+	for i, seg := range segments {
+		// the package segment with version, e.g. "react@19.0.0"
+		if strings.IndexByte(seg, '@') <= 0 {
+			continue
+		}
+		if i+1 >= len(segments) {
+			break
+		}
+		var args BuildArgs
+		if xArgs := segments[i+1]; strings.HasPrefix(xArgs, "X-") {
+			a, err := decodeBuildArgs(xArgs)
+			if err != nil {
+				return dts
+			}
+			args = a
+			segments = slices.Delete(segments, i+1, i+2)
+		}
+		args.DtsBundle = true
+		segments = slices.Insert(segments, i+1, "X-"+encodeBuildArgs(args, true))
+		return "/" + strings.Join(segments, "/")
+	}
+	return dts
+}
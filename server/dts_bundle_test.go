@@ -0,0 +1,231 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/esm-dev/esm.sh/internal/storage"
+	"github.com/ije/gox/log"
+)
+
+func TestBundleDTS(t *testing.T) {
+	root := t.TempDir()
+	wd := filepath.Join(root, "wd")
+	pkgName := "dts-pkg"
+	pkgDir := filepath.Join(wd, "node_modules", pkgName)
+	if err := os.MkdirAll(filepath.Join(pkgDir, "types", "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"types/index.d.ts": strings.Join([]string{
+			`/// <reference lib="dom" />`,
+			`import type { Options } from "./options";`,
+			`export * from "./lib/utils";`,
+			`export { Level as LogLevel } from "./options";`,
+			`/** create a client */`,
+			`export declare function create(options: Options): Client;`,
+			`export interface Client {`,
+			`  run(): void`,
+			`}`,
+		}, "\n"),
+		"types/options.d.ts": strings.Join([]string{
+			`export interface Options {`,
+			`  level: Level;`,
+			`  format?: (s: string) => string`,
+			`}`,
+			`export type Level =`,
+			`  | "debug"`,
+			`  | "info"`,
+			`export {};`,
+		}, "\n"),
+		"types/lib/utils.d.ts": strings.Join([]string{
+			`import { Level } from "../options";`,
+			`declare const VERSION: string, DEBUG: boolean;`,
+			`export function format(s: string, level?: Level): string;`,
+			`export { VERSION };`,
+		}, "\n"),
+		"types/broken.d.ts": strings.Join([]string{
+			`import * as options from "./options";`,
+			`export declare function create(options: options.Options): void;`,
+		}, "\n"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pkgDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := storage.NewFSStorage(filepath.Join(root, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFile := func(name string) string {
+		f, _, err := fs.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	logger, _ := log.New("")
+	ctx := &BuildContext{
+		logger:  logger,
+		storage: fs,
+		wd:      wd,
+		args:    BuildArgs{DtsBundle: true},
+		esmPath: EsmPath{PkgName: pkgName, PkgVersion: "1.0.0"},
+		pkgJson: &npm.PackageJSON{Name: pkgName, Version: "1.0.0", Types: "./types/index.d.ts"},
+		target:  "types",
+	}
+	prefix := ctx.getBuildArgsPrefix(true)
+	if prefix != "X-Yg/" {
+		t.Fatalf("unexpected build args prefix: %s", prefix)
+	}
+	if err := ctx.transformDTS("./types/index.d.ts"); err != nil {
+		t.Fatal(err)
+	}
+	dts := readFile(normalizeSavePath("types/dts-pkg@1.0.0/" + prefix + "types/index.d.ts"))
+	if strings.Contains(dts, `from "./`) || strings.Contains(dts, `from "../`) {
+		t.Fatalf("relative imports should be inlined: %s", dts)
+	}
+	if !strings.HasPrefix(dts, `/// <reference lib="dom" />`) {
+		t.Fatalf("triple-slash directives should be kept at the top: %s", dts)
+	}
+	for _, s := range []string{
+		"export interface Client {",
+		"/** create a client */\nexport declare function create(options: Options): Client;",
+		"interface Options {",
+		"type Level =\n  | \"debug\"\n  | \"info\"",
+		"declare const VERSION: string, DEBUG: boolean;",
+		"declare function format(s: string, level?: Level): string;",
+		"export { Level as LogLevel, VERSION, format };",
+	} {
+		if !strings.Contains(dts, s) {
+			t.Fatalf("missing %q in bundled dts: %s", s, dts)
+		}
+	}
+	if strings.Contains(dts, "export interface Options") || strings.Contains(dts, "export {};") {
+		t.Fatalf("inlined declarations should not be exported: %s", dts)
+	}
+	if strings.Count(dts, "export {") != 1 {
+		t.Fatalf("unexpected exports: %s", dts)
+	}
+
+	// fall back to the per-file mode
+	if err := ctx.transformDTS("./types/broken.d.ts"); err != nil {
+		t.Fatal(err)
+	}
+	if dts := readFile(normalizeSavePath("types/dts-pkg@1.0.0/" + prefix + "types/broken.d.ts")); !strings.Contains(dts, `from "./options.d.ts"`) {
+		t.Fatalf("should fall back to the per-file mode: %s", dts)
+	}
+	if dts := readFile(normalizeSavePath("types/dts-pkg@1.0.0/" + prefix + "types/options.d.ts")); !strings.Contains(dts, "export interface Options") {
+		t.Fatalf("should fall back to the per-file mode: %s", dts)
+	}
+}
+
+func TestGetDtsBundlePath(t *testing.T) {
+	testCases := map[string]string{
+		"/react@19.0.0/index.d.ts":                     "/react@19.0.0/X-Yg/index.d.ts",
+		"/@types/react@~19.0.0/index.d.ts":             "/@types/react@~19.0.0/X-Yg/index.d.ts",
+		"/gh/owner/repo@abcdef/types/index.d.ts":       "/gh/owner/repo@abcdef/X-Yg/types/index.d.ts",
+		"/preact@10.0.0/X-" + btoaUrl("ereact") + "/x": "/preact@10.0.0/X-" + btoaUrl("ereact\nb") + "/x",
+	}
+	for dts, expected := range testCases {
+		if ret := getDtsBundlePath(dts); ret != expected {
+			t.Fatalf("getDtsBundlePath(%q): expected %q, got %q", dts, expected, ret)
+		}
+	}
+}
+
+func TestSplitDtsStmts(t *testing.T) {
+	code := strings.Join([]string{
+		`/// <reference types="node" />`,
+		`// a comment with a semicolon; and a brace {`,
+		"export type Path = `/${string};{`;",
+		`/* } */ export declare const SEP: "};";`,
+		`export interface A {`,
+		`  // export interface B {`,
+		`  b: string`,
+		`}`,
+		`export type C =`,
+		`  // import "x"`,
+		`  | "c"`,
+		`export declare function f(): typeof import("./a")`,
+	}, "\n")
+	directives, stmts := splitDtsStmts(code)
+	if len(directives) != 1 || directives[0] != `/// <reference types="node" />` {
+		t.Fatalf("unexpected directives: %v", directives)
+	}
+	expected := []string{
+		"export type Path = `/${string};{`;",
+		`export declare const SEP: "};";`,
+		"export interface A {\n  // export interface B {\n  b: string\n}",
+		"export type C =\n  // import \"x\"\n  | \"c\"",
+		`export declare function f(): typeof import("./a")`,
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("expected %d statements, got %d: %+v", len(expected), len(stmts), stmts)
+	}
+	for i, stmt := range stmts {
+		if stmt.body != expected[i] {
+			t.Fatalf("unexpected statement %d: %q", i, stmt.body)
+		}
+	}
+	if stmts[1].lead != "\n/* } */ " || strings.Join(stmts[1].tokens, " ") != `export declare const SEP : "};" ;` {
+		t.Fatalf("unexpected statement: %+v", stmts[1])
+	}
+	if strings.Join(stmts[3].tokens, " ") != `export type C = | "c"` {
+		t.Fatalf("comments should be skipped: %q", stmts[3].tokens)
+	}
+}
+
+func TestDtsTokens(t *testing.T) {
+	tokens := func(code string) dtsTokens {
+		_, stmts := splitDtsStmts(code)
+		if len(stmts) != 1 {
+			t.Fatalf("expected one statement: %q", code)
+		}
+		return stmts[0].tokens
+	}
+
+	if clause, specifier, ok := tokens(`import type { a, b as c } from "./from";`).matchImportFrom(); !ok || specifier != "./from" || strings.Join(clause, " ") != "{ a , b as c }" {
+		t.Fatalf("unexpected import: %v %q %v", clause, specifier, ok)
+	}
+	if name, ok := tokens(`import type Foo = require("foo")`).matchImportEquals(); !ok || name != "Foo" {
+		t.Fatalf("unexpected import equals: %q %v", name, ok)
+	}
+	if !tokens(`export declare function f(): typeof import("./a")`).hasRelImportCall() {
+		t.Fatal("expected a relative import call")
+	}
+	if tokens("export declare const f: `import(\"./a\")`").hasRelImportCall() {
+		t.Fatal("template literal types should not be import calls")
+	}
+	for code, expected := range map[string]dtsExportForm{
+		`export type * from "./a";`:      dtsExportAllFrom,
+		`export * as ns from "./a"`:      dtsExportNsFrom,
+		`export { a as "}" } from "./a"`: dtsExportListFrom,
+		`export { a, type b };`:          dtsExportList,
+		`export as namespace Foo;`:       dtsExportSpecial,
+	} {
+		if form, _, _, ok := tokens(code).matchExport(); !ok || form != expected {
+			t.Fatalf("unexpected export form of %q: %v %v", code, form, ok)
+		}
+	}
+	decl, ok := tokens(`export declare const a: { b: string, c: number }, d: (x: number) => void, e: Map<string, number>;`).matchDeclaration()
+	if !ok || !decl.exported || !decl.declared || decl.keyword != "const" || strings.Join(decl.names, ",") != "a,d,e" {
+		t.Fatalf("unexpected declaration: %+v", decl)
+	}
+	decl, ok = tokens(`declare const enum Kind { A = ";" }`).matchDeclaration()
+	if !ok || decl.exported || decl.keyword != "const enum" || strings.Join(decl.names, ",") != "Kind" {
+		t.Fatalf("unexpected declaration: %+v", decl)
+	}
+}
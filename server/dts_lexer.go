@@ -1,31 +1,13 @@
 package server
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"regexp"
 )
 
-var (
-	regexpImportDecl        = regexp.MustCompile(`^import(\s+type)?\s*('|"|[\w\$]+|\*|\{)`)
-	regexpExportDecl        = regexp.MustCompile(`^export(\s+type)?\s*(\*|\{)`)
-	regexpFromExpr          = regexp.MustCompile(`(\}|\*|\s)from\s*['"]`)
-	regexpImportPathDecl    = regexp.MustCompile(`^import\s*['"]`)
-	regexpImportCallExpr    = regexp.MustCompile(`(import|require)\(['"][^'"]+['"]\)`)
-	regexpDeclareModuleStmt = regexp.MustCompile(`^declare\s+module\s*['"].+?['"]`)
-	regexpTSReferenceTag    = regexp.MustCompile(`^\s*<reference\s+(path|types)\s*=\s*['"](.+?)['"].+>`)
-)
-
-var (
-	bytesSingleQoute  = []byte{'\''}
-	bytesDoubleQoute  = []byte{'"'}
-	bytesCommentStart = []byte{'/', '*'}
-	bytesCommentEnd   = []byte{'*', '/'}
-	bytesDoubleSlash  = []byte{'/', '/'}
-	bytesStripleSlash = []byte{'/', '/', '/'}
-)
+var regexpTSReferenceTag = regexp.MustCompile(`^\s*<reference\s+(path|types)\s*=\s*['"](.+?)['"].+>`)
 
 type TsImportKind uint8
 
@@ -37,236 +19,301 @@ const (
 	TsDeclareModule
 )
 
-// a simple dts lexer for resolving import path
+type dtsTokenKind uint8
+
+const (
+	dtsTokenSpace dtsTokenKind = iota
+	dtsTokenComment
+	dtsTokenIdent
+	dtsTokenString
+	dtsTokenTemplate
+	dtsTokenPunct
+)
+
+// dtsToken is a token of the TypeScript declaration source
+type dtsToken struct {
+	kind  dtsTokenKind
+	start int
+	end   int
+	// the template literal has no substitutions, e.g. `foo`
+	noSubst bool
+	// the comment is at the beginning of a line
+	lineStart bool
+}
+
+// parseDts parses the TypeScript declaration source and resolves the module specifiers of
+//   - `/// <reference path="..." />` and `/// <reference types="..." />` directives
+//   - import/export declarations, e.g. `import type { A } from "..."`, `export * as ns from "..."`
+//   - `import("...")` types and `require("...")` calls, e.g. `import A = require("...")`
+//   - `declare module "..."` augmentations
 func parseDts(r io.Reader, w *bytes.Buffer, resolve func(specifier string, kind TsImportKind, position int) (resovledPath string, err error)) (err error) {
-	var multiLineComment bool
-	var importOrExportDeclFound bool
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(nil, 1024*1024)
-	for scanner.Scan() {
-		line, trimedSpaces := trimSpace(scanner.Bytes())
-		w.Write(trimedSpaces)
-	CheckCommentScope:
-		if !multiLineComment && bytes.HasPrefix(line, bytesCommentStart) {
-			multiLineComment = true
-		}
-		if multiLineComment {
-			endIndex := bytes.Index(line, bytesCommentEnd)
-			if endIndex > -1 {
-				multiLineComment = false
-				w.Write(line[:endIndex+2])
-				if rest := line[endIndex+2:]; len(rest) > 0 {
-					line, trimedSpaces = trimSpace(rest)
-					w.Write(trimedSpaces)
-					goto CheckCommentScope
-				}
-			} else {
-				w.Write(line)
-			}
-		} else if after, ok := bytes.CutPrefix(line, bytesStripleSlash); ok {
-			rest := after
-			if regexpTSReferenceTag.Match(rest) {
-				a := regexpTSReferenceTag.FindAllSubmatch(rest, 1)
-				format := string(a[0][1])
-				path := string(a[0][2])
-				if format == "path" || format == "types" {
-					if format == "path" {
-						if !isRelPathSpecifier(path) {
-							path = "./" + path
-						}
-					}
-					kind := TsReferenceTypes
-					if format == "path" {
-						kind = TsReferencePath
-					}
-					var res string
-					res, err = resolve(path, kind, w.Len())
-					if err != nil {
-						return
-					}
-					if len(res) > 0 {
-						fmt.Fprintf(w, `/// <reference %s="%s" />`, format, res)
-					} else {
-						fmt.Fprintf(w, `// ignored <reference %s="%s" />`, format, path)
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	tokens := scanDtsTokens(src)
+	specifiers := analyzeDtsTokens(src, tokens)
+	for i, tok := range tokens {
+		text := src[tok.start:tok.end]
+		if tok.kind == dtsTokenComment && tok.lineStart && bytes.HasPrefix(text, []byte("///")) {
+			if m := regexpTSReferenceTag.FindSubmatch(text[3:]); m != nil {
+				format := string(m[1])
+				path := string(m[2])
+				kind := TsReferenceTypes
+				if format == "path" {
+					kind = TsReferencePath
+					if !isRelPathSpecifier(path) {
+						path = "./" + path
 					}
-				} else {
-					w.Write(line)
 				}
-			} else {
-				w.Write(line)
-			}
-		} else if bytes.HasPrefix(line, bytesDoubleSlash) {
-			w.Write(line)
-		} else {
-			var i int
-			stmtScanner := bufio.NewScanner(bytes.NewReader(line))
-			stmtScanner.Buffer(nil, 1024*1024)
-			stmtScanner.Split(splitJSStmt)
-			for stmtScanner.Scan() {
-				if i > 0 {
-					w.WriteByte(';')
+				var res string
+				res, err = resolve(path, kind, w.Len())
+				if err != nil {
+					return
 				}
-				stmt, trimedLeftSpaces := trimSpace(stmtScanner.Bytes())
-				w.Write(trimedLeftSpaces)
-				if len(stmt) > 0 {
-					if regexpImportCallExpr.Match(stmt) {
-						stmt = regexpImportCallExpr.ReplaceAllFunc(stmt, func(importCallExpr []byte) []byte {
-							q := bytesSingleQoute
-							a := bytes.Split(importCallExpr, q)
-							if len(a) != 3 {
-								q = bytesDoubleQoute
-								a = bytes.Split(importCallExpr, q)
-							}
-							if len(a) == 3 {
-								tmp := &bytes.Buffer{}
-								tmp.Write(a[0])
-								tmp.Write(q)
-								var res string
-								res, err = resolve(string(a[1]), TsImportCall, w.Len())
-								if err != nil {
-									return importCallExpr
-								}
-								tmp.WriteString(res)
-								tmp.Write(q)
-								tmp.Write(a[2])
-								return tmp.Bytes()
-							}
-							return importCallExpr
-						})
-					}
-
-					if !importOrExportDeclFound && (bytes.HasPrefix(stmt, []byte("import")) && regexpImportDecl.Match(stmt)) || (bytes.HasPrefix(stmt, []byte("export")) && regexpExportDecl.Match(stmt)) {
-						importOrExportDeclFound = true
-					}
-					if bytes.HasPrefix(stmt, []byte("declare")) && regexpDeclareModuleStmt.Match(stmt) {
-						q := bytesSingleQoute
-						a := bytes.Split(stmt, q)
-						if len(a) != 3 {
-							q = bytesDoubleQoute
-							a = bytes.Split(stmt, q)
-						}
-						if len(a) == 3 {
-							w.Write(a[0])
-							w.Write(q)
-							var res string
-							res, err = resolve(string(a[1]), TsDeclareModule, w.Len())
-							if err != nil {
-								return
-							}
-							w.WriteString(res)
-							w.Write(q)
-							w.Write(a[2])
-						} else {
-							w.Write(stmt)
-						}
-					} else if importOrExportDeclFound {
-						if regexpFromExpr.Match(stmt) || (bytes.HasPrefix(stmt, []byte("import")) && regexpImportPathDecl.Match(stmt)) {
-							q := bytesSingleQoute
-							a := bytes.Split(stmt, q)
-							if len(a) != 3 {
-								q = bytesDoubleQoute
-								a = bytes.Split(stmt, q)
-							}
-							if len(a) == 3 {
-								w.Write(a[0])
-								w.Write(q)
-								var res string
-								res, err = resolve(string(a[1]), TsImportDecl, w.Len())
-								if err != nil {
-									return
-								}
-								w.WriteString(res)
-								w.Write(q)
-								w.Write(a[2])
-							} else {
-								w.Write(stmt)
-							}
-							importOrExportDeclFound = false
-						} else {
-							w.Write(stmt)
-						}
-					} else {
-						w.Write(stmt)
-					}
+				if len(res) > 0 {
+					fmt.Fprintf(w, `/// <reference %s="%s" />`, format, res)
+				} else {
+					fmt.Fprintf(w, `// ignored <reference %s="%s" />`, format, path)
 				}
-				i++
+				continue
 			}
-			err = stmtScanner.Err()
+		}
+		if kind, ok := specifiers[i]; ok {
+			w.WriteByte(text[0])
+			var res string
+			res, err = resolve(string(text[1:len(text)-1]), kind, w.Len())
 			if err != nil {
 				return
 			}
+			w.WriteString(res)
+			w.WriteByte(text[len(text)-1])
+			continue
 		}
-		w.WriteByte('\n')
+		w.Write(text)
 	}
-	err = scanner.Err()
 	return
 }
 
-// A split function for bufio.Scanner to split javascript statement
-func splitJSStmt(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	var commentScope bool
-	var stringScope byte
-	for i := range data {
-		var prev, next byte
-		if i > 0 {
-			prev = data[i-1]
+// analyzeDtsTokens finds the module specifier tokens, returns a map of token index to import kind.
+func analyzeDtsTokens(src []byte, tokens []dtsToken) map[int]TsImportKind {
+	// the indexes of the significant tokens (not spaces or comments)
+	sig := make([]int, 0, len(tokens)/2)
+	for i, tok := range tokens {
+		if tok.kind != dtsTokenSpace && tok.kind != dtsTokenComment {
+			sig = append(sig, i)
 		}
-		if i+1 < len(data) {
-			next = data[i+1]
+	}
+	text := func(k int) string {
+		if k < 0 || k >= len(sig) {
+			return ""
 		}
-		c := data[i]
-		switch c {
-		case '/':
-			if stringScope == 0 {
-				if commentScope {
-					if prev == '*' {
-						commentScope = false
-					}
-				} else if next == '*' {
-					commentScope = true
+		tok := tokens[sig[k]]
+		return string(src[tok.start:tok.end])
+	}
+	isSpecifier := func(k int) bool {
+		if k < 0 || k >= len(sig) {
+			return false
+		}
+		tok := tokens[sig[k]]
+		// a terminated string literal or a template literal without substitutions
+		return (tok.kind == dtsTokenString || (tok.kind == dtsTokenTemplate && tok.noSubst)) && tok.end-tok.start >= 2 && src[tok.start] == src[tok.end-1]
+	}
+
+	specifiers := map[int]TsImportKind{}
+	expectFrom := false
+	for k, i := range sig {
+		tok := tokens[i]
+		if tok.kind == dtsTokenPunct {
+			switch src[tok.start] {
+			case ';', '=', '(':
+				expectFrom = false
+			case '}':
+				if text(k+1) != "from" {
+					expectFrom = false
 				}
 			}
-		case '\'', '"', '`':
-			if !commentScope {
-				if stringScope == 0 {
-					stringScope = c
-				} else if stringScope == c && prev != '\\' {
-					stringScope = 0
+			continue
+		}
+		if tok.kind != dtsTokenIdent || text(k-1) == "." {
+			continue
+		}
+		switch text(k) {
+		case "import":
+			switch next := text(k + 1); {
+			case next == "(":
+				// import("...") type
+				if isSpecifier(k + 2) {
+					specifiers[sig[k+2]] = TsImportCall
+				}
+			case next == ".":
+				// import.meta
+			case isSpecifier(k + 1):
+				// import "..."
+				if tokens[sig[k+1]].kind == dtsTokenString {
+					specifiers[sig[k+1]] = TsImportDecl
 				}
+			default:
+				expectFrom = true
+			}
+		case "export":
+			next := text(k + 1)
+			if next == "type" {
+				next = text(k + 2)
+			}
+			if next == "{" || next == "*" {
+				expectFrom = true
 			}
-		case ';':
-			if stringScope == 0 && !commentScope {
-				return i + 1, data[:i], nil
+		case "from":
+			if expectFrom && isSpecifier(k+1) && tokens[sig[k+1]].kind == dtsTokenString {
+				specifiers[sig[k+1]] = TsImportDecl
+				expectFrom = false
+			}
+		case "require":
+			if text(k+1) == "(" && isSpecifier(k+2) {
+				specifiers[sig[k+2]] = TsImportCall
+			}
+		case "declare":
+			if text(k+1) == "module" && isSpecifier(k+2) {
+				specifiers[sig[k+2]] = TsDeclareModule
 			}
 		}
 	}
-	if !atEOF {
-		return 0, nil, nil
+	return specifiers
+}
+
+// scanDtsTokens splits the TypeScript declaration source into tokens.
+func scanDtsTokens(src []byte) []dtsToken {
+	s := &dtsScanner{src: src, lineStart: true}
+	s.scan(false)
+	return s.tokens
+}
+
+type dtsScanner struct {
+	src       []byte
+	i         int
+	tokens    []dtsToken
+	lineStart bool
+}
+
+func (s *dtsScanner) emit(kind dtsTokenKind, start int) {
+	end := min(s.i, len(s.src))
+	s.tokens = append(s.tokens, dtsToken{kind: kind, start: start, end: end, lineStart: s.lineStart})
+	s.i = end
+}
+
+// scan scans the tokens until the end of the source, or the `}` that closes the template substitution.
+func (s *dtsScanner) scan(inSubst bool) {
+	src := s.src
+	n := len(src)
+	depth := 0
+	for s.i < n {
+		c := src[s.i]
+		start := s.i
+		switch {
+		case isDtsSpaceByte(c):
+			for s.i < n && isDtsSpaceByte(src[s.i]) {
+				if src[s.i] == '\n' {
+					s.lineStart = true
+				}
+				s.i++
+			}
+			s.tokens = append(s.tokens, dtsToken{kind: dtsTokenSpace, start: start, end: s.i})
+			continue
+		case c == '/' && s.i+1 < n && src[s.i+1] == '/':
+			if end := bytes.IndexByte(src[s.i:], '\n'); end < 0 {
+				s.i = n
+			} else {
+				s.i += end
+			}
+			s.emit(dtsTokenComment, start)
+		case c == '/' && s.i+1 < n && src[s.i+1] == '*':
+			if end := bytes.Index(src[s.i+2:], []byte("*/")); end < 0 {
+				s.i = n
+			} else {
+				s.i += end + 4
+			}
+			s.emit(dtsTokenComment, start)
+		case c == '\'' || c == '"':
+			s.scanString()
+			s.emit(dtsTokenString, start)
+		case c == '`':
+			s.scanTemplate()
+		case isDtsIdentByte(c):
+			for s.i < n && isDtsIdentByte(src[s.i]) {
+				s.i++
+			}
+			s.emit(dtsTokenIdent, start)
+		default:
+			if c == '{' {
+				depth++
+			} else if c == '}' {
+				if inSubst && depth == 0 {
+					return
+				}
+				depth--
+			}
+			s.i++
+			s.emit(dtsTokenPunct, start)
+		}
+		s.lineStart = false
 	}
-	// There is one final token to be delivered, which may be the empty string.
-	// Returning bufio.ErrFinalToken here tells Scan there are no more tokens after this
-	// but does not trigger an error to be returned from Scan itself.
-	return 0, data, bufio.ErrFinalToken
 }
 
-// trimSpace trims leading and trailing spaces, tabs, newlines and carriage returns
-func trimSpace(line []byte) ([]byte, []byte) {
-	s := 0
-	l := len(line)
-	for i := range l {
-		c := line[i]
-		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
-			break
+// scanString moves to the end of the string literal, an unterminated string literal ends at the line break.
+func (s *dtsScanner) scanString() {
+	src := s.src
+	n := len(src)
+	q := src[s.i]
+	for s.i++; s.i < n; s.i++ {
+		switch src[s.i] {
+		case '\\':
+			s.i++
+		case '\n':
+			return
+		case q:
+			s.i++
+			return
 		}
-		s++
 	}
-	e := l
-	for i := l - 1; i >= s; i-- {
-		c := line[i]
-		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
-			break
+}
+
+// scanTemplate scans the template literal, the substitutions (`${...}`) of the template literal are scanned as tokens.
+func (s *dtsScanner) scanTemplate() {
+	src := s.src
+	n := len(src)
+	start := s.i
+	hasSubst := false
+	for s.i++; s.i < n; s.i++ {
+		switch src[s.i] {
+		case '\\':
+			s.i++
+		case '`':
+			s.i++
+			s.emit(dtsTokenTemplate, start)
+			s.tokens[len(s.tokens)-1].noSubst = !hasSubst
+			return
+		case '$':
+			if s.i+1 < n && src[s.i+1] == '{' {
+				hasSubst = true
+				s.i += 2
+				s.emit(dtsTokenTemplate, start)
+				s.scan(true)
+				if s.i >= n {
+					return
+				}
+				// the template continues with the `}`
+				start = s.i
+			}
 		}
-		e--
 	}
-	return line[s:e], line[:s]
+	s.emit(dtsTokenTemplate, start)
+}
+
+func isDtsSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDtsIdentByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
 }
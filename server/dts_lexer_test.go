@@ -3,9 +3,35 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
+// the seed corpus of the dts parser, derived from the `TestDtsWalker` and `TestParseDts` cases
+var dtsCorpus = []string{
+	`/// <reference path="global.d.ts" />`,
+	`/// <reference types="node" />` + "\n" + `/// <reference lib="dom" />`,
+	`import * as hooks from "./hooks";`,
+	`import type { Interaction as SchedulerInteraction } /* inline comment */ from "scheduler/tracing";`,
+	`import DefaultExport, { AndNamed } from "scheduler/tracing";`,
+	"import {\n  client,\n  server\n} from \"react-dom\"\nexport {\n  client,\n  server\n} from \"react-dom\"",
+	"import type {\n  A,\n  B,\n} from 'multi-line'",
+	`export * from "react"; export = React;`,
+	`export type * from "a"; export * as ns from "b"; export type { T } from "c";`,
+	`import React = import('react'); import React = require("react");`,
+	`import ReactDOM = { client: import('react-dom/client'), server: import('react-dom/server') }`,
+	"export = require(\"cjs\");",
+	"type A = typeof import(`template`);",
+	"type B = import ( \"spaced\" ).B<`${string}-${import(\"nested\").C}`>;",
+	`declare module "vue" { interface ComponentCustomProperties { $t: Function } }`,
+	`import { from } from "from"; export { from };`,
+	`import json from "./data.json" with { type: "json" };`,
+	`declare const s: "import('x')"; // import("y")`,
+	"/* unterminated comment",
+	"import 'unterminated",
+	"`unterminated ${ template",
+}
+
 func TestDtsWalker(t *testing.T) {
 	const rawDts = `
 /*
@@ -94,3 +120,112 @@ import ReactDOM = { client: import('https://esm.sh/react-dom@1.0.0/client.d.ts')
 		t.Fatal("transformed dts not match, want:", expectedDts, "got:", buf.String())
 	}
 }
+
+func TestParseDts(t *testing.T) {
+	const rawDts = `import type {
+  A,
+  B,
+} from 'multi-line'
+export type * from "a"; export * as ns from "b";
+export = require("cjs");
+type C = typeof import(` + "`template`" + `);
+type D = import ( "spaced" ).D;
+type E = ` + "`${import(\"nested\").E}-${string}`" + `;
+declare module "vue" { interface ComponentCustomProperties { $t: Function } }
+import { from } from "from"; export { from };
+import json from "./data.json" with { type: "json" };
+declare const s: "import('x')"; // import("y")
+`
+	const expectedDts = `import type {
+  A,
+  B,
+} from 'https://esm.sh/multi-line.d.ts'
+export type * from "https://esm.sh/a.d.ts"; export * as ns from "https://esm.sh/b.d.ts";
+export = require("https://esm.sh/cjs.d.ts");
+type C = typeof import(` + "`https://esm.sh/template.d.ts`" + `);
+type D = import ( "https://esm.sh/spaced.d.ts" ).D;
+type E = ` + "`${import(\"https://esm.sh/nested.d.ts\").E}-${string}`" + `;
+declare module "https://esm.sh/vue.d.ts" { interface ComponentCustomProperties { $t: Function } }
+import { from } from "https://esm.sh/from.d.ts"; export { from };
+import json from "./data.json.d.ts" with { type: "json" };
+declare const s: "import('x')"; // import("y")
+`
+
+	kinds := map[string]TsImportKind{}
+	buf := bytes.NewBuffer(nil)
+	err := parseDts(strings.NewReader(rawDts), buf, func(specifier string, kind TsImportKind, position int) (string, error) {
+		kinds[specifier] = kind
+		if isRelPathSpecifier(specifier) {
+			return specifier + ".d.ts", nil
+		}
+		return "https://esm.sh/" + specifier + ".d.ts", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expectedDts {
+		t.Fatal("transformed dts not match, want:", expectedDts, "got:", buf.String())
+	}
+	expectedKinds := map[string]TsImportKind{
+		"multi-line":  TsImportDecl,
+		"a":           TsImportDecl,
+		"b":           TsImportDecl,
+		"cjs":         TsImportCall,
+		"template":    TsImportCall,
+		"spaced":      TsImportCall,
+		"nested":      TsImportCall,
+		"vue":         TsDeclareModule,
+		"from":        TsImportDecl,
+		"./data.json": TsImportDecl,
+	}
+	if len(kinds) != len(expectedKinds) {
+		t.Fatalf("unexpected specifiers: %v", kinds)
+	}
+	for specifier, kind := range expectedKinds {
+		if k, ok := kinds[specifier]; !ok || k != kind {
+			t.Fatalf("unexpected kind of %q: %v", specifier, k)
+		}
+	}
+}
+
+func FuzzParseDts(f *testing.F) {
+	for _, dts := range dtsCorpus {
+		f.Add(dts)
+	}
+	f.Fuzz(func(t *testing.T, dts string) {
+		identity := func(specifier string, kind TsImportKind, position int) (string, error) {
+			return specifier, nil
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := parseDts(strings.NewReader(dts), buf, identity); err != nil {
+			t.Fatal(err)
+		}
+		// the output is stable with the identity resolver
+		out := buf.String()
+		buf.Reset()
+		if err := parseDts(strings.NewReader(out), buf, identity); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != out {
+			t.Fatalf("unstable output of %q: %q != %q", dts, buf.String(), out)
+		}
+		// the code without reference directives is not changed
+		if !strings.Contains(dts, "///") && out != dts {
+			t.Fatalf("unexpected output of %q: %q", dts, out)
+		}
+		// the resolved specifiers are in the source
+		buf.Reset()
+		err := parseDts(strings.NewReader(dts), buf, func(specifier string, kind TsImportKind, position int) (string, error) {
+			if kind != TsReferencePath && !strings.Contains(dts, specifier) {
+				t.Fatalf("specifier %q is not in the source %q", specifier, dts)
+			}
+			if position > buf.Len() {
+				t.Fatalf("invalid position %d of %q", position, specifier)
+			}
+			return "x", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/esm-dev/esm.sh/internal/npm"
+)
+
+// the TypeScript version that is used to select the `typesVersions` mapping and
+// the `types@<range>` export conditions of a package
+const typescriptVersion = "5.8.3"
+
+// typesPackageMatch is the version of the `@types` package that is chosen for a package
+type typesPackageMatch struct {
+	Version string
+	Reason  string
+}
+
+// matchTypeScriptVersion checks if the TypeScript version satisfies the given range, e.g. ">=4.2", "<5.0", "*"
+func matchTypeScriptVersion(versionRange string) bool {
+	versionRange = strings.TrimSpace(versionRange)
+	if versionRange == "*" || versionRange == "" {
+		return true
+	}
+	c, err := semver.NewConstraint(versionRange)
+	if err != nil {
+		return false
+	}
+	return c.Check(semver.MustParse(typescriptVersion))
+}
+
+// selectTypesVersions returns the first mapping of the `typesVersions` field that matches the TypeScript version,
+// the keys are checked in the order they are defined like what the TypeScript compiler does.
+func selectTypesVersions(typesVersions npm.JSONObject) (versionRange string, mapping npm.JSONObject, ok bool) {
+	for _, key := range typesVersions.Keys() {
+		if !matchTypeScriptVersion(key) {
+			continue
+		}
+		v, _ := typesVersions.Get(key)
+		if mapping, ok = v.(npm.JSONObject); ok {
+			return key, mapping, true
+		}
+	}
+	return
+}
+
+// matchTypesPackageVersion finds the version of the `@types` package that is closest to the given package version:
+//  1. the latest version with the same major.minor version
+//  2. the closest version with the same major version, lower versions are preferred
+//  3. the closest version of any major version, lower versions are preferred
+//
+// deprecated versions (e.g. the stub versions when the package ships its own types) and prereleases are ignored.
+func matchTypesPackageVersion(metadata *npm.PackageMetadata, pkgName string, pkgVersion string) (m typesPackageMatch) {
+	v, err := semver.NewVersion(pkgVersion)
+	if err != nil {
+		return
+	}
+	var sameMinor, sameMajorLower, sameMajorHigher, lower, higher *semver.Version
+	for version, raw := range metadata.Versions {
+		if deprecated, ok := raw.Deprecated.(string); ok && deprecated != "" {
+			continue
+		}
+		tv, err := semver.NewVersion(version)
+		if err != nil || tv.Prerelease() != "" {
+			continue
+		}
+		switch {
+		case tv.Major() == v.Major() && tv.Minor() == v.Minor():
+			if sameMinor == nil || tv.GreaterThan(sameMinor) {
+				sameMinor = tv
+			}
+		case tv.Major() == v.Major() && tv.LessThan(v):
+			if sameMajorLower == nil || tv.GreaterThan(sameMajorLower) {
+				sameMajorLower = tv
+			}
+		case tv.Major() == v.Major():
+			if sameMajorHigher == nil || tv.LessThan(sameMajorHigher) {
+				sameMajorHigher = tv
+			}
+		case tv.LessThan(v):
+			if lower == nil || tv.GreaterThan(lower) {
+				lower = tv
+			}
+		default:
+			if higher == nil || tv.LessThan(higher) {
+				higher = tv
+			}
+		}
+	}
+	typesPkgName := npm.ToTypesPackageName(pkgName)
+	switch {
+	case sameMinor != nil:
+		m.Version = sameMinor.String()
+		m.Reason = fmt.Sprintf("%s@%s matches the major.minor version of %s@%s", typesPkgName, m.Version, pkgName, pkgVersion)
+	case sameMajorLower != nil || sameMajorHigher != nil:
+		if sameMajorLower != nil {
+			m.Version = sameMajorLower.String()
+		} else {
+			m.Version = sameMajorHigher.String()
+		}
+		m.Reason = fmt.Sprintf("%s@%s is the closest version to %s@%s in the same major version", typesPkgName, m.Version, pkgName, pkgVersion)
+	case lower != nil || higher != nil:
+		if lower != nil {
+			m.Version = lower.String()
+		} else {
+			m.Version = higher.String()
+		}
+		m.Reason = fmt.Sprintf("%s@%s is the closest version to %s@%s, no version of %s matches the major version", typesPkgName, m.Version, pkgName, pkgVersion, typesPkgName)
+	}
+	return
+}
+
+// lookupTypesPackage finds the `@types` package version for the current package,
+// the version specified by the `?deps` query is preferred.
+func (ctx *BuildContext) lookupTypesPackage() (m typesPackageMatch, err error) {
+	pkgJson := ctx.pkgJson
+	typesPkgName := npm.ToTypesPackageName(pkgJson.Name)
+	if version, ok := ctx.args.Deps[typesPkgName]; ok {
+		p, err := ctx.npmrc.getPackageInfoContext(ctx.Context(), typesPkgName, version)
+		if err == nil {
+			m.Version = p.Version
+			m.Reason = fmt.Sprintf("%s@%s is specified by the `?deps` query", typesPkgName, p.Version)
+			return m, nil
+		}
+	}
+	return withCache("npm:"+typesPkgName+"@types-of:"+pkgJson.Version, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() (m typesPackageMatch, aliasKey string, err error) {
+		metadata, _, err := ctx.npmrc.fetchPackageMetadataContext(ctx.Context(), typesPkgName, "", false)
+		if err != nil {
+			if strings.HasSuffix(err.Error(), " not found") {
+				// cache the empty match
+				err = nil
+			}
+			return
+		}
+		m = matchTypesPackageVersion(metadata, pkgJson.Name, pkgJson.Version)
+		return
+	})
+}
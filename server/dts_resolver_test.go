@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+)
+
+func TestSelectTypesVersions(t *testing.T) {
+	for _, c := range []struct {
+		json     string
+		expected string
+	}{
+		{`{">=3.1": {"*": ["ts3.1/*"]}}`, ">=3.1"},
+		{`{"<4.0": {"*": ["ts3/*"]}, ">=4.0": {"*": ["ts4/*"]}}`, ">=4.0"},
+		// the first matching range wins, even if a later one is "newer"
+		{`{">=4.2": {"*": ["ts4.2/*"]}, ">=5.0": {"*": ["ts5/*"]}}`, ">=4.2"},
+		{`{">=6.0": {"*": ["ts6/*"]}, "*": {"*": ["ts/*"]}}`, "*"},
+		{`{">=6.0": {"*": ["ts6/*"]}}`, ""},
+	} {
+		var typesVersions npm.JSONObject
+		if err := typesVersions.UnmarshalJSON([]byte(c.json)); err != nil {
+			t.Fatal(err)
+		}
+		versionRange, _, ok := selectTypesVersions(typesVersions)
+		if ok != (c.expected != "") || versionRange != c.expected {
+			t.Fatalf("selectTypesVersions(%s): expected %q, got %q", c.json, c.expected, versionRange)
+		}
+	}
+	if matchTypeScriptVersion("<5.0") || !matchTypeScriptVersion(">=5.0 <6") || matchTypeScriptVersion("invalid") {
+		t.Fatal("matchTypeScriptVersion: unexpected result")
+	}
+}
+
+func TestMatchTypesPackageVersion(t *testing.T) {
+	metadata := &npm.PackageMetadata{
+		Versions: map[string]npm.PackageJSONRaw{
+			"16.14.0":     {},
+			"17.0.2":      {},
+			"17.0.80":     {},
+			"18.2.0":      {},
+			"18.3.1":      {},
+			"18.3.12":     {},
+			"19.0.0-rc.1": {},
+			"19.0.0":      {Deprecated: "This is a stub types definition."},
+			"20.1.0":      {},
+		},
+	}
+	for _, c := range []struct {
+		version  string
+		expected string
+	}{
+		{"18.3.1", "18.3.12"},
+		{"18.4.0", "18.3.12"},
+		{"18.1.0", "18.2.0"},
+		{"17.1.0", "17.0.80"},
+		{"19.1.0", "18.3.12"},
+		{"15.0.0", "16.14.0"},
+		{"invalid", ""},
+	} {
+		m := matchTypesPackageVersion(metadata, "react", c.version)
+		if m.Version != c.expected {
+			t.Fatalf("matchTypesPackageVersion(react@%s): expected %q, got %q", c.version, c.expected, m.Version)
+		}
+		if m.Version != "" && m.Reason == "" {
+			t.Fatalf("matchTypesPackageVersion(react@%s): missing reason", c.version)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
@@ -17,6 +18,20 @@ import (
 
 func (ctx *BuildContext) transformDTS(dts string) error {
 	start := time.Now()
+	if ctx.args.DtsBundle {
+		n, err := ctx.bundleDTS(dts)
+		if err == nil {
+			if DEBUG {
+				ctx.logger.Debugf("bundle dts '%s'(%d inlined dts files) in %v", dts, n, time.Since(start))
+			}
+			return nil
+		}
+		if err.Error() == "types not found" {
+			return err
+		}
+		// fallback to the per-file mode
+		ctx.logger.Warnf("bundle dts '%s' of %s: %v", dts, ctx.esmPath.PackageId(), err)
+	}
 	n, err := transformDTS(ctx, dts, ctx.getBuildArgsPrefix(true), nil)
 	if err != nil {
 		return err
@@ -48,8 +63,7 @@ func transformDTS(ctx *BuildContext, dts string, buildArgsPrefix string, marker
 		return
 	}
 
-	dtsFilename := path.Join(ctx.wd, "node_modules", ctx.esmPath.PkgName, dts)
-	dtsContent, err := os.Open(dtsFilename)
+	dtsContent, err := ctx.openDTS(dts)
 	if err != nil {
 		// if the dts file does not exist, print a warning but continue to build
 		if os.IsNotExist(err) {
@@ -68,214 +82,289 @@ func transformDTS(ctx *BuildContext, dts string, buildArgsPrefix string, marker
 	deps := set.New[string]()
 
 	err = parseDts(dtsContent, buffer, func(specifier string, kind TsImportKind, position int) (string, error) {
-		if ctx.esmPath.PkgName == "@types/node" {
-			if strings.HasPrefix(specifier, "node:") || nodeBuiltinModules[specifier] || isRelPathSpecifier(specifier) {
-				return specifier, nil
+		res, isDep, err := ctx.resolveDTSImport(dts, specifier, kind)
+		if isDep {
+			deps.Add(res)
+		}
+		return res, err
+	})
+	if err != nil {
+		return
+	}
+
+	err = ctx.storage.Put(savePath, ctx.rewriteDTS(dts, buffer))
+	if err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	var errors []error
+	for _, s := range deps.Values() {
+		wg.Add(1)
+		go func(s string) {
+			j, err := transformDTS(ctx, "./"+path.Join(path.Dir(dts), s), buildArgsPrefix, marker)
+			if err != nil {
+				errors = append(errors, err)
 			}
+			n += j
+			wg.Done()
+		}(s)
+	}
+	wg.Wait()
+
+	if len(errors) > 0 {
+		err = errors[0]
+	}
+	return
+}
+
+// resolveDTSImport resolves the import specifier of a `.d.ts` file, the `isDep` is true if the specifier
+// is a relative `.d.ts` file of current package that needs to be transformed as well.
+func (ctx *BuildContext) resolveDTSImport(dts string, specifier string, kind TsImportKind) (resolved string, isDep bool, err error) {
+	if ctx.esmPath.PkgName == "@types/node" {
+		if strings.HasPrefix(specifier, "node:") || nodeBuiltinModules[specifier] || isRelPathSpecifier(specifier) {
+			return specifier, false, nil
 		}
+	}
 
-		// normalize specifier
-		specifier = normalizeImportSpecifier(specifier)
-
-		if isRelPathSpecifier(specifier) {
-			dtsDir := path.Dir(dtsFilename)
-			specifier = strings.TrimSuffix(specifier, ".d")
-			if !endsWith(specifier, ".d.ts", ".d.mts", ".d.cts") {
-				var p npm.PackageJSONRaw
-				var isSubmodule bool
-				if utils.ParseJSONFile(path.Join(dtsDir, specifier, "package.json"), &p) == nil {
-					dir := path.Join("/", path.Dir(dts))
-					if types := p.Types.String(); types != "" {
-						specifier, _ = relPath(dir, "/"+path.Join(dir, specifier, types))
-						isSubmodule = true
-					} else if typings := p.Typings.String(); typings != "" {
-						specifier, _ = relPath(dir, "/"+path.Join(dir, specifier, typings))
-						isSubmodule = true
-					}
+	// normalize specifier
+	specifier = normalizeImportSpecifier(specifier)
+
+	// convert `jsr:` specifier to the npm name, e.g. "jsr:@std/path@^1.0.0/posix" -> "@jsr/std__path/posix"
+	if jsrSpecifier, ok := strings.CutPrefix(specifier, "jsr:"); ok {
+		pkgName, _, subPath := splitEsmPath(jsrSpecifier)
+		specifier = toJsrNpmPackageName(pkgName)
+		if subPath != "" {
+			specifier += "/" + subPath
+		}
+	}
+
+	if isRelPathSpecifier(specifier) {
+		dtsDir := path.Dir(path.Join(ctx.wd, "node_modules", ctx.esmPath.PkgName, dts))
+		specifier = strings.TrimSuffix(specifier, ".d")
+		if !endsWith(specifier, ".d.ts", ".d.mts", ".d.cts") {
+			var p npm.PackageJSONRaw
+			var isSubmodule bool
+			if utils.ParseJSONFile(path.Join(dtsDir, specifier, "package.json"), &p) == nil {
+				dir := path.Join("/", path.Dir(dts))
+				if types := p.Types.String(); types != "" {
+					specifier, _ = relPath(dir, "/"+path.Join(dir, specifier, types))
+					isSubmodule = true
+				} else if typings := p.Typings.String(); typings != "" {
+					specifier, _ = relPath(dir, "/"+path.Join(dir, specifier, typings))
+					isSubmodule = true
 				}
-				if !isSubmodule {
+			}
+			if !isSubmodule {
+				if existsFile(path.Join(dtsDir, specifier+".d.mts")) {
+					specifier = specifier + ".d.mts"
+				} else if existsFile(path.Join(dtsDir, specifier+".d.ts")) {
+					specifier = specifier + ".d.ts"
+				} else if existsFile(path.Join(dtsDir, specifier+".d.cts")) {
+					specifier = specifier + ".d.cts"
+				} else if endsWith(specifier, ".js", ".mjs", ".cjs", ".ts", ".mts", ".cts") {
+					specifier = stripModuleExt(specifier)
 					if existsFile(path.Join(dtsDir, specifier+".d.mts")) {
 						specifier = specifier + ".d.mts"
 					} else if existsFile(path.Join(dtsDir, specifier+".d.ts")) {
 						specifier = specifier + ".d.ts"
 					} else if existsFile(path.Join(dtsDir, specifier+".d.cts")) {
 						specifier = specifier + ".d.cts"
-					} else if endsWith(specifier, ".js", ".mjs", ".cjs", ".ts", ".mts", ".cts") {
-						specifier = stripModuleExt(specifier)
-						if existsFile(path.Join(dtsDir, specifier+".d.mts")) {
-							specifier = specifier + ".d.mts"
-						} else if existsFile(path.Join(dtsDir, specifier+".d.ts")) {
-							specifier = specifier + ".d.ts"
-						} else if existsFile(path.Join(dtsDir, specifier+".d.cts")) {
-							specifier = specifier + ".d.cts"
-						}
-					} else if existsFile(path.Join(dtsDir, specifier, "index.d.mts")) {
-						specifier = strings.TrimSuffix(specifier, "/") + "/index.d.mts"
-					} else if existsFile(path.Join(dtsDir, specifier, "index.d.ts")) {
-						specifier = strings.TrimSuffix(specifier, "/") + "/index.d.ts"
-					} else if existsFile(path.Join(dtsDir, specifier, "index.d.cts")) {
-						specifier = strings.TrimSuffix(specifier, "/") + "/index.d.cts"
 					}
+				} else if existsFile(path.Join(dtsDir, specifier, "index.d.mts")) {
+					specifier = strings.TrimSuffix(specifier, "/") + "/index.d.mts"
+				} else if existsFile(path.Join(dtsDir, specifier, "index.d.ts")) {
+					specifier = strings.TrimSuffix(specifier, "/") + "/index.d.ts"
+				} else if existsFile(path.Join(dtsDir, specifier, "index.d.cts")) {
+					specifier = strings.TrimSuffix(specifier, "/") + "/index.d.cts"
 				}
 			}
+		}
 
-			if endsWith(specifier, ".d.ts", ".d.mts", ".d.cts") {
-				deps.Add(specifier)
-			} else {
-				specifier += ".d.ts"
+		if endsWith(specifier, ".d.ts", ".d.mts", ".d.cts") {
+			return specifier, true, nil
+		}
+		// the declaration file of the typescript source is generated for JSR packages
+		if ctx.npmrc.isNativeJsrPackage(ctx.esmPath.PkgName) {
+			for _, filename := range []string{specifier, specifier + ".ts", specifier + ".tsx", specifier + ".mts", specifier + ".cts"} {
+				if endsWith(filename, ".ts", ".tsx", ".mts", ".cts") && existsFile(path.Join(dtsDir, filename)) {
+					return toDeclarationPath(filename), true, nil
+				}
 			}
-			return specifier, nil
 		}
+		return specifier + ".d.ts", false, nil
+	}
 
-		if kind == TsReferenceTypes && specifier == "node" {
-			// return empty string to ignore the reference types 'node'
-			return "", nil
-		}
+	if kind == TsReferenceTypes && specifier == "node" {
+		// return empty string to ignore the reference types 'node'
+		return "", false, nil
+	}
 
-		if specifier == "node" || isNodeBuiltinSpecifier(specifier) {
-			return specifier, nil
-		}
+	if specifier == "node" || isNodeBuiltinSpecifier(specifier) {
+		return specifier, false, nil
+	}
 
-		depPkgName, _, subPath := splitEsmPath(specifier)
-		specifier = depPkgName
-		if len(subPath) > 0 {
-			specifier += "/" + subPath
-		}
+	depPkgName, _, subPath := splitEsmPath(specifier)
+	specifier = depPkgName
+	if len(subPath) > 0 {
+		specifier += "/" + subPath
+	}
 
-		if depPkgName == ctx.esmPath.PkgName {
-			if strings.ContainsRune(subPath, '*') {
+	if depPkgName == ctx.esmPath.PkgName {
+		if strings.ContainsRune(subPath, '*') {
+			return fmt.Sprintf(
+				"{ESM_CDN_ORIGIN}/%s/%s%s",
+				ctx.esmPath.PackageId(),
+				ctx.getBuildArgsPrefix(true),
+				subPath,
+			), false, nil
+		} else {
+			entry := ctx.resolveEntry(EsmPath{
+				PkgName:    depPkgName,
+				PkgVersion: ctx.esmPath.PkgVersion,
+				SubPath:    stripEntryModuleExt(subPath),
+			})
+			if entry.types != "" {
 				return fmt.Sprintf(
 					"{ESM_CDN_ORIGIN}/%s/%s%s",
 					ctx.esmPath.PackageId(),
 					ctx.getBuildArgsPrefix(true),
-					subPath,
-				), nil
-			} else {
-				entry := ctx.resolveEntry(EsmPath{
-					PkgName:    depPkgName,
-					PkgVersion: ctx.esmPath.PkgVersion,
-					SubPath:    stripEntryModuleExt(subPath),
-				})
-				if entry.types != "" {
-					return fmt.Sprintf(
-						"{ESM_CDN_ORIGIN}/%s/%s%s",
-						ctx.esmPath.PackageId(),
-						ctx.getBuildArgsPrefix(true),
-						strings.TrimPrefix(entry.types, "./"),
-					), nil
-				}
+					strings.TrimPrefix(entry.types, "./"),
+				), false, nil
 			}
-			// virtual module
-			return "https://esm.sh/" + specifier, nil
 		}
+		// virtual module
+		return "https://esm.sh/" + specifier, false, nil
+	}
 
-		// respect `?alias` query
-		alias, ok := ctx.args.Alias[depPkgName]
-		if ok {
-			aliasPkgName, _, aliasSubPath := splitEsmPath(alias)
-			depPkgName = aliasPkgName
-			if len(aliasSubPath) > 0 {
-				if len(subPath) > 0 {
-					subPath = aliasSubPath + "/" + subPath
-				} else {
-					subPath = aliasSubPath
-				}
-			}
-			specifier = depPkgName
+	// respect `?alias` query
+	alias, ok := ctx.args.Alias[depPkgName]
+	if ok {
+		aliasPkgName, _, aliasSubPath := splitEsmPath(alias)
+		depPkgName = aliasPkgName
+		if len(aliasSubPath) > 0 {
 			if len(subPath) > 0 {
-				specifier += "/" + subPath
-			}
-		}
-
-		// respect `?external` query
-		if ctx.externalAll || ctx.args.External.Has(depPkgName) || isPackageInExternalNamespace(depPkgName, ctx.args.External) {
-			return specifier, nil
-		}
-
-		typesPkgName := npm.ToTypesPackageName(depPkgName)
-		if _, ok := ctx.pkgJson.Dependencies[typesPkgName]; ok {
-			depPkgName = typesPkgName
-		} else if _, ok := ctx.pkgJson.PeerDependencies[typesPkgName]; ok {
-			depPkgName = typesPkgName
-		}
-
-		_, p, err := ctx.resolveDependency(depPkgName, true)
-		if err != nil {
-			if kind == TsDeclareModule && strings.HasSuffix(err.Error(), " not found") {
-				return specifier, nil
+				subPath = aliasSubPath + "/" + subPath
+			} else {
+				subPath = aliasSubPath
 			}
-			return "", err
-		}
-
-		dtsModule := EsmPath{
-			PkgName:    p.Name,
-			PkgVersion: p.Version,
-			SubPath:    stripEntryModuleExt(subPath),
-		}
-		args := BuildArgs{
-			Alias:      ctx.args.Alias,
-			Deps:       ctx.args.Deps,
-			External:   ctx.args.External,
-			Conditions: ctx.args.Conditions,
-		}
-		b := &BuildContext{
-			npmrc:   ctx.npmrc,
-			logger:  ctx.logger,
-			esmPath: dtsModule,
-			args:    args,
-			target:  "types",
-			ctx:     ctx.ctx,
-		}
-		err = b.install()
-		if err != nil {
-			return "", err
 		}
-		err = resolveBuildArgs(ctx.npmrc, b.wd, &b.args, dtsModule)
-		if err != nil {
-			return "", err
+		specifier = depPkgName
+		if len(subPath) > 0 {
+			specifier += "/" + subPath
 		}
+	}
 
-		dtsPath, err := b.resolveDTS(b.resolveEntry(dtsModule))
-		if err != nil {
-			return "", err
-		}
+	// respect `?external` query
+	if ctx.externalAll || ctx.args.External.Has(depPkgName) || isPackageInExternalNamespace(depPkgName, ctx.args.External) {
+		return specifier, false, nil
+	}
 
-		if dtsPath != "" {
-			return fmt.Sprintf("{ESM_CDN_ORIGIN}%s", dtsPath), nil
-		}
+	typesPkgName := npm.ToTypesPackageName(depPkgName)
+	if _, ok := ctx.pkgJson.Dependencies[typesPkgName]; ok {
+		depPkgName = typesPkgName
+	} else if _, ok := ctx.pkgJson.PeerDependencies[typesPkgName]; ok {
+		depPkgName = typesPkgName
+	}
 
-		if kind == TsDeclareModule {
-			return fmt.Sprintf("{ESM_CDN_ORIGIN}/%s", dtsModule.String()), nil
+	_, p, err := ctx.resolveDependency(depPkgName, true)
+	if err != nil {
+		if kind == TsDeclareModule && strings.HasSuffix(err.Error(), " not found") {
+			return specifier, false, nil
 		}
+		return "", false, err
+	}
 
-		return fmt.Sprintf("{ESM_CDN_ORIGIN}%s", b.Path()), nil
-	})
+	dtsModule := EsmPath{
+		PkgName:    p.Name,
+		PkgVersion: p.Version,
+		SubPath:    stripEntryModuleExt(subPath),
+	}
+	args := BuildArgs{
+		Alias:      ctx.args.Alias,
+		Deps:       ctx.args.Deps,
+		External:   ctx.args.External,
+		Conditions: ctx.args.Conditions,
+		DtsBundle:  ctx.args.DtsBundle,
+	}
+	b := &BuildContext{
+		npmrc:   ctx.npmrc,
+		logger:  ctx.logger,
+		esmPath: dtsModule,
+		args:    args,
+		target:  "types",
+		ctx:     ctx.ctx,
+	}
+	err = b.install()
 	if err != nil {
-		return
+		return "", false, err
+	}
+	err = resolveBuildArgs(ctx.npmrc, b.wd, &b.args, dtsModule)
+	if err != nil {
+		return "", false, err
 	}
 
-	err = ctx.storage.Put(savePath, ctx.rewriteDTS(dts, buffer))
+	dtsPath, _, err := b.resolveDTS(b.resolveEntry(dtsModule))
 	if err != nil {
-		return
+		return "", false, err
 	}
 
-	var wg sync.WaitGroup
-	var errors []error
-	for _, s := range deps.Values() {
-		wg.Add(1)
-		go func(s string) {
-			j, err := transformDTS(ctx, "./"+path.Join(path.Dir(dts), s), buildArgsPrefix, marker)
-			if err != nil {
-				errors = append(errors, err)
+	if dtsPath != "" {
+		return fmt.Sprintf("{ESM_CDN_ORIGIN}%s", dtsPath), false, nil
+	}
+
+	if kind == TsDeclareModule {
+		return fmt.Sprintf("{ESM_CDN_ORIGIN}/%s", dtsModule.String()), false, nil
+	}
+
+	return fmt.Sprintf("{ESM_CDN_ORIGIN}%s", b.Path()), false, nil
+}
+
+// openDTS opens the declaration file of the package, for JSR packages the declaration file
+// is generated from the typescript source if it doesn't exist.
+func (ctx *BuildContext) openDTS(dts string) (io.ReadCloser, error) {
+	pkgDir := path.Join(ctx.wd, "node_modules", ctx.esmPath.PkgName)
+	f, err := os.Open(path.Join(pkgDir, dts))
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) || !ctx.npmrc.isNativeJsrPackage(ctx.esmPath.PkgName) {
+		return nil, err
+	}
+	var sourceFile string
+	switch {
+	case strings.HasSuffix(dts, ".d.ts"):
+		for _, ext := range []string{".ts", ".tsx"} {
+			if existsFile(path.Join(pkgDir, strings.TrimSuffix(dts, ".d.ts")+ext)) {
+				sourceFile = strings.TrimSuffix(dts, ".d.ts") + ext
+				break
 			}
-			n += j
-			wg.Done()
-		}(s)
+		}
+	case strings.HasSuffix(dts, ".d.mts"), strings.HasSuffix(dts, ".d.cts"):
+		if s := strings.Replace(dts, ".d.", ".", 1); existsFile(path.Join(pkgDir, s)) {
+			sourceFile = s
+		}
 	}
-	wg.Wait()
+	if sourceFile == "" {
+		return nil, err
+	}
+	code, err := os.ReadFile(path.Join(pkgDir, sourceFile))
+	if err != nil {
+		return nil, err
+	}
+	output, err := transpileDeclaration(ctx.Context(), ctx.npmrc, path.Base(sourceFile), string(code))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the declaration file of '%s': %v", sourceFile, err)
+	}
+	return io.NopCloser(strings.NewReader(output.Code)), nil
+}
 
-	if len(errors) > 0 {
-		err = errors[0]
+// toDeclarationPath returns the declaration file path of a typescript module, e.g. "./mod.ts" -> "./mod.d.ts"
+func toDeclarationPath(filename string) string {
+	switch ext := path.Ext(filename); ext {
+	case ".mts", ".cts":
+		return strings.TrimSuffix(filename, ext) + ".d" + ext
+	default:
+		return strings.TrimSuffix(filename, ext) + ".d.ts"
 	}
-	return
 }
@@ -4,16 +4,28 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/esm-dev/esm.sh/internal/fetch"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/esbuild-internal/xxhash"
 	"github.com/ije/gox/utils"
+	"github.com/ije/gox/valid"
 )
 
 type GitRef struct {
@@ -21,78 +33,607 @@ type GitRef struct {
 	Sha string
 }
 
-// list refs of a github repository using `git ls-remote repo`
-func listGhRepoRefs(repo string) (refs []GitRef, err error) {
-	return listGhRepoRefsContext(context.Background(), repo)
+// GitHost is a git server that serves repositories over the smart HTTP protocol.
+type GitHost struct {
+	// the prefix of the module path, e.g. "gh", "gitlab", "git/gitea"
+	Prefix  string
+	BaseURL string
+	// the type of the host decides how to download the source archive of a ref,
+	// one of "github", "gitlab", "gitea" and "bitbucket". The repository is fetched
+	// with the `git` command if the type is empty.
+	Type  string
+	User  string
+	Token string
 }
 
-func listGhRepoRefsContext(ctx context.Context, repo string) (refs []GitRef, err error) {
-	return withCache("git ls-remote "+repo, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() ([]GitRef, string, error) {
-		stdout := &bytes.Buffer{}
-		errout := &bytes.Buffer{}
-		cancelCtx, cancel := context.WithTimeout(ctx, time.Minute)
+var githubHost = &GitHost{Prefix: "gh", BaseURL: "https://github.com", Type: "github"}
+
+var builtinGitHosts = map[string]*GitHost{
+	"gh":        githubHost,
+	"gitlab":    {Prefix: "gitlab", BaseURL: "https://gitlab.com", Type: "gitlab"},
+	"bitbucket": {Prefix: "bitbucket", BaseURL: "https://bitbucket.org", Type: "bitbucket"},
+}
+
+// getGitHost returns the git host of the given prefix, the custom hosts are
+// configured with the `gitHosts` option and prefixed with "git/", e.g. "git/gitea".
+func getGitHost(prefix string) (*GitHost, bool) {
+	if host, ok := builtinGitHosts[prefix]; ok {
+		return host, true
+	}
+	if name, ok := strings.CutPrefix(prefix, "git/"); ok && config != nil {
+		if c, ok := config.GitHosts[name]; ok {
+			return &GitHost{
+				Prefix:  prefix,
+				BaseURL: c.BaseURL,
+				Type:    c.Type,
+				User:    c.User,
+				Token:   c.Token,
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// cutGitHostPrefix cuts the git host prefix of the pathname,
+// e.g. "/gitlab/owner/repo@v1.0.0" -> ("gitlab", "/owner/repo@v1.0.0")
+func cutGitHostPrefix(pathname string) (prefix string, rest string, ok bool) {
+	for _, alias := range [][2]string{
+		{"/gh/", "gh"},
+		{"/github.com/", "gh"},
+		{"/gitlab/", "gitlab"},
+		{"/gitlab.com/", "gitlab"},
+		{"/bitbucket/", "bitbucket"},
+		{"/bitbucket.org/", "bitbucket"},
+	} {
+		if rest, ok := strings.CutPrefix(pathname, alias[0]); ok {
+			return alias[1], "/" + rest, true
+		}
+	}
+	if rest, ok := strings.CutPrefix(pathname, "/git/"); ok {
+		name, rest := utils.SplitByFirstByte(rest, '/')
+		if name != "" {
+			return "git/" + name, "/" + rest, true
+		}
+	}
+	return
+}
+
+// Name returns the display name of the host, e.g. "github", "gitlab", "git.example.com"
+func (host *GitHost) Name() string {
+	if host.Prefix == "gh" {
+		return "github"
+	}
+	if strings.HasPrefix(host.Prefix, "git/") {
+		if u, err := url.Parse(host.BaseURL); err == nil {
+			return u.Host
+		}
+	}
+	return host.Prefix
+}
+
+// RepoURL returns the URL of the repository, e.g. "https://github.com/owner/repo"
+func (host *GitHost) RepoURL(repo string) string {
+	return strings.TrimRight(host.BaseURL, "/") + "/" + repo
+}
+
+// authorization returns the `Authorization` header to access the repository, the token is sent
+// as a bearer token if the user is not specified. For GitHub, the token of the repository owner
+// configured by the `githubTokens` option is used, the private repositories are only fetched for
+// the authorized requests of themselves since they can't be dependencies, see `isPrivateGhDependency`.
+func (host *GitHost) authorization(repo string) string {
+	user, token := host.User, host.Token
+	if host == githubHost {
+		if c, ok := getGithubToken(repo); ok {
+			user, token = "x-access-token", c.Token
+		}
+	}
+	if token == "" {
+		return ""
+	}
+	if user != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+token))
+	}
+	return "Bearer " + token
+}
+
+// archiveURL returns the URL of the source archive(.tar.gz) of the ref.
+func (host *GitHost) archiveURL(repo string, ref string) string {
+	switch host.Type {
+	case "github":
+		if host == githubHost {
+			if _, ok := getGithubToken(repo); ok {
+				// codeload.github.com doesn't accept tokens, the API redirects to a temporary URL of the archive
+				return fmt.Sprintf("%s/repos/%s/tarball/%s", githubApiOrigin, repo, ref)
+			}
+			return fmt.Sprintf("https://codeload.github.com/%s/tar.gz/%s", repo, ref)
+		}
+		// GitHub Enterprise Server
+		return fmt.Sprintf("%s/archive/%s.tar.gz", host.RepoURL(repo), ref)
+	case "gitlab":
+		return fmt.Sprintf("%s/-/archive/%s/%s-%s.tar.gz", host.RepoURL(repo), ref, path.Base(repo), strings.ReplaceAll(ref, "/", "-"))
+	case "gitea":
+		return fmt.Sprintf("%s/archive/%s.tar.gz", host.RepoURL(repo), ref)
+	case "bitbucket":
+		return fmt.Sprintf("%s/get/%s.tar.gz", host.RepoURL(repo), ref)
+	default:
+		return ""
+	}
+}
+
+// getGithubToken returns the token config of the owner of the GitHub repository.
+func getGithubToken(repo string) (GithubTokenConfig, bool) {
+	if config == nil || len(config.GithubTokens) == 0 {
+		return GithubTokenConfig{}, false
+	}
+	owner, _ := utils.SplitByFirstByte(repo, '/')
+	c, ok := config.GithubTokens[strings.ToLower(owner)]
+	return c, ok
+}
+
+// getPrivateGhRepo returns the private GitHub repository of the pathname, e.g.
+// "/gh/owner/repo@1.0.0/es2022/repo.mjs" -> "owner/repo". The asterisk prefix of the pathname is ignored.
+func getPrivateGhRepo(pathname string) (repo string, ok bool) {
+	if strings.HasPrefix(pathname, "/*") {
+		pathname = "/" + pathname[2:]
+	}
+	prefix, rest, ok := cutGitHostPrefix(pathname)
+	if !ok || prefix != "gh" {
+		return "", false
+	}
+	owner, rest := utils.SplitByFirstByte(strings.TrimPrefix(rest[1:], "*"), '/')
+	name, _ := utils.SplitByFirstByte(rest, '/')
+	name, _ = utils.SplitByFirstByte(name, '@')
+	repo = owner + "/" + name
+	_, ok = getGithubToken(repo)
+	return
+}
+
+type privateGhRepoKey struct{}
+
+// withPrivateGhRepo returns a copy of the context that allows the private GitHub repository to be
+// installed as a dependency, e.g. the workspace packages of the repository that is being built.
+func withPrivateGhRepo(ctx context.Context, repo string) context.Context {
+	return context.WithValue(ctx, privateGhRepoKey{}, repo)
+}
+
+// isPrivateGhDependency checks if the dependency is a private GitHub repository that is not allowed by
+// the context. The private repositories are only served to the authorized clients with the "private/"
+// storage prefix, a public package that depends on them would leak the source to the shared cache.
+func isPrivateGhDependency(ctx context.Context, pkg npm.Package) bool {
+	if !pkg.Github || pkg.GitHost != "" {
+		return false
+	}
+	if _, ok := getGithubToken(pkg.Name); !ok {
+		return false
+	}
+	repo, _ := ctx.Value(privateGhRepoKey{}).(string)
+	return !strings.EqualFold(repo, pkg.Name)
+}
+
+// isAuthorizedGhClient checks if the `Authorization` header of the request is allowed
+// to access the private GitHub repository.
+func isAuthorizedGhClient(repo string, authorization string) bool {
+	c, ok := getGithubToken(repo)
+	if !ok {
+		return true
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, clientToken := range c.ClientTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(clientToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// list refs of a github repository
+func listGhRepoRefs(repoUrl string) (refs []GitRef, err error) {
+	return listRepoRefsContext(context.Background(), repoUrl, "")
+}
+
+// ListRepoRefsContext lists the refs of a repository on the host.
+func (host *GitHost) ListRepoRefsContext(ctx context.Context, repo string) (refs []GitRef, err error) {
+	return listRepoRefsContext(ctx, host.RepoURL(repo), host.authorization(repo))
+}
+
+// listRepoRefsContext lists the refs of a repository like `git ls-remote repo` does, using the smart HTTP protocol.
+// see https://git-scm.com/docs/http-protocol#_smart_clients
+func listRepoRefsContext(ctx context.Context, repoUrl string, authorization string) (refs []GitRef, err error) {
+	cacheKey := "git ls-remote " + repoUrl
+	if authorization != "" {
+		// don't share the refs of private repositories with anonymous requests
+		cacheKey += " " + strconv.FormatUint(xxhash.Sum64([]byte(authorization)), 36)
+	}
+	return withCache(cacheKey, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() ([]GitRef, string, error) {
+		u, err := url.Parse(strings.TrimSuffix(repoUrl, ".git") + ".git/info/refs?service=git-upload-pack")
+		if err != nil {
+			return nil, "", err
+		}
+		header := http.Header{}
+		if authorization != "" {
+			header.Set("Authorization", authorization)
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, time.Minute)
 		defer cancel()
-		cmd := exec.CommandContext(cancelCtx, "git", "ls-remote", repo)
-		cmd.Stdout = stdout
-		cmd.Stderr = errout
-		err = cmd.Run()
+		client := fetch.NewClient("git/esmd-"+VERSION, 60, false)
+		res, err := client.FetchWithContext(fetchCtx, u, header)
 		if err != nil {
-			if errout.Len() > 0 {
-				return nil, "", errors.New(errout.String())
-			}
 			return nil, "", err
 		}
-		refs = make([]GitRef, 0)
-		r := bufio.NewReader(stdout)
-		for {
-			var line []byte
-			line, err = r.ReadBytes('\n')
-			if err == io.EOF {
-				err = nil
-				break
-			}
-			if err != nil {
-				return nil, "", err
-			}
-			sha, ref := utils.SplitByLastByte(string(bytes.TrimSpace(line)), '\t')
-			refs = append(refs, GitRef{
-				Ref: ref,
-				Sha: sha,
-			})
+		defer res.Body.Close()
+
+		if res.StatusCode == 404 || res.StatusCode == 401 || res.StatusCode == 403 {
+			return nil, "", fmt.Errorf("repository '%s' not found", repoUrl)
+		}
+		if res.StatusCode != 200 {
+			return nil, "", fmt.Errorf("git ls-remote %s: %s", repoUrl, res.Status)
+		}
+		if !strings.HasPrefix(res.Header.Get("Content-Type"), "application/x-git-upload-pack-advertisement") {
+			return nil, "", fmt.Errorf("git ls-remote %s: the server does not support the smart HTTP protocol", repoUrl)
+		}
+		refs, err := parseRefsAdvertisement(io.LimitReader(res.Body, 64*1024*1024))
+		if err != nil {
+			return nil, "", err
 		}
 		return refs, "", nil
 	})
 }
 
+// parseRefsAdvertisement parses the refs advertisement of the `git-upload-pack` service
+// that is encoded in the pkt-line format.
+// see https://git-scm.com/docs/gitprotocol-common#_pkt_line_format
+func parseRefsAdvertisement(r io.Reader) (refs []GitRef, err error) {
+	br := bufio.NewReader(r)
+	refs = make([]GitRef, 0)
+	for {
+		var lenHex [4]byte
+		_, err = io.ReadFull(br, lenHex[:])
+		if err == io.EOF {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		n, e := strconv.ParseUint(string(lenHex[:]), 16, 16)
+		if e != nil {
+			return nil, errors.New("invalid pkt-line")
+		}
+		if n < 4 {
+			// flush-pkt(0000), delim-pkt(0001) or response-end-pkt(0002)
+			continue
+		}
+		line := make([]byte, n-4)
+		_, err = io.ReadFull(br, line)
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if bytes.HasPrefix(line, []byte("# service=")) {
+			continue
+		}
+		// strip the capabilities after the first ref
+		if i := bytes.IndexByte(line, 0); i >= 0 {
+			line = line[:i]
+		}
+		sha, ref := utils.SplitByFirstByte(string(line), ' ')
+		if ref == "" || ref == "capabilities^{}" {
+			// empty repository
+			continue
+		}
+		if (len(sha) != 40 && len(sha) != 64) || !valid.IsHexString(sha) {
+			return nil, fmt.Errorf("invalid ref advertisement: %s", line)
+		}
+		refs = append(refs, GitRef{
+			Ref: ref,
+			Sha: sha,
+		})
+	}
+}
+
 func ghInstall(wd, name, tag string) (err error) {
-	return ghInstallContext(context.Background(), wd, name, tag)
+	return githubHost.InstallContext(context.Background(), wd, name, tag)
 }
 
-func ghInstallContext(ctx context.Context, wd, name, tag string) (err error) {
-	u, err := url.Parse(fmt.Sprintf("https://codeload.github.com/%s/tar.gz/%s", name, tag))
+// InstallContext installs the repository at the given ref(tag, branch or commit hash) to the `node_modules` of wd.
+func (host *GitHost) InstallContext(ctx context.Context, wd, repo, ref string) (err error) {
+	defer func() {
+		if err != nil {
+			// clear wd if failed to install, otherwise the partial
+			// installation would be treated as a completed installation
+			os.RemoveAll(wd)
+		}
+	}()
+
+	if host.Type == "" {
+		return host.fetchRepoContext(ctx, wd, repo, ref)
+	}
+
+	u, err := url.Parse(host.archiveURL(repo, ref))
 	if err != nil {
 		return
 	}
+	header := http.Header{}
+	if authorization := host.authorization(repo); authorization != "" {
+		header.Set("Authorization", authorization)
+	}
 	client := fetch.NewClient("esmd/"+VERSION, 30, false)
-	res, err := client.FetchWithContext(ctx, u, nil)
+	res, err := client.FetchWithContext(ctx, u, header)
 	if err != nil {
 		return
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == 404 || res.StatusCode == 401 {
-		return fmt.Errorf("github: repo \"%s\" or tag \"%s\" not found", name, tag)
+	if res.StatusCode == 404 || res.StatusCode == 401 || res.StatusCode == 403 {
+		return fmt.Errorf("%s: repo \"%s\" or tag \"%s\" not found", host.Name(), repo, ref)
 	}
 
 	if res.StatusCode != 200 {
 		return fmt.Errorf("fetch %s failed: %s", u, res.Status)
 	}
 
-	err = extractPackageTarballContext(ctx, wd, name, io.LimitReader(res.Body, maxPackageTarballSize))
+	return extractPackageTarballContext(ctx, wd, repo, io.LimitReader(res.Body, maxPackageTarballSize))
+}
+
+// resolveRefSha returns the commit sha of the ref, the tags and branches are matched first, then a
+// commit-ish ref (7-40 hex characters) is matched as a sha prefix. The ref is returned as it is if
+// nothing matches, e.g. a commit that is not the head of any ref.
+func resolveRefSha(refs []GitRef, ref string) string {
+	for _, r := range refs {
+		if r.Ref == "refs/tags/"+ref || r.Ref == "refs/heads/"+ref {
+			return r.Sha
+		}
+	}
+	if isCommitish(ref) {
+		for _, r := range refs {
+			if strings.HasPrefix(r.Sha, ref) {
+				return r.Sha
+			}
+		}
+	}
+	return ref
+}
+
+// fetchRepoContext fetches the ref of the repository with the `git` command for the hosts
+// that don't provide source archives, then installs the files with `git archive`.
+func (host *GitHost) fetchRepoContext(ctx context.Context, wd, repo, ref string) (err error) {
+	refs, err := host.ListRepoRefsContext(ctx, repo)
 	if err != nil {
-		// clear wd if failed to extract tarball, otherwise the partial
-		// extraction would be treated as a completed installation
-		os.RemoveAll(wd)
+		return
 	}
-	return
+	sha := resolveRefSha(refs, ref)
+
+	gitDir, err := os.MkdirTemp("", "esmd-git-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(gitDir)
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	git := func(args ...string) error {
+		errout := &bytes.Buffer{}
+		cmd := exec.CommandContext(cancelCtx, "git", args...)
+		cmd.Dir = gitDir
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		cmd.Stderr = errout
+		if err := cmd.Run(); err != nil {
+			if errout.Len() > 0 {
+				return errors.New(strings.TrimSpace(errout.String()))
+			}
+			return err
+		}
+		return nil
+	}
+
+	err = git("init", "-q", "--bare")
+	if err != nil {
+		return
+	}
+	fetchArgs := []string{}
+	if authorization := host.authorization(repo); authorization != "" {
+		fetchArgs = append(fetchArgs, "-c", "http.extraHeader=Authorization: "+authorization)
+	}
+	fetchArgs = append(fetchArgs, "fetch", "-q", "--depth=1", host.RepoURL(repo), sha)
+	err = git(fetchArgs...)
+	if err != nil {
+		return fmt.Errorf("%s: repo \"%s\" or tag \"%s\" not found", host.Name(), repo, ref)
+	}
+	archive := filepath.Join(gitDir, "archive.tar.gz")
+	err = git("archive", "--format=tar.gz", "--prefix=package/", "-o", archive, "FETCH_HEAD")
+	if err != nil {
+		return
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return extractPackageTarballContext(ctx, wd, repo, io.LimitReader(f, maxPackageTarballSize))
+}
+
+// findGitWorkspace finds the workspace package of a monorepo in the sub-path, the workspace is the
+// shortest directory of the sub-path that contains a `package.json` file,
+// e.g. "packages/foo/index.js" -> ("packages/foo", "index.js")
+func findGitWorkspace(npmrc *NpmRC, esm EsmPath, subPath string) (workspace string, rest string, err error) {
+	segments := strings.Split(subPath, "/")
+	for _, seg := range segments {
+		if seg == "" || seg == "." || seg == ".." || seg == "node_modules" {
+			return "", subPath, nil
+		}
+	}
+	esm.Workspace = ""
+	esm.SubPath = ""
+	pkg := esm.Package()
+	workspace, err = withCache("git workspace "+pkg.String()+"/"+subPath, time.Hour, func() (string, string, error) {
+		_, err := npmrc.installPackage(pkg)
+		if err != nil {
+			return "", "", err
+		}
+		repoDir := filepath.Join(npmrc.StoreDir(), pkg.String(), "node_modules", pkg.Name)
+		if !isMonorepo(repoDir) {
+			return "", "", nil
+		}
+		for i := 1; i <= len(segments); i++ {
+			dir := strings.Join(segments[:i], "/")
+			if existsFile(filepath.Join(repoDir, dir, "package.json")) {
+				return dir, "", nil
+			}
+		}
+		return "", "", nil
+	})
+	if err != nil || workspace == "" {
+		return "", subPath, err
+	}
+	return workspace, strings.TrimPrefix(strings.TrimPrefix(subPath, workspace), "/"), nil
+}
+
+// isMonorepo checks if the repository declares workspaces.
+func isMonorepo(repoDir string) bool {
+	for _, name := range []string{"pnpm-workspace.yaml", "lerna.json"} {
+		if existsFile(filepath.Join(repoDir, name)) {
+			return true
+		}
+	}
+	var raw struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	return utils.ParseJSONFile(filepath.Join(repoDir, "package.json"), &raw) == nil && len(raw.Workspaces) > 0 && string(raw.Workspaces) != "null"
+}
+
+// getGitWorkspaces returns the workspace packages of a monorepo, the key is the package name
+// and the value is the directory of the package, e.g. {"@scope/foo": "packages/foo"}
+func getGitWorkspaces(repoDir string) map[string]string {
+	workspaces := map[string]string{}
+	filepath.WalkDir(repoDir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if filename != repoDir && (name == "node_modules" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			if strings.Count(strings.TrimPrefix(filename, repoDir), string(filepath.Separator)) > 4 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == "package.json" && filepath.Dir(filename) != repoDir {
+			var raw npm.PackageJSONRaw
+			if utils.ParseJSONFile(filename, &raw) == nil && raw.Name != "" {
+				dir, _ := filepath.Rel(repoDir, filepath.Dir(filename))
+				workspaces[raw.Name] = filepath.ToSlash(dir)
+			}
+		}
+		return nil
+	})
+	return workspaces
+}
+
+// installGitWorkspaceContext installs a workspace package of a monorepo, the repository is installed once and
+// the files of the workspace package are copied to the installDir. The `workspace:` dependencies are resolved
+// to the sibling packages of the repository at the same ref.
+func (npmrc *NpmRC) installGitWorkspaceContext(ctx context.Context, installDir string, pkg npm.Package) (err error) {
+	repo := pkg
+	repo.Workspace = ""
+	_, err = npmrc.installPackageContext(ctx, repo)
+	if err != nil {
+		return
+	}
+	repoDir := filepath.Join(npmrc.StoreDir(), repo.String(), "node_modules", repo.Name)
+	workspaceDir := filepath.Join(repoDir, pkg.Workspace)
+	if !existsFile(filepath.Join(workspaceDir, "package.json")) {
+		return fmt.Errorf("workspace '%s' not found in %s", pkg.Workspace, repo.String())
+	}
+
+	defer func() {
+		if err != nil {
+			// clear installDir if failed to install, otherwise the partial
+			// installation would be treated as a completed installation
+			os.RemoveAll(installDir)
+		}
+	}()
+
+	pkgDir := filepath.Join(installDir, "node_modules", pkg.Name)
+	err = filepath.WalkDir(workspaceDir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name() == "package.json" && filepath.Dir(filename) == workspaceDir {
+			return nil
+		}
+		rel, _ := filepath.Rel(workspaceDir, filename)
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		savepath := filepath.Join(pkgDir, rel)
+		if err := ensureDir(filepath.Dir(savepath)); err != nil {
+			return err
+		}
+		return os.WriteFile(savepath, data, 0644)
+	})
+	if err != nil {
+		return
+	}
+
+	// write `package.json` at last with the `workspace:` dependencies resolved
+	data, err := os.ReadFile(filepath.Join(workspaceDir, "package.json"))
+	if err != nil {
+		return
+	}
+	var pkgJson map[string]json.RawMessage
+	err = json.Unmarshal(data, &pkgJson)
+	if err != nil {
+		return
+	}
+	var workspaces map[string]string
+	for _, field := range []string{"dependencies", "peerDependencies", "optionalDependencies"} {
+		var deps map[string]string
+		if json.Unmarshal(pkgJson[field], &deps) != nil {
+			continue
+		}
+		changed := false
+		for name, version := range deps {
+			if !strings.HasPrefix(version, "workspace:") {
+				continue
+			}
+			if workspaces == nil {
+				workspaces = getGitWorkspaces(repoDir)
+			}
+			dir, ok := workspaces[name]
+			if !ok {
+				return fmt.Errorf("workspace package '%s' not found in %s", name, repo.String())
+			}
+			deps[name] = toGitDependencySpecifier(repo, dir)
+			changed = true
+		}
+		if changed {
+			pkgJson[field] = utils.MustEncodeJSON(deps)
+		}
+	}
+	data, err = json.Marshal(pkgJson)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(pkgDir, "package.json"), data, 0644)
+}
+
+// toGitDependencySpecifier returns the dependency specifier of a workspace package in the git repository,
+// e.g. "github:owner/repo#1a2b3c4&path:/packages/foo"
+func toGitDependencySpecifier(repo npm.Package, workspace string) string {
+	prefix := "github"
+	if repo.GitHost != "" {
+		prefix = repo.GitHost
+	}
+	return prefix + ":" + repo.Name + "#" + repo.Version + "&path:/" + workspace
 }
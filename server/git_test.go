@@ -1,11 +1,20 @@
 package server
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/esm-dev/esm.sh/internal/npm"
 	"github.com/ije/gox/crypto/rand"
 )
 
@@ -37,3 +46,317 @@ func TestGhInstall(t *testing.T) {
 		t.Fatal("README.md not found")
 	}
 }
+
+func TestParseRefsAdvertisement(t *testing.T) {
+	headSha := "6ecf3bc7f4f5bd4c8c3b8c2e07a5d5d1cd7a8d9e"
+	tagSha := "0a2b5c4c4b0f9a3b0c3d9e8f7a6b5c4d3e2f1a0b"
+	pktLine := func(s string) string {
+		return fmt.Sprintf("%04x%s", len(s)+4, s)
+	}
+	data := pktLine("# service=git-upload-pack\n") + "0000" +
+		pktLine(headSha+" HEAD\x00multi_ack thin-pack side-band symref=HEAD:refs/heads/main\n") +
+		pktLine(headSha+" refs/heads/main\n") +
+		pktLine(tagSha+" refs/tags/v1.0.0\n") +
+		"0000"
+	refs, err := parseRefsAdvertisement(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 3 {
+		t.Fatalf("expected 3 refs, got %d", len(refs))
+	}
+	if refs[0].Ref != "HEAD" || refs[0].Sha != headSha {
+		t.Fatalf("unexpected ref: %v", refs[0])
+	}
+	if refs[2].Ref != "refs/tags/v1.0.0" || refs[2].Sha != tagSha {
+		t.Fatalf("unexpected ref: %v", refs[2])
+	}
+
+	// empty repository
+	refs, err = parseRefsAdvertisement(strings.NewReader(pktLine("# service=git-upload-pack\n") + "0000" + pktLine(strings.Repeat("0", 40)+" capabilities^{}\x00agent=git/2.39.5\n") + "0000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 0 {
+		t.Fatalf("expected no refs, got %v", refs)
+	}
+
+	_, err = parseRefsAdvertisement(strings.NewReader(pktLine("not-a-sha HEAD\n")))
+	if err == nil {
+		t.Fatal("should fail with invalid ref advertisement")
+	}
+}
+
+func TestResolveRefSha(t *testing.T) {
+	refs := []GitRef{
+		{Ref: "HEAD", Sha: "6ecf3bc7f4f5bd4c8c3b8c2e07a5d5d1cd7a8d9e"},
+		{Ref: "refs/heads/main", Sha: "6ecf3bc7f4f5bd4c8c3b8c2e07a5d5d1cd7a8d9e"},
+		{Ref: "refs/heads/deadbeef", Sha: "0a2b5c4c4b0f9a3b0c3d9e8f7a6b5c4d3e2f1a0b"},
+		{Ref: "refs/tags/v1.0.0", Sha: "deadbeef4b0f9a3b0c3d9e8f7a6b5c4d3e2f1a0b"},
+		{Ref: "refs/tags/6ecf", Sha: "1111111111111111111111111111111111111111"},
+	}
+	for ref, expected := range map[string]string{
+		"main":     "6ecf3bc7f4f5bd4c8c3b8c2e07a5d5d1cd7a8d9e",
+		"v1.0.0":   "deadbeef4b0f9a3b0c3d9e8f7a6b5c4d3e2f1a0b",
+		"deadbeef": "0a2b5c4c4b0f9a3b0c3d9e8f7a6b5c4d3e2f1a0b", // the branch wins over the sha prefix
+		"6ecf":     "1111111111111111111111111111111111111111", // the tag wins over the sha prefix
+		"6ecf3bc":  "6ecf3bc7f4f5bd4c8c3b8c2e07a5d5d1cd7a8d9e",
+		"0a2b":     "0a2b",    // too short to be a sha prefix
+		"abcdef1":  "abcdef1", // unknown commit
+		"":         "",
+	} {
+		if sha := resolveRefSha(refs, ref); sha != expected {
+			t.Fatalf("expected %q to be resolved to %s, got %s", ref, expected, sha)
+		}
+	}
+}
+
+func TestCutGitHostPrefix(t *testing.T) {
+	for pathname, expected := range map[string][2]string{
+		"/gh/owner/repo":                {"gh", "/owner/repo"},
+		"/github.com/owner/repo":        {"gh", "/owner/repo"},
+		"/gitlab/owner/repo@v1.0.0":     {"gitlab", "/owner/repo@v1.0.0"},
+		"/bitbucket.org/owner/repo/mod": {"bitbucket", "/owner/repo/mod"},
+		"/git/gitea/owner/repo":         {"git/gitea", "/owner/repo"},
+	} {
+		prefix, rest, ok := cutGitHostPrefix(pathname)
+		if !ok || prefix != expected[0] || rest != expected[1] {
+			t.Fatalf("cutGitHostPrefix(%q): unexpected result (%q, %q, %v)", pathname, prefix, rest, ok)
+		}
+	}
+	if _, _, ok := cutGitHostPrefix("/react@19.0.0"); ok {
+		t.Fatal("cutGitHostPrefix: should not match npm packages")
+	}
+}
+
+// TestGitHttpBackend lists refs and installs a repository from a custom git host that is
+// served by `git http-backend`.
+func TestGitHttpBackend(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	execPath, err := exec.Command(gitPath, "--exec-path").Output()
+	if err != nil {
+		t.Skip("git exec path not found")
+	}
+	httpBackend := filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend")
+	if !existsFile(httpBackend) {
+		t.Skip("git-http-backend not found")
+	}
+
+	root := t.TempDir()
+	workTree := filepath.Join(root, "work")
+	git := func(dir string, args ...string) {
+		cmd := exec.Command(gitPath, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=esm.sh", "GIT_AUTHOR_EMAIL=test@esm.sh", "GIT_COMMITTER_NAME=esm.sh", "GIT_COMMITTER_EMAIL=test@esm.sh")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+	os.MkdirAll(workTree, 0755)
+	os.WriteFile(filepath.Join(workTree, "package.json"), []byte(`{"name":"lib","version":"1.0.0","main":"index.js"}`), 0644)
+	os.WriteFile(filepath.Join(workTree, "index.js"), []byte(`export default "hello";`), 0644)
+	git(workTree, "init", "-q", "-b", "main")
+	git(workTree, "add", "-A")
+	git(workTree, "commit", "-q", "-m", "init")
+	git(workTree, "tag", "v1.0.0")
+	git(root, "clone", "-q", "--bare", workTree, filepath.Join(root, "repos", "team", "lib.git"))
+
+	backend := &cgi.Handler{
+		Path: httpBackend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Join(root, "repos"), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(401)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	host := &GitHost{Prefix: "git/test", BaseURL: server.URL, Token: "secret"}
+	refs, err := host.ListRepoRefsContext(context.Background(), "team/lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headSha, tagSha string
+	for _, ref := range refs {
+		switch ref.Ref {
+		case "HEAD":
+			headSha = ref.Sha
+		case "refs/tags/v1.0.0":
+			tagSha = ref.Sha
+		}
+	}
+	if headSha == "" || headSha != tagSha {
+		t.Fatalf("unexpected refs: %v", refs)
+	}
+
+	wd := filepath.Join(root, "install")
+	err = host.InstallContext(context.Background(), wd, "team/lib", headSha[:7])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(wd, "node_modules/team/lib/index.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `export default "hello";` {
+		t.Fatalf("unexpected content of index.js: %q", data)
+	}
+
+	unauthorized := &GitHost{Prefix: "git/test", BaseURL: server.URL + "/"}
+	_, err = unauthorized.ListRepoRefsContext(context.Background(), "team/lib")
+	if err == nil || !strings.HasSuffix(err.Error(), " not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestPrivateGhRepos(t *testing.T) {
+	githubTokens := config.GithubTokens
+	config.GithubTokens = map[string]GithubTokenConfig{
+		"acme": {Token: "ghp_secret", ClientTokens: []string{"client-secret"}},
+	}
+	defer func() { config.GithubTokens = githubTokens }()
+
+	for pathname, expected := range map[string]string{
+		"/gh/acme/lib":        "acme/lib",
+		"/gh/ACME/lib@v1.0.0": "ACME/lib",
+		"/github.com/acme/lib@1a2b3c4/es2022/lib.mjs": "acme/lib",
+		"/gh/*acme/lib@1a2b3c4/es2022/lib.mjs":        "acme/lib",
+		"/*gh/acme/lib@1a2b3c4/es2022/lib.mjs":        "acme/lib",
+		"/types/gh/acme/lib@1a2b3c4":                  "", // the `types` package
+		"/gh/public/lib":                              "",
+		"/gitlab/acme/lib":                            "",
+		"/acme@1.0.0":                                 "",
+	} {
+		repo, ok := getPrivateGhRepo(pathname)
+		if !ok {
+			repo = ""
+		}
+		if repo != expected {
+			t.Fatalf("getPrivateGhRepo(%q): expected %q, got (%q, %v)", pathname, expected, repo, ok)
+		}
+	}
+
+	if !isAuthorizedGhClient("acme/lib", "Bearer client-secret") {
+		t.Fatal("client with valid token should be authorized")
+	}
+	if isAuthorizedGhClient("acme/lib", "Bearer wrong") || isAuthorizedGhClient("acme/lib", "") || isAuthorizedGhClient("acme/lib", "client-secret") {
+		t.Fatal("client without valid token should not be authorized")
+	}
+	if !isAuthorizedGhClient("public/lib", "") {
+		t.Fatal("public repositories should be accessible")
+	}
+
+	if githubHost.authorization("acme/lib") != "Basic "+base64.StdEncoding.EncodeToString([]byte("x-access-token:ghp_secret")) {
+		t.Fatal("github token should be sent for private repositories")
+	}
+	if githubHost.authorization("public/lib") != "" {
+		t.Fatal("github token should not be sent for public repositories")
+	}
+	if u := githubHost.archiveURL("acme/lib", "v1.0.0"); u != "https://api.github.com/repos/acme/lib/tarball/v1.0.0" {
+		t.Fatalf("unexpected archive url of private repository: %s", u)
+	}
+
+	if p := normalizeSavePath("modules/gh/acme/lib@1a2b3c4/es2022/lib.mjs"); p != "private/modules/gh/acme/lib@1a2b3c4/es2022/lib.mjs" {
+		t.Fatalf("unexpected save path of private repository: %s", p)
+	}
+	if p := normalizeSavePath("types/gh/public/lib@1a2b3c4/index.d.ts"); p != "types/gh/public/lib@1a2b3c4/index.d.ts" {
+		t.Fatalf("unexpected save path of public repository: %s", p)
+	}
+	if k := normalizeMetaStoreKey("/gh/acme/lib@1a2b3c4/es2022/lib.mjs"); !strings.HasPrefix(k, "private/meta/") {
+		t.Fatalf("unexpected meta key of private repository: %s", k)
+	}
+
+	// private repositories can't be dependencies of other packages
+	if !isPrivateGhDependency(context.Background(), npm.Package{Github: true, Name: "acme/lib", Version: "1a2b3c4"}) {
+		t.Fatal("private repository should not be a dependency")
+	}
+	if isPrivateGhDependency(withPrivateGhRepo(context.Background(), "ACME/lib"), npm.Package{Github: true, Name: "acme/lib", Version: "1a2b3c4", Workspace: "packages/foo"}) {
+		t.Fatal("the repository being built should be allowed as a dependency")
+	}
+	if isPrivateGhDependency(context.Background(), npm.Package{Github: true, Name: "public/lib"}) || isPrivateGhDependency(context.Background(), npm.Package{Github: true, GitHost: "gitlab", Name: "acme/lib"}) {
+		t.Fatal("public repositories should be allowed as dependencies")
+	}
+	err := DefaultNpmRC().installDependenciesContext(context.Background(), t.TempDir(), &npm.PackageJSON{Name: "public-pkg", Dependencies: map[string]string{"lib": "github:acme/lib#1a2b3c4"}}, false, nil)
+	if err == nil || !strings.Contains(err.Error(), "private repository 'acme/lib'") {
+		t.Fatalf("expected private repository error, got %v", err)
+	}
+}
+
+func TestGitWorkspace(t *testing.T) {
+	workDir := config.WorkDir
+	config.WorkDir = t.TempDir()
+	defer func() { config.WorkDir = workDir }()
+
+	npmrc := DefaultNpmRC()
+	repo := npm.Package{Github: true, Name: "acme/mono", Version: "1a2b3c4d"}
+	repoDir := filepath.Join(npmrc.StoreDir(), repo.String(), "node_modules", repo.Name)
+	for name, content := range map[string]string{
+		"package.json":                   `{"name":"mono","private":true,"workspaces":["packages/*"]}`,
+		"packages/foo/package.json":      `{"name":"@acme/foo","version":"1.0.0","dependencies":{"@acme/bar":"workspace:^","react":"^19.0.0"}}`,
+		"packages/foo/index.js":          `export { bar } from "@acme/bar";`,
+		"packages/foo/node_modules/x.js": `export default "x";`,
+		"packages/bar/package.json":      `{"name":"@acme/bar","version":"1.0.0"}`,
+		"packages/bar/index.js":          `export const bar = "bar";`,
+	} {
+		filename := filepath.Join(repoDir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		os.WriteFile(filename, []byte(content), 0644)
+	}
+
+	esm := EsmPath{GhPrefix: true, PkgName: repo.Name, PkgVersion: repo.Version}
+	workspace, rest, err := findGitWorkspace(npmrc, esm, "packages/foo/index.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspace != "packages/foo" || rest != "index.js" {
+		t.Fatalf("unexpected workspace %q and sub-path %q", workspace, rest)
+	}
+	workspace, rest, err = findGitWorkspace(npmrc, esm, "src/index.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspace != "" || rest != "src/index.js" {
+		t.Fatalf("unexpected workspace %q and sub-path %q", workspace, rest)
+	}
+
+	esm.Workspace = "packages/foo"
+	if esm.PackageId() != "gh/acme/mono@1a2b3c4d/packages/foo" {
+		t.Fatalf("unexpected package id: %s", esm.PackageId())
+	}
+	if esm.moduleName() != "foo" {
+		t.Fatalf("unexpected module name: %s", esm.moduleName())
+	}
+
+	pkgJson, err := npmrc.installPackage(esm.Package())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgJson.Name != "@acme/foo" {
+		t.Fatalf("unexpected package name: %s", pkgJson.Name)
+	}
+	if pkgJson.Dependencies["@acme/bar"] != "github:acme/mono#1a2b3c4d&path:/packages/bar" || pkgJson.Dependencies["react"] != "^19.0.0" {
+		t.Fatalf("unexpected dependencies: %v", pkgJson.Dependencies)
+	}
+	pkg := esm.Package()
+	pkgDir := filepath.Join(npmrc.StoreDir(), pkg.String(), "node_modules", repo.Name)
+	if !existsFile(filepath.Join(pkgDir, "index.js")) {
+		t.Fatal("index.js should be copied")
+	}
+	if existsFile(filepath.Join(pkgDir, "node_modules", "x.js")) {
+		t.Fatal("node_modules should be skipped")
+	}
+
+	dep, err := npm.ResolveDependencyVersion(pkgJson.Dependencies["@acme/bar"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dep.String() != "gh/acme/mono@1a2b3c4d/packages/bar" {
+		t.Fatalf("unexpected dependency: %s", dep.String())
+	}
+}
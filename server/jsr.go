@@ -0,0 +1,313 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esm-dev/esm.sh/internal/fetch"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/gox/term"
+	"github.com/ije/gox/utils"
+)
+
+// the origin of the JSR registry, the packages in the `@jsr` scope are installed from
+// the JSR registry natively instead of the npm compatibility layer (npm.jsr.io).
+// see https://jsr.io/docs/api#registry-api
+var jsrOrigin = "https://jsr.io"
+
+// JsrPackageMeta defines the `meta.json` of a JSR package
+type JsrPackageMeta struct {
+	Scope    string                       `json:"scope"`
+	Name     string                       `json:"name"`
+	Latest   string                       `json:"latest"`
+	Versions map[string]JsrPackageVersion `json:"versions"`
+}
+
+// JsrPackageVersion defines the version info in the `meta.json` of a JSR package
+type JsrPackageVersion struct {
+	Yanked bool `json:"yanked"`
+}
+
+// JsrVersionMeta defines the `<version>_meta.json` of a JSR package
+type JsrVersionMeta struct {
+	Manifest     map[string]JsrManifestEntry `json:"manifest"`
+	Exports      npm.JSONObject              `json:"exports"`
+	ModuleGraph2 map[string]JsrModuleInfo    `json:"moduleGraph2"`
+}
+
+// JsrManifestEntry defines a file in the manifest of a JSR package version
+type JsrManifestEntry struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// JsrModuleInfo defines a module in the module graph of a JSR package version
+type JsrModuleInfo struct {
+	Dependencies []struct {
+		Specifier string `json:"specifier"`
+	} `json:"dependencies"`
+}
+
+// isNativeJsrPackage returns true if the package is in the `@jsr` scope and the scope
+// is not configured to use a custom npm registry.
+func (npmrc *NpmRC) isNativeJsrPackage(pkgName string) bool {
+	return strings.HasPrefix(pkgName, "@jsr/") && npmrc != nil && npmrc.getRegistryByPackageName(pkgName).Registry == jsrRegistry
+}
+
+// splitJsrPackageName splits the npm name of a JSR package into the scope and name,
+// e.g. "@jsr/std__path" -> ("std", "path")
+func splitJsrPackageName(pkgName string) (scope string, name string, ok bool) {
+	scopedName, ok := strings.CutPrefix(pkgName, "@jsr/")
+	if !ok {
+		return
+	}
+	scope, name, ok = strings.Cut(scopedName, "__")
+	ok = ok && scope != "" && name != ""
+	return
+}
+
+// toJsrNpmPackageName converts the JSR package name to the npm name, e.g. "@std/path" -> "@jsr/std__path"
+func toJsrNpmPackageName(name string) string {
+	scope, name := utils.SplitByFirstByte(name, '/')
+	return "@jsr/" + strings.TrimPrefix(scope, "@") + "__" + name
+}
+
+// fetchJsrJSON fetches a JSON file from the JSR registry.
+func fetchJsrJSON(ctx context.Context, pathname string, v any) (err error) {
+	u, err := url.Parse(jsrOrigin + pathname)
+	if err != nil {
+		return
+	}
+
+	if DEBUG {
+		fmt.Println(term.Dim(fmt.Sprintf("Fetching %s...", u.String())))
+	}
+
+	fetchClient := fetch.NewClient("esmd/"+VERSION, 15, false)
+
+	retryTimes := 0
+RETRY:
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	res, err := fetchClient.FetchWithContext(ctx, u, nil)
+	if err != nil {
+		if retryTimes < 3 {
+			retryTimes++
+			if sleepErr := sleepWithContext(ctx, time.Duration(retryTimes)*100*time.Millisecond); sleepErr != nil {
+				return sleepErr
+			}
+			goto RETRY
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return errors.New("not found")
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("%s: %s", u.Hostname(), res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// fetchJsrPackageMetadataContext fetches the versions of a JSR package, the yanked versions are excluded
+// unless the version is requested exactly.
+func fetchJsrPackageMetadataContext(ctx context.Context, pkgName string, version string) (*npm.PackageMetadata, error) {
+	scope, name, ok := splitJsrPackageName(pkgName)
+	if !ok {
+		return nil, fmt.Errorf("invalid jsr package name '%s'", pkgName)
+	}
+	var meta JsrPackageMeta
+	err := fetchJsrJSON(ctx, fmt.Sprintf("/@%s/%s/meta.json", scope, name), &meta)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, fmt.Errorf("package '%s' not found", pkgName)
+		}
+		return nil, err
+	}
+	metadata := &npm.PackageMetadata{
+		DistTags: map[string]string{},
+		Versions: map[string]npm.PackageJSONRaw{},
+	}
+	for v, info := range meta.Versions {
+		if info.Yanked && v != version {
+			continue
+		}
+		metadata.Versions[v] = npm.PackageJSONRaw{Name: pkgName, Version: v}
+	}
+	if _, ok := metadata.Versions[meta.Latest]; ok {
+		metadata.DistTags["latest"] = meta.Latest
+	}
+	if len(metadata.Versions) == 0 {
+		return nil, fmt.Errorf("version %s of '%s' not found", version, pkgName)
+	}
+	return metadata, nil
+}
+
+// installJsrPackageContext installs a JSR package by downloading the module files listed in the manifest of
+// the version, and creates a `package.json` file with the exports and the dependencies of the package.
+func installJsrPackageContext(ctx context.Context, installDir string, pkgName string, version string) (err error) {
+	scope, name, ok := splitJsrPackageName(pkgName)
+	if !ok {
+		return fmt.Errorf("invalid jsr package name '%s'", pkgName)
+	}
+
+	var meta JsrVersionMeta
+	err = fetchJsrJSON(ctx, fmt.Sprintf("/@%s/%s/%s_meta.json", scope, name, version), &meta)
+	if err != nil {
+		if err.Error() == "not found" {
+			return fmt.Errorf("version %s of '%s' not found", version, pkgName)
+		}
+		return
+	}
+
+	var totalSize int64
+	for filename, entry := range meta.Manifest {
+		if !strings.HasPrefix(filename, "/") || path.Clean(filename) != filename {
+			return fmt.Errorf("invalid file path '%s' in the manifest of '%s@%s'", filename, pkgName, version)
+		}
+		totalSize += entry.Size
+	}
+	if totalSize > maxPackageTarballSize {
+		return fmt.Errorf("package '%s@%s' is too large", pkgName, version)
+	}
+
+	defer func() {
+		if err != nil {
+			// clear installDir if failed to install, otherwise the partial
+			// installation would be treated as a completed installation
+			os.RemoveAll(installDir)
+		}
+	}()
+
+	pkgDir := filepath.Join(installDir, "node_modules", pkgName)
+	fetchClient := fetch.NewClient("esmd/"+VERSION, 30, false)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	queue := make(chan struct{}, 8)
+	for filename, entry := range meta.Manifest {
+		wg.Add(1)
+		queue <- struct{}{}
+		go func(filename string, entry JsrManifestEntry) {
+			defer func() {
+				<-queue
+				wg.Done()
+			}()
+			err := downloadJsrFile(ctx, fetchClient, fmt.Sprintf("%s/@%s/%s/%s%s", jsrOrigin, scope, name, version, filename), filepath.Join(pkgDir, filename), entry)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(filename, entry)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return fmt.Errorf("failed to install '%s@%s': %v", pkgName, version, firstErr)
+	}
+
+	// write `package.json` at last
+	pkgJson := map[string]any{
+		"name":    pkgName,
+		"version": version,
+		"type":    "module",
+	}
+	if meta.Exports.Len() > 0 {
+		exports := bytes.NewBufferString("{")
+		for _, key := range meta.Exports.Keys() {
+			if s, ok := meta.Exports.Values()[key].(string); ok {
+				if exports.Len() > 1 {
+					exports.WriteByte(',')
+				}
+				exports.Write(utils.MustEncodeJSON(key))
+				exports.WriteByte(':')
+				exports.Write(utils.MustEncodeJSON(s))
+			}
+		}
+		exports.WriteByte('}')
+		pkgJson["exports"] = json.RawMessage(exports.Bytes())
+	}
+	if deps := getJsrDependencies(meta.ModuleGraph2); len(deps) > 0 {
+		pkgJson["dependencies"] = deps
+	}
+	data, err := json.Marshal(pkgJson)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(pkgDir, "package.json"), data, 0644)
+}
+
+// downloadJsrFile downloads a module file of a JSR package and verifies the checksum of the file.
+func downloadJsrFile(ctx context.Context, fetchClient *fetch.FetchClient, fileUrl string, filename string, entry JsrManifestEntry) (err error) {
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return
+	}
+	res, err := fetchClient.FetchWithContext(ctx, u, nil)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("could not download %s: %s", fileUrl, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, entry.Size+1))
+	if err != nil {
+		return
+	}
+	if algorithm, checksum, ok := strings.Cut(entry.Checksum, "-"); ok && algorithm == "sha256" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != checksum {
+			return fmt.Errorf("checksum mismatch of %s", fileUrl)
+		}
+	}
+	err = ensureDir(filepath.Dir(filename))
+	if err != nil {
+		return
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// getJsrDependencies returns the `jsr:` and `npm:` dependencies in the module graph of a JSR package,
+// the JSR dependencies are mapped to the npm names, e.g. "jsr:@std/path@^1.0.0" -> "@jsr/std__path": "^1.0.0"
+func getJsrDependencies(moduleGraph map[string]JsrModuleInfo) map[string]string {
+	deps := map[string]string{}
+	for _, module := range moduleGraph {
+		for _, dep := range module.Dependencies {
+			var pkgName, pkgVersion string
+			if specifier, ok := strings.CutPrefix(dep.Specifier, "jsr:"); ok {
+				pkgName, pkgVersion, _ = splitEsmPath(specifier)
+				if !strings.HasPrefix(pkgName, "@") || !strings.ContainsRune(pkgName, '/') {
+					continue
+				}
+				pkgName = toJsrNpmPackageName(pkgName)
+			} else if specifier, ok := strings.CutPrefix(dep.Specifier, "npm:"); ok {
+				pkgName, pkgVersion, _ = splitEsmPath(specifier)
+			}
+			if pkgName != "" && pkgVersion != "" {
+				deps[pkgName] = pkgVersion
+			}
+		}
+	}
+	return deps
+}
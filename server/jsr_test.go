@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestJsrPackageName(t *testing.T) {
+	scope, name, ok := splitJsrPackageName("@jsr/std__path")
+	if !ok || scope != "std" || name != "path" {
+		t.Fatalf("splitJsrPackageName: unexpected result %q %q %v", scope, name, ok)
+	}
+	for _, pkgName := range []string{"@jsr/std", "@jsr/__path", "@std/path", "react"} {
+		if _, _, ok := splitJsrPackageName(pkgName); ok {
+			t.Fatalf("splitJsrPackageName(%q): should be invalid", pkgName)
+		}
+	}
+	if got := toJsrNpmPackageName("@std/path"); got != "@jsr/std__path" {
+		t.Fatalf("toJsrNpmPackageName: expected '@jsr/std__path', got %q", got)
+	}
+}
+
+func TestToDeclarationPath(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"./mod.ts":       "./mod.d.ts",
+		"/mod.tsx":       "/mod.d.ts",
+		"/lib/index.mts": "/lib/index.d.mts",
+		"/lib/index.cts": "/lib/index.d.cts",
+	} {
+		if got := toDeclarationPath(filename); got != expected {
+			t.Fatalf("toDeclarationPath(%q): expected %q, got %q", filename, expected, got)
+		}
+	}
+}
+
+func TestGetJsrDependencies(t *testing.T) {
+	deps := getJsrDependencies(map[string]JsrModuleInfo{
+		"/mod.ts": {Dependencies: []struct {
+			Specifier string `json:"specifier"`
+		}{
+			{Specifier: "jsr:@std/path@^1.0.0"},
+			{Specifier: "jsr:@std/path@^1.0.0/join"},
+			{Specifier: "npm:react@^19.0.0"},
+			{Specifier: "./util.ts"},
+			{Specifier: "jsr:invalid@1.0.0"},
+		}},
+	})
+	if len(deps) != 2 || deps["@jsr/std__path"] != "^1.0.0" || deps["react"] != "^19.0.0" {
+		t.Fatalf("unexpected dependencies: %v", deps)
+	}
+}
+
+func TestInstallJsrPackage(t *testing.T) {
+	modTs := "export function add(a: number, b: number): number { return a + b; }\n"
+	sum := sha256.Sum256([]byte(modTs))
+	checksum := "sha256-" + hex.EncodeToString(sum[:])
+	corrupted := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/@test/math/meta.json":
+			w.Write([]byte(`{"scope":"test","name":"math","latest":"1.0.0","versions":{"1.0.0":{},"1.1.0":{"yanked":true}}}`))
+		case "/@test/math/1.0.0_meta.json":
+			w.Write([]byte(`{"manifest":{"/mod.ts":{"size":` + strconv.Itoa(len(modTs)) + `,"checksum":"` + checksum + `"}},"exports":{"./sub":"./mod.ts",".":"./mod.ts"},"moduleGraph2":{"/mod.ts":{"dependencies":[{"specifier":"jsr:@std/path@^1.0.0"}]}}}`))
+		case "/@test/math/1.0.0/mod.ts":
+			if corrupted {
+				w.Write([]byte("export const evil = true;\n"))
+			} else {
+				w.Write([]byte(modTs))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	origin := jsrOrigin
+	jsrOrigin = server.URL
+	defer func() { jsrOrigin = origin }()
+
+	metadata, err := fetchJsrPackageMetadataContext(context.Background(), "@jsr/test__math", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := metadata.Versions["1.1.0"]; ok {
+		t.Fatal("yanked version should be excluded")
+	}
+	if metadata.DistTags["latest"] != "1.0.0" {
+		t.Fatalf("expected latest tag '1.0.0', got %q", metadata.DistTags["latest"])
+	}
+	metadata, err = fetchJsrPackageMetadataContext(context.Background(), "@jsr/test__math", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := metadata.Versions["1.1.0"]; !ok {
+		t.Fatal("yanked version should be included if requested exactly")
+	}
+
+	installDir := t.TempDir()
+	err = installJsrPackageContext(context.Background(), installDir, "@jsr/test__math", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgDir := filepath.Join(installDir, "node_modules", "@jsr/test__math")
+	data, err := os.ReadFile(filepath.Join(pkgDir, "mod.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != modTs {
+		t.Fatalf("unexpected content of mod.ts: %q", data)
+	}
+	data, err = os.ReadFile(filepath.Join(pkgDir, "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"exports":{"./sub":"./mod.ts",".":"./mod.ts"}`) {
+		t.Fatalf("exports should keep the original order: %s", data)
+	}
+	if !strings.Contains(string(data), `"dependencies":{"@jsr/std__path":"^1.0.0"}`) {
+		t.Fatalf("missing dependencies: %s", data)
+	}
+
+	corrupted = true
+	installDir = filepath.Join(t.TempDir(), "corrupted")
+	err = installJsrPackageContext(context.Background(), installDir, "@jsr/test__math", "1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch error, got %v", err)
+	}
+	if existsDir(installDir) {
+		t.Fatal("install directory should be removed after a failed installation")
+	}
+}
@@ -12,6 +12,9 @@ import (
 	esbuild "github.com/ije/esbuild-internal/api"
 )
 
+// loaderRevision is bumped when the loader scripts are changed to recompile the cached loaders.
+const loaderRevision = "2"
+
 type LoaderOutput struct {
 	Lang  string `json:"lang"`
 	Code  string `json:"code"`
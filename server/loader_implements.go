@@ -11,7 +11,7 @@ import (
 )
 
 func transformSvelte(ctx context.Context, npmrc *NpmRC, svelteVersion string, filename string, code string) (output *LoaderOutput, err error) {
-	loaderExecPath := path.Join(npmrc.StoreDir(), "svelte@"+svelteVersion, "loader.js")
+	loaderExecPath := path.Join(npmrc.StoreDir(), "svelte@"+svelteVersion, "loader-"+loaderRevision+".js")
 
 	err = doOnce(loaderExecPath, func() (err error) {
 		if !existsFile(loaderExecPath) {
@@ -53,7 +53,9 @@ func compileSvelteLoader(ctx context.Context, npmrc *NpmRC, svelteVersion string
 	      sourceCode += text;
 	    }
 	    const { js } = compile(sourceCode, { filename: Deno.args[0], css: "injected" });
-	    await write("1\n" + js.code);
+	    // embed the source map so that esbuild can remap the output to the original component
+	    const sourceMappingURL = js.map ? "\n//# sourceMappingURL=" + js.map.toUrl() : "";
+	    await write("1\n" + js.code + sourceMappingURL);
 	  } catch (err) {
 	    await write("0\n" + err.message);
 	  }
@@ -64,7 +66,7 @@ func compileSvelteLoader(ctx context.Context, npmrc *NpmRC, svelteVersion string
 
 func transformVue(ctx context.Context, npmrc *NpmRC, vueVersion string, filename string, code string) (output *LoaderOutput, err error) {
 	loaderVersion := "1.0.1" // @esm.sh/vue-compiler
-	loaderExecPath := path.Join(npmrc.StoreDir(), "@vue/compiler-sfc@"+vueVersion, "loader-"+loaderVersion+".js")
+	loaderExecPath := path.Join(npmrc.StoreDir(), "@vue/compiler-sfc@"+vueVersion, "loader-"+loaderVersion+"-"+loaderRevision+".js")
 
 	err = doOnce(loaderExecPath, func() (err error) {
 		if !existsFile(loaderExecPath) {
@@ -110,8 +112,64 @@ func compileVueLoader(ctx context.Context, npmrc *NpmRC, vueVersion string, load
 	    for await (const text of stdin.readable.pipeThrough(new TextDecoderStream())) {
 	      sourceCode += text;
 	    }
-	    const { lang, code } = await transform(Deno.args[0], sourceCode, { imports: { "@vue/compiler-sfc": vueCompilerSFC } });
-	    await write((lang === "ts" ? '2' : '1') + '\n' + code);
+	    const { lang, code, map } = await transform(Deno.args[0], sourceCode, { imports: { "@vue/compiler-sfc": vueCompilerSFC } });
+	    // embed the source map so that esbuild can remap the output to the original SFC
+	    const sourceMappingURL = map ? "\n//# sourceMappingURL=data:application/json;base64," + btoa(unescape(encodeURIComponent(typeof map === "string" ? map : JSON.stringify(map)))) : "";
+	    await write((lang === "ts" ? '2' : '1') + '\n' + code + sourceMappingURL);
+	  } catch (err) {
+	    await write("0\n" + err.message);
+	  }
+	`
+	err = buildLoader(wd, loaderJS, loaderExecPath)
+	return
+}
+
+// transpileDeclaration generates the declaration file of a typescript module with the `transpileDeclaration` API
+// of the TypeScript compiler, the module must not have "slow types", which is enforced by JSR when publishing.
+// see https://jsr.io/docs/about-slow-types
+func transpileDeclaration(ctx context.Context, npmrc *NpmRC, filename string, code string) (output *LoaderOutput, err error) {
+	loaderExecPath := path.Join(npmrc.StoreDir(), "typescript@"+typescriptVersion, "loader-dts-"+loaderRevision+".js")
+
+	err = doOnce(loaderExecPath, func() (err error) {
+		if !existsFile(loaderExecPath) {
+			if DEBUG {
+				fmt.Println(term.Dim("Compiling typescript declaration loader..."))
+			}
+			err = compileDeclarationLoader(ctx, npmrc, loaderExecPath)
+		}
+		return
+	})
+	if err != nil {
+		err = errors.New("failed to compile typescript declaration loader: " + err.Error())
+		return
+	}
+
+	return runLoaderContext(ctx, loaderExecPath, filename, code)
+}
+
+func compileDeclarationLoader(ctx context.Context, npmrc *NpmRC, loaderExecPath string) (err error) {
+	wd := path.Join(npmrc.StoreDir(), "typescript@"+typescriptVersion)
+
+	// install typescript
+	_, err = npmrc.installPackageContext(ctx, npm.Package{Name: "typescript", Version: typescriptVersion})
+	if err != nil {
+		return
+	}
+
+	loaderJS := `
+	  import ts from "typescript";
+	  const { stdin, stdout } = Deno;
+	  const write = data => stdout.write(new TextEncoder().encode(data));
+	  try {
+	    let sourceCode = "";
+	    for await (const text of stdin.readable.pipeThrough(new TextDecoderStream())) {
+	      sourceCode += text;
+	    }
+	    const { outputText } = ts.transpileDeclaration(sourceCode, {
+	      fileName: Deno.args[0],
+	      compilerOptions: { allowImportingTsExtensions: true },
+	    });
+	    await write("2\n" + outputText);
 	  } catch (err) {
 	    await write("0\n" + err.message);
 	  }
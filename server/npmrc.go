@@ -102,6 +102,11 @@ func (npmrc *NpmRC) getRegistryByPackageName(packageName string) *NpmRegistry {
 }
 
 func (npmrc *NpmRC) fetchPackageMetadataContext(ctx context.Context, pkgName string, version string, isWellknownVersion bool) (*npm.PackageMetadata, *npm.PackageJSONRaw, error) {
+	if npmrc.isNativeJsrPackage(pkgName) {
+		metadata, err := fetchJsrPackageMetadataContext(ctx, pkgName, version)
+		return metadata, nil, err
+	}
+
 	reg := npmrc.getRegistryByPackageName(pkgName)
 	regUrlStr := reg.Registry
 	if reg.isRateLimited() && reg.BackupRegistry != "" {
@@ -345,8 +350,18 @@ func (npmrc *NpmRC) installPackageContext(ctx context.Context, pkg npm.Package)
 		return
 	}
 
-	if pkg.Github {
-		err = ghInstallContext(ctx, installDir, pkg.Name, pkg.Version)
+	if pkg.Github && pkg.Workspace != "" {
+		err = npmrc.installGitWorkspaceContext(ctx, installDir, pkg)
+	} else if pkg.Github {
+		host := githubHost
+		if pkg.GitHost != "" {
+			var ok bool
+			host, ok = getGitHost(pkg.GitHost)
+			if !ok {
+				return nil, fmt.Errorf("git host '%s' not found", pkg.GitHost)
+			}
+		}
+		err = host.InstallContext(ctx, installDir, pkg.Name, pkg.Version)
 		// ensure 'package.json' file if not exists after installing from github
 		if err == nil && !existsFile(packageJsonPath) {
 			buf := bytes.NewBuffer(nil)
@@ -396,8 +411,16 @@ func (npmrc *NpmRC) installPackageContext(ctx context.Context, pkg npm.Package)
 				return
 			}
 		}
+	} else if pkg.Tarball != "" {
+		err = installTarballPackageContext(ctx, installDir, pkg)
 	} else if pkg.PkgPrNew {
-		err = fetchPackageTarballContext(ctx, &NpmRegistry{}, installDir, pkg.Name, "https://pkg.pr.new/"+pkg.Name+"@"+pkg.Version)
+		err = fetchPackageTarballContext(ctx, &NpmRegistry{}, installDir, pkg.Name, prOrigin+"/"+pkg.Name+"@"+pkg.Version)
+	} else if npmrc.isNativeJsrPackage(pkg.Name) {
+		info, fetchErr := npmrc.getPackageInfoContext(ctx, pkg.Name, pkg.Version)
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		err = installJsrPackageContext(ctx, installDir, pkg.Name, info.Version)
 	} else {
 		info, fetchErr := npmrc.getPackageInfoContext(ctx, pkg.Name, pkg.Version)
 		if fetchErr != nil {
@@ -478,11 +501,24 @@ func (npmrc *NpmRC) installDependenciesContext(ctx context.Context, wd string, p
 			if p.Name != "" {
 				pkg = p
 			}
+			if p.Tarball != "" {
+				pkg = p
+				pkg.Name = name
+				// `file:` tarballs are resolved relative to the directory of the dependent package
+				var pkgDir string
+				if pkgJson.Name != "" {
+					pkgDir = filepath.Join(wd, "node_modules", pkgJson.Name)
+				}
+				if err := resolveTarballPackage(&pkg, pkgDir); err != nil {
+					setErr(err)
+					return
+				}
+			}
 			if strings.HasSuffix(pkg.Name, "@types/") {
 				// skip installing `@types/*` packages
 				return
 			}
-			if !npm.IsExactVersion(pkg.Version) && !pkg.Github && !pkg.PkgPrNew {
+			if !npm.IsExactVersion(pkg.Version) && !pkg.Github && !pkg.PkgPrNew && pkg.Tarball == "" {
 				p, e := npmrc.getPackageInfoContext(ctx, pkg.Name, pkg.Version)
 				if e != nil {
 					setErr(e)
@@ -490,6 +526,10 @@ func (npmrc *NpmRC) installDependenciesContext(ctx context.Context, wd string, p
 				}
 				pkg.Version = p.Version
 			}
+			if isPrivateGhDependency(ctx, pkg) {
+				setErr(fmt.Errorf("private repository '%s' can't be a dependency", pkg.Name))
+				return
+			}
 			markId := fmt.Sprintf("%s@%s:%s:%v", pkgJson.Name, pkgJson.Version, pkg.String(), npmMode)
 			if mark.Has(markId) {
 				return
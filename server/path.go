@@ -1,10 +1,12 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
@@ -18,7 +20,12 @@ import (
 )
 
 type EsmPath struct {
-	GhPrefix   bool
+	// GhPrefix is true for the packages from a git repository
+	GhPrefix bool
+	// GitHost is the prefix of the git host other than GitHub, e.g. "gitlab", "bitbucket", "git/gitea"
+	GitHost string
+	// Workspace is the directory of the workspace package in a monorepo, e.g. "packages/foo"
+	Workspace  string
 	PrPrefix   bool
 	PkgName    string
 	PkgVersion string
@@ -27,27 +34,65 @@ type EsmPath struct {
 
 func (p EsmPath) Package() npm.Package {
 	return npm.Package{
-		Github:   p.GhPrefix,
-		PkgPrNew: p.PrPrefix,
-		Name:     p.PkgName,
-		Version:  p.PkgVersion,
+		Github:    p.GhPrefix,
+		GitHost:   p.GitHost,
+		Workspace: p.Workspace,
+		PkgPrNew:  p.PrPrefix,
+		Name:      p.PkgName,
+		Version:   p.PkgVersion,
 	}
 }
 
+// RegistryPrefix returns the path prefix of the registry, e.g. "gh", "gitlab", "git/gitea", "pr",
+// or an empty string for npm packages.
+func (p EsmPath) RegistryPrefix() string {
+	if p.GhPrefix {
+		if p.GitHost != "" {
+			return p.GitHost
+		}
+		return "gh"
+	}
+	if p.PrPrefix {
+		return "pr"
+	}
+	return ""
+}
+
 func (p EsmPath) PackageId() string {
 	id := p.PkgName
 	if p.PkgVersion != "" && p.PkgVersion != "*" && p.PkgVersion != "latest" {
 		id += "@" + strings.ReplaceAll(p.PkgVersion, " ", "%20")
 	}
-	if p.GhPrefix {
-		return "gh/" + id
+	if p.Workspace != "" {
+		id += "/" + p.Workspace
 	}
-	if p.PrPrefix {
-		return "pr/" + id
+	if prefix := p.RegistryPrefix(); prefix != "" {
+		return prefix + "/" + id
 	}
 	return id
 }
 
+// gitHost returns the git host of the package, GitHub by default.
+func (p EsmPath) gitHost() (*GitHost, error) {
+	if p.GitHost == "" {
+		return githubHost, nil
+	}
+	host, ok := getGitHost(p.GitHost)
+	if !ok {
+		return nil, fmt.Errorf("git host '%s' not found", p.GitHost)
+	}
+	return host, nil
+}
+
+// moduleName returns the file name of the main module, e.g. "react" for "react@19.0.0",
+// or "foo" for the workspace package "packages/foo" of a monorepo.
+func (p EsmPath) moduleName() string {
+	if p.Workspace != "" {
+		return strings.TrimSuffix(path.Base(p.Workspace), ".js")
+	}
+	return strings.TrimSuffix(path.Base(p.PkgName), ".js")
+}
+
 func (p EsmPath) String() string {
 	if p.SubPath != "" {
 		return p.PackageId() + "/" + p.SubPath
@@ -91,28 +136,32 @@ func parseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 			return
 		}
 		if !isCommitish(esm.PkgVersion) {
-			err = errors.New("pkg.pr.new: tag or branch not found")
+			if isPrNumber(version) {
+				err = fmt.Errorf("pkg.pr.new: preview of pull request #%s not found", version)
+			} else {
+				err = errors.New("pkg.pr.new: tag or branch not found")
+			}
 		}
 		return
 	}
 
 	var ghPrefix bool
-	if strings.HasPrefix(pathname, "/gh/") {
-		if !strings.ContainsRune(pathname[4:], '/') {
+	var gitHost string
+	if prefix, rest, ok := cutGitHostPrefix(pathname); ok {
+		if !strings.ContainsRune(rest[1:], '/') {
 			err = errors.New("invalid path")
 			return
 		}
-		// add a leading `@` to the package name
-		pathname = "/@" + pathname[4:]
-		ghPrefix = true
-	} else if strings.HasPrefix(pathname, "/github.com/") {
-		if !strings.ContainsRune(pathname[12:], '/') {
-			err = errors.New("invalid path")
+		if _, ok := getGitHost(prefix); !ok {
+			err = fmt.Errorf("git host '%s' not found", strings.TrimPrefix(prefix, "git/"))
 			return
 		}
 		// add a leading `@` to the package name
-		pathname = "/@" + pathname[12:]
+		pathname = "/@" + rest[1:]
 		ghPrefix = true
+		if prefix != "gh" {
+			gitHost = prefix
+		}
 	} else if strings.HasPrefix(pathname, "/jsr/") {
 		segs := strings.Split(pathname[5:], "/")
 		if len(segs) < 2 || !strings.HasPrefix(segs[0], "@") {
@@ -164,21 +213,36 @@ func parseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 		PkgVersion: version,
 		SubPath:    stripEntryModuleExt(subPath),
 		GhPrefix:   ghPrefix,
+		GitHost:    gitHost,
 	}
 
 	if ghPrefix {
 		if npm.IsExactVersion(strings.TrimPrefix(esm.PkgVersion, "v")) || isCommitish(esm.PkgVersion) {
 			exactVersion = true
-			return
-		}
-
-		esm.PkgVersion, err = resolveGhPackageVersion(esm)
-		if err != nil {
-			return
+		} else {
+			esm.PkgVersion, err = resolveGhPackageVersion(esm)
+			if err != nil {
+				return
+			}
+			if !isCommitish(esm.PkgVersion) {
+				err = fmt.Errorf("%s: tag or branch not found", strings.TrimPrefix(esm.RegistryPrefix(), "git/"))
+				return
+			}
 		}
 
-		if !isCommitish(esm.PkgVersion) {
-			err = errors.New("github: tag or branch not found")
+		// check if the sub-path points to a workspace package of a monorepo,
+		// e.g. "/gh/owner/repo@ref/packages/foo"
+		if subPathRaw != "" && target == "" && xArgs == nil {
+			var workspace, rest string
+			workspace, rest, err = findGitWorkspace(npmrc, esm, subPathRaw)
+			if err != nil {
+				return
+			}
+			if workspace != "" {
+				subPath, target, xArgs = parseSubPath(rest)
+				esm.Workspace = workspace
+				esm.SubPath = stripEntryModuleExt(subPath)
+			}
 		}
 		return
 	}
@@ -301,9 +365,13 @@ func isPackageInExternalNamespace(pkgName string, external set.ReadOnlySet[strin
 }
 
 func resolveGhPackageVersion(esm EsmPath) (version string, err error) {
-	return withCache("gh/"+esm.PkgName+"@"+esm.PkgVersion, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() (version string, aliasKey string, err error) {
+	return withCache(esm.RegistryPrefix()+"/"+esm.PkgName+"@"+esm.PkgVersion, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() (version string, aliasKey string, err error) {
+		host, err := esm.gitHost()
+		if err != nil {
+			return
+		}
 		var refs []GitRef
-		refs, err = listGhRepoRefs(fmt.Sprintf("https://github.com/%s", esm.PkgName))
+		refs, err = host.ListRepoRefsContext(context.Background(), esm.PkgName)
 		if err != nil {
 			return
 		}
@@ -350,9 +418,11 @@ func resolveGhPackageVersion(esm EsmPath) (version string, err error) {
 	})
 }
 
+// resolvePrPackageVersion resolves the version of a pkg.pr.new package to a commit, the version can be
+// a branch, a tag, or a pull request number that resolves to the latest preview commit of the pull request.
 func resolvePrPackageVersion(esm EsmPath) (version string, err error) {
 	return withCache("pr/"+esm.PkgName+"@"+esm.PkgVersion, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() (version string, aliasKey string, err error) {
-		u, err := url.Parse(fmt.Sprintf("https://pkg.pr.new/%s@%s", esm.PkgName, esm.PkgVersion))
+		u, err := url.Parse(fmt.Sprintf("%s/%s@%s", prOrigin, esm.PkgName, esm.PkgVersion))
 		if err != nil {
 			return
 		}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esm-dev/esm.sh/internal/fetch"
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/gox/utils"
+	"github.com/ije/gox/valid"
+)
+
+// the origin of pkg.pr.new, see https://pkg.pr.new
+var prOrigin = "https://pkg.pr.new"
+
+// the origin of the GitHub REST API
+var githubApiOrigin = "https://api.github.com"
+
+// the maximum number of the pull requests that are checked for the preview builds
+const maxPrPreviews = 30
+
+// PrPreview represents a preview build of a pull request that is published to pkg.pr.new.
+type PrPreview struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	Url       string `json:"url"`
+	Branch    string `json:"branch"`
+	Commit    string `json:"commit"`
+	UpdatedAt string `json:"updatedAt"`
+	Module    string `json:"module"`
+}
+
+// PrPreviewList represents the preview builds of a package.
+type PrPreviewList struct {
+	Name     string      `json:"name"`
+	Repo     string      `json:"repo"`
+	Previews []PrPreview `json:"previews"`
+}
+
+// isPrNumber checks if the version of a pkg.pr.new package is a pull request number, e.g. "123".
+func isPrNumber(version string) bool {
+	return len(version) > 0 && len(version) < 7 && version[0] != '0' && valid.IsDigtalOnlyString(version)
+}
+
+// cutPrPackageName returns the package name of the pkg.pr.new path without a version,
+// e.g. "/pr/tinybench" -> "tinybench", "/pr/tinylibs/tinybench/tinybench" -> "tinylibs/tinybench/tinybench"
+func cutPrPackageName(pathname string) (pkgName string, ok bool) {
+	if after, found := strings.CutPrefix(pathname, "/pr/"); found {
+		pkgName = after
+	} else if after, found := strings.CutPrefix(pathname, "/pkg.pr.new/"); found {
+		pkgName = after
+	} else {
+		return "", false
+	}
+	pkgName = strings.TrimSuffix(pkgName, "/")
+	if pkgName == "" || strings.ContainsRune(pkgName[1:], '@') {
+		return "", false
+	}
+	return pkgName, true
+}
+
+// getPrPackageRepo returns the GitHub repository of a pkg.pr.new package. The repository is specified in
+// the full form "owner/repo/pkg", or resolved from the `repository` field of the package.json for the compact form.
+func getPrPackageRepo(npmrc *NpmRC, pkgName string) (repo string, name string, err error) {
+	segments := strings.Split(pkgName, "/")
+	if strings.HasPrefix(pkgName, "@") {
+		if len(segments) == 2 {
+			name = pkgName
+		}
+	} else if len(segments) == 1 {
+		name = pkgName
+	} else if len(segments) == 3 || (len(segments) == 4 && strings.HasPrefix(segments[2], "@")) {
+		return segments[0] + "/" + segments[1], strings.Join(segments[2:], "/"), nil
+	}
+	if name == "" || !npm.ValidatePackageName(name) {
+		return "", "", errors.New("invalid package name")
+	}
+	info, err := npmrc.getPackageInfo(name, "latest")
+	if err != nil {
+		return
+	}
+	repo = parseGithubRepo(info.Repository)
+	if repo == "" {
+		return "", "", fmt.Errorf("github repository of package '%s' not found", name)
+	}
+	return
+}
+
+// parseGithubRepo parses the GitHub repository from the `repository` field of a package.json,
+// e.g. "git+https://github.com/owner/repo.git" -> "owner/repo"
+func parseGithubRepo(repository string) string {
+	var path string
+	if after, ok := strings.CutPrefix(repository, "github:"); ok {
+		path = after
+	} else if i := strings.Index(repository, "github.com"); i >= 0 {
+		path = repository[i+len("github.com"):]
+		if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, ":") {
+			return ""
+		}
+		path = path[1:]
+	} else if !strings.Contains(repository, ":") && strings.Count(repository, "/") == 1 {
+		// shortcut syntax, e.g. "owner/repo"
+		path = repository
+	}
+	owner, rest := utils.SplitByFirstByte(path, '/')
+	repo, _ := utils.SplitByFirstByte(rest, '/')
+	repo, _ = utils.SplitByFirstByte(repo, '#')
+	repo = strings.TrimSuffix(repo, ".git")
+	if owner == "" || repo == "" || !npm.Naming.Match(owner) || !npm.Naming.Match(repo) {
+		return ""
+	}
+	return owner + "/" + repo
+}
+
+// listPrPreviews lists the preview builds of the open pull requests of a package that are published to pkg.pr.new.
+func listPrPreviews(npmrc *NpmRC, pkgName string, origin string) (list *PrPreviewList, err error) {
+	repo, _, err := getPrPackageRepo(npmrc, pkgName)
+	if err != nil {
+		return
+	}
+	pulls, err := listGithubPulls(repo)
+	if err != nil {
+		return
+	}
+	list = &PrPreviewList{Name: pkgName, Repo: repo, Previews: []PrPreview{}}
+	previews := make([]*PrPreview, len(pulls))
+	var wg sync.WaitGroup
+	queue := make(chan struct{}, 8)
+	for i, pull := range pulls {
+		wg.Add(1)
+		queue <- struct{}{}
+		go func(i int, pull githubPull) {
+			defer func() {
+				<-queue
+				wg.Done()
+			}()
+			commit, err := resolvePrPackageVersion(EsmPath{PkgName: pkgName, PkgVersion: strconv.Itoa(pull.Number), PrPrefix: true})
+			if err != nil || !isCommitish(commit) {
+				return
+			}
+			previews[i] = &PrPreview{
+				Number:    pull.Number,
+				Title:     pull.Title,
+				Url:       pull.HtmlUrl,
+				Branch:    pull.Head.Ref,
+				Commit:    commit,
+				UpdatedAt: pull.UpdatedAt,
+				Module:    fmt.Sprintf("%s/pr/%s@%s", origin, pkgName, commit),
+			}
+		}(i, pull)
+	}
+	wg.Wait()
+	for _, preview := range previews {
+		if preview != nil {
+			list.Previews = append(list.Previews, *preview)
+		}
+	}
+	return
+}
+
+type githubPull struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	HtmlUrl   string `json:"html_url"`
+	UpdatedAt string `json:"updated_at"`
+	Head      struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// listGithubPulls lists the recently updated open pull requests of a GitHub repository,
+// the configured token of the repository owner is used if any.
+func listGithubPulls(repo string) (pulls []githubPull, err error) {
+	return withCache("github pulls "+repo, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() (pulls []githubPull, aliasKey string, err error) {
+		u, err := url.Parse(fmt.Sprintf("%s/repos/%s/pulls?state=open&sort=updated&direction=desc&per_page=%d", githubApiOrigin, repo, maxPrPreviews))
+		if err != nil {
+			return
+		}
+		header := http.Header{"Accept": []string{"application/vnd.github+json"}}
+		if authorization := githubHost.authorization(repo); authorization != "" {
+			header.Set("Authorization", authorization)
+		}
+		client := fetch.NewClient("esmd/"+VERSION, 30, false)
+		res, err := client.Fetch(u, header)
+		if err != nil {
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode == 404 {
+			err = fmt.Errorf("repository '%s' not found", repo)
+			return
+		}
+		if res.StatusCode != 200 {
+			err = fmt.Errorf("failed to list pull requests of %s: %s", repo, res.Status)
+			return
+		}
+		err = json.NewDecoder(res.Body).Decode(&pulls)
+		return
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPrNumber(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"123":     true,
+		"1":       true,
+		"0123":    false,
+		"a832a55": false,
+		"1234567": false,
+		"main":    false,
+		"":        false,
+	} {
+		if isPrNumber(version) != expected {
+			t.Fatalf("isPrNumber(%q): expected %v", version, expected)
+		}
+	}
+}
+
+func TestCutPrPackageName(t *testing.T) {
+	for pathname, expected := range map[string]string{
+		"/pr/tinybench":                    "tinybench",
+		"/pkg.pr.new/@scope/pkg/":          "@scope/pkg",
+		"/pr/tinylibs/tinybench/tinybench": "tinylibs/tinybench/tinybench",
+		"/pr/tinybench@a832a55":            "",
+		"/pr/@scope/pkg@123":               "",
+		"/pr/":                             "",
+		"/tinybench":                       "",
+	} {
+		pkgName, ok := cutPrPackageName(pathname)
+		if pkgName != expected || ok != (expected != "") {
+			t.Fatalf("cutPrPackageName(%q): expected %q, got %q", pathname, expected, pkgName)
+		}
+	}
+}
+
+func TestParseGithubRepo(t *testing.T) {
+	for repository, expected := range map[string]string{
+		"git+https://github.com/tinylibs/tinybench.git": "tinylibs/tinybench",
+		"https://github.com/vuejs/core/tree/main":       "vuejs/core",
+		"git@github.com:owner/repo.git":                 "owner/repo",
+		"github:owner/repo#main":                        "owner/repo",
+		"owner/repo":                                    "owner/repo",
+		"https://gitlab.com/owner/repo.git":             "",
+		"https://github.company.com/owner/repo":         "",
+		"":                                              "",
+	} {
+		if repo := parseGithubRepo(repository); repo != expected {
+			t.Fatalf("parseGithubRepo(%q): expected %q, got %q", repository, expected, repo)
+		}
+	}
+}
+
+func TestPrPreviews(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/tinylibs/tinybench/pulls":
+			w.Write([]byte(`[
+				{"number":12,"title":"feat: add bench","html_url":"https://github.com/tinylibs/tinybench/pull/12","updated_at":"2026-10-01T00:00:00Z","head":{"ref":"feat-bench"}},
+				{"number":13,"title":"docs: typo","html_url":"https://github.com/tinylibs/tinybench/pull/13","updated_at":"2026-09-01T00:00:00Z","head":{"ref":"docs"}}
+			]`))
+		case "/repos/acme/private/pulls":
+			if r.Header.Get("Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("x-access-token:ghp_secret")) {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`[]`))
+		case "/tinylibs/tinybench/tinybench@12":
+			http.Redirect(w, r, "/tinylibs/tinybench/tinybench@a832a55", http.StatusFound)
+		case "/tinylibs/tinybench/tinybench@a832a55":
+			w.Header().Set("x-commit-key", "tinylibs:tinybench:a832a55")
+			w.Write([]byte("tarball"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	origin, apiOrigin := prOrigin, githubApiOrigin
+	prOrigin, githubApiOrigin = server.URL, server.URL
+	defer func() { prOrigin, githubApiOrigin = origin, apiOrigin }()
+
+	npmrc := DefaultNpmRC()
+	esm, _, exactVersion, _, _, err := parseEsmPath(npmrc, "/pr/tinylibs/tinybench/tinybench@12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if esm.PkgVersion != "a832a55" || exactVersion {
+		t.Fatalf("unexpected version %q (exact: %v)", esm.PkgVersion, exactVersion)
+	}
+	_, _, _, _, _, err = parseEsmPath(npmrc, "/pr/tinylibs/tinybench/tinybench@13")
+	if err == nil || err.Error() != "pkg.pr.new: preview of pull request #13 not found" {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	list, err := listPrPreviews(npmrc, "tinylibs/tinybench/tinybench", "https://esm.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Repo != "tinylibs/tinybench" || len(list.Previews) != 1 {
+		t.Fatalf("unexpected previews: %+v", list)
+	}
+	preview := list.Previews[0]
+	if preview.Number != 12 || preview.Commit != "a832a55" || preview.Branch != "feat-bench" || preview.Module != "https://esm.sh/pr/tinylibs/tinybench/tinybench@a832a55" {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+
+	_, err = listPrPreviews(npmrc, "acme/missing/pkg", "https://esm.sh")
+	if err == nil || !strings.HasSuffix(err.Error(), " not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	// the pull requests of a private repository are listed with the configured token
+	githubTokens := config.GithubTokens
+	config.GithubTokens = map[string]GithubTokenConfig{"acme": {Token: "ghp_secret"}}
+	defer func() { config.GithubTokens = githubTokens }()
+	list, err = listPrPreviews(npmrc, "acme/private/pkg", "https://esm.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Repo != "acme/private" || len(list.Previews) != 0 {
+		t.Fatalf("unexpected previews: %+v", list)
+	}
+}
@@ -19,8 +19,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/esm-dev/esm.sh/importmap"
 	"github.com/esm-dev/esm.sh/internal/fetch"
-	"github.com/esm-dev/esm.sh/internal/importmap"
 	"github.com/esm-dev/esm.sh/internal/mime"
 	"github.com/esm-dev/esm.sh/internal/storage"
 	esbuild "github.com/ije/esbuild-internal/api"
@@ -326,12 +326,24 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 					query.Get("name"),
 					query.Get("importer"),
 				))
+			case "unsupported-tarball-dependency":
+				return errorJS(ctx, fmt.Sprintf(
+					`Unsupported tarball dependency "%s" (Imported by "%s")`,
+					query.Get("name"),
+					query.Get("importer"),
+				))
 			case "unsupported-git-dependency":
 				return errorJS(ctx, fmt.Sprintf(
 					`Unsupported git dependency "%s" (Imported by "%s")`,
 					query.Get("name"),
 					query.Get("importer"),
 				))
+			case "private-repository-dependency":
+				return errorJS(ctx, fmt.Sprintf(
+					`Private repository "%s" can't be a dependency (Imported by "%s")`,
+					query.Get("name"),
+					query.Get("importer"),
+				))
 			case "invalid-jsr-dependency":
 				return errorJS(ctx, fmt.Sprintf(
 					`Invalid jsr dependency "%s" (Imported by "%s")`,
@@ -438,13 +450,10 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				return rex.Status(404, "Not Found")
 			}
 			name := pathname[6:]
-			js, ok := getNodeRuntimeJS(name)
+			js, ok := getNodeRuntimeModule(name)
 			if !ok {
-				if !nodeBuiltinModules[name] {
-					ctx.SetHeader("Cache-Control", ccImmutable)
-					return rex.Status(404, "Not Found")
-				}
-				js = []byte("export default {}")
+				ctx.SetHeader("Cache-Control", ccImmutable)
+				return rex.Status(404, "Not Found")
 			}
 			if strings.HasPrefix(name, "chunk-") {
 				ctx.SetHeader("Cache-Control", ccImmutable)
@@ -484,17 +493,54 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			return data
 		}
 
+		// check `/PKG@VERSION?types-index` pattern for the types index
+		typesIndex := ctx.R.URL.Query().Has("types-index")
+
+		// list the preview builds of a pkg.pr.new package, e.g. `/pr/tinybench`
+		if pkgName, ok := cutPrPackageName(pathname); ok && !typesIndex {
+			if !config.AllowList.IsEmpty() && !config.AllowList.IsPackageAllowed("pr/"+pkgName) {
+				ctx.SetHeader("Cache-Control", "public, max-age=3600")
+				return rex.Status(403, "forbidden")
+			}
+			if !config.BanList.IsEmpty() && config.BanList.IsPackageBanned("pr/"+pkgName) {
+				ctx.SetHeader("Cache-Control", "public, max-age=3600")
+				return rex.Status(403, "forbidden")
+			}
+			list, err := listPrPreviews(npmrc, pkgName, getOrigin(ctx))
+			if err != nil {
+				message := err.Error()
+				if strings.HasPrefix(message, "invalid") {
+					return rex.Status(400, message)
+				}
+				if strings.HasSuffix(message, " not found") {
+					return rex.Status(404, message)
+				}
+				return rex.Status(500, message)
+			}
+			ctx.SetHeader("Content-Type", ctJSON)
+			if _, ok := getGithubToken(list.Repo); ok {
+				// the pull requests of a private repository are listed with the configured token
+				if !isAuthorizedGhClient(list.Repo, ctx.R.Header.Get("Authorization")) {
+					ctx.SetHeader("Cache-Control", "private, no-store")
+					ctx.SetHeader("WWW-Authenticate", `Bearer realm="esm.sh"`)
+					return rex.Status(401, "Unauthorized")
+				}
+				appendVaryHeader(ctx.W.Header(), "Authorization")
+				ctx.SetHeader("Cache-Control", fmt.Sprintf("private, max-age=%d", config.NpmQueryCacheTTL))
+				return list
+			}
+			ctx.SetHeader("Cache-Control", fmt.Sprintf("public, max-age=%d", config.NpmQueryCacheTTL))
+			return list
+		}
+
 		// check `/*pathname` pattern
 		asteriskPrefix := false
 		if strings.HasPrefix(pathname, "/*") {
 			asteriskPrefix = true
 			pathname = "/" + pathname[2:]
-		} else if strings.HasPrefix(pathname, "/gh/*") {
-			asteriskPrefix = true
-			pathname = "/gh/" + pathname[5:]
-		} else if strings.HasPrefix(pathname, "/github.com/*") {
+		} else if prefix, rest, ok := cutGitHostPrefix(pathname); ok && strings.HasPrefix(rest, "/*") {
 			asteriskPrefix = true
-			pathname = "/gh/" + pathname[13:]
+			pathname = "/" + prefix + "/" + rest[2:]
 		} else if strings.HasPrefix(pathname, "/pr/*") {
 			asteriskPrefix = true
 			pathname = "/pr/" + pathname[5:]
@@ -529,11 +575,31 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 
 		origin := getOrigin(ctx)
 
+		// list the types of every export of the package
+		if typesIndex {
+			if esmPath.SubPath != "" {
+				ctx.SetHeader("Cache-Control", ccImmutable)
+				return rex.Status(404, "Not Found")
+			}
+			index, err := getTypesIndex(npmrc, logger, esmPath, origin)
+			if err != nil {
+				if strings.HasSuffix(err.Error(), " not found") {
+					return rex.Status(404, err.Error())
+				}
+				return rex.Status(500, err.Error())
+			}
+			ctx.SetHeader("Content-Type", ctJSON)
+			if isExactVersion {
+				ctx.SetHeader("Cache-Control", ccImmutable)
+			} else {
+				ctx.SetHeader("Cache-Control", fmt.Sprintf("public, max-age=%d", config.NpmQueryCacheTTL))
+			}
+			return index
+		}
+
 		registryPrefix := ""
-		if esmPath.GhPrefix {
-			registryPrefix = "/gh"
-		} else if esmPath.PrPrefix {
-			registryPrefix = "/pr"
+		if prefix := esmPath.RegistryPrefix(); prefix != "" {
+			registryPrefix = "/" + prefix
 		}
 
 		// redirect `/@types/PKG` to it's main dts file
@@ -643,6 +709,11 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			}
 		}
 
+		// build the package css file when `?module` or `?target` query is present
+		if pathKind == RawFile && !rawFlag && strings.HasSuffix(esmPath.SubPath, ".css") && (query.Has("module") || query.Has("target")) {
+			pathKind = EsmBuild
+		}
+
 		if pathKind == RawFile && !rawFlag && esmPath.SubPath != "" && strings.HasSuffix(esmPath.SubPath, ".map") {
 			pkgJson, err := npmrc.installPackage(esmPath.Package())
 			if err != nil {
@@ -672,8 +743,8 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				subPath := ""
 				query := ""
 				if asteriskPrefix {
-					if esmPath.GhPrefix || esmPath.PrPrefix {
-						pkgName = pkgName[0:3] + "*" + pkgName[3:]
+					if prefix := esmPath.RegistryPrefix(); prefix != "" {
+						pkgName = prefix + "/*" + strings.TrimPrefix(pkgName, prefix+"/")
 					} else {
 						pkgName = "*" + pkgName
 					}
@@ -699,11 +770,7 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 					pkgName = "jsr/@" + strings.ReplaceAll(pkgName[5:], "__", "/")
 				}
 				if asteriskPrefix {
-					if esmPath.GhPrefix || esmPath.PrPrefix {
-						pkgName = pkgName[0:3] + "*" + pkgName[3:]
-					} else {
-						pkgName = "*" + pkgName
-					}
+					pkgName = "*" + pkgName
 				}
 				if esmPath.SubPath != "" {
 					subPath = "/" + esmPath.SubPath
@@ -715,6 +782,9 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				if extraQuery != "" {
 					pkgVersion += "&" + extraQuery
 				}
+				if esmPath.Workspace != "" {
+					subPath = "/" + esmPath.Workspace + subPath
+				}
 				if rawQuery != "" {
 					query = "?" + rawQuery
 				}
@@ -723,6 +793,25 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			}
 		}
 
+		// serve the assets emitted by the build, e.g. `.wasm` files
+		if hasTargetSegment && isExactVersion && pathKind == RawFile && !rawFlag {
+			savePath := normalizeSavePath(path.Join("modules", pathname))
+			f, stat, err := esmStorage.Get(savePath)
+			if err == nil {
+				if contentType := mime.GetContentType(savePath); contentType != "" {
+					ctx.SetHeader("Content-Type", contentType)
+				}
+				ctx.SetHeader("Content-Length", fmt.Sprintf("%d", stat.Size()))
+				ctx.SetHeader("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+				ctx.SetHeader("Cache-Control", ccImmutable)
+				return f // auto closed
+			}
+			if err != storage.ErrNotFound {
+				logger.Errorf("storage.get(%s): %v", savePath, err)
+				return rex.Status(500, "Storage error, please try again")
+			}
+		}
+
 		// fix url that is related to `import.meta.url`
 		if hasTargetSegment && isExactVersion && pathKind == RawFile && !rawFlag {
 			extname := path.Ext(esmPath.SubPath)
@@ -763,7 +852,7 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				ctx.SetHeader("Cache-Control", ccImmutable)
 				return rex.Status(404, "File not found")
 			}
-			url := fmt.Sprintf("%s%s/%s@%s/%s", origin, registryPrefix, esmPath.PkgName, esmPath.PkgVersion, file)
+			url := fmt.Sprintf("%s/%s/%s", origin, esmPath.PackageId(), file)
 			return redirect(ctx, url, true)
 		}
 
@@ -783,29 +872,6 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				return buf
 			}
 
-			// return css file as a `CSSStyleSheet` object when `?module` query is present
-			if pathKind == RawFile && strings.HasSuffix(esmPath.SubPath, ".css") && query.Has("module") {
-				filename := path.Join(npmrc.StoreDir(), esmPath.PackageId(), "node_modules", esmPath.PkgName, esmPath.SubPath)
-				css, err := os.ReadFile(filename)
-				if err != nil {
-					return rex.Status(500, err.Error())
-				}
-				css, err = minify(string(css), esbuild.LoaderCSS, esbuild.ES2022)
-				if err != nil {
-					return rex.Status(500, err.Error())
-				}
-				buf := bytes.NewBufferString("/* esm.sh - css module */\n")
-				buf.WriteString("const stylesheet = new CSSStyleSheet();\n")
-				buf.WriteString("stylesheet.replaceSync(")
-				buf.WriteString(strings.TrimSuffix(string(utils.MustEncodeJSON(strings.TrimSuffix(string(css), "\n"))), "\n"))
-				buf.WriteString(");\n")
-				buf.WriteString("export default stylesheet;\n")
-				ctx.SetHeader("Content-Type", ctJavaScript)
-				ctx.SetHeader("Content-Length", fmt.Sprintf("%d", buf.Len()))
-				ctx.SetHeader("Cache-Control", ccImmutable)
-				return buf
-			}
-
 			// serve package raw files
 			if pathKind == RawFile {
 				if esmPath.SubPath == "" {
@@ -920,6 +986,10 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 					savePath = path.Join("types", pathname)
 				} else {
 					savePath = path.Join("modules", pathname)
+					// the css module script of the css build
+					if strings.HasSuffix(pathname, ".css") && query.Has("module") {
+						savePath += ".mjs"
+					}
 				}
 				savePath = normalizeSavePath(savePath)
 				f, stat, err := esmStorage.Get(savePath)
@@ -939,7 +1009,7 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 						ctx.SetHeader("Content-Type", ctTypeScript)
 					} else if pathKind == EsmSourceMap {
 						ctx.SetHeader("Content-Type", ctJSON)
-					} else if strings.HasSuffix(pathname, ".css") {
+					} else if strings.HasSuffix(savePath, ".css") {
 						ctx.SetHeader("Content-Type", ctCSS)
 					} else {
 						ctx.SetHeader("Content-Type", ctJavaScript)
@@ -971,6 +1041,7 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 							defer f.Close()
 							xxh := xxhash.New()
 							xxh.Write([]byte(strings.Join(exports, ",")))
+							buildSavePath := savePath
 							savePath = strings.TrimSuffix(savePath, ".mjs") + "_" + base64.RawURLEncoding.EncodeToString(xxh.Sum(nil)) + ".mjs"
 							f2, stat, err := esmStorage.Get(savePath)
 							if err == nil {
@@ -993,13 +1064,16 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 									break
 								}
 							}
-							ret, err := treeShake(npmrc, esmPath.Package(), code, exports, target)
+							sourceMap, err := readBuildSourceMap(esmStorage, buildSavePath, code)
+							if err != nil {
+								logger.Errorf("storage.get(%s.map): %v", buildSavePath, err)
+								return rex.Status(500, "Storage error, please try again")
+							}
+							ret, retSourceMap, err := treeShake(npmrc, esmPath.Package(), code, sourceMap, exports, target)
 							if err != nil {
 								return rex.Status(500, err.Error())
 							}
-							// note: the source map is dropped
-							go esmStorage.Put(savePath, bytes.NewReader(ret))
-							return ret
+							return saveTreeShakenModule(esmStorage, savePath, ret, retSourceMap)
 						}
 					}
 					if pathKind == EsmDts {
@@ -1036,11 +1110,7 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				pkgName = "jsr/@" + strings.ReplaceAll(pkgName[5:], "__", "/")
 			}
 			if asteriskPrefix {
-				if esmPath.GhPrefix || esmPath.PrPrefix {
-					pkgName = pkgName[0:3] + "*" + pkgName[3:]
-				} else {
-					pkgName = "*" + pkgName
-				}
+				pkgName = "*" + pkgName
 			}
 			if esmPath.SubPath != "" {
 				subPath = "/" + esmPath.SubPath
@@ -1052,6 +1122,9 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			if extraQuery != "" {
 				pkgVersion += "&" + extraQuery
 			}
+			if esmPath.Workspace != "" {
+				subPath = "/" + esmPath.Workspace + subPath
+			}
 			if rawQuery != "" {
 				qs = "?" + rawQuery
 			}
@@ -1140,6 +1213,9 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 
 		// build and return the types(.d.ts) file
 		if pathKind == EsmDts {
+			if xArgs == nil && query.Has("dts-bundle") {
+				buildArgs.DtsBundle = true
+			}
 			readDts := func() (content io.ReadCloser, stat storage.Stat, err error) {
 				args := ""
 				if a := encodeBuildArgs(buildArgs, true); a != "" {
@@ -1218,6 +1294,22 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			buildArgs.ExternalRequire = externalRequire
 			buildArgs.KeepNames = query.Has("keep-names")
 			buildArgs.IgnoreAnnotations = query.Has("ignore-annotations")
+			buildArgs.InlineAssets = query.Has("inline-assets")
+			// check `?sourcemap` query, the default mode is not encoded into the build path
+			if query.Has("sourcemap") {
+				mode, ok := normalizeSourceMapMode(query.Get("sourcemap"))
+				if !ok {
+					ctx.SetHeader("Cache-Control", ccImmutable)
+					return rex.Status(400, "Invalid sourcemap query, available values are \"inline\", \"external\" and \"none\"")
+				}
+				defaultMode := "none"
+				if config.SourceMap {
+					defaultMode = "external"
+				}
+				if mode != defaultMode {
+					buildArgs.SourceMap = mode
+				}
+			}
 		}
 
 		bundleMode := BundleDefault
@@ -1246,7 +1338,7 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				esmPath.SubPath = before
 				dev = true
 			}
-			basename := strings.TrimSuffix(path.Base(esmPath.PkgName), ".js")
+			basename := esmPath.moduleName()
 			switch esmPath.SubPath {
 			case basename:
 				esmPath.SubPath = ""
@@ -1293,12 +1385,18 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 
 		if buildMeta.CSSEntry != "" {
 			url := getCSSEntryRedirectURL(origin, esmPath, buildMeta.CSSEntry)
+			if query.Has("module") || query.Has("target") {
+				url += "?" + rawQuery
+			}
 			return redirect(ctx, url, isExactVersion)
 		}
 
 		// redirect to `*.d.ts` file
 		if buildMeta.TypesOnly {
 			dtsUrl := origin + buildMeta.Dts
+			if query.Has("dts-bundle") {
+				dtsUrl = origin + getDtsBundlePath(buildMeta.Dts)
+			}
 			ctx.SetHeader("X-TypeScript-Types", dtsUrl)
 			ctx.SetHeader("Content-Type", ctJavaScript)
 			ctx.SetHeader("Cache-Control", ccImmutable)
@@ -1330,6 +1428,9 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			}
 			if esmPath.GhPrefix {
 				metaJson["gh"] = true
+				if esmPath.GitHost != "" {
+					metaJson["gitHost"] = esmPath.GitHost
+				}
 			}
 			if esmPath.PrPrefix {
 				metaJson["pr"] = true
@@ -1346,9 +1447,15 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 					}
 				}
 				metaJson["exports"] = exports
+				if packageJson.Deprecated != "" {
+					metaJson["deprecated"] = packageJson.Deprecated
+				}
 			}
 			if buildMeta.Dts != "" {
 				metaJson["dts"] = buildMeta.Dts
+				if buildMeta.DtsReason != "" {
+					metaJson["dtsReason"] = buildMeta.DtsReason
+				}
 			}
 			if buildMeta.Imports != nil {
 				packageJson, err := npmrc.getPackageInfo(esmPath.PkgName, esmPath.PkgVersion)
@@ -1401,8 +1508,18 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				}
 			}
 			metaJson["integrity"] = integrity
+			graphComplete := true
+			if query.Has("graph") {
+				// the integrity of the modules in the static import graph, e.g. chunks and node runtime modules
+				var graph map[string]string
+				graph, graphComplete = getModuleGraphIntegrity(metaDB, buildMeta.Imports)
+				metaJson["graph"] = graph
+			}
 			ctx.SetHeader("Content-Type", ctJSON)
-			if isExactVersion {
+			if !graphComplete {
+				// some modules of the graph are not built yet
+				ctx.SetHeader("Cache-Control", ccMustRevalidate)
+			} else if isExactVersion {
 				ctx.SetHeader("Cache-Control", ccImmutable)
 			} else {
 				ctx.SetHeader("Cache-Control", fmt.Sprintf("public, max-age=%d", config.NpmQueryCacheTTL))
@@ -1437,7 +1554,12 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 				return buf.Bytes()
 			}
 			savePath := build.getSavePath()
-			if strings.HasSuffix(esmPath.SubPath, ".css") && buildMeta.CSSInJS {
+			if build.isCSSBuild() {
+				// the css module script of the css build
+				if query.Has("module") || strings.HasSuffix(pathname, ".mjs") {
+					savePath += ".mjs"
+				}
+			} else if strings.HasSuffix(esmPath.SubPath, ".css") && buildMeta.CSSInJS {
 				path, _ := utils.SplitByLastByte(savePath, '.')
 				savePath = path + ".css"
 			}
@@ -1457,6 +1579,9 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			}
 			ctx.SetHeader("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
 			ctx.SetHeader("Cache-Control", ccImmutable)
+			if targetFromUA {
+				appendVaryHeader(ctx.W.Header(), "User-Agent")
+			}
 			if strings.HasSuffix(savePath, ".css") {
 				ctx.SetHeader("Content-Type", ctCSS)
 			} else if endsWith(savePath, ".map") {
@@ -1476,7 +1601,11 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 					)
 				}
 				if noDts := query.Has("no-dts") || query.Has("no-check"); !noDts && buildMeta.Dts != "" {
-					ctx.SetHeader("X-TypeScript-Types", origin+buildMeta.Dts)
+					dtsUrl := origin + buildMeta.Dts
+					if query.Has("dts-bundle") {
+						dtsUrl = origin + getDtsBundlePath(buildMeta.Dts)
+					}
+					ctx.SetHeader("X-TypeScript-Types", dtsUrl)
 					ctx.SetHeader("Access-Control-Expose-Headers", "X-TypeScript-Types")
 				}
 				if !buildMeta.CJS && len(exports) > 0 {
@@ -1497,13 +1626,16 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 					if err != nil {
 						return rex.Status(500, err.Error())
 					}
-					ret, err := treeShake(npmrc, esmPath.Package(), code, exports, targets[target])
+					sourceMap, err := readBuildSourceMap(esmStorage, build.getSavePath(), code)
+					if err != nil {
+						logger.Errorf("storage.get(%s.map): %v", build.getSavePath(), err)
+						return rex.Status(500, "Storage error, please try again")
+					}
+					ret, retSourceMap, err := treeShake(npmrc, esmPath.Package(), code, sourceMap, exports, targets[target])
 					if err != nil {
 						return rex.Status(500, err.Error())
 					}
-					go esmStorage.Put(savePath, bytes.NewReader(ret))
-					// note: the source map is dropped
-					return ret
+					return saveTreeShakenModule(esmStorage, savePath, ret, retSourceMap)
 				}
 			}
 			ctx.SetHeader("Content-Length", fmt.Sprintf("%d", fi.Size()))
@@ -1543,7 +1675,11 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 			}
 			ctx.SetHeader("X-ESM-Path", esmPath)
 			if noDts := query.Has("no-dts") || query.Has("no-check"); !noDts && buildMeta.Dts != "" {
-				ctx.SetHeader("X-TypeScript-Types", origin+buildMeta.Dts)
+				dtsUrl := origin + buildMeta.Dts
+				if query.Has("dts-bundle") {
+					dtsUrl = origin + getDtsBundlePath(buildMeta.Dts)
+				}
+				ctx.SetHeader("X-TypeScript-Types", dtsUrl)
 				ctx.SetHeader("Access-Control-Expose-Headers", "X-ESM-Path, X-TypeScript-Types")
 			} else {
 				ctx.SetHeader("Access-Control-Expose-Headers", "X-ESM-Path")
@@ -1566,6 +1702,30 @@ func esmRouter(esmStorage storage.Storage, logger *log.Logger) rex.Handle {
 	}
 }
 
+// withPrivateGhRepos serves the modules of private GitHub repositories only to the authorized clients,
+// and marks the responses as private to prevent them from being stored by shared caches(CDN).
+func withPrivateGhRepos(handle rex.Handle) rex.Handle {
+	return func(ctx *rex.Context) any {
+		repo, ok := getPrivateGhRepo(ctx.R.URL.Path)
+		if !ok {
+			return handle(ctx)
+		}
+		if !isAuthorizedGhClient(repo, ctx.R.Header.Get("Authorization")) {
+			ctx.SetHeader("Cache-Control", "private, no-store")
+			ctx.SetHeader("WWW-Authenticate", `Bearer realm="esm.sh"`)
+			return rex.Status(401, "Unauthorized")
+		}
+		res := handle(ctx)
+		appendVaryHeader(ctx.W.Header(), "Authorization")
+		if cc := ctx.W.Header().Get("Cache-Control"); strings.HasPrefix(cc, "public") {
+			ctx.SetHeader("Cache-Control", "private"+cc[6:])
+		} else if cc == "" {
+			ctx.SetHeader("Cache-Control", "private, no-cache")
+		}
+		return res
+	}
+}
+
 func getOrigin(ctx *rex.Context) string {
 	origin := ctx.R.Header.Get("X-Real-Origin")
 	if origin != "" {
@@ -1606,6 +1766,19 @@ func errorJS(ctx *rex.Context, message string) any {
 	return buf.Bytes()
 }
 
+// saveTreeShakenModule saves the tree-shaken module and its source map to the storage in background,
+// and returns the module code linked to the source map.
+func saveTreeShakenModule(esmStorage storage.Storage, savePath string, code []byte, sourceMap []byte) []byte {
+	if len(sourceMap) > 0 {
+		buf := bytes.NewBuffer(stripSourceMappingURL(code))
+		writeSourceMappingURL(buf, sourceMap, path.Base(savePath), false, false)
+		code = buf.Bytes()
+		go esmStorage.Put(savePath+".map", bytes.NewReader(sourceMap))
+	}
+	go esmStorage.Put(savePath, bytes.NewReader(code))
+	return code
+}
+
 func getCSSEntryRedirectURL(origin string, esmPath EsmPath, cssEntry string) string {
 	return origin + "/" + esmPath.PackageId() + utils.NormalizePathname(cssEntry)
 }
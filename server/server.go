@@ -80,7 +80,7 @@ func Start() {
 		rex.Optional(rex.Compress(), config.Compress),
 		rex.Optional(customLandingPage(&config.CustomLandingPage), config.CustomLandingPage.Origin != ""),
 		esmLegacyRouter(esmStorage),
-		esmRouter(esmStorage, logger),
+		withPrivateGhRepos(esmRouter(esmStorage, logger)),
 	)
 
 	// start server
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/internal/fetch"
+	"github.com/esm-dev/esm.sh/internal/npm"
+)
+
+// isTrustedTarballHost checks if the host of the tarball url is in the `tarballHosts` list of the config,
+// wildcard subdomains like "*.example.com" are supported.
+func isTrustedTarballHost(u *url.URL) bool {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for _, trusted := range config.TarballHosts {
+		if trusted == host || trusted == hostname {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(trusted, "*"); ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(hostname, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTarballDependency checks if the dependency is installed from a tarball.
+func isTarballDependency(pkgJson *npm.PackageJSON, pkgName string) bool {
+	v, ok := pkgJson.Dependencies[pkgName]
+	if !ok {
+		return false
+	}
+	p, err := npm.ResolveDependencyVersion(v)
+	return err == nil && p.Tarball != ""
+}
+
+// getTarballDependencies returns the dependencies that are installed from tarballs.
+func getTarballDependencies(pkgJson *npm.PackageJSON) map[string]string {
+	deps := map[string]string{}
+	for name := range pkgJson.Dependencies {
+		if isTarballDependency(pkgJson, name) {
+			deps[name] = pkgJson.Dependencies[name]
+		}
+	}
+	return deps
+}
+
+// resolveTarballPackage resolves the version of a tarball package that is used as the key of the npm store.
+// The `file:` tarball is resolved relative to the dependent package directory and must not be outside of it,
+// its version is the hash of the tarball content. The version of a remote tarball is the hash of the url,
+// remote tarballs are expected to be immutable, and the `http:` tarballs must have an integrity.
+func resolveTarballPackage(pkg *npm.Package, pkgDir string) error {
+	if filename, ok := strings.CutPrefix(pkg.Tarball, "file:"); ok {
+		if pkgDir == "" || filepath.IsAbs(filename) {
+			return fmt.Errorf("unsupported file dependency '%s'", pkg.Tarball)
+		}
+		root, err := filepath.EvalSymlinks(pkgDir)
+		if err != nil {
+			return err
+		}
+		filename, err = filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(filename)))
+		if err != nil {
+			return fmt.Errorf("tarball '%s' not found", pkg.Tarball)
+		}
+		if !strings.HasPrefix(filename, root+string(filepath.Separator)) {
+			return fmt.Errorf("tarball '%s' is outside of the package", pkg.Tarball)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		_, err = io.Copy(h, io.LimitReader(f, maxPackageTarballSize))
+		if err != nil {
+			return err
+		}
+		pkg.Tarball = "file:" + filename
+		pkg.Version = hex.EncodeToString(h.Sum(nil))[:16]
+		return nil
+	}
+	u, err := url.Parse(pkg.Tarball)
+	if err != nil {
+		return err
+	}
+	if !isTrustedTarballHost(u) {
+		return fmt.Errorf("tarball host '%s' is not allowed", u.Host)
+	}
+	// the tarball over plain http may be tampered with, it's verified with the required integrity
+	if u.Scheme == "http" && pkg.Integrity == "" {
+		return fmt.Errorf("http tarball '%s' requires an integrity", pkg.Tarball)
+	}
+	sum := sha256.Sum256([]byte(pkg.Tarball + "#" + pkg.Integrity))
+	pkg.Version = hex.EncodeToString(sum[:])[:16]
+	return nil
+}
+
+// installTarballPackageContext installs a package from a tarball url or a local tarball file,
+// the tarball is verified with the integrity of the package if it's provided.
+func installTarballPackageContext(ctx context.Context, installDir string, pkg npm.Package) (err error) {
+	var data []byte
+	if filename, ok := strings.CutPrefix(pkg.Tarball, "file:"); ok {
+		if !filepath.IsAbs(filename) {
+			return fmt.Errorf("unresolved file dependency '%s'", pkg.Tarball)
+		}
+		var f *os.File
+		f, err = os.Open(filename)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		data, err = io.ReadAll(io.LimitReader(f, maxPackageTarballSize))
+		if err != nil {
+			return
+		}
+	} else {
+		data, err = fetchTarballContext(ctx, pkg.Tarball)
+		if err != nil {
+			return
+		}
+	}
+
+	if pkg.Integrity != "" {
+		err = verifyIntegrity(data, pkg.Integrity)
+		if err != nil {
+			return fmt.Errorf("failed to install %s: %v", pkg.Tarball, err)
+		}
+	}
+
+	err = extractPackageTarballContext(ctx, installDir, pkg.Name, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("failed to extract tarball '%s': %v", pkg.Tarball, err)
+		// clear installDir if failed to extract tarball
+		os.RemoveAll(installDir)
+	}
+	return
+}
+
+// fetchTarballContext downloads a tarball from a trusted host, redirects to untrusted hosts are not allowed.
+func fetchTarballContext(ctx context.Context, tarballUrl string) ([]byte, error) {
+	u, err := url.Parse(tarballUrl)
+	if err != nil {
+		return nil, err
+	}
+	if !isTrustedTarballHost(u) {
+		return nil, fmt.Errorf("tarball host '%s' is not allowed", u.Host)
+	}
+	fetchClient := fetch.NewClient("esmd/"+VERSION, 60, false)
+	checkRedirect := fetchClient.CheckRedirect
+	fetchClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !isTrustedTarballHost(req.URL) {
+			return fmt.Errorf("tarball host '%s' is not allowed", req.URL.Host)
+		}
+		return checkRedirect(req, via)
+	}
+	res, err := fetchClient.FetchWithContext(ctx, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download tarball '%s': %v", tarballUrl, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 || res.StatusCode == 401 {
+		return nil, fmt.Errorf("tarball '%s' not found", tarballUrl)
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("could not download tarball '%s': %s", tarballUrl, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxPackageTarballSize))
+}
+
+// verifyIntegrity verifies the data with the subresource integrity,
+// see https://w3c.github.io/webappsec-subresource-integrity/#integrity-metadata-description
+func verifyIntegrity(data []byte, integrity string) error {
+	supported := false
+	for item := range strings.FieldsSeq(integrity) {
+		algorithm, digest, ok := strings.Cut(item, "-")
+		if !ok {
+			continue
+		}
+		// ignore the options, e.g. "sha512-...?foo"
+		digest, _, _ = strings.Cut(digest, "?")
+		var h hash.Hash
+		switch algorithm {
+		case "sha1":
+			h = sha1.New()
+		case "sha256":
+			h = sha256.New()
+		case "sha384":
+			h = sha512.New384()
+		case "sha512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		supported = true
+		h.Write(data)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) == digest {
+			return nil
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported integrity '%s'", integrity)
+	}
+	return errors.New("integrity mismatch")
+}
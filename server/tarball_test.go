@@ -0,0 +1,159 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+)
+
+func createTestTarball(t *testing.T, files map[string]string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: "package/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestIsTrustedTarballHost(t *testing.T) {
+	tarballHosts := config.TarballHosts
+	config.TarballHosts = []string{"example.com", "*.cdn.example.com", "localhost:8080"}
+	defer func() { config.TarballHosts = tarballHosts }()
+
+	for rawUrl, expected := range map[string]bool{
+		"https://example.com/lib.tgz":          true,
+		"https://EXAMPLE.com:8443/lib.tgz":     true,
+		"https://a.cdn.example.com/lib.tgz":    true,
+		"https://cdn.example.com/lib.tgz":      false,
+		"https://evil.com/example.com/lib.tgz": false,
+		"http://localhost:8080/lib.tgz":        true,
+		"http://localhost:3000/lib.tgz":        false,
+		"ftp://example.com/lib.tgz":            false,
+	} {
+		u, _ := url.Parse(rawUrl)
+		if isTrustedTarballHost(u) != expected {
+			t.Fatalf("isTrustedTarballHost(%q): expected %v", rawUrl, expected)
+		}
+	}
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	data := []byte("hello")
+	sum := sha512.Sum512(data)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	if err := verifyIntegrity(data, integrity); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyIntegrity(data, "sha256-invalid "+integrity); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyIntegrity([]byte("world"), integrity); err == nil || err.Error() != "integrity mismatch" {
+		t.Fatalf("expected integrity mismatch error, got %v", err)
+	}
+	if err := verifyIntegrity(data, "md5-xxx"); err == nil || !strings.HasPrefix(err.Error(), "unsupported integrity") {
+		t.Fatalf("expected unsupported integrity error, got %v", err)
+	}
+}
+
+func TestInstallTarballDependencies(t *testing.T) {
+	workDir := config.WorkDir
+	tarballHosts := config.TarballHosts
+	config.WorkDir = t.TempDir()
+	defer func() {
+		config.WorkDir = workDir
+		config.TarballHosts = tarballHosts
+	}()
+
+	remoteTarball := createTestTarball(t, map[string]string{
+		"package.json": `{"name":"remote","version":"1.0.0"}`,
+		"index.js":     `export default "remote";`,
+	})
+	sum := sha512.Sum512(remoteTarball)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/remote-1.0.0.tgz":
+			w.Write(remoteTarball)
+		case "/redirect.tgz":
+			http.Redirect(w, r, "http://localhost:1/remote-1.0.0.tgz", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	config.TarballHosts = []string{serverUrl.Host}
+
+	npmrc := DefaultNpmRC()
+	wd := filepath.Join(npmrc.StoreDir(), "gh/acme/app@1a2b3c4d")
+	pkgDir := filepath.Join(wd, "node_modules", "acme/app")
+	os.MkdirAll(filepath.Join(pkgDir, "vendor"), 0755)
+	os.WriteFile(filepath.Join(pkgDir, "vendor", "local.tgz"), createTestTarball(t, map[string]string{
+		"package.json": `{"name":"local","version":"0.1.0"}`,
+		"index.js":     `export default "local";`,
+	}), 0644)
+	os.WriteFile(filepath.Join(wd, "secret.tgz"), remoteTarball, 0644)
+
+	install := func(deps map[string]string) error {
+		return npmrc.installDependencies(wd, &npm.PackageJSON{Name: "acme/app", Dependencies: deps}, false, nil)
+	}
+
+	err := install(map[string]string{
+		"remote": server.URL + "/remote-1.0.0.tgz#" + integrity,
+		"local":  "file:./vendor/local.tgz",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"remote": `export default "remote";`, "local": `export default "local";`} {
+		data, err := os.ReadFile(filepath.Join(wd, "node_modules", name, "index.js"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("unexpected content of %s/index.js: %q", name, data)
+		}
+	}
+
+	for deps, expected := range map[string]string{
+		server.URL + "/remote-1.0.0.tgz#sha512-invalid": "integrity mismatch",
+		server.URL + "/redirect.tgz#" + integrity:       "is not allowed",
+		server.URL + "/remote-1.0.0.tgz":                "requires an integrity",
+		"https://example.com/remote-1.0.0.tgz":          "tarball host 'example.com' is not allowed",
+		"file:../../../secret.tgz":                      "is outside of the package",
+		"file:./vendor/missing.tgz":                     "not found",
+		"file:./vendor":                                 "unsupported file dependency",
+	} {
+		err := install(map[string]string{"dep": deps})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("install %q: expected error containing %q, got %v", deps, expected, err)
+		}
+	}
+
+	if !isTarballDependency(&npm.PackageJSON{Dependencies: map[string]string{"local": "file:./vendor/local.tgz"}}, "local") {
+		t.Fatal("local should be a tarball dependency")
+	}
+	err = installTarballPackageContext(context.Background(), t.TempDir(), npm.Package{Name: "x", Tarball: "file:vendor/local.tgz"})
+	if err == nil {
+		t.Fatal("unresolved file dependency should not be installed")
+	}
+}
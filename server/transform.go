@@ -1,12 +1,13 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 
-	"github.com/esm-dev/esm.sh/internal/importmap"
+	"github.com/esm-dev/esm.sh/importmap"
 	"github.com/esm-dev/esm.sh/internal/npm"
 	esbuild "github.com/ije/esbuild-internal/api"
 	"github.com/ije/gox/utils"
@@ -161,7 +162,22 @@ func transform(options *ResolvedTransformOptions) (out *TransformOutput, err err
 }
 
 // treeShake tree-shakes the given javascript code with the given exports.
-func treeShake(npmrc *NpmRC, pkg npm.Package, code []byte, exports []string, target esbuild.Target) ([]byte, error) {
+// If the source map of the code is provided, a remapped source map is returned as well.
+func treeShake(npmrc *NpmRC, pkg npm.Package, code []byte, sourceMap []byte, exports []string, target esbuild.Target) (out []byte, outSourceMap []byte, err error) {
+	sourceMapMode := esbuild.SourceMapNone
+	inlineSourceMap := false
+	if len(sourceMap) > 0 {
+		// chain the source map by embedding it into the input code
+		buf := bytes.NewBuffer(stripSourceMappingURL(code))
+		buf.WriteByte('\n')
+		writeSourceMappingURL(buf, sourceMap, "", true, false)
+		code = buf.Bytes()
+		sourceMapMode = esbuild.SourceMapExternal
+	} else if bytes.Contains(code, []byte("//# sourceMappingURL=data:")) {
+		// the source map is fixed and re-inlined after the build
+		sourceMapMode = esbuild.SourceMapExternal
+		inlineSourceMap = true
+	}
 	input := &esbuild.StdinOptions{
 		Contents: fmt.Sprintf(`export { %s } from '.';`, strings.Join(exports, ", ")),
 		Loader:   esbuild.LoaderJS,
@@ -202,14 +218,31 @@ func treeShake(npmrc *NpmRC, pkg npm.Package, code []byte, exports []string, tar
 		MinifyWhitespace:  config.Minify,
 		MinifyIdentifiers: config.Minify,
 		MinifySyntax:      config.Minify,
+		Sourcemap:         sourceMapMode,
 		Outdir:            "/esbuild",
 		Write:             false,
 		Plugins:           plugins,
 	})
 	if len(ret.Errors) > 0 {
-		return nil, errors.New(ret.Errors[0].Text)
+		return nil, nil, errors.New(ret.Errors[0].Text)
 	}
-	return ret.OutputFiles[0].Contents, nil
+	for _, file := range ret.OutputFiles {
+		if strings.HasSuffix(file.Path, ".map") {
+			outSourceMap, err = fixSourceMap(file.Contents, 0)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			out = file.Contents
+		}
+	}
+	if inlineSourceMap && len(outSourceMap) > 0 {
+		buf := bytes.NewBuffer(stripSourceMappingURL(out))
+		writeSourceMappingURL(buf, outSourceMap, "", true, false)
+		out = buf.Bytes()
+		outSourceMap = nil
+	}
+	return
 }
 
 // minify minifies the given javascript code.
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"path"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+	"github.com/ije/gox/log"
+	"github.com/ije/gox/utils"
+)
+
+// TypesIndex lists the types(dts) of every export of a package, served by the `/PKG@VERSION?types-index` endpoint
+type TypesIndex struct {
+	Name    string            `json:"name"`
+	Version string            `json:"version"`
+	Exports []TypesIndexEntry `json:"exports"`
+}
+
+// TypesIndexEntry describes the types of an export of a package
+type TypesIndexEntry struct {
+	// the export path, e.g. ".", "./jsx-runtime"
+	Path string `json:"path"`
+	// the URL of the types
+	Types string `json:"types,omitempty"`
+	// the `@types` package that provides the types, e.g. "@types/react@~19.0.0"
+	TypesPackage string `json:"typesPackage,omitempty"`
+	// "bundled" for the types shipped with the package, "generated" for the types generated from the
+	// TypeScript sources (JSR packages), "@types" for the DefinitelyTyped types, or "none"
+	Source string `json:"source"`
+	// the reason why the types are chosen
+	Reason string `json:"reason,omitempty"`
+}
+
+// getTypesIndex resolves the types of every export of the package without building the JS modules.
+func getTypesIndex(npmrc *NpmRC, logger *log.Logger, esm EsmPath, origin string) (index *TypesIndex, err error) {
+	ctx := &BuildContext{
+		npmrc:   npmrc,
+		logger:  logger,
+		esmPath: esm,
+		target:  "types",
+	}
+	err = ctx.install()
+	if err != nil {
+		return
+	}
+
+	index = &TypesIndex{
+		Name:    esm.PkgName,
+		Version: esm.PkgVersion,
+		Exports: []TypesIndexEntry{},
+	}
+	for _, exportPath := range getTypesIndexExportPaths(ctx.pkgJson) {
+		b := &BuildContext{
+			npmrc:   npmrc,
+			logger:  logger,
+			esmPath: esm,
+			target:  "types",
+			wd:      ctx.wd,
+			pkgJson: ctx.pkgJson,
+		}
+		b.esmPath.SubPath = strings.TrimPrefix(strings.TrimPrefix(exportPath, "."), "/")
+		dts, reason, err := b.resolveDTS(b.resolveEntry(b.esmPath))
+		if err != nil {
+			return nil, err
+		}
+		entry := TypesIndexEntry{
+			Path:   exportPath,
+			Source: "none",
+			Reason: reason,
+		}
+		if dts != "" {
+			entry.Types = origin + dts
+			if strings.HasPrefix(dts, "/@types/") {
+				entry.Source = "@types"
+				typesPkgName := toPackageName(dts[1:])
+				version, _ := utils.SplitByFirstByte(strings.TrimPrefix(dts, "/"+typesPkgName+"@"), '/')
+				entry.TypesPackage = typesPkgName + "@" + version
+			} else if strings.HasPrefix(esm.PkgName, "@jsr/") {
+				entry.Source = "generated"
+			} else {
+				entry.Source = "bundled"
+			}
+		}
+		index.Exports = append(index.Exports, entry)
+	}
+	return
+}
+
+// getTypesIndexExportPaths returns the export paths of the package, the pattern exports (e.g. "./*") and the
+// non-module exports (e.g. "./package.json", "./style.css") are ignored.
+func getTypesIndexExportPaths(pkgJson *npm.PackageJSON) []string {
+	var exportPaths []string
+	for _, key := range pkgJson.Exports.Keys() {
+		if key != "." && (!strings.HasPrefix(key, "./") || strings.ContainsRune(key, '*') || strings.HasSuffix(key, "/")) {
+			continue
+		}
+		if ext := path.Ext(key); key != "." && ext != "" && (ext == ".css" || assetExts[ext[1:]]) {
+			continue
+		}
+		exportPaths = append(exportPaths, key)
+	}
+	if len(exportPaths) == 0 {
+		// the `exports` field is not defined or only has the conditions of the main export
+		exportPaths = []string{"."}
+	}
+	return exportPaths
+}
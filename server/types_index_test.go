@@ -0,0 +1,32 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/internal/npm"
+)
+
+func TestGetTypesIndexExportPaths(t *testing.T) {
+	for _, c := range []struct {
+		exports  string
+		expected []string
+	}{
+		{`{}`, []string{"."}},
+		{`{"types": "./index.d.ts", "default": "./index.js"}`, []string{"."}},
+		{
+			`{".": "./index.js", "./jsx-runtime": "./jsx-runtime.js", "./package.json": "./package.json", "./style.css": "./style.css", "./*": "./*.js", "./lib/": "./lib/"}`,
+			[]string{".", "./jsx-runtime"},
+		},
+		{`{"./client": "./client.js", "./server": {"types": "./server.d.ts"}}`, []string{"./client", "./server"}},
+	} {
+		var exports npm.JSONObject
+		if err := exports.UnmarshalJSON([]byte(c.exports)); err != nil {
+			t.Fatal(err)
+		}
+		paths := getTypesIndexExportPaths(&npm.PackageJSON{Exports: exports})
+		if !reflect.DeepEqual(paths, c.expected) {
+			t.Fatalf("getTypesIndexExportPaths(%s): expected %v, got %v", c.exports, c.expected, paths)
+		}
+	}
+}
@@ -35,6 +35,19 @@ func getNodeRuntimeJS(name string) (js []byte, ok bool) {
 	return
 }
 
+// getNodeRuntimeModule returns the js of the node runtime module by the given name, e.g. "process.mjs".
+// A node builtin module without runtime is an empty module.
+func getNodeRuntimeModule(name string) (js []byte, ok bool) {
+	js, ok = getNodeRuntimeJS(name)
+	if !ok {
+		if !nodeBuiltinModules[name] {
+			return nil, false
+		}
+		js = []byte("export default {}")
+	}
+	return js, true
+}
+
 // loadNodeRuntime loads the unenv node runtime from the embed filesystem.
 func loadNodeRuntime() (err error) {
 	data, err := embedFS.ReadFile("embed/node-runtime.tgz")
@@ -44,4 +44,35 @@ Deno.test("?meta query", async () => {
     assertEquals(meta.peerImports?.length, 1);
     assert(meta.peerImports?.[0].startsWith("/react@19.2."));
   }
+  {
+    const res = await fetch("http://localhost:8080/request@2.88.2?meta", { headers: { "User-Agent": "i'm a browser" } });
+    assertEquals(res.status, 200);
+    const meta = await res.json();
+    assertEquals(meta.name, "request");
+    assertEquals(meta.version, "2.88.2");
+    assert(meta.deprecated.startsWith("request has been deprecated"));
+  }
+  {
+    const res = await fetch("http://localhost:8080/react@19.2.3?meta", { headers: { "User-Agent": "i'm a browser" } });
+    assertEquals(res.status, 200);
+    const meta = await res.json();
+    assert(!meta.deprecated);
+  }
+  {
+    const res = await fetch("http://localhost:8080/react-dom@19.2.3/es2022/client.mjs?meta&graph", { headers: { "User-Agent": "i'm a browser" } });
+    assertEquals(res.status, 200);
+    const meta = await res.json();
+    assert(meta.integrity.startsWith("sha384-"));
+    assert(typeof meta.graph === "object");
+    for (const [pathname, integrity] of Object.entries(meta.graph)) {
+      assert(pathname.startsWith("/") && !pathname.includes("?"));
+      assert(integrity === "" || (integrity as string).startsWith("sha384-"));
+    }
+  }
+  {
+    const res = await fetch("http://localhost:8080/react-dom@19.2.3/es2022/client.mjs?meta", { headers: { "User-Agent": "i'm a browser" } });
+    assertEquals(res.status, 200);
+    const meta = await res.json();
+    assert(!meta.graph);
+  }
 });
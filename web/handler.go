@@ -16,7 +16,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/esm-dev/esm.sh/internal/importmap"
+	"github.com/esm-dev/esm.sh/importmap"
 	"github.com/esm-dev/esm.sh/internal/mime"
 	"github.com/gorilla/websocket"
 	esbuild "github.com/ije/esbuild-internal/api"
@@ -603,7 +603,14 @@ func (s *Handler) ServeFrameworkCSS(w http.ResponseWriter, r *http.Request, quer
 					tokenizer.Next()
 					innerText := bytes.TrimSpace(tokenizer.Text())
 					if len(innerText) > 0 {
-						importMap, _ = importmap.Parse(nil, innerText)
+						if im, err := importmap.Parse(nil, innerText); err == nil {
+							if importMap == nil {
+								importMap = im
+							} else {
+								// multiple import maps are merged, the existing rules win
+								importMap.Merge(im)
+							}
+						}
 					}
 				} else if srcAttr == "" {
 					// inline script content